@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config holds every setting for a stashr process. Settings come from
+// built-in defaults, then an optional JSON config file, then flags given on
+// the command line, each overriding the last.
+type Config struct {
+	HTTPPort    int
+	GRPCPort    int
+	RESPPort    int
+	HTTPUnix    string
+	GRPCUnix    string
+	UnixMode    string
+	DisableHTTP bool
+	DisableGRPC bool
+
+	ShutdownTimeout time.Duration
+	LogLevel        string
+	LogFormat       string
+	AccessLog       bool
+	TrustProxy      bool
+	OTLPEndpoint    string
+	OTLPRecordKeys  bool
+	Pprof           string
+
+	AuthToken          string
+	AuthTokenFile      string
+	AuthSkipReflection bool
+	AuthPublicProbes   bool
+	AdminToken         string
+
+	MaxKeyBytes   int
+	MaxValueBytes int
+	MaxBodyBytes  int64
+	GzipMinBytes  int
+	GzipBinary    bool
+	RateLimit     float64
+	RateBurst     int
+	RateLimitBy   string
+	CORSOrigins   string
+	MaxKeys       int
+	MaxBytes      int64
+	EvictRandom   bool
+	EvictTTL      bool
+	ExpiryJitter  time.Duration
+	TTLJitter     float64
+	DefaultTTL    time.Duration
+	MaxTTL        time.Duration
+	History       int
+	ReadOnly      bool
+	ReplicaOf     string
+
+	GCInterval    time.Duration
+	GCMinInterval time.Duration
+	GCMaxInterval time.Duration
+
+	SnapshotFile       string
+	LoadSnapshot       string
+	SaveSnapshotOnExit string
+	SnapshotInterval   time.Duration
+	WAL                string
+	WALFsync           string
+
+	TLSCert     string
+	TLSKey      string
+	TLSClientCA string
+
+	HTTPTLSCert     string
+	HTTPTLSKey      string
+	HTTPTLSClientCA string
+}
+
+// configKeys maps config file keys to the flags they set.
+var configKeys = map[string]string{
+	"http_port":             "hport",
+	"grpc_port":             "gport",
+	"resp_port":             "respport",
+	"http_unix":             "httpunix",
+	"grpc_unix":             "grpcunix",
+	"unix_mode":             "unixmode",
+	"disable_http":          "disableHTTP",
+	"disable_grpc":          "disableGRPC",
+	"shutdown_timeout":      "shutdowntimeout",
+	"log_level":             "loglevel",
+	"log_format":            "logformat",
+	"access_log":            "accesslog",
+	"otlp_endpoint":         "otlpendpoint",
+	"otlp_record_keys":      "otlp-record-keys",
+	"pprof":                 "pprof",
+	"trust_proxy":           "trustproxy",
+	"auth_token":            "authtoken",
+	"auth_token_file":       "authtoken-file",
+	"auth_skip_reflection":  "authskipreflection",
+	"auth_public_probes":    "authpublicprobes",
+	"admin_token":           "admintoken",
+	"max_key_bytes":         "maxkeybytes",
+	"max_value_bytes":       "maxvaluebytes",
+	"max_body_bytes":        "maxbodybytes",
+	"gzip_min_bytes":        "gzip-min-bytes",
+	"gzip_binary":           "gzip-binary",
+	"rate_limit":            "ratelimit",
+	"rate_burst":            "rateburst",
+	"rate_limit_by":         "ratelimit-by",
+	"cors_origins":          "corsorigins",
+	"max_keys":              "max-keys",
+	"max_entries":           "max-keys", // as -maxentries
+	"max_bytes":             "max-bytes",
+	"evict_random":          "evict-random",
+	"evict_ttl":             "evict-ttl",
+	"expiry_jitter":         "expiry-jitter",
+	"ttl_jitter":            "ttl-jitter",
+	"default_ttl":           "default-ttl",
+	"max_ttl":               "max-ttl",
+	"history":               "history",
+	"read_only":             "read-only",
+	"replica_of":            "replicaof",
+	"gc_interval":           "gc-interval",
+	"gc_min_interval":       "gc-min-interval",
+	"gc_max_interval":       "gc-max-interval",
+	"snapshot_file":         "snapshot-file",
+	"load_snapshot":         "load-snapshot",
+	"save_snapshot_on_exit": "save-snapshot-on-exit",
+	"snapshot_interval":     "snapshot-interval",
+	"wal":                   "wal",
+	"aof_fsync":             "aof-fsync",
+	"tls_cert":              "tlscert",
+	"tls_key":               "tlskey",
+	"tls_client_ca":         "tlsclientca",
+	"http_tls_cert":         "http-tls-cert",
+	"http_tls_key":          "http-tls-key",
+	"http_tls_client_ca":    "http-tls-client-ca",
+}
+
+// flagAliases maps alternative flag names to the flag they stand for.
+var flagAliases = map[string]string{
+	"maxentries": "max-keys",
+	"aof":        "wal",
+}
+
+// registerFlags binds cfg's fields to flags on fs, with the built-in defaults.
+func (cfg *Config) registerFlags(fs *flag.FlagSet) {
+	// By default, this application will start an HTTP server on port 8080 and a gRPC server on port 9090.
+	// However, with the appropriate flags, you can disable the HTTP server, gRPC server, or change the
+	// port to an arbitrary number.
+	fs.IntVar(&cfg.HTTPPort, "hport", 8080, "HTTP Port to listen on.")
+	fs.IntVar(&cfg.GRPCPort, "gport", 9090, "gRPC Port to listen on.")
+	fs.IntVar(&cfg.RESPPort, "respport", 0, "Port for a Redis-compatible (RESP) listener serving simple commands such as GET and SET (0 to disable).")
+	fs.StringVar(&cfg.HTTPUnix, "httpunix", "", "Path of a Unix domain socket to also serve HTTP on. With -hport 0, HTTP is served only on the socket.")
+	fs.StringVar(&cfg.GRPCUnix, "grpcunix", "", "Path of a Unix domain socket to also serve gRPC on. With -gport 0, gRPC is served only on the socket.")
+	fs.StringVar(&cfg.UnixMode, "unixmode", "0600", "Octal permissions for the -httpunix and -grpcunix sockets. The default lets only the user stashr runs as connect.")
+	fs.BoolVar(&cfg.DisableHTTP, "disableHTTP", false, "Disable HTTP Service")
+	fs.BoolVar(&cfg.DisableGRPC, "disableGRPC", false, "Disable gRPC Service")
+	fs.StringVar(&cfg.LogLevel, "loglevel", "info", "Minimum level to log: debug, info, warn or error. debug also logs every request.")
+	fs.StringVar(&cfg.LogFormat, "logformat", "text", "Log output format: text or json.")
+	fs.BoolVar(&cfg.AccessLog, "accesslog", false, "Log every HTTP request with its client IP, status, size and duration at info level.")
+	fs.BoolVar(&cfg.TrustProxy, "trustproxy", false, "Take the access log's client IP from X-Forwarded-For. Only set this behind a proxy that sets the header.")
+	fs.StringVar(&cfg.OTLPEndpoint, "otlpendpoint", "", "OpenTelemetry collector to send a trace span for every request to, over OTLP/HTTP, e.g. http://localhost:4318. Tracing is off when empty.")
+	fs.BoolVar(&cfg.OTLPRecordKeys, "otlp-record-keys", true, "Record the key each request names on its trace span. Turn off if keys hold personal data.")
+	fs.StringVar(&cfg.Pprof, "pprof", "", "Address such as localhost:6060 to serve runtime profiles on under /debug/pprof/, without auth or TLS. Only expose it on trusted networks. Disabled when empty.")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdowntimeout", 10*time.Second, "How long to wait for in-flight requests on shutdown before closing connections forcibly.")
+	fs.StringVar(&cfg.AuthToken, "authtoken", os.Getenv("STASHR_AUTH_TOKEN"), "Bearer token required on all non-admin HTTP endpoints and gRPC calls. Defaults to $STASHR_AUTH_TOKEN; auth is disabled when empty.")
+	fs.StringVar(&cfg.AuthTokenFile, "authtoken-file", "", "File to read the -authtoken from, keeping the token off the command line. Overrides -authtoken and $STASHR_AUTH_TOKEN.")
+	fs.BoolVar(&cfg.AuthSkipReflection, "authskipreflection", false, "Leave the gRPC reflection service open when -authtoken is set.")
+	fs.BoolVar(&cfg.AuthPublicProbes, "authpublicprobes", true, "Leave /healthz, /readyz and /metrics open when -authtoken is set.")
+	fs.StringVar(&cfg.AdminToken, "admintoken", "", "Bearer token required for /admin endpoints. Admin endpoints are disabled when empty.")
+	fs.IntVar(&cfg.MaxKeyBytes, "maxkeybytes", 1<<10, "Maximum size in bytes of a key (0 for unlimited).")
+	fs.IntVar(&cfg.MaxValueBytes, "maxvaluebytes", 1<<20, "Maximum size in bytes of a value, including via append (0 for unlimited).")
+	fs.Int64Var(&cfg.MaxBodyBytes, "maxbodybytes", 8<<20, "Maximum size in bytes of an HTTP request body (0 for unlimited). Leave room above -maxvaluebytes for JSON escaping.")
+	fs.IntVar(&cfg.GzipMinBytes, "gzip-min-bytes", 0, "Gzip HTTP responses of at least this many bytes for clients that accept it (0 disables compression).")
+	fs.BoolVar(&cfg.GzipBinary, "gzip-binary", false, "Also gzip raw application/octet-stream values, which are often compressed already.")
+	fs.Float64Var(&cfg.RateLimit, "ratelimit", 0, "Requests per second allowed per client across HTTP and gRPC (0 disables rate limiting).")
+	fs.IntVar(&cfg.RateBurst, "rateburst", 0, "Requests a client may burst above -ratelimit (0 means one second's worth).")
+	fs.StringVar(&cfg.RateLimitBy, "ratelimit-by", "ip", `What identifies a client for -ratelimit: "ip" or "token" (the -authtoken or -admintoken a request carries, falling back to the IP).`)
+	fs.StringVar(&cfg.CORSOrigins, "corsorigins", "", `Comma-separated origins allowed to call the HTTP API from a browser, or "*" for any (empty disables CORS).`)
+	fs.IntVar(&cfg.MaxKeys, "max-keys", 0, "Maximum number of keys to hold, evicting the least recently used beyond it (0 for unlimited).")
+	fs.IntVar(&cfg.MaxKeys, "maxentries", 0, "Deprecated alias for -max-keys.")
+	fs.Int64Var(&cfg.MaxBytes, "max-bytes", 0, "Approximate memory budget in bytes for keys and values, evicting beyond it (0 for unlimited).")
+	fs.BoolVar(&cfg.EvictRandom, "evict-random", false, "Evict arbitrary keys instead of the least recently used when over -max-keys or -max-bytes.")
+	fs.BoolVar(&cfg.EvictTTL, "evict-ttl", false, "Evict the keys closest to expiring first when over -max-keys or -max-bytes.")
+	fs.Float64Var(&cfg.TTLJitter, "ttl-jitter", 0, "Randomize every TTL by up to this fraction of itself either way, e.g. 0.1 for ±10%, so keys set together do not all expire at once (0 disables).")
+	fs.DurationVar(&cfg.ExpiryJitter, "expiry-jitter", 0, "Lengthen every TTL by a random amount up to this duration, so keys set together do not all expire at once (0 disables).")
+	fs.DurationVar(&cfg.DefaultTTL, "default-ttl", 0, "TTL for writes that do not set one (0 means no expiry).")
+	fs.DurationVar(&cfg.MaxTTL, "max-ttl", 0, "Cap every TTL at this duration, including writes without one (0 means no cap).")
+	fs.BoolVar(&cfg.ReadOnly, "read-only", false, "Start with the store read-only, rejecting writes until switched off with POST /admin/readonly. Snapshots and the WAL still load.")
+	fs.StringVar(&cfg.ReplicaOf, "replicaof", "", "host:port of a leader's gRPC server to follow. The store becomes a read-only copy of the leader, rejecting writes with the leader's address, and resynchronizes whenever the connection is lost.")
+	fs.IntVar(&cfg.History, "history", 0, "Keep the last N mutations in memory for the key history endpoints (0 disables).")
+	fs.DurationVar(&cfg.GCInterval, "gc-interval", time.Second, "How often to sweep expired keys from memory; 0 disables the sweep. With -gc-min-interval and -gc-max-interval, the starting interval.")
+	fs.DurationVar(&cfg.GCMinInterval, "gc-min-interval", 0, "Lower bound for an adaptive sweep interval that speeds up when many keys expire. Requires -gc-max-interval.")
+	fs.DurationVar(&cfg.GCMaxInterval, "gc-max-interval", 0, "Upper bound for an adaptive sweep interval that backs off when few keys expire. Requires -gc-min-interval.")
+	fs.StringVar(&cfg.SnapshotFile, "snapshot-file", "", "Path to a snapshot loaded on startup and written on shutdown. Shorthand for setting -load-snapshot and -save-snapshot-on-exit to the same path.")
+	fs.StringVar(&cfg.LoadSnapshot, "load-snapshot", "", "Path to a snapshot to restore before serving. A missing file is skipped with a warning.")
+	fs.DurationVar(&cfg.SnapshotInterval, "snapshot-interval", 0, "Also write the -snapshot-file/-save-snapshot-on-exit snapshot at this interval when there are changes (0 disables).")
+	fs.StringVar(&cfg.SaveSnapshotOnExit, "save-snapshot-on-exit", "", "Path to write a snapshot to after the servers have stopped.")
+	fs.StringVar(&cfg.WAL, "wal", "", "Path to a write-ahead log. When set, writes are logged and replayed on startup.")
+	fs.StringVar(&cfg.WAL, "aof", "", "Alias for -wal.")
+	fs.StringVar(&cfg.WALFsync, "aof-fsync", "never", `When to fsync the write-ahead log: "always", "never", or an interval such as "100ms".`)
+	fs.StringVar(&cfg.TLSCert, "tlscert", "", "TLS certificate file. Enables TLS on both servers together with -tlskey.")
+	fs.StringVar(&cfg.TLSKey, "tlskey", "", "TLS private key file.")
+	fs.StringVar(&cfg.TLSClientCA, "tlsclientca", "", "CA bundle for verifying client certificates. When set, clients must present a valid certificate (mutual TLS).")
+	fs.StringVar(&cfg.HTTPTLSCert, "http-tls-cert", "", "TLS certificate file for the HTTP server only, in place of -tlscert. Requires -http-tls-key.")
+	fs.StringVar(&cfg.HTTPTLSKey, "http-tls-key", "", "TLS private key file for the HTTP server only, in place of -tlskey.")
+	fs.StringVar(&cfg.HTTPTLSClientCA, "http-tls-client-ca", "", "CA bundle for verifying HTTP client certificates, in place of -tlsclientca. Requires -http-tls-cert and -http-tls-key.")
+}
+
+// parseConfig builds a Config from args, applying the file named by -config,
+// if any, underneath the flags given explicitly in args.
+func parseConfig(fs *flag.FlagSet, args []string) (Config, error) {
+	var cfg Config
+	cfg.registerFlags(fs)
+	configPath := fs.String("config", "", "Path to a JSON config file. Flags given on the command line override its values.")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if *configPath != "" {
+		if err := applyConfigFile(fs, *configPath); err != nil {
+			return Config{}, err
+		}
+	}
+	if cfg.AuthTokenFile != "" {
+		token, err := readTokenFile(cfg.AuthTokenFile)
+		if err != nil {
+			return Config{}, err
+		}
+		cfg.AuthToken = token
+	}
+	if cfg.LoadSnapshot == "" {
+		cfg.LoadSnapshot = cfg.SnapshotFile
+	}
+	if cfg.SaveSnapshotOnExit == "" {
+		cfg.SaveSnapshotOnExit = cfg.SnapshotFile
+	}
+	return cfg, nil
+}
+
+// readTokenFile reads a token from the file at path, ignoring surrounding
+// whitespace such as a trailing newline. An empty file is an error rather
+// than silently disabling auth.
+func readTokenFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("auth token: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("auth token: %s is empty", path)
+	}
+	return token, nil
+}
+
+// applyConfigFile sets the flags named by the keys in the JSON file at path,
+// skipping any that were given explicitly on the command line. Unknown keys
+// are an error.
+func applyConfigFile(fs *flag.FlagSet, path string) error {
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		return fmt.Errorf("config %s: YAML is not supported, use JSON", path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var values map[string]any
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("config %s: %w", path, err)
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		name := f.Name
+		if canonical, ok := flagAliases[name]; ok {
+			name = canonical
+		}
+		explicit[name] = true
+	})
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name, ok := configKeys[k]
+		if !ok {
+			return fmt.Errorf("config %s: unknown key %q", path, k)
+		}
+		if explicit[name] {
+			continue
+		}
+		var v string
+		switch val := values[k].(type) {
+		case string:
+			v = val
+		case json.Number:
+			v = val.String()
+		case bool:
+			v = fmt.Sprint(val)
+		default:
+			return fmt.Errorf("config %s: key %q: unsupported value %v", path, k, val)
+		}
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("config %s: key %q: %w", path, k, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTestConfig(t *testing.T, file string, args ...string) (Config, error) {
+	t.Helper()
+	if file != "" {
+		path := filepath.Join(t.TempDir(), "stashr.json")
+		if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		args = append([]string{"-config", path}, args...)
+	}
+	fs := flag.NewFlagSet("stashr", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return parseConfig(fs, args)
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg, err := parseTestConfig(t, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HTTPPort != 8080 || cfg.GRPCPort != 9090 || !cfg.AuthPublicProbes || cfg.MaxValueBytes != 1<<20 {
+		t.Fatalf("unexpected defaults %+v", cfg)
+	}
+}
+
+func TestConfigFileAndFlagPrecedence(t *testing.T) {
+	file := `{
+		"http_port": 8000,
+		"grpc_port": 9000,
+		"disable_grpc": true,
+		"max_keys": 100,
+		"snapshot_file": "/var/lib/stashr/snap",
+		"snapshot_interval": "30s",
+		"tls_cert": "cert.pem"
+	}`
+	cfg, err := parseTestConfig(t, file, "-hport", "7000", "-maxentries", "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HTTPPort != 7000 {
+		t.Errorf("expected the flag to override the file, got http port %d", cfg.HTTPPort)
+	}
+	if cfg.MaxKeys != 5 {
+		t.Errorf("expected an aliased flag to override the file, got max keys %d", cfg.MaxKeys)
+	}
+	if cfg.GRPCPort != 9000 || !cfg.DisableGRPC || cfg.TLSCert != "cert.pem" {
+		t.Errorf("expected file values to override defaults, got %+v", cfg)
+	}
+	if cfg.SnapshotInterval != 30*time.Second {
+		t.Errorf("expected snapshot interval 30s, got %v", cfg.SnapshotInterval)
+	}
+	if cfg.LoadSnapshot != "/var/lib/stashr/snap" || cfg.SaveSnapshotOnExit != "/var/lib/stashr/snap" {
+		t.Errorf("expected snapshot_file to set both snapshot paths, got %+v", cfg)
+	}
+}
+
+func TestConfigMaxEntriesKey(t *testing.T) {
+	for _, file := range []string{`{"max_entries": 100}`, `{"max_keys": 100}`} {
+		cfg, err := parseTestConfig(t, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.MaxKeys != 100 {
+			t.Errorf("%s: expected max keys 100, got %d", file, cfg.MaxKeys)
+		}
+	}
+}
+
+func TestConfigUnknownKey(t *testing.T) {
+	_, err := parseTestConfig(t, `{"http_prot": 8000}`)
+	if err == nil || !strings.Contains(err.Error(), `unknown key "http_prot"`) {
+		t.Fatalf("expected an unknown key error, got %v", err)
+	}
+}
+
+func TestConfigBadValue(t *testing.T) {
+	if _, err := parseTestConfig(t, `{"http_port": "eighty"}`); err == nil {
+		t.Fatal("expected an error for a non-numeric port")
+	}
+}
+
+func TestConfigAuthTokenFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "token")
+	if err := os.WriteFile(path, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseTestConfig(t, "", "-authtoken", "other", "-authtoken-file", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AuthToken != "s3cret" {
+		t.Fatalf("expected the token from the file, got %q", cfg.AuthToken)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if err := os.WriteFile(empty, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseTestConfig(t, "", "-authtoken-file", empty); err == nil {
+		t.Fatal("expected an empty token file to be an error")
+	}
+	if _, err := parseTestConfig(t, "", "-authtoken-file", filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected a missing token file to be an error")
+	}
+}
@@ -2,16 +2,27 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
+	"go.opentelemetry.io/otel"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 
 	"stashr/pb"
@@ -20,70 +31,479 @@ import (
 )
 
 func main() {
-	s := store.New()
+	cfg, err := parseConfig(flag.CommandLine, os.Args[1:])
+	if err != nil {
+		fatal("invalid configuration", err)
+	}
+	logger, err := newLogger(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		fatal("invalid configuration", err)
+	}
+	slog.SetDefault(logger)
+	run(cfg, logger)
+}
+
+// fatal logs msg and err at error level and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
+}
+
+// newLogger builds the process logger from the -loglevel and -logformat flags.
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("-loglevel: %w", err)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf(`-logformat: want "text" or "json", got %q`, format)
+}
+
+// run starts the servers described by cfg and blocks until SIGINT or SIGTERM,
+// then shuts them down. Requests are logged to logger at debug level.
+func run(cfg Config, logger *slog.Logger) {
+	tlsCfg, err := tlsConfig(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA)
+	if err != nil {
+		fatal("invalid TLS configuration", err)
+	}
+	httpTLS, err := httpTLSConfig(cfg, tlsCfg)
+	if err != nil {
+		fatal("invalid HTTP TLS configuration", err)
+	}
+
+	opts := []store.Option{
+		store.WithMaxKeyBytes(cfg.MaxKeyBytes),
+		store.WithMaxValueBytes(cfg.MaxValueBytes),
+		store.WithMaxEntries(cfg.MaxKeys),
+		store.WithMaxBytes(cfg.MaxBytes),
+		store.WithExpiryJitter(cfg.ExpiryJitter),
+		store.WithTTLJitterFraction(cfg.TTLJitter),
+		store.WithDefaultTTL(cfg.DefaultTTL),
+		store.WithMaxTTL(cfg.MaxTTL),
+		store.WithHistory(cfg.History),
+		store.WithGCInterval(cfg.GCInterval),
+		store.WithAdaptiveGC(cfg.GCMinInterval, cfg.GCMaxInterval),
+	}
+	if !(cfg.TTLJitter >= 0 && cfg.TTLJitter <= 1) {
+		fatal("invalid -ttl-jitter", fmt.Errorf("%v is not a fraction between 0 and 1", cfg.TTLJitter))
+	}
+	switch {
+	case cfg.EvictRandom && cfg.EvictTTL:
+		fatal("invalid eviction policy", errors.New("-evict-random and -evict-ttl are mutually exclusive"))
+	case cfg.EvictRandom:
+		opts = append(opts, store.WithEviction(store.EvictRandom))
+	case cfg.EvictTTL:
+		opts = append(opts, store.WithEviction(store.EvictSoonestExpiry))
+	}
+	if cfg.WAL != "" {
+		policy, interval, err := parseFsync(cfg.WALFsync)
+		if err != nil {
+			fatal("invalid -aof-fsync", err)
+		}
+		opts = append(opts, store.WithWAL(cfg.WAL), store.WithWALFsync(policy, interval))
+	}
+	s, err := store.Open(opts...)
+	if err != nil {
+		fatal("failed to open store", err)
+	}
 	defer s.Stop()
 
-	// By default, this application will start an HTTP server on port 8080 and a gRPC server on port 9090.
-	// However, with the appropriate flags, you can disable the HTTP server, gRPC server, or change the
-	// port to an arbitrary number.
-	httpPort := flag.Int("hport", 8080, "HTTP Port to listen on.")
-	grpcPort := flag.Int("gport", 9090, "gRPC Port to listen on.")
-	disableHttp := flag.Bool("disableHTTP", false, "Disable HTTP Service")
-	disablegRPC := flag.Bool("disableGRPC", false, "Disable gRPC Service")
+	if cfg.LoadSnapshot != "" {
+		if err := loadSnapshot(s, cfg.LoadSnapshot); err != nil {
+			fatal("failed to load snapshot", err)
+		}
+	}
+	// Only after loading, which is itself a write.
+	s.SetReadOnly(cfg.ReadOnly)
+
+	stopFollowing := func() {}
+	if cfg.ReplicaOf != "" {
+		stopFollowing = follow(s, cfg, tlsCfg, logger)
+	}
+
+	var limiter *server.RateLimiter
+	if cfg.RateLimit > 0 {
+		key, err := server.ParseRateLimitKey(cfg.RateLimitBy)
+		if err != nil {
+			fatal("invalid -ratelimit-by", err)
+		}
+		burst := cfg.RateBurst
+		if burst <= 0 {
+			burst = int(math.Ceil(cfg.RateLimit))
+		}
+		limiter = server.NewRateLimiter(cfg.RateLimit, burst, key)
+		limiter.SetTokens(cfg.AuthToken, cfg.AdminToken)
+	}
 
-	flag.Parse()
+	var tracer *server.Tracer
+	if cfg.OTLPEndpoint != "" {
+		otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+			logger.Warn("failed to export trace spans", "err", err)
+		}))
+		var err error
+		tracer, err = server.NewTracer(context.Background(), cfg.OTLPEndpoint, cfg.OTLPRecordKeys)
+		if err != nil {
+			fatal("invalid -otlpendpoint", err)
+		}
+		slog.Info("tracing enabled", "endpoint", cfg.OTLPEndpoint)
+	}
 
 	// HTTP server
+	httpHandler := server.NewHTTPServer(s)
+	httpHandler.SetAdminToken(cfg.AdminToken)
+	httpHandler.SetAuthToken(cfg.AuthToken, cfg.AuthPublicProbes)
+	httpHandler.SetLogger(logger)
+	httpHandler.SetAccessLog(cfg.AccessLog, cfg.TrustProxy)
+	httpHandler.SetMaxBodyBytes(cfg.MaxBodyBytes)
+	httpHandler.SetCompression(cfg.GzipMinBytes, cfg.GzipBinary)
+	httpHandler.SetRateLimiter(limiter)
+	httpHandler.SetTracer(tracer)
+	httpHandler.SetCORSOrigins(splitList(cfg.CORSOrigins))
 	httpSrv := &http.Server{
-		Addr:    fmt.Sprintf(":%d", *httpPort),
-		Handler: server.NewHTTPServer(s).Handler(),
+		Addr:      fmt.Sprintf(":%d", cfg.HTTPPort),
+		Handler:   httpHandler.Handler(),
+		TLSConfig: httpTLS,
 	}
+	httpSrv.RegisterOnShutdown(httpHandler.Close)
 
 	// gRPC server
-	grpcSrv := grpc.NewServer()
-	pb.RegisterKVStoreServer(grpcSrv, server.NewGRPCServer(s))
+	grpcOpts := []grpc.ServerOption{
+		server.TracingServerOption(tracer),
+		grpc.ChainUnaryInterceptor(
+			server.TracingUnaryInterceptor(tracer),
+			server.LoggingUnaryInterceptor(logger),
+			server.RateLimitUnaryInterceptor(limiter),
+			server.AuthUnaryInterceptor(cfg.AuthToken, cfg.AdminToken, cfg.AuthSkipReflection),
+		),
+		grpc.ChainStreamInterceptor(
+			server.LoggingStreamInterceptor(logger),
+			server.RateLimitStreamInterceptor(limiter),
+			server.AuthStreamInterceptor(cfg.AuthToken, cfg.AdminToken, cfg.AuthSkipReflection),
+		),
+	}
+	if tlsCfg != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+	grpcSrv := grpc.NewServer(grpcOpts...)
+	grpcHandler := server.NewGRPCServer(s)
+	pb.RegisterKVStoreServer(grpcSrv, grpcHandler)
 	reflection.Register(grpcSrv)
 
+	unixMode, err := parseUnixMode(cfg.UnixMode)
+	if err != nil {
+		fatal("invalid -unixmode", err)
+	}
+
 	// Start HTTP
-	if !*disableHttp {
+	if !cfg.DisableHTTP {
+		for _, lis := range listen("HTTP", cfg.HTTPPort, cfg.HTTPUnix, unixMode, httpTLS != nil) {
+			go func() {
+				var err error
+				if httpTLS != nil {
+					// The certificate is already loaded into httpSrv.TLSConfig.
+					err = httpSrv.ServeTLS(lis, "", "")
+				} else {
+					err = httpSrv.Serve(lis)
+				}
+				if err != nil && err != http.ErrServerClosed {
+					fatal("HTTP server error", err)
+				}
+			}()
+		}
+	}
+
+	// Start gRPC
+	if !cfg.DisableGRPC {
+		for _, lis := range listen("gRPC", cfg.GRPCPort, cfg.GRPCUnix, unixMode, tlsCfg != nil) {
+			go func() {
+				if err := grpcSrv.Serve(lis); err != nil {
+					fatal("gRPC server error", err)
+				}
+			}()
+		}
+	}
+
+	// RESP server
+	respSrv := server.NewRESPServer(s)
+	respSrv.SetAuthToken(cfg.AuthToken)
+	respSrv.SetMaxArgBytes(cfg.MaxBodyBytes)
+	respSrv.SetMaxCommandBytes(cfg.MaxBodyBytes)
+	respSrv.SetLogger(logger)
+	if cfg.RESPPort > 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.RESPPort))
+		if err != nil {
+			fatal(fmt.Sprintf("failed to listen on :%d", cfg.RESPPort), err)
+		}
+		if tlsCfg != nil {
+			lis = tls.NewListener(lis, tlsCfg)
+		}
 		go func() {
-			log.Printf("HTTP server listening on :%d\n", *httpPort)
-			if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-				log.Fatalf("HTTP server error: %v", err)
+			slog.Info("RESP server listening", "port", cfg.RESPPort, "tls", tlsCfg != nil)
+			if err := respSrv.Serve(lis); err != nil && err != server.ErrRESPServerClosed {
+				fatal("RESP server error", err)
 			}
 		}()
 	}
 
-	// Start gRPC
-	if !*disablegRPC {
-		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", *grpcPort))
+	// Profiling server
+	var pprofSrv *http.Server
+	if cfg.Pprof != "" {
+		lis, err := net.Listen("tcp", cfg.Pprof)
 		if err != nil {
-			log.Fatalf("failed to listen on :%d: %v", *grpcPort, err)
+			fatal("failed to listen on "+cfg.Pprof, err)
 		}
+		pprofSrv = &http.Server{Handler: pprofHandler()}
 		go func() {
-			log.Printf("gRPC server listening on :%d\n", *grpcPort)
-			if err := grpcSrv.Serve(lis); err != nil {
-				log.Fatalf("gRPC server error: %v", err)
+			slog.Info("pprof server listening", "addr", lis.Addr().String())
+			if err := pprofSrv.Serve(lis); err != nil && err != http.ErrServerClosed {
+				fatal("pprof server error", err)
 			}
 		}()
 	}
 
-	if *disableHttp && *disablegRPC {
-		log.Fatalf("All servers disabled! What should I do?")
+	if cfg.DisableHTTP && cfg.DisableGRPC && cfg.RESPPort == 0 {
+		slog.Error("All servers disabled! What should I do?")
+		os.Exit(1)
+	}
+
+	stopSnapshots := make(chan struct{})
+	snapshotsDone := make(chan struct{})
+	if cfg.SaveSnapshotOnExit != "" && cfg.SnapshotInterval > 0 {
+		go func() {
+			defer close(snapshotsDone)
+			snapshotLoop(s, cfg.SaveSnapshotOnExit, cfg.SnapshotInterval, stopSnapshots)
+		}()
+	} else {
+		close(snapshotsDone)
 	}
 
+	httpHandler.SetReady(true)
+
 	// Graceful shutdown
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 	<-sigCh
 
-	log.Println("shutting down...")
+	slog.Info("shutting down")
 
-	if !*disablegRPC {
-		grpcSrv.GracefulStop()
+	// Both servers share one deadline, so a stuck client cannot hold up
+	// termination for longer than -shutdowntimeout in total.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	respSrv.Close()
+	stopFollowing()
+	if pprofSrv != nil {
+		// A CPU profile or trace can run for as long as it was asked to, so
+		// profiling requests are cut off rather than waited for.
+		pprofSrv.Close()
+	}
+
+	if !cfg.DisableGRPC {
+		grpcHandler.Close()
+		if stopGracefully(ctx, grpcSrv.GracefulStop, grpcSrv.Stop) {
+			slog.Info("gRPC server stopped gracefully")
+		} else {
+			slog.Warn("gRPC server shutdown timed out, closed connections forcibly")
+		}
+	}
+
+	if !cfg.DisableHTTP {
+		if err := httpSrv.Shutdown(ctx); err != nil {
+			httpSrv.Close()
+			slog.Warn("HTTP server shutdown timed out, closed connections forcibly", "err", err)
+		} else {
+			slog.Info("HTTP server stopped gracefully")
+		}
+	}
+
+	if err := tracer.Close(ctx); err != nil {
+		slog.Warn("failed to send the last trace spans", "err", err)
+	}
+
+	close(stopSnapshots)
+	<-snapshotsDone
+	if cfg.SaveSnapshotOnExit != "" {
+		if err := saveSnapshot(s, cfg.SaveSnapshotOnExit); err != nil {
+			slog.Error("failed to write snapshot", "path", cfg.SaveSnapshotOnExit, "err", err)
+		}
+	}
+}
+
+// listen opens the listeners for the server called name: TCP on port, and a
+// Unix domain socket at socket if it is set. Port 0 means an ephemeral port,
+// unless there is a socket, in which case it means no TCP listener at all. It
+// exits if a listener cannot be opened. Closing the server removes the
+// socket file.
+func listen(name string, port int, socket string, mode fs.FileMode, tls bool) []net.Listener {
+	var listeners []net.Listener
+	if port != 0 || socket == "" {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			fatal(fmt.Sprintf("failed to listen on :%d", port), err)
+		}
+		slog.Info(name+" server listening", "port", lis.Addr().(*net.TCPAddr).Port, "tls", tls)
+		listeners = append(listeners, lis)
+	}
+	if socket != "" {
+		lis, err := listenUnix(socket, mode)
+		if err != nil {
+			fatal("failed to listen on "+socket, err)
+		}
+		slog.Info(name+" server listening", "socket", socket, "tls", tls)
+		listeners = append(listeners, lis)
+	}
+	return listeners
+}
+
+// follow makes s a follower of the leader at cfg.ReplicaOf and starts
+// replicating from it in the background, returning a function that stops.
+// The leader is dialed over TLS when this server uses TLS itself, trusting
+// -tlsclientca if set and presenting this server's certificate.
+func follow(s *store.Store, cfg Config, tlsCfg *tls.Config, logger *slog.Logger) (stop func()) {
+	creds := insecure.NewCredentials()
+	if tlsCfg != nil {
+		creds = credentials.NewTLS(&tls.Config{
+			Certificates: tlsCfg.Certificates,
+			RootCAs:      tlsCfg.ClientCAs,
+			MinVersion:   tls.VersionTLS12,
+		})
+	}
+	conn, err := grpc.NewClient(cfg.ReplicaOf, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		fatal("invalid -replicaof", err)
+	}
+	s.SetLeader(cfg.ReplicaOf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if cfg.AuthToken != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+cfg.AuthToken)
 	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		slog.Info("following leader", "addr", cfg.ReplicaOf)
+		server.Follow(ctx, s, pb.NewKVStoreClient(conn), logger)
+	}()
+	return func() {
+		cancel()
+		<-done
+		conn.Close()
+	}
+}
+
+// stopGracefully runs graceful and waits for it to return. If ctx ends first,
+// it calls force, which must make graceful return, and reports false.
+func stopGracefully(ctx context.Context, graceful, force func()) bool {
+	done := make(chan struct{})
+	go func() {
+		graceful()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		force()
+		<-done
+		return false
+	}
+}
+
+// parseFsync parses the -aof-fsync flag.
+func parseFsync(v string) (store.FsyncPolicy, time.Duration, error) {
+	switch v {
+	case "always":
+		return store.FsyncAlways, 0, nil
+	case "never":
+		return store.FsyncNever, 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, 0, fmt.Errorf(`want "always", "never" or a positive duration, got %q`, v)
+	}
+	return store.FsyncInterval, d, nil
+}
+
+// splitList splits a comma-separated flag value, trimming spaces and dropping
+// empty items.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
 
-	if !*disableHttp {
-		httpSrv.Shutdown(context.Background())
+// snapshotLoop writes a snapshot of s to path every interval until stop is
+// closed, skipping intervals in which nothing changed.
+func snapshotLoop(s *store.Store, path string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := s.Mutations()
+	for {
+		select {
+		case <-ticker.C:
+			// Read the counter before snapshotting, so a change that races
+			// with the snapshot is picked up next time rather than missed.
+			m := s.Mutations()
+			if m == last {
+				continue
+			}
+			start := time.Now()
+			if err := saveSnapshot(s, path); err != nil {
+				slog.Error("failed to write snapshot", "path", path, "err", err)
+				continue
+			}
+			last = m
+			slog.Info("wrote snapshot", "keys", s.Len(), "path", path, "duration", time.Since(start))
+		case <-stop:
+			return
+		}
+	}
+}
+
+// loadSnapshot restores s from the snapshot at path. A missing file is only
+// a warning, so the first run starts empty; a corrupt one is an error.
+func loadSnapshot(s *store.Store, path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		slog.Warn("snapshot not found, starting empty", "path", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.Restore(f)
+}
+
+// saveSnapshot writes a snapshot of s to path, via a temporary file so a crash
+// part way through leaves the previous snapshot intact.
+func saveSnapshot(s *store.Store, path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := s.Snapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
 	}
+	return os.Rename(tmp, path)
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"stashr/store"
+)
+
+func TestSnapshotFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stashr.snapshot")
+
+	s := store.New()
+	s.Set("plain", "1", 0)
+	s.Set("session", "2", 10*time.Second)
+	if err := saveSnapshot(s, path); err != nil {
+		t.Fatal(err)
+	}
+	s.Stop()
+
+	// Let some of the TTL elapse between the save and the restore.
+	time.Sleep(1100 * time.Millisecond)
+
+	r := store.New()
+	defer r.Stop()
+	if err := loadSnapshot(r, path); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := r.Get("plain"); v != "1" {
+		t.Fatalf("expected plain=1, got %q", v)
+	}
+	remaining, hasTTL, ok := r.TTL("session")
+	if !ok || !hasTTL {
+		t.Fatal("expected session to be restored with a TTL")
+	}
+	if remaining > 9*time.Second {
+		t.Fatalf("expected the TTL to keep counting down across the restore, got %v remaining", remaining)
+	}
+}
+
+func TestLoadSnapshotMissingAndCorrupt(t *testing.T) {
+	dir := t.TempDir()
+	s := store.New()
+	defer s.Stop()
+
+	if err := loadSnapshot(s, filepath.Join(dir, "missing")); err != nil {
+		t.Fatalf("expected a missing snapshot to be skipped, got %v", err)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt")
+	if err := os.WriteFile(corrupt, []byte("not json\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadSnapshot(s, corrupt); err == nil {
+		t.Fatal("expected a corrupt snapshot to fail")
+	}
+}
+
+func TestSnapshotLoopSkipsIdle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stashr.snapshot")
+	s := store.New()
+	defer s.Stop()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		snapshotLoop(s, path, 20*time.Millisecond, stop)
+		close(done)
+	}()
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no snapshot while idle, stat err = %v", err)
+	}
+
+	s.Set("a", "1", 0)
+	time.Sleep(60 * time.Millisecond)
+	close(stop)
+	<-done
+
+	r := store.New()
+	defer r.Stop()
+	if err := loadSnapshot(r, path); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := r.Get("a"); v != "1" {
+		t.Fatalf("expected periodic snapshot to contain a=1, got %q", v)
+	}
+}
+
+func TestStopGracefully(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	forced := false
+	if !stopGracefully(ctx, func() {}, func() { forced = true }) || forced {
+		t.Fatal("expected a prompt stop to complete gracefully")
+	}
+}
+
+func TestStopGracefullyForcesAfterDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	release := make(chan struct{})
+	hang := func() { <-release }
+	force := func() { close(release) }
+	if stopGracefully(ctx, hang, force) {
+		t.Fatal("expected a hung stop to be forced")
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "warn", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown")
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, `"msg":"shown"`) {
+		t.Fatalf("expected only the warning, as JSON, got %q", out)
+	}
+
+	if _, err := newLogger(&buf, "loud", "text"); err == nil {
+		t.Fatal("expected an error for an unknown level")
+	}
+	if _, err := newLogger(&buf, "info", "xml"); err == nil {
+		t.Fatal("expected an error for an unknown format")
+	}
+}
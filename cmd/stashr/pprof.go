@@ -0,0 +1,23 @@
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// pprofHandler serves the runtime profiles of net/http/pprof under
+// /debug/pprof/. It is served on its own listener rather than the HTTP API's,
+// so profiling requests bypass the API's auth, rate limits and tracing and
+// never show up in its metrics. Profiles expose command lines, stacks and
+// memory contents, so the listener should only be reachable from trusted
+// networks.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	return mux
+}
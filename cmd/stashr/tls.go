@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// tlsConfig builds the TLS configuration shared by the HTTP and gRPC servers.
+// It returns nil if TLS is not configured. certFile and keyFile must be set
+// together; clientCAFile additionally requires clients to present a
+// certificate signed by one of its CAs. TLS 1.2 is the minimum version, and
+// cipher suites are left to Go's defaults, which only offer modern ones.
+func tlsConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, errors.New("-tlsclientca requires -tlscert and -tlskey")
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("-tlscert and -tlskey must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load key pair: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// httpTLSConfig returns the TLS configuration for the HTTP server: its own,
+// built like tlsConfig's from the -http-tls-* flags if they are set, or shared,
+// the configuration of the other servers, otherwise.
+func httpTLSConfig(cfg Config, shared *tls.Config) (*tls.Config, error) {
+	if cfg.HTTPTLSCert == "" && cfg.HTTPTLSKey == "" {
+		if cfg.HTTPTLSClientCA != "" {
+			return nil, errors.New("-http-tls-client-ca requires -http-tls-cert and -http-tls-key")
+		}
+		return shared, nil
+	}
+	if cfg.HTTPTLSCert == "" || cfg.HTTPTLSKey == "" {
+		return nil, errors.New("-http-tls-cert and -http-tls-key must be set together")
+	}
+	return tlsConfig(cfg.HTTPTLSCert, cfg.HTTPTLSKey, cfg.HTTPTLSClientCA)
+}
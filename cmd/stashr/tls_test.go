@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSigned writes a self-signed certificate and key to dir and returns
+// their paths.
+func writeSelfSigned(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "stashr-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	certFile, keyFile := writeSelfSigned(t, t.TempDir())
+
+	if cfg, err := tlsConfig("", "", ""); cfg != nil || err != nil {
+		t.Fatalf("expected TLS off without flags, got %v, %v", cfg, err)
+	}
+	if _, err := tlsConfig(certFile, "", ""); err == nil {
+		t.Fatal("expected an error with only -tlscert")
+	}
+	if _, err := tlsConfig("", keyFile, ""); err == nil {
+		t.Fatal("expected an error with only -tlskey")
+	}
+	if _, err := tlsConfig("", "", certFile); err == nil {
+		t.Fatal("expected an error with only -tlsclientca")
+	}
+
+	cfg, err := tlsConfig(certFile, keyFile, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MinVersion != tls.VersionTLS12 || cfg.ClientAuth != tls.NoClientCert {
+		t.Fatalf("unexpected config: min %x, client auth %v", cfg.MinVersion, cfg.ClientAuth)
+	}
+
+	cfg, err = tlsConfig(certFile, keyFile, certFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert || cfg.ClientCAs == nil {
+		t.Fatal("expected -tlsclientca to require verified client certificates")
+	}
+}
+
+func TestHTTPTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeSelfSigned(t, dir)
+	shared := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if got, err := httpTLSConfig(Config{}, shared); got != shared || err != nil {
+		t.Fatalf("expected the shared config without -http-tls-* flags, got %v, %v", got, err)
+	}
+	if got, err := httpTLSConfig(Config{}, nil); got != nil || err != nil {
+		t.Fatalf("expected TLS off without any flags, got %v, %v", got, err)
+	}
+	if _, err := httpTLSConfig(Config{HTTPTLSCert: certFile}, shared); err == nil {
+		t.Fatal("expected an error with only -http-tls-cert")
+	}
+	if _, err := httpTLSConfig(Config{HTTPTLSClientCA: certFile}, shared); err == nil {
+		t.Fatal("expected an error with only -http-tls-client-ca")
+	}
+	if _, err := httpTLSConfig(Config{HTTPTLSCert: filepath.Join(dir, "missing.pem"), HTTPTLSKey: keyFile}, nil); err == nil {
+		t.Fatal("expected an error for a certificate that cannot be loaded")
+	}
+
+	got, err := httpTLSConfig(Config{HTTPTLSCert: certFile, HTTPTLSKey: keyFile, HTTPTLSClientCA: certFile}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.MinVersion != tls.VersionTLS12 || got.ClientAuth != tls.RequireAndVerifyClientCert || len(got.Certificates) != 1 {
+		t.Fatalf("unexpected config: min %x, client auth %v", got.MinVersion, got.ClientAuth)
+	}
+}
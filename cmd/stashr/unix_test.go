@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// socketDir returns a short temporary directory; t.TempDir paths can exceed
+// the length limit on Unix socket addresses.
+func socketDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "stashr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(socketDir(t), "s.sock")
+	lis, err := listenUnix(path, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Fatalf("socket mode %v, want 0600", fi.Mode().Perm())
+	}
+
+	if _, err := listenUnix(path, 0o600); err == nil {
+		t.Fatal("listened on a socket already in use")
+	}
+
+	lis.Close()
+	if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("socket not removed on close: %v", err)
+	}
+}
+
+func TestListenUnixStaleSocket(t *testing.T) {
+	path := filepath.Join(socketDir(t), "s.sock")
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Leave the file behind, as a crashed process would.
+	lis.(*net.UnixListener).SetUnlinkOnClose(false)
+	lis.Close()
+
+	lis, err = listenUnix(path, 0o660)
+	if err != nil {
+		t.Fatalf("stale socket not replaced: %v", err)
+	}
+	defer lis.Close()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o660 {
+		t.Fatalf("socket mode %v, want 0660", fi.Mode().Perm())
+	}
+}
+
+func TestListenUnixNotSocket(t *testing.T) {
+	path := filepath.Join(socketDir(t), "data")
+	if err := os.WriteFile(path, []byte("keep me"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listenUnix(path, 0o600); err == nil {
+		t.Fatal("replaced a regular file with a socket")
+	}
+	if b, err := os.ReadFile(path); err != nil || string(b) != "keep me" {
+		t.Fatalf("file clobbered: %q, %v", b, err)
+	}
+}
+
+func TestParseUnixMode(t *testing.T) {
+	for in, want := range map[string]fs.FileMode{"0600": 0o600, "660": 0o660, "0777": 0o777} {
+		got, err := parseUnixMode(in)
+		if err != nil || got != want {
+			t.Errorf("parseUnixMode(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "rw", "0800", "01777", "-1"} {
+		if _, err := parseUnixMode(in); err == nil {
+			t.Errorf("parseUnixMode(%q) succeeded", in)
+		}
+	}
+}
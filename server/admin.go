@@ -0,0 +1,120 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// SetAdminToken enables the /admin endpoints, which require an
+// "Authorization: Bearer <token>" header. With no token configured the admin
+// endpoints respond 404.
+func (h *HTTPServer) SetAdminToken(token string) {
+	h.adminToken = token
+}
+
+func (h *HTTPServer) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.adminToken == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if !validBearer(r, h.adminToken) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// validBearer reports whether r carries the expected bearer token. The
+// comparison is constant-time.
+func validBearer(r *http.Request, token string) bool {
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+func (h *HTTPServer) handleExpireNow(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	expired, err := h.store.ExpireNow(key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"expired": expired})
+}
+
+// handleFlush removes every key in every namespace. Being an admin endpoint,
+// the admin token is the confirmation; ?reset_stats=true also zeroes the
+// cumulative counters.
+func (h *HTTPServer) handleFlush(w http.ResponseWriter, r *http.Request) {
+	n, err := h.store.Flush(r.Context(), r.URL.Query().Get("reset_stats") == "true")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"flushed": n})
+}
+
+// handleReadOnly switches the store in or out of read-only mode, as given by
+// {"read_only": true|false}, and reports the resulting mode.
+func (h *HTTPServer) handleReadOnly(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ReadOnly *bool `json:"read_only"`
+	}
+	const invalid = `{"error":"expected {\"read_only\": true|false}"}`
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err, invalid)
+		return
+	}
+	if req.ReadOnly == nil {
+		http.Error(w, invalid, http.StatusBadRequest)
+		return
+	}
+	h.store.SetReadOnly(*req.ReadOnly)
+	h.logger.Info("read-only mode changed", "read_only", *req.ReadOnly)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"read_only": h.store.ReadOnly()})
+}
+
+// handleDump streams every live key in every namespace in the format of
+// store.Export, for loading into another server with /restore.
+func (h *HTTPServer) handleDump(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if err := h.store.Export(w); err != nil {
+		// The status is already sent; all that can be done is to stop.
+		h.logger.Warn("dump failed", "err", err)
+	}
+}
+
+// handleRestore imports a /dump body with store.Import, leaving keys that
+// already exist alone unless ?overwrite=true, and reports how many entries
+// were imported and skipped. On an entry the store rejects, such as a
+// malformed one or one over the size limits, it stops there with the status
+// writeError would give and a body that still carries the counts, since the
+// entries before it were imported. Errors about the store itself, such as
+// read-only mode or a failed write to the log, are answered by writeError.
+func (h *HTTPServer) handleRestore(w http.ResponseWriter, r *http.Request) {
+	imported, skipped, err := h.store.Import(r.Body, r.URL.Query().Get("overwrite") == "true")
+	code := http.StatusOK
+	if err != nil {
+		if code, _ = errorStatus(err); code == http.StatusForbidden || code >= 500 {
+			writeError(w, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	resp := map[string]any{"imported": imported, "skipped": skipped}
+	if err != nil {
+		resp["error"] = err.Error()
+	}
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// probePaths are the endpoints monitoring systems poll. They can be left open
+// when token auth is enabled.
+var probePaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// adminRoutes are the admin endpoints outside /admin/, by method and path.
+// Like those they check the admin token rather than the auth token.
+var adminRoutes = map[string]bool{
+	"POST /flush":   true,
+	"GET /dump":     true,
+	"HEAD /dump":    true,
+	"POST /restore": true,
+}
+
+// SetAuthToken requires an "Authorization: Bearer <token>" header on every
+// request. The admin endpoints are exempt since they check the admin token
+// instead. If publicProbes is true, /healthz, /readyz and /metrics stay open
+// as well. An empty token disables auth.
+func (h *HTTPServer) SetAuthToken(token string, publicProbes bool) {
+	h.authToken = token
+	h.publicProbes = publicProbes
+}
+
+// requireAuth wraps next with the token check configured by SetAuthToken.
+func (h *HTTPServer) requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.authToken == "" || h.exemptFromAuth(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !validBearer(r, h.authToken) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// exemptFromAuth reports whether r skips the auth token check: admin
+// requests, which carry the admin token in the same header, and the probes
+// if they are public.
+func (h *HTTPServer) exemptFromAuth(r *http.Request) bool {
+	path := r.URL.Path
+	if strings.HasPrefix(path, "/admin/") || adminRoutes[r.Method+" "+path] || flushesAll(r) {
+		return true
+	}
+	return h.publicProbes && probePaths[path]
+}
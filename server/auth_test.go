@@ -0,0 +1,206 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"stashr/store"
+)
+
+func TestAuthToken(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("k", "v", 0)
+
+	h := NewHTTPServer(s)
+	h.SetAuthToken("secret", true)
+	handler := h.Handler()
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"missing token", "/keys/k", "", http.StatusUnauthorized},
+		{"wrong token", "/keys/k", "Bearer nope", http.StatusUnauthorized},
+		{"wrong scheme", "/keys/k", "Basic secret", http.StatusUnauthorized},
+		{"no scheme", "/keys/k", "secret", http.StatusUnauthorized},
+		{"empty bearer", "/keys/k", "Bearer ", http.StatusUnauthorized},
+		{"bearer without space", "/keys/k", "Bearersecret", http.StatusUnauthorized},
+		{"token prefix", "/keys/k", "Bearer secre", http.StatusUnauthorized},
+		{"correct token", "/keys/k", "Bearer secret", http.StatusOK},
+		{"list needs token", "/keys", "", http.StatusUnauthorized},
+		{"public health", "/healthz", "", http.StatusOK},
+		{"public metrics", "/metrics", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+			if tt.want == http.StatusUnauthorized {
+				if body := strings.TrimSpace(rec.Body.String()); body != `{"error":"unauthorized"}` {
+					t.Fatalf("expected a JSON error, got %s", body)
+				}
+				if rec.Header().Get("WWW-Authenticate") != "Bearer" {
+					t.Fatalf("expected a Bearer challenge, got %q", rec.Header().Get("WWW-Authenticate"))
+				}
+			}
+		})
+	}
+}
+
+func TestAuthTokenPrivateProbes(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+
+	h := NewHTTPServer(s)
+	h.SetAuthToken("secret", false)
+	rec := httptest.NewRecorder()
+	h.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected probes to require the token, got %d", rec.Code)
+	}
+}
+
+func TestAuthDisabledByDefault(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("k", "v", 0)
+
+	rec := httptest.NewRecorder()
+	NewHTTPServer(s).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys/k", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected open access without a token, got %d", rec.Code)
+	}
+}
+
+func TestAdminFlush(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("a", "1", 0)
+
+	h := NewHTTPServer(s)
+	handler := h.Handler()
+	flush := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/flush", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := flush(""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 with admin endpoints disabled, got %d", rec.Code)
+	}
+	h.SetAdminToken("secret")
+	if rec := flush("wrong"); rec.Code != http.StatusUnauthorized || s.Len() != 1 {
+		t.Fatalf("expected 401 and no flush, got %d with %d keys", rec.Code, s.Len())
+	}
+	rec := flush("secret")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"flushed":1}` {
+		t.Fatalf("expected {\"flushed\":1}, got %d %s", rec.Code, rec.Body)
+	}
+	if s.Len() != 0 {
+		t.Fatalf("expected an empty store, got %d keys", s.Len())
+	}
+}
+
+func TestAdminStats(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("a", "1", time.Hour)
+	s.Set("b", "2", 0)
+	s.Namespace("app").Set("c", "3", 0)
+	s.SweepNow()
+
+	h := NewHTTPServer(s)
+	h.SetAuthToken("user", true)
+	h.SetAdminToken("secret")
+	handler := h.Handler()
+	get := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", "Bearer "+auth)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, auth := range []string{"", "user"} {
+		if rec := get(auth); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401 without the admin token, got %d", rec.Code)
+		}
+	}
+	rec := get("secret")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body)
+	}
+	var st adminStatsResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Keys != 3 || st.LiveKeys != 3 || st.KeysWithTTL != 1 || st.KeysWithoutTTL != 2 || st.Bytes <= 0 {
+		t.Fatalf("unexpected key counts %+v", st)
+	}
+	if st.Sweeps < 1 || st.StartedAt.IsZero() || st.ReadOnly {
+		t.Fatalf("unexpected store stats %+v", st)
+	}
+	if st.Runtime.GoVersion == "" || st.Runtime.Goroutines < 1 || st.Runtime.HeapAllocBytes == 0 || st.Runtime.GOMAXPROCS < 1 {
+		t.Fatalf("unexpected runtime stats %+v", st.Runtime)
+	}
+}
+
+// The admin endpoints outside /admin/ take the admin token in the same
+// header the auth token goes in, so they must not also demand the auth token.
+func TestAdminRoutesWithSeparateTokens(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	h.SetAuthToken("user", false)
+	h.SetAdminToken("admin")
+	handler := h.Handler()
+	do := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for _, route := range []struct{ method, path string }{
+		{http.MethodPost, "/flush"},
+		{http.MethodDelete, "/keys?confirm=true"},
+		{http.MethodGet, "/dump"},
+		{http.MethodPost, "/restore"},
+	} {
+		if code := do(route.method, route.path, "user"); code != http.StatusUnauthorized {
+			t.Errorf("%s %s: expected 401 with the auth token, got %d", route.method, route.path, code)
+		}
+		if code := do(route.method, route.path, "admin"); code != http.StatusOK {
+			t.Errorf("%s %s: expected 200 with the admin token, got %d", route.method, route.path, code)
+		}
+	}
+
+	// Deleting by prefix is an ordinary request and still needs the auth token.
+	if code := do(http.MethodDelete, "/keys?prefix=a", "admin"); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 deleting by prefix with the admin token, got %d", code)
+	}
+	if code := do(http.MethodDelete, "/keys?prefix=a", "user"); code != http.StatusOK {
+		t.Fatalf("expected 200 deleting by prefix with the auth token, got %d", code)
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"stashr/store"
+)
+
+type batchOp struct {
+	Op         string  `json:"op"`
+	Key        string  `json:"key"`
+	Value      *string `json:"value"`
+	TTLSeconds int64   `json:"ttl_seconds"`
+}
+
+type batchResult struct {
+	Op      string `json:"op,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Found   *bool  `json:"found,omitempty"`
+	Deleted *bool  `json:"deleted,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// handleBatch applies a JSON array of get/set/delete operations in order and
+// returns one result per operation. A malformed or failing operation yields an
+// error entry in its slot without aborting the rest of the batch. Operations
+// are applied one at a time, so other clients may observe a partially applied
+// batch.
+//
+// Errors about the store rather than the operation, answered 403 or 503 by
+// writeError because it is read-only, a follower or closed, would fail every
+// later write too, so they end the batch with that response instead.
+func (h *HTTPServer) handleBatch(w http.ResponseWriter, r *http.Request) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		bodyError(w, err, `{"error":"invalid JSON"}`)
+		return
+	}
+	if len(raw) > maxBatchItems {
+		http.Error(w, fmt.Sprintf(`{"error":"at most %d operations per batch"}`, maxBatchItems), http.StatusBadRequest)
+		return
+	}
+
+	ns := h.namespace(r)
+	results := make([]batchResult, len(raw))
+	for i, msg := range raw {
+		var op batchOp
+		if err := json.Unmarshal(msg, &op); err != nil {
+			results[i] = batchResult{Error: "invalid operation"}
+			continue
+		}
+		res, err := h.applyBatchOp(ns, op)
+		if err != nil {
+			code, msg := errorStatus(err)
+			if code == http.StatusForbidden || code == http.StatusServiceUnavailable {
+				writeError(w, err)
+				return
+			}
+			res.Error = msg
+		}
+		results[i] = res
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// applyBatchOp applies op to ns. A malformed op is reported in the result's
+// Error; a failed write is returned as the error.
+func (h *HTTPServer) applyBatchOp(ns *store.Namespace, op batchOp) (batchResult, error) {
+	res := batchResult{Op: op.Op, Key: op.Key}
+	if op.Key == "" {
+		res.Error = "missing key"
+		return res, nil
+	}
+	switch op.Op {
+	case "get":
+		val, ok := ns.Get(op.Key)
+		res.Value, res.Found = val, &ok
+	case "set":
+		if op.Value == nil {
+			res.Error = "missing value"
+			return res, nil
+		}
+		var ttl time.Duration
+		if op.TTLSeconds > 0 {
+			ttl = time.Duration(op.TTLSeconds) * time.Second
+		}
+		if err := ns.Set(op.Key, *op.Value, ttl); err != nil {
+			return res, err
+		}
+	case "delete":
+		deleted, err := ns.Delete(op.Key)
+		if err != nil {
+			return res, err
+		}
+		res.Deleted = &deleted
+	default:
+		res.Error = "unknown op"
+	}
+	return res, nil
+}
+
+// maxBatchItems caps the operations in one /batch request and the keys or
+// items in one /keys/batch request, so a single request cannot tie up the
+// store for long.
+const maxBatchItems = 1000
+
+type batchKeysRequest struct {
+	Keys []string `json:"keys"`
+}
+
+type batchSetItem struct {
+	Key        string  `json:"key"`
+	Value      *string `json:"value"`
+	TTLSeconds int64   `json:"ttl_seconds"`
+}
+
+// decodeBatchKeys reads {"keys": [...]} from r's body, answering with 400 and
+// returning false if it is malformed or too long.
+func decodeBatchKeys(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var req batchKeysRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err, `{"error":"invalid JSON"}`)
+		return nil, false
+	}
+	if len(req.Keys) > maxBatchItems {
+		http.Error(w, fmt.Sprintf(`{"error":"at most %d keys per batch"}`, maxBatchItems), http.StatusBadRequest)
+		return nil, false
+	}
+	return req.Keys, true
+}
+
+// handleBatchGet looks up every key in {"keys": [...]} in one pass and returns
+// the values found, by key, and the keys that were not, in request order.
+func (h *HTTPServer) handleBatchGet(w http.ResponseWriter, r *http.Request) {
+	keys, ok := decodeBatchKeys(w, r)
+	if !ok {
+		return
+	}
+	values := h.namespace(r).MGet(keys)
+	missing := []string{}
+	for _, k := range keys {
+		if _, ok := values[k]; !ok {
+			missing = append(missing, k)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"values": values, "missing": missing})
+}
+
+// handleBatchSet writes an array of {key, value, ttl_seconds} items with
+// MSet, so the batch is applied atomically: every item is checked first, and
+// a malformed one fails the whole request with 400 and its index, before
+// anything is written. If a key appears more than once the last item wins.
+func (h *HTTPServer) handleBatchSet(w http.ResponseWriter, r *http.Request) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		bodyError(w, err, `{"error":"invalid JSON"}`)
+		return
+	}
+	if len(raw) > maxBatchItems {
+		http.Error(w, fmt.Sprintf(`{"error":"at most %d items per batch"}`, maxBatchItems), http.StatusBadRequest)
+		return
+	}
+	entries := make(map[string]store.SetOptions, len(raw))
+	for i, msg := range raw {
+		var item batchSetItem
+		reason := ""
+		switch err := json.Unmarshal(msg, &item); {
+		case err != nil:
+			reason = "invalid item"
+		case item.Key == "":
+			reason = "missing key"
+		case item.Value == nil:
+			reason = "missing value"
+		case item.TTLSeconds < 0:
+			reason = "ttl_seconds must not be negative"
+		}
+		if reason != "" {
+			b, _ := json.Marshal(map[string]any{"error": reason, "index": i})
+			http.Error(w, string(b), http.StatusBadRequest)
+			return
+		}
+		entries[item.Key] = store.SetOptions{Value: *item.Value, TTL: time.Duration(item.TTLSeconds) * time.Second}
+	}
+	if err := h.namespace(r).MSet(entries); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"written": len(entries)})
+}
+
+// handleBatchDelete deletes every key in {"keys": [...]} as a single atomic
+// write and returns how many were live.
+func (h *HTTPServer) handleBatchDelete(w http.ResponseWriter, r *http.Request) {
+	keys, ok := decodeBatchKeys(w, r)
+	if !ok {
+		return
+	}
+	n, err := h.namespace(r).MDelete(keys)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"deleted": n})
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"stashr/pb"
+	"stashr/store"
+)
+
+// binaryValue holds a NUL byte and bytes that are not valid UTF-8.
+var binaryValue = []byte{'a', 0x00, 0xff, 0xfe, 'z', 0xc3}
+
+func TestHTTPBinaryValues(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+
+	req := httptest.NewRequest(http.MethodPut, "/keys/blob?ttl_seconds=60", bytes.NewReader(binaryValue))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/keys/blob", nil)
+	req.Header.Set("Accept", "application/octet-stream")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if !bytes.Equal(rec.Body.Bytes(), binaryValue) {
+		t.Fatalf("expected %q, got %q", binaryValue, rec.Body.Bytes())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/octet-stream" {
+		t.Fatalf("expected an octet-stream response, got %q", ct)
+	}
+	if ttl := rec.Header().Get("X-TTL-Seconds"); ttl != "60" {
+		t.Fatalf("expected X-TTL-Seconds 60, got %q", ttl)
+	}
+}
+
+func TestGRPCBinaryValues(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+
+	client := dialBufconn(t, s)
+	ctx := context.Background()
+
+	if _, err := client.Set(ctx, &pb.SetRequest{Key: "blob", Value: binaryValue}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(ctx, &pb.GetRequest{Key: "blob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(resp.Value, binaryValue) {
+		t.Fatalf("expected %q, got %q", binaryValue, resp.Value)
+	}
+}
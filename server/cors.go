@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// corsMethods and corsHeaders are what browsers may use cross-origin: every
+// method the API routes, and the request headers it reads.
+const (
+	corsMethods = "GET, HEAD, PUT, POST, PATCH, DELETE"
+	corsHeaders = "Authorization, Content-Type, Accept, If-Match, If-None-Match"
+	// corsExpose lets browser code read the response headers the API sets.
+	corsExpose = "ETag, X-TTL-Seconds, X-Version, Retry-After"
+)
+
+// SetCORSOrigins lets browser pages from origins call the API. An origin of
+// "*" allows any. Preflight OPTIONS requests from allowed origins are answered
+// with 204 before auth, since browsers never send credentials on them; the
+// real request that follows is still checked. Empty, the default, disables
+// CORS.
+func (h *HTTPServer) SetCORSOrigins(origins []string) {
+	h.corsOrigins = origins
+}
+
+// cors applies the SetCORSOrigins allowlist.
+func (h *HTTPServer) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if len(h.corsOrigins) == 0 || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		allowed := h.corsAllowed(origin)
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			if !allowed {
+				http.Error(w, `{"error":"origin not allowed"}`, http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", corsExpose)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *HTTPServer) corsAllowed(origin string) bool {
+	return slices.ContainsFunc(h.corsOrigins, func(o string) bool {
+		return o == "*" || strings.EqualFold(o, origin)
+	})
+}
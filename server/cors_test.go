@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"stashr/store"
+)
+
+func TestCORS(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	h.SetAuthToken("secret", false)
+	h.SetCORSOrigins([]string{"https://dash.example.com"})
+	handler := h.Handler()
+
+	preflight := func(origin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodOptions, "/keys/k", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPut)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := preflight("https://dash.example.com")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 for an allowed preflight without a token, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://dash.example.com" {
+		t.Fatalf("expected the origin to be allowed, got %q", got)
+	}
+	if rec.Header().Get("Access-Control-Allow-Headers") == "" || rec.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Fatal("expected the allowed methods and headers")
+	}
+
+	rec = preflight("https://evil.example.com")
+	if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected a disallowed preflight to be refused, got %d %q", rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	for origin, want := range map[string]string{
+		"https://dash.example.com": "https://dash.example.com",
+		"https://evil.example.com": "",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/keys", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Authorization", "Bearer secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", origin, rec.Code)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != want {
+			t.Fatalf("%s: expected Access-Control-Allow-Origin %q, got %q", origin, want, got)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/keys", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected the real request to still need a token, got %d", rec.Code)
+	}
+}
+
+func TestCORSWildcard(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	h.SetCORSOrigins([]string{"*"})
+	handler := h.Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/keys", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://anywhere.example.com" {
+		t.Fatalf("expected any origin to be allowed, got %q", got)
+	}
+}
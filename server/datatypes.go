@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+type pushRequest struct {
+	Values []string `json:"values"`
+	Head   bool     `json:"head"` // push onto the head instead of the tail
+}
+
+// handlePush appends the values in the body to the list, or prepends them
+// with "head":true, and returns the list's new length.
+func (h *HTTPServer) handlePush(w http.ResponseWriter, r *http.Request) {
+	var req pushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err, `{"error":"invalid JSON"}`)
+		return
+	}
+	if len(req.Values) == 0 {
+		http.Error(w, `{"error":"values must not be empty"}`, http.StatusBadRequest)
+		return
+	}
+	ns := h.namespace(r)
+	push := ns.RPush
+	if req.Head {
+		push = ns.LPush
+	}
+	n, err := push(r.PathValue("key"), req.Values...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"length": n})
+}
+
+// handleRange returns the list's elements from ?start= to ?stop= inclusive,
+// the whole list by default, as {"values": [...]}. A missing key is an
+// empty list.
+func (h *HTTPServer) handleRange(w http.ResponseWriter, r *http.Request) {
+	start, stop := 0, -1
+	for name, dst := range map[string]*int{"start": &start, "stop": &stop} {
+		if !r.URL.Query().Has(name) {
+			continue
+		}
+		v, err := strconv.Atoi(r.URL.Query().Get(name))
+		if err != nil {
+			http.Error(w, `{"error":"`+name+` must be an integer"}`, http.StatusBadRequest)
+			return
+		}
+		*dst = v
+	}
+	values, err := h.namespace(r).LRange(r.PathValue("key"), start, stop)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if values == nil {
+		values = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]string{"values": values})
+}
+
+func (h *HTTPServer) handleListLength(w http.ResponseWriter, r *http.Request) {
+	n, err := h.namespace(r).LLen(r.PathValue("key"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"length": n})
+}
+
+// handleHashGetAll returns every field of the hash as {"fields": {...}}. A
+// missing key is an empty hash.
+func (h *HTTPServer) handleHashGetAll(w http.ResponseWriter, r *http.Request) {
+	fields, err := h.namespace(r).HGetAll(r.PathValue("key"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]map[string]string{"fields": fields})
+}
+
+func (h *HTTPServer) handleHashGet(w http.ResponseWriter, r *http.Request) {
+	value, ok, err := h.namespace(r).HGet(r.PathValue("key"), r.PathValue("field"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !ok {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"value": value})
+}
+
+func (h *HTTPServer) handleHashSet(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err, `{"error":"invalid JSON"}`)
+		return
+	}
+	added, err := h.namespace(r).HSet(r.PathValue("key"), r.PathValue("field"), req.Value)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"added": added})
+}
+
+func (h *HTTPServer) handleHashDelete(w http.ResponseWriter, r *http.Request) {
+	n, err := h.namespace(r).HDel(r.PathValue("key"), r.PathValue("field"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"deleted": n > 0})
+}
@@ -2,8 +2,16 @@ package server
 
 import (
 	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
 	"time"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
 	"stashr/pb"
 	"stashr/store"
 )
@@ -11,27 +19,631 @@ import (
 type GRPCServer struct {
 	pb.UnimplementedKVStoreServer
 	store *store.Store
+
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 func NewGRPCServer(s *store.Store) *GRPCServer {
-	return &GRPCServer{store: s}
+	return &GRPCServer{store: s, done: make(chan struct{})}
+}
+
+// Close ends any open Watch streams. Call it before GracefulStop, which
+// otherwise waits for long-lived streams forever.
+func (g *GRPCServer) Close() {
+	g.closeOnce.Do(func() { close(g.done) })
+}
+
+// ns returns the namespace a request names, where "" is the default, with
+// writes recorded in the history as coming from the calling peer.
+func (g *GRPCServer) ns(ctx context.Context, name string) *store.Namespace {
+	source := "grpc"
+	if p, ok := peer.FromContext(ctx); ok {
+		source += " " + p.Addr.String()
+	}
+	return g.store.Namespace(name).WithSource(source)
 }
 
-func (g *GRPCServer) Get(_ context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
-	val, ok := g.store.Get(req.Key)
-	return &pb.GetResponse{Value: val, Found: ok}, nil
+func (g *GRPCServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	val, info, ok := g.ns(ctx, req.Namespace).GetWithInfo(req.Key)
+	if !ok {
+		return &pb.GetResponse{}, nil
+	}
+	return &pb.GetResponse{Value: []byte(val), Found: true, Version: info.Version}, nil
 }
 
-func (g *GRPCServer) Set(_ context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+func (g *GRPCServer) GetTTL(ctx context.Context, req *pb.GetTTLRequest) (*pb.GetTTLResponse, error) {
+	remaining, hasTTL, found := g.ns(ctx, req.Namespace).TTL(req.Key)
+	resp := &pb.GetTTLResponse{HasTtl: hasTTL, Found: found}
+	if hasTTL {
+		resp.TtlSeconds = ceilSeconds(remaining)
+	}
+	return resp, nil
+}
+
+func (g *GRPCServer) Info(ctx context.Context, req *pb.InfoRequest) (*pb.InfoResponse, error) {
+	info, found := g.ns(ctx, req.Namespace).Info(req.Key)
+	if !found {
+		return &pb.InfoResponse{}, nil
+	}
+	resp := &pb.InfoResponse{
+		Found:           true,
+		Size:            int64(info.Size),
+		HasTtl:          info.HasTTL,
+		CreatedAtUnixMs: info.CreatedAt.UnixMilli(),
+		UpdatedAtUnixMs: info.UpdatedAt.UnixMilli(),
+		Type:            info.Type,
+	}
+	if info.HasTTL {
+		resp.TtlSeconds = ceilSeconds(info.TTL)
+	}
+	return resp, nil
+}
+
+func (g *GRPCServer) History(ctx context.Context, req *pb.HistoryRequest) (*pb.HistoryResponse, error) {
+	ns := g.ns(ctx, req.Namespace)
+	var muts []store.Mutation
+	if req.Key == "" {
+		muts = ns.RecentMutations(int(req.Limit))
+	} else {
+		muts = ns.History(req.Key, int(req.Limit))
+	}
+	resp := &pb.HistoryResponse{Mutations: make([]*pb.Mutation, len(muts))}
+	for i, m := range muts {
+		resp.Mutations[i] = &pb.Mutation{
+			Key:        m.Key,
+			Type:       eventTypes[m.Op],
+			Size:       int64(m.Size),
+			TimeUnixMs: m.Time.UnixMilli(),
+			Source:     m.Source,
+		}
+	}
+	return resp, nil
+}
+
+func (g *GRPCServer) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	if req.Limit > 0 || req.Cursor != "" {
+		keys, next, err := g.ns(ctx, req.Namespace).ListPageFunc(ctx, req.Cursor, int(req.Limit), keyFilter(req.Prefix, req.Pattern))
+		if errors.Is(err, store.ErrInvalidCursor) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if err != nil {
+			return nil, writeStatus(err)
+		}
+		return &pb.ListResponse{Keys: keys, NextCursor: next}, nil
+	}
+	if !req.Detail {
+		return &pb.ListResponse{Keys: listKeys(g.ns(ctx, req.Namespace), req.Prefix, req.Pattern)}, nil
+	}
+	entries := g.ns(ctx, req.Namespace).ListEntries(store.ListOptions{
+		Prefix:        req.Prefix,
+		Pattern:       req.Pattern,
+		MaxValueBytes: int(req.MaxValueBytes),
+	})
+	resp := &pb.ListResponse{Keys: make([]string, len(entries)), Entries: make([]*pb.Entry, len(entries))}
+	for i, e := range entries {
+		resp.Keys[i] = e.Key
+		resp.Entries[i] = &pb.Entry{
+			Key:           e.Key,
+			Size:          int64(e.Size),
+			HasTtl:        e.HasTTL,
+			TtlSeconds:    ceilSeconds(e.TTL),
+			ValueIncluded: e.ValueIncluded,
+		}
+		if e.ValueIncluded {
+			resp.Entries[i].Value = []byte(e.Value)
+		}
+	}
+	return resp, nil
+}
+
+func (g *GRPCServer) Set(ctx context.Context, req *pb.SetRequest) (*pb.SetResponse, error) {
+	written, version, err := g.set(ctx, req)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	resp := &pb.SetResponse{Written: written, Swapped: req.HasExpected && written, Version: version}
+	if written {
+		resp.TtlSeconds = ceilSeconds(g.store.EffectiveTTL(time.Duration(req.TtlSeconds) * time.Second))
+	}
+	return resp, nil
+}
+
+var (
+	// errMultipleConditions rejects a SetRequest asking for more than one of
+	// nx, a compare-and-swap and a version check.
+	errMultipleConditions = errors.New("nx, has_expected and if_version are mutually exclusive")
+	// errConditionalSliding rejects a sliding SetRequest that is also
+	// conditional; only plain writes can be sliding.
+	errConditionalSliding = errors.New("sliding cannot be combined with nx, has_expected or if_version")
+	// errConditionalTags rejects a tagged SetRequest that is also
+	// conditional; only plain writes can carry tags.
+	errConditionalTags = errors.New("tags cannot be combined with nx, has_expected or if_version")
+)
+
+// invalidSet reports whether err rejects a SetRequest itself, rather than
+// being a failure of the store.
+func invalidSet(err error) bool {
+	return errors.Is(err, store.ErrKeyTooLarge) || errors.Is(err, store.ErrValueTooLarge) ||
+		errors.Is(err, store.ErrReservedKey) ||
+		errors.Is(err, errMultipleConditions) || errors.Is(err, errConditionalSliding) ||
+		errors.Is(err, errConditionalTags)
+}
+
+// set applies a SetRequest, reporting whether it was written and, for an
+// if_version request, the key's version afterwards.
+func (g *GRPCServer) set(ctx context.Context, req *pb.SetRequest) (bool, uint64, error) {
 	var ttl time.Duration
 	if req.TtlSeconds > 0 {
 		ttl = time.Duration(req.TtlSeconds) * time.Second
 	}
-	g.store.Set(req.Key, req.Value, ttl)
-	return &pb.SetResponse{}, nil
+	conditions := 0
+	for _, set := range []bool{req.Nx, req.HasExpected, req.IfVersion != nil} {
+		if set {
+			conditions++
+		}
+	}
+	if conditions > 1 {
+		return false, 0, errMultipleConditions
+	}
+	if req.Sliding && conditions > 0 {
+		return false, 0, errConditionalSliding
+	}
+	if len(req.Tags) > 0 && conditions > 0 {
+		return false, 0, errConditionalTags
+	}
+	ns := g.ns(ctx, req.Namespace)
+	switch {
+	case req.IfVersion != nil:
+		return ns.SetIfVersion(req.Key, string(req.Value), *req.IfVersion, ttl)
+	case req.HasExpected:
+		swapped, err := ns.CompareAndSwap(req.Key, string(req.ExpectedValue), string(req.Value), ttl)
+		return swapped, 0, err
+	case req.Nx:
+		written, err := ns.SetNX(req.Key, string(req.Value), ttl)
+		return written, 0, err
+	}
+	o := store.SetOptions{Value: string(req.Value), TTL: ttl, Sliding: req.Sliding, Tags: req.Tags}
+	return true, 0, ns.SetWithOptions(req.Key, o)
+}
+
+// BatchSet applies each streamed SetRequest as it arrives, so memory stays
+// bounded however many are sent. Invalid requests, such as oversized ones, are
+// counted as failed and the stream carries on; any other error ends it.
+func (g *GRPCServer) BatchSet(stream pb.KVStore_BatchSetServer) error {
+	var sum pb.BatchSetSummary
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&sum)
+		}
+		if err != nil {
+			return err
+		}
+		sum.Received++
+		written, _, err := g.set(stream.Context(), req)
+		switch {
+		case invalidSet(err):
+			sum.Failed++
+		case err != nil:
+			return status.Errorf(status.Code(writeStatus(err)), "after %d writes: %v", sum.Written, err)
+		case written:
+			sum.Written++
+		}
+	}
+}
+
+// BatchGet looks up several keys at once. Results come back in request order,
+// with found false for missing keys.
+func (g *GRPCServer) BatchGet(ctx context.Context, req *pb.BatchGetRequest) (*pb.BatchGetResponse, error) {
+	vals := g.ns(ctx, req.Namespace).MGet(req.Keys)
+	resp := &pb.BatchGetResponse{Results: make([]*pb.GetResult, len(req.Keys))}
+	for i, k := range req.Keys {
+		v, ok := vals[k]
+		resp.Results[i] = &pb.GetResult{Key: k, Value: []byte(v), Found: ok}
+	}
+	return resp, nil
 }
 
-func (g *GRPCServer) Delete(_ context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
-	deleted := g.store.Delete(req.Key)
+// writeStatus converts a failed store write to a gRPC status, reporting
+// invalid requests as InvalidArgument, a stopped store as Unavailable and a
+// read-only one as FailedPrecondition.
+func writeStatus(err error) error {
+	if invalidSet(err) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, store.ErrStoreClosed) {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	if errors.Is(err, store.ErrReadOnly) || errors.Is(err, store.ErrWrongType) {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if errors.Is(err, store.ErrInvalidUTF8) || errors.Is(err, store.ErrInvalidEntry) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (g *GRPCServer) Copy(ctx context.Context, req *pb.CopyRequest) (*pb.CopyResponse, error) {
+	var ttl *time.Duration
+	if req.TtlSeconds != nil {
+		d := time.Duration(*req.TtlSeconds) * time.Second
+		ttl = &d
+	}
+	err := g.ns(ctx, req.Namespace).Copy(req.Key, req.Destination, req.Overwrite, ttl)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, store.ErrKeyExists):
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, store.ErrSameKey):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, writeStatus(err)
+	}
+	return &pb.CopyResponse{}, nil
+}
+
+func (g *GRPCServer) DeletePrefix(ctx context.Context, req *pb.DeletePrefixRequest) (*pb.DeletePrefixResponse, error) {
+	n, err := g.ns(ctx, req.Namespace).DeletePrefix(ctx, req.Prefix)
+	if errors.Is(err, store.ErrEmptyPrefix) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.DeletePrefixResponse{Deleted: int64(n)}, nil
+}
+
+func (g *GRPCServer) Flush(ctx context.Context, req *pb.FlushRequest) (*pb.FlushResponse, error) {
+	n, err := g.store.Flush(ctx, req.ResetStats)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.FlushResponse{Flushed: int64(n)}, nil
+}
+
+func (g *GRPCServer) RandomKey(ctx context.Context, req *pb.RandomKeyRequest) (*pb.RandomKeyResponse, error) {
+	key, ok := g.ns(ctx, req.Namespace).RandomKey()
+	return &pb.RandomKeyResponse{Key: key, Found: ok}, nil
+}
+
+func (g *GRPCServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	deleted, err := g.ns(ctx, req.Namespace).Delete(req.Key)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
 	return &pb.DeleteResponse{Deleted: deleted}, nil
 }
+
+func (g *GRPCServer) Append(ctx context.Context, req *pb.AppendRequest) (*pb.AppendResponse, error) {
+	n, err := g.ns(ctx, req.Namespace).Append(req.Key, string(req.Suffix))
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.AppendResponse{Length: int64(n)}, nil
+}
+
+func (g *GRPCServer) LPush(ctx context.Context, req *pb.PushRequest) (*pb.PushResponse, error) {
+	n, err := g.ns(ctx, req.Namespace).LPush(req.Key, req.Values...)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.PushResponse{Length: int64(n)}, nil
+}
+
+func (g *GRPCServer) RPush(ctx context.Context, req *pb.PushRequest) (*pb.PushResponse, error) {
+	n, err := g.ns(ctx, req.Namespace).RPush(req.Key, req.Values...)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.PushResponse{Length: int64(n)}, nil
+}
+
+func (g *GRPCServer) LRange(ctx context.Context, req *pb.LRangeRequest) (*pb.LRangeResponse, error) {
+	values, err := g.ns(ctx, req.Namespace).LRange(req.Key, int(req.Start), int(req.Stop))
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.LRangeResponse{Values: values}, nil
+}
+
+func (g *GRPCServer) LLen(ctx context.Context, req *pb.LLenRequest) (*pb.LLenResponse, error) {
+	n, err := g.ns(ctx, req.Namespace).LLen(req.Key)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.LLenResponse{Length: int64(n)}, nil
+}
+
+func (g *GRPCServer) HSet(ctx context.Context, req *pb.HSetRequest) (*pb.HSetResponse, error) {
+	added, err := g.ns(ctx, req.Namespace).HSet(req.Key, req.Field, req.Value)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.HSetResponse{Added: added}, nil
+}
+
+func (g *GRPCServer) HGet(ctx context.Context, req *pb.HGetRequest) (*pb.HGetResponse, error) {
+	value, found, err := g.ns(ctx, req.Namespace).HGet(req.Key, req.Field)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.HGetResponse{Value: value, Found: found}, nil
+}
+
+func (g *GRPCServer) HGetAll(ctx context.Context, req *pb.HGetAllRequest) (*pb.HGetAllResponse, error) {
+	fields, err := g.ns(ctx, req.Namespace).HGetAll(req.Key)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.HGetAllResponse{Fields: fields}, nil
+}
+
+func (g *GRPCServer) HDel(ctx context.Context, req *pb.HDelRequest) (*pb.HDelResponse, error) {
+	n, err := g.ns(ctx, req.Namespace).HDel(req.Key, req.Fields...)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.HDelResponse{Deleted: int64(n)}, nil
+}
+
+func (g *GRPCServer) Expire(ctx context.Context, req *pb.ExpireRequest) (*pb.ExpireResponse, error) {
+	var ttl time.Duration
+	if req.TtlSeconds > 0 {
+		ttl = time.Duration(req.TtlSeconds) * time.Second
+	}
+	found, err := g.ns(ctx, req.Namespace).Expire(req.Key, ttl)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.ExpireResponse{Found: found}, nil
+}
+
+func (g *GRPCServer) Persist(ctx context.Context, req *pb.PersistRequest) (*pb.PersistResponse, error) {
+	found, err := g.ns(ctx, req.Namespace).Persist(req.Key)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.PersistResponse{Found: found}, nil
+}
+
+func (g *GRPCServer) GetSet(ctx context.Context, req *pb.GetSetRequest) (*pb.GetSetResponse, error) {
+	var ttl time.Duration
+	if req.TtlSeconds > 0 {
+		ttl = time.Duration(req.TtlSeconds) * time.Second
+	}
+	old, existed, err := g.ns(ctx, req.Namespace).GetSet(req.Key, string(req.Value), ttl)
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.GetSetResponse{OldValue: []byte(old), Existed: existed}, nil
+}
+
+func (g *GRPCServer) Touch(ctx context.Context, req *pb.TouchRequest) (*pb.TouchResponse, error) {
+	var ttl time.Duration
+	if req.TtlSeconds > 0 {
+		ttl = time.Duration(req.TtlSeconds) * time.Second
+	}
+	var touched bool
+	var err error
+	if req.Refresh {
+		touched, err = g.ns(ctx, req.Namespace).Refresh(req.Key)
+	} else {
+		touched, err = g.ns(ctx, req.Namespace).Touch(req.Key, ttl)
+	}
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.TouchResponse{Touched: touched}, nil
+}
+
+func (g *GRPCServer) Stats(ctx context.Context, req *pb.StatsRequest) (*pb.StatsResponse, error) {
+	st := g.store.Stats()
+	if req.Namespace != "" {
+		st = g.ns(ctx, req.Namespace).Stats()
+	}
+	return &pb.StatsResponse{
+		Keys:            int64(st.Keys),
+		LiveKeys:        int64(st.LiveKeys),
+		KeysWithTtl:     int64(st.KeysWithTTL),
+		Bytes:           st.Bytes,
+		Hits:            st.Hits,
+		Misses:          st.Misses,
+		Sets:            st.Sets,
+		Deletes:         st.Deletes,
+		Evictions:       st.Evictions,
+		Expirations:     st.Expirations,
+		ExpiredBySweep:  st.ExpiredBySweep,
+		ExpiredOnAccess: st.ExpiredOnAccess,
+		UptimeSeconds:   int64(st.Uptime / time.Second),
+	}, nil
+}
+
+func (g *GRPCServer) DeleteNamespace(ctx context.Context, req *pb.DeleteNamespaceRequest) (*pb.DeleteNamespaceResponse, error) {
+	n, err := g.store.DeleteNamespace(req.Namespace)
+	if errors.Is(err, store.ErrDefaultNamespace) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		return nil, writeStatus(err)
+	}
+	return &pb.DeleteNamespaceResponse{Deleted: int64(n)}, nil
+}
+
+var eventTypes = map[store.EventType]pb.EventType{
+	store.EventSet:    pb.EventType_EVENT_TYPE_SET,
+	store.EventDelete: pb.EventType_EVENT_TYPE_DELETE,
+	store.EventExpire: pb.EventType_EVENT_TYPE_EXPIRE,
+}
+
+// Scan streams the matching keys a batch at a time, walking the store with
+// Namespace.ScanFunc so no shard is locked for longer than one batch.
+func (g *GRPCServer) Scan(req *pb.ScanRequest, stream pb.KVStore_ScanServer) error {
+	if req.BatchSize < 0 {
+		return status.Error(codes.InvalidArgument, "batch_size must not be negative")
+	}
+	ns := g.ns(stream.Context(), req.Namespace)
+	keep := keyFilter(req.Prefix, req.Pattern)
+	var cursor string
+	for {
+		keys, next, err := ns.ScanFunc(cursor, int(req.BatchSize), keep)
+		if err != nil {
+			return writeStatus(err)
+		}
+		if len(keys) > 0 {
+			if err := stream.Send(&pb.ScanResponse{Keys: keys}); err != nil {
+				return err
+			}
+		}
+		if next == "" {
+			return nil
+		}
+		cursor = next
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-g.done:
+			return status.Error(codes.Unavailable, "server shutting down")
+		default:
+		}
+	}
+}
+
+// Watch streams changes to keys matching the requested prefix until the client
+// goes away. If the client falls too far behind, the store disconnects it and
+// the stream ends with Aborted; the client should re-read state and watch again.
+func (g *GRPCServer) Watch(req *pb.WatchRequest, stream pb.KVStore_WatchServer) error {
+	events, cancel := g.ns(stream.Context(), req.Namespace).Subscribe(req.Prefix)
+	defer cancel()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return status.Error(codes.Aborted, "watch closed: subscriber fell behind or store stopped")
+			}
+			out := &pb.WatchEvent{Type: eventTypes[ev.Type], Key: ev.Key, Value: []byte(ev.Value)}
+			if !ev.ExpiresAt.IsZero() {
+				out.ExpiresAtUnixMs = ev.ExpiresAt.UnixMilli()
+			}
+			if err := stream.Send(out); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		case <-g.done:
+			return status.Error(codes.Unavailable, "server shutting down")
+		}
+	}
+}
+
+// Replicate streams the whole store, and then every change to it, to a
+// follower started with -replicaof.
+func (g *GRPCServer) Replicate(req *pb.ReplicateRequest, stream pb.KVStore_ReplicateServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+	go func() {
+		select {
+		case <-g.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err := g.store.Replicate(ctx, func(record []byte) error {
+		return stream.Send(&pb.ReplicationRecord{Record: record})
+	})
+	switch {
+	case errors.Is(err, store.ErrReplicaBehind):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, store.ErrStopped):
+		return status.Error(codes.Unavailable, err.Error())
+	case stream.Context().Err() != nil:
+		return nil
+	case ctx.Err() != nil:
+		return status.Error(codes.Unavailable, "server shutting down")
+	}
+	return err
+}
+
+// Dump streams every live entry in every namespace, a shard at a time, so
+// the server never holds more than one shard's worth of entries for it.
+func (g *GRPCServer) Dump(req *pb.DumpRequest, stream pb.KVStore_DumpServer) error {
+	err := g.store.ExportEach(stream.Context(), func(rec store.Record) error {
+		select {
+		case <-g.done:
+			return status.Error(codes.Unavailable, "server shutting down")
+		default:
+		}
+		return stream.Send(dumpEntry(rec))
+	})
+	if err := stream.Context().Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	return err
+}
+
+func dumpEntry(rec store.Record) *pb.DumpEntry {
+	e := &pb.DumpEntry{Namespace: rec.Namespace, Key: rec.Key, Value: []byte(rec.Value), Type: rec.Type, List: rec.List, Hash: rec.Hash, Tags: rec.Tags}
+	if !rec.ExpiresAt.IsZero() {
+		e.ExpiresAtUnixMs = rec.ExpiresAt.UnixMilli()
+	}
+	return e
+}
+
+// Restore loads a stream of entries written by Dump. The mode is taken from
+// the first message: RESTORE_MERGE leaves keys that already hold a live
+// value alone, RESTORE_MERGE_OVERWRITE replaces them, and RESTORE_REPLACE
+// flushes the store before loading anything. Entries are written one at a
+// time as they arrive, so a restore that fails part way, or a replace seen
+// by other clients, is not atomic; the error says how far it got.
+func (g *GRPCServer) Restore(stream pb.KVStore_RestoreServer) error {
+	var sum pb.RestoreSummary
+	var overwrite bool
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(&sum)
+		}
+		if err != nil {
+			return err
+		}
+		if sum.Received == 0 {
+			switch req.Mode {
+			case pb.RestoreMode_RESTORE_REPLACE:
+				if _, err := g.store.Flush(stream.Context(), false); err != nil {
+					return writeStatus(err)
+				}
+				overwrite = true
+			case pb.RestoreMode_RESTORE_MERGE_OVERWRITE:
+				overwrite = true
+			}
+		}
+		sum.Received++
+		switch {
+		case req.Entry == nil:
+			return status.Errorf(codes.InvalidArgument, "after %d imported: entry %d is missing", sum.Imported, sum.Received)
+		case !slices.Contains([]string{"", "string", "list", "hash"}, req.Entry.Type):
+			return status.Errorf(codes.InvalidArgument, "after %d imported: entry %d has unknown type %q", sum.Imported, sum.Received, req.Entry.Type)
+		}
+		written, err := g.store.ImportRecord(restoreRecord(req.Entry), overwrite)
+		if err != nil {
+			return status.Errorf(status.Code(writeStatus(err)), "after %d imported: %v", sum.Imported, err)
+		}
+		if written {
+			sum.Imported++
+		} else {
+			sum.Skipped++
+		}
+	}
+}
+
+func restoreRecord(e *pb.DumpEntry) store.Record {
+	rec := store.Record{Namespace: e.Namespace, Key: e.Key, Type: e.Type, Value: string(e.Value), List: e.List, Hash: e.Hash, Tags: e.Tags}
+	if e.ExpiresAtUnixMs != 0 {
+		rec.ExpiresAt = time.UnixMilli(e.ExpiresAtUnixMs)
+	}
+	return rec
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"stashr/pb"
+)
+
+// reflectionPrefix is the method prefix of the gRPC reflection service.
+const reflectionPrefix = "/grpc.reflection."
+
+// adminMethods are the RPCs that, like their HTTP counterparts, take the
+// admin token rather than the auth token.
+var adminMethods = map[string]bool{
+	pb.KVStore_Flush_FullMethodName:   true,
+	pb.KVStore_Dump_FullMethodName:    true,
+	pb.KVStore_Restore_FullMethodName: true,
+}
+
+// AuthUnaryInterceptor rejects unary calls whose "authorization" metadata is
+// not "Bearer <token>" with codes.Unauthenticated. It is a no-op when token is
+// empty. If skipReflection is true, the reflection service stays open so tools
+// like grpcurl can still list services.
+//
+// Flush, Dump and Restore take adminToken instead of token, as on HTTP: they
+// fail with codes.PermissionDenied when no admin token is configured or the
+// caller is authenticated only with token.
+func AuthUnaryInterceptor(token, adminToken string, skipReflection bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := checkToken(ctx, info.FullMethod, token, adminToken, skipReflection); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamInterceptor is the streaming counterpart of AuthUnaryInterceptor,
+// covering Watch, Dump, Restore and the reflection service itself.
+func AuthStreamInterceptor(token, adminToken string, skipReflection bool) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := checkToken(ss.Context(), info.FullMethod, token, adminToken, skipReflection); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func checkToken(ctx context.Context, method, token, adminToken string, skipReflection bool) error {
+	if adminMethods[method] {
+		return checkAdmin(ctx, token, adminToken)
+	}
+	if token == "" || (skipReflection && strings.HasPrefix(method, reflectionPrefix)) {
+		return nil
+	}
+	if !hasBearer(ctx, token) {
+		return status.Error(codes.Unauthenticated, "missing or invalid token")
+	}
+	return nil
+}
+
+// checkAdmin lets a call through only with the admin token. A caller that
+// would otherwise be allowed in gets PermissionDenied rather than
+// Unauthenticated, so it can tell a missing privilege from a bad token.
+func checkAdmin(ctx context.Context, token, adminToken string) error {
+	if adminToken != "" && hasBearer(ctx, adminToken) {
+		return nil
+	}
+	if token != "" && !hasBearer(ctx, token) {
+		return status.Error(codes.Unauthenticated, "missing or invalid token")
+	}
+	if adminToken == "" {
+		return status.Error(codes.PermissionDenied, "admin calls are disabled without an admin token")
+	}
+	return status.Error(codes.PermissionDenied, "admin token required")
+}
+
+// hasBearer reports whether the "authorization" metadata in ctx carries
+// "Bearer <token>". The comparison is constant-time.
+func hasBearer(ctx context.Context, token string) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		got, ok := strings.CutPrefix(v, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthUnaryInterceptor(t *testing.T) {
+	ok := func(context.Context, any) (any, error) { return "ok", nil }
+	getInfo := &grpc.UnaryServerInfo{FullMethod: "/stashr.KVStore/Get"}
+	reflInfo := &grpc.UnaryServerInfo{FullMethod: "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo"}
+	withAuth := func(v string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", v))
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		skipReflection bool
+		ctx            context.Context
+		info           *grpc.UnaryServerInfo
+		want           codes.Code
+	}{
+		{"no token configured", "", false, context.Background(), getInfo, codes.OK},
+		{"missing metadata", "secret", false, context.Background(), getInfo, codes.Unauthenticated},
+		{"wrong token", "secret", false, withAuth("Bearer nope"), getInfo, codes.Unauthenticated},
+		{"no scheme", "secret", false, withAuth("secret"), getInfo, codes.Unauthenticated},
+		{"wrong scheme", "secret", false, withAuth("Basic secret"), getInfo, codes.Unauthenticated},
+		{"empty bearer", "secret", false, withAuth("Bearer "), getInfo, codes.Unauthenticated},
+		{"token prefix", "secret", false, withAuth("Bearer secre"), getInfo, codes.Unauthenticated},
+		{"correct token", "secret", false, withAuth("Bearer secret"), getInfo, codes.OK},
+		{"reflection guarded", "secret", false, context.Background(), reflInfo, codes.Unauthenticated},
+		{"reflection skipped", "secret", true, context.Background(), reflInfo, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := AuthUnaryInterceptor(tt.token, "", tt.skipReflection)(tt.ctx, nil, tt.info, ok)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// fakeStream is a grpc.ServerStream that only carries a context.
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s fakeStream) Context() context.Context { return s.ctx }
+
+func TestAuthStreamInterceptor(t *testing.T) {
+	ok := func(any, grpc.ServerStream) error { return nil }
+	info := &grpc.StreamServerInfo{FullMethod: "/stashr.KVStore/Watch"}
+	intercept := AuthStreamInterceptor("secret", "", false)
+
+	tests := []struct {
+		name string
+		md   metadata.MD
+		want codes.Code
+	}{
+		{"missing metadata", nil, codes.Unauthenticated},
+		{"malformed", metadata.Pairs("authorization", "secret"), codes.Unauthenticated},
+		{"wrong token", metadata.Pairs("authorization", "Bearer nope"), codes.Unauthenticated},
+		{"correct token", metadata.Pairs("authorization", "Bearer secret"), codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.md != nil {
+				ctx = metadata.NewIncomingContext(ctx, tt.md)
+			}
+			err := intercept(nil, fakeStream{ctx: ctx}, info, ok)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestAuthAdminMethods(t *testing.T) {
+	unary := func(context.Context, any) (any, error) { return "ok", nil }
+	stream := func(any, grpc.ServerStream) error { return nil }
+	withAuth := func(v string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", v))
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		adminToken string
+		ctx        context.Context
+		want       codes.Code
+	}{
+		{"admin token", "user", "admin", withAuth("Bearer admin"), codes.OK},
+		{"admin token alone", "", "admin", withAuth("Bearer admin"), codes.OK},
+		{"auth token", "user", "admin", withAuth("Bearer user"), codes.PermissionDenied},
+		{"no auth configured", "", "admin", context.Background(), codes.PermissionDenied},
+		{"wrong token", "user", "admin", withAuth("Bearer nope"), codes.Unauthenticated},
+		{"missing metadata", "user", "admin", context.Background(), codes.Unauthenticated},
+		{"no admin token configured", "user", "", withAuth("Bearer user"), codes.PermissionDenied},
+		{"no tokens configured", "", "", context.Background(), codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := &grpc.UnaryServerInfo{FullMethod: "/stashr.KVStore/Flush"}
+			_, err := AuthUnaryInterceptor(tt.token, tt.adminToken, false)(tt.ctx, nil, info, unary)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("Flush: expected %v, got %v", tt.want, got)
+			}
+			for _, method := range []string{"/stashr.KVStore/Dump", "/stashr.KVStore/Restore"} {
+				info := &grpc.StreamServerInfo{FullMethod: method}
+				err := AuthStreamInterceptor(tt.token, tt.adminToken, false)(nil, fakeStream{ctx: tt.ctx}, info, stream)
+				if got := status.Code(err); got != tt.want {
+					t.Fatalf("%s: expected %v, got %v", method, tt.want, got)
+				}
+			}
+		})
+	}
+
+	// The admin token does not stand in for the auth token elsewhere.
+	info := &grpc.UnaryServerInfo{FullMethod: "/stashr.KVStore/Get"}
+	_, err := AuthUnaryInterceptor("user", "admin", false)(withAuth("Bearer admin"), nil, info, unary)
+	if got := status.Code(err); got != codes.Unauthenticated {
+		t.Fatalf("expected Get with the admin token to be Unauthenticated, got %v", got)
+	}
+}
@@ -0,0 +1,495 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"stashr/pb"
+	"stashr/store"
+)
+
+// dialBufconn serves s over an in-memory gRPC connection and returns a client
+// for it. Both are torn down when the test ends.
+func dialBufconn(t *testing.T, s *store.Store) pb.KVStoreClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterKVStoreServer(srv, NewGRPCServer(s))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewKVStoreClient(conn)
+}
+
+func TestGRPCScan(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	client := dialBufconn(t, s)
+
+	ns := s.Namespace("app")
+	for i := 0; i < 40; i++ {
+		ns.Set(fmt.Sprintf("user:%02d", i), "v", 0)
+	}
+	ns.Set("order:1", "v", 0)
+	s.Set("user:default", "v", 0)
+
+	stream, err := client.Scan(context.Background(), &pb.ScanRequest{Namespace: "app", Prefix: "user:", BatchSize: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	batches := 0
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Keys) > 15 {
+			t.Fatalf("batch of %d keys exceeds batch_size", len(resp.Keys))
+		}
+		for _, k := range resp.Keys {
+			seen[k] = true
+		}
+		batches++
+	}
+	if len(seen) != 40 {
+		t.Fatalf("expected the 40 namespaced user keys, got %d: %v", len(seen), seen)
+	}
+	if batches < 3 {
+		t.Fatalf("expected at least 3 batches, got %d", batches)
+	}
+}
+
+func TestGRPCListPage(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	client := dialBufconn(t, s)
+	ctx := context.Background()
+
+	for _, k := range []string{"c", "a", "e", "b", "d"} {
+		s.Set(k, "v", 0)
+	}
+	var keys []string
+	req := &pb.ListRequest{Limit: 2}
+	for {
+		resp, err := client.List(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, resp.Keys...)
+		if resp.NextCursor == "" {
+			break
+		}
+		req.Cursor = resp.NextCursor
+	}
+	if strings.Join(keys, ",") != "a,b,c,d,e" {
+		t.Fatalf("expected the keys in order, got %v", keys)
+	}
+
+	if _, err := client.List(ctx, &pb.ListRequest{Cursor: "bogus!"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for a bad cursor, got %v", err)
+	}
+}
+
+func TestGRPCBatchSetAndGet(t *testing.T) {
+	s := store.New(store.WithMaxKeyBytes(32))
+	defer s.Stop()
+	client := dialBufconn(t, s)
+	ctx := context.Background()
+
+	s.Set("key-0", "existing", 0)
+	stream, err := client.BatchSet(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 300; i++ {
+		req := &pb.SetRequest{Key: fmt.Sprintf("key-%d", i), Value: []byte(fmt.Sprint(i)), Nx: i == 0}
+		if err := stream.Send(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.Send(&pb.SetRequest{Key: strings.Repeat("x", 33)}); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum.Received != 301 || sum.Written != 299 || sum.Failed != 1 {
+		t.Fatalf("expected 301 received, 299 written and 1 failed, got %+v", sum)
+	}
+	if s.Len() != 300 {
+		t.Fatalf("expected 300 keys, got %d", s.Len())
+	}
+
+	resp, err := client.BatchGet(ctx, &pb.BatchGetRequest{Keys: []string{"key-7", "missing", "key-0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		value string
+		found bool
+	}{{"7", true}, {"", false}, {"existing", true}}
+	for i, r := range resp.Results {
+		if string(r.Value) != want[i].value || r.Found != want[i].found {
+			t.Errorf("result %d: expected %+v, got %q %v", i, want[i], r.Value, r.Found)
+		}
+	}
+}
+
+func TestGRPCSetCompareAndSwap(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	client := dialBufconn(t, s)
+	ctx := context.Background()
+
+	cas := func(key, expected, value string) *pb.SetResponse {
+		t.Helper()
+		resp, err := client.Set(ctx, &pb.SetRequest{Key: key, Value: []byte(value), ExpectedValue: []byte(expected), HasExpected: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	if resp := cas("k", "", "v"); resp.Swapped || resp.Written {
+		t.Fatalf("expected no swap on a missing key, got %+v", resp)
+	}
+	s.Set("k", "1", 0)
+	if resp := cas("k", "0", "2"); resp.Swapped {
+		t.Fatal("expected no swap with a stale expected value")
+	}
+	if resp := cas("k", "1", "2"); !resp.Swapped || !resp.Written {
+		t.Fatalf("expected a swap, got %+v", resp)
+	}
+	if v, _ := s.Get("k"); v != "2" {
+		t.Fatalf("expected 2, got %q", v)
+	}
+
+	_, err := client.Set(ctx, &pb.SetRequest{Key: "k", Nx: true, HasExpected: true})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for nx with has_expected, got %v", err)
+	}
+}
+
+func TestGRPCSetIfVersion(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	client := dialBufconn(t, s)
+	ctx := context.Background()
+
+	setIf := func(version uint64, value string) *pb.SetResponse {
+		t.Helper()
+		resp, err := client.Set(ctx, &pb.SetRequest{Key: "k", Value: []byte(value), IfVersion: &version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	created := setIf(0, "a")
+	if !created.Written || created.Version == 0 {
+		t.Fatalf("expected version 0 to create the key, got %+v", created)
+	}
+	got, err := client.Get(ctx, &pb.GetRequest{Key: "k"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != created.Version {
+		t.Fatalf("expected Get to report version %d, got %d", created.Version, got.Version)
+	}
+	if resp := setIf(0, "b"); resp.Written || resp.Version != created.Version {
+		t.Fatalf("expected a stale version to fail and report the current one, got %+v", resp)
+	}
+	if resp := setIf(created.Version, "b"); !resp.Written || resp.Version <= created.Version {
+		t.Fatalf("expected a matching version to write, got %+v", resp)
+	}
+
+	version := got.Version
+	_, err = client.Set(ctx, &pb.SetRequest{Key: "k", Nx: true, IfVersion: &version})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for nx with if_version, got %v", err)
+	}
+}
+
+func TestGRPCSetTags(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	client := dialBufconn(t, s)
+	ctx := context.Background()
+
+	tags := map[string]string{"tenant": "acme"}
+	if _, err := client.Set(ctx, &pb.SetRequest{Key: "k", Value: []byte("v"), Namespace: "app", Tags: tags}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Namespace("app").ListByTag("tenant", "acme"); !slices.Equal(got, []string{"k"}) {
+		t.Fatalf("expected k tagged tenant=acme, got %v", got)
+	}
+	_, err := client.Set(ctx, &pb.SetRequest{Key: "k", Value: []byte("v"), Nx: true, Tags: tags})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for nx with tags, got %v", err)
+	}
+}
+
+func TestGRPCDeletePrefix(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	client := dialBufconn(t, s)
+	ctx := context.Background()
+
+	for _, k := range []string{"job:12:a", "job:12:b", "job:123:a"} {
+		s.Set(k, "v", 0)
+	}
+	resp, err := client.DeletePrefix(ctx, &pb.DeletePrefixRequest{Prefix: "job:12:"})
+	if err != nil || resp.Deleted != 2 {
+		t.Fatalf("expected 2 keys deleted, got %v, %v", resp, err)
+	}
+	if !s.Exists("job:123:a") {
+		t.Fatal("expected job:123:a to survive deleting job:12:")
+	}
+	if _, err := client.DeletePrefix(ctx, &pb.DeletePrefixRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for an empty prefix, got %v", err)
+	}
+}
+
+func TestGRPCCanceledContext(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("job:1", "v", 0)
+	g := NewGRPCServer(s)
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+
+	if _, err := g.DeletePrefix(ctx, &pb.DeletePrefixRequest{Prefix: "job:"}); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	if _, err := g.List(ctx, &pb.ListRequest{Limit: 10}); status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	if !s.Exists("job:1") {
+		t.Fatal("expected the key to survive a delete past its deadline")
+	}
+}
+
+func TestGRPCHistory(t *testing.T) {
+	s := store.New(store.WithHistory(10))
+	defer s.Stop()
+	client := dialBufconn(t, s)
+	ctx := context.Background()
+
+	client.Set(ctx, &pb.SetRequest{Key: "k", Value: []byte("v"), Namespace: "app"})
+	client.Delete(ctx, &pb.DeleteRequest{Key: "k", Namespace: "app"})
+	s.Set("other", "v", 0)
+
+	resp, err := client.History(ctx, &pb.HistoryRequest{Key: "k", Namespace: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Mutations) != 2 || resp.Mutations[0].Type != pb.EventType_EVENT_TYPE_DELETE || resp.Mutations[1].Size != 1 {
+		t.Fatalf("expected a set then a delete, got %v", resp.Mutations)
+	}
+	if !strings.HasPrefix(resp.Mutations[0].Source, "grpc ") {
+		t.Fatalf("expected the peer as the source, got %q", resp.Mutations[0].Source)
+	}
+
+	resp, err = client.History(ctx, &pb.HistoryRequest{Namespace: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Mutations) != 2 || resp.Mutations[0].Key != "k" {
+		t.Fatalf("expected only the namespace's mutations without a key, got %v", resp.Mutations)
+	}
+}
+
+func TestGRPCStoppedStore(t *testing.T) {
+	s := store.New()
+	client := dialBufconn(t, s)
+	s.Stop()
+
+	_, err := client.Set(context.Background(), &pb.SetRequest{Key: "k", Value: []byte("v")})
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable, got %v", err)
+	}
+}
+
+func TestGRPCReadOnly(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	client := dialBufconn(t, s)
+	s.SetReadOnly(true)
+
+	_, err := client.Set(context.Background(), &pb.SetRequest{Key: "k", Value: []byte("v")})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition, got %v", err)
+	}
+}
+
+func TestGRPCReservedKey(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	client := dialBufconn(t, s)
+	s.Namespace("tenantA").Set("secret", "mine", 0)
+
+	_, err := client.Set(context.Background(), &pb.SetRequest{Key: "\x007\x00tenantAsecret", Value: []byte("pwned")})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	if v, _ := s.Namespace("tenantA").Get("secret"); v != "mine" {
+		t.Fatalf("expected tenantA's key to be untouched, got %q", v)
+	}
+}
+
+func TestGRPCInfo(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	client := dialBufconn(t, s)
+	s.Namespace("ns").Set("k", "value", 0)
+
+	resp, err := client.Info(context.Background(), &pb.InfoRequest{Key: "k", Namespace: "ns"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Found || resp.Size != 5 || resp.HasTtl || resp.CreatedAtUnixMs == 0 || resp.UpdatedAtUnixMs < resp.CreatedAtUnixMs {
+		t.Fatalf("unexpected info %+v", resp)
+	}
+	if resp, _ := client.Info(context.Background(), &pb.InfoRequest{Key: "k"}); resp.Found {
+		t.Fatal("expected the key not to be found outside its namespace")
+	}
+}
+
+func TestGRPCListsAndHashes(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	client := dialBufconn(t, s)
+	ctx := context.Background()
+
+	if _, err := client.RPush(ctx, &pb.PushRequest{Key: "l", Values: []string{"b", "c"}, Namespace: "app"}); err != nil {
+		t.Fatal(err)
+	}
+	if resp, _ := client.LPush(ctx, &pb.PushRequest{Key: "l", Values: []string{"a"}, Namespace: "app"}); resp.GetLength() != 3 {
+		t.Fatalf("expected length 3, got %d", resp.GetLength())
+	}
+	rng, err := client.LRange(ctx, &pb.LRangeRequest{Key: "l", Start: 0, Stop: -1, Namespace: "app"})
+	if err != nil || !slices.Equal(rng.Values, []string{"a", "b", "c"}) {
+		t.Fatalf("unexpected range %v, %v", rng.GetValues(), err)
+	}
+
+	client.HSet(ctx, &pb.HSetRequest{Key: "h", Field: "f", Value: "v"})
+	if resp, _ := client.HGet(ctx, &pb.HGetRequest{Key: "h", Field: "f"}); !resp.GetFound() || resp.GetValue() != "v" {
+		t.Fatalf("unexpected field %v", resp)
+	}
+	if resp, _ := client.HDel(ctx, &pb.HDelRequest{Key: "h", Fields: []string{"f", "g"}}); resp.GetDeleted() != 1 {
+		t.Fatalf("expected 1 field deleted, got %d", resp.GetDeleted())
+	}
+
+	s.Set("str", "v", 0)
+	if _, err := client.LLen(ctx, &pb.LLenRequest{Key: "str"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FAILED_PRECONDITION for a string, got %v", err)
+	}
+}
+
+func TestGRPCDumpRestore(t *testing.T) {
+	src := store.New()
+	defer src.Stop()
+	src.Set("s", "v", time.Hour)
+	src.SetBytes("bin", []byte{0xff, 0x00}, 0)
+	src.Namespace("app").RPush("l", "a", "b")
+	ctx := context.Background()
+
+	dump, err := dialBufconn(t, src).Dump(ctx, &pb.DumpRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []*pb.DumpEntry
+	for {
+		e, err := dump.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	dst := store.New()
+	defer dst.Stop()
+	dst.Set("s", "kept", 0)
+	dst.Set("extra", "v", 0)
+	client := dialBufconn(t, dst)
+	restore := func(mode pb.RestoreMode) *pb.RestoreSummary {
+		t.Helper()
+		stream, err := client.Restore(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, e := range entries {
+			req := &pb.RestoreRequest{Entry: e}
+			if i == 0 {
+				req.Mode = mode
+			}
+			if err := stream.Send(req); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sum, err := stream.CloseAndRecv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+
+	if sum := restore(pb.RestoreMode_RESTORE_MERGE); sum.Received != 3 || sum.Imported != 2 || sum.Skipped != 1 {
+		t.Fatalf("unexpected merge summary %v", sum)
+	}
+	if v, _ := dst.Get("s"); v != "kept" || !dst.Exists("extra") {
+		t.Fatal("expected a merge to keep existing keys")
+	}
+	if v, _ := dst.GetBytes("bin"); !slices.Equal(v, []byte{0xff, 0x00}) {
+		t.Fatalf("expected binary values to survive, got %v", v)
+	}
+	if got, _ := dst.Namespace("app").LRange("l", 0, -1); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("unexpected list %v", got)
+	}
+
+	if sum := restore(pb.RestoreMode_RESTORE_REPLACE); sum.Imported != 3 {
+		t.Fatalf("unexpected replace summary %v", sum)
+	}
+	if v, _ := dst.Get("s"); v != "v" || dst.Exists("extra") {
+		t.Fatal("expected a replace to leave only the dumped keys")
+	}
+	if ttl, ok, _ := dst.TTL("s"); !ok || ttl <= 59*time.Minute {
+		t.Fatalf("expected the expiry to be restored, got %v", ttl)
+	}
+
+	stream, _ := client.Restore(ctx)
+	stream.Send(&pb.RestoreRequest{Entry: &pb.DumpEntry{Key: "k", Type: "set"}})
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected an unknown type to be rejected, got %v", err)
+	}
+}
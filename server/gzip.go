@@ -0,0 +1,154 @@
+package server
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// SetCompression gzips response bodies of at least minBytes for clients that
+// send Accept-Encoding: gzip. Zero, the default, disables compression. Raw
+// application/octet-stream values are often compressed already (images,
+// archives), so they are sent as they are unless compressBinary is set.
+func (h *HTTPServer) SetCompression(minBytes int, compressBinary bool) {
+	h.gzipMinBytes = minBytes
+	h.gzipBinary = compressBinary
+}
+
+// compress applies the SetCompression settings to every response.
+func (h *HTTPServer) compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.gzipMinBytes <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		if !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w, h: h}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// acceptsGzip reports whether r's Accept-Encoding allows gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if strings.TrimSpace(name) == "gzip" && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipWriter holds back the status and the start of the body until it has
+// seen minBytes of it, the handler flushes, or the handler returns, and only
+// then decides whether to compress. Small and empty responses, such as the 204
+// from a set, therefore go out unchanged.
+type gzipWriter struct {
+	http.ResponseWriter
+	h       *HTTPServer
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+		if len(w.buf) < w.h.gzipMinBytes {
+			return len(b), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// decide sends the status, compressing what follows if the response is big
+// enough and of a kind worth compressing, and writes out the buffered body.
+func (w *gzipWriter) decide() error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if len(w.buf) >= w.h.gzipMinBytes && w.compressible() {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Del("Content-Length")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if len(w.buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(w.buf)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buf)
+	}
+	w.buf = nil
+	return err
+}
+
+// compressible reports whether the response may be gzipped: it has a body,
+// is not encoded already, and is not a stream or, unless configured, a raw
+// binary value.
+func (w *gzipWriter) compressible() bool {
+	if w.status == http.StatusNoContent || w.status == http.StatusNotModified || w.Header().Get("Content-Encoding") != "" {
+		return false
+	}
+	mt, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	switch mt {
+	case "text/event-stream":
+		return false
+	case octetStream:
+		return w.h.gzipBinary
+	}
+	return true
+}
+
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close sends anything still held back and ends the gzip stream.
+func (w *gzipWriter) close() {
+	if !w.decided && w.status != 0 {
+		w.decide()
+	}
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"stashr/store"
+)
+
+func TestCompression(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	big := strings.Repeat("compressible ", 200)
+	s.Set("big", big, 0)
+	s.Set("small", "v", 0)
+	h := NewHTTPServer(s)
+	h.SetCompression(1024, false)
+	handler := h.Handler()
+
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/keys/big", "")
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("expected a large JSON response to be gzipped")
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), big) {
+		t.Fatalf("expected the decompressed body to hold the value, got %.40q", body)
+	}
+
+	if rec := get("/keys/small", ""); rec.Header().Get("Content-Encoding") != "" {
+		t.Fatal("expected a response under the threshold to be sent as is")
+	}
+	if rec := get("/keys/big", octetStream); rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != big {
+		t.Fatal("expected a raw binary value to be sent as is")
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(`{"value":"`+big+`"}`))
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated || rec.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected a plain 201 from a set, got %d %q", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/keys/big", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Fatal("expected no compression without Accept-Encoding: gzip")
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for header, want := range map[string]bool{
+		"":                   false,
+		"gzip":               true,
+		"deflate, gzip;q=.5": true,
+		"gzip;q=0":           false,
+		"br":                 false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", header)
+		if got := acceptsGzip(req); got != want {
+			t.Errorf("acceptsGzip(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
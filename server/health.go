@@ -0,0 +1,40 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// SetReady marks the server as ready (or not) to take traffic. /readyz
+// reports 503 until main calls SetReady(true) once startup, such as loading
+// persisted data, has finished.
+func (h *HTTPServer) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+type healthResponse struct {
+	Status        string `json:"status"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+	Keys          int    `json:"keys"`
+}
+
+// handleHealth is a liveness check. It reads only the store's key counter, so
+// it is cheap and does not show up in the operation metrics.
+func (h *HTTPServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(healthResponse{
+		Status:        "ok",
+		UptimeSeconds: int64(time.Since(h.started) / time.Second),
+		Keys:          h.store.Len(),
+	})
+}
+
+func (h *HTTPServer) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !h.ready.Load() {
+		http.Error(w, `{"status":"starting"}`, http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+}
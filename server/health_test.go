@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"stashr/store"
+)
+
+func TestReadyz(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	ready := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec
+	}
+
+	if rec := ready(); rec.Code != http.StatusServiceUnavailable || strings.TrimSpace(rec.Body.String()) != `{"status":"starting"}` {
+		t.Fatalf("expected 503 before the store is ready, got %d %s", rec.Code, rec.Body)
+	}
+	h.SetReady(true)
+	if rec := ready(); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"status":"ready"}` {
+		t.Fatalf("expected 200 once ready, got %d %s", rec.Code, rec.Body)
+	}
+	h.SetReady(false)
+	if rec := ready(); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 after SetReady(false), got %d", rec.Code)
+	}
+}
@@ -1,8 +1,21 @@
 package server
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"stashr/store"
@@ -11,42 +24,683 @@ import (
 type HTTPServer struct {
 	store *store.Store
 	mux   *http.ServeMux
+
+	adminToken   string
+	authToken    string
+	publicProbes bool
+
+	started time.Time
+	ready   atomic.Bool
+	logger  *slog.Logger
+
+	accessLog    bool
+	trustProxy   bool
+	maxBodyBytes int64
+	gzipMinBytes int
+	gzipBinary   bool
+	limiter      *RateLimiter
+	tracer       *Tracer
+	corsOrigins  []string
+	keepalive    time.Duration // between comment lines on idle watch streams
+
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 func NewHTTPServer(s *store.Store) *HTTPServer {
-	h := &HTTPServer{store: s, mux: http.NewServeMux()}
+	h := &HTTPServer{store: s, mux: http.NewServeMux(), started: time.Now(), logger: slog.Default(), keepalive: sseKeepalive, done: make(chan struct{})}
+	h.mux.HandleFunc("GET /keys", h.handleList)
+	h.mux.HandleFunc("DELETE /keys", h.handleDeleteKeys)
 	h.mux.HandleFunc("GET /keys/{key}", h.handleGet)
+	h.mux.HandleFunc("HEAD /keys/{key}", h.handleHead)
 	h.mux.HandleFunc("PUT /keys/{key}", h.handleSet)
 	h.mux.HandleFunc("DELETE /keys/{key}", h.handleDelete)
+	h.mux.HandleFunc("PATCH /keys/{key}", h.handleExpire)
+	h.mux.HandleFunc("POST /keys/batch/get", h.handleBatchGet)
+	h.mux.HandleFunc("POST /keys/batch/set", h.handleBatchSet)
+	h.mux.HandleFunc("POST /keys/batch/delete", h.handleBatchDelete)
+	h.mux.HandleFunc("POST /keys/{key}/append", h.handleAppend)
+	h.mux.HandleFunc("POST /keys/{key}/touch", h.handleTouch)
+	h.mux.HandleFunc("POST /keys/{key}/copy", h.handleCopy)
+	h.mux.HandleFunc("GET /keys/{key}/info", h.handleInfo)
+	h.mux.HandleFunc("GET /keys/{key}/ttl", h.handleTTL)
+	h.mux.HandleFunc("GET /keys/{key}/history", h.handleHistory)
+	h.mux.HandleFunc("GET /lists/{key}", h.handleRange)
+	h.mux.HandleFunc("POST /lists/{key}", h.handlePush)
+	h.mux.HandleFunc("GET /lists/{key}/length", h.handleListLength)
+	h.mux.HandleFunc("GET /hashes/{key}", h.handleHashGetAll)
+	h.mux.HandleFunc("GET /hashes/{key}/{field}", h.handleHashGet)
+	h.mux.HandleFunc("PUT /hashes/{key}/{field}", h.handleHashSet)
+	h.mux.HandleFunc("DELETE /hashes/{key}/{field}", h.handleHashDelete)
+	h.mux.HandleFunc("POST /batch", h.handleBatch)
+	h.mux.HandleFunc("GET /watch", h.handleWatch)
+	h.mux.Handle("GET /metrics", metricsHandler(s))
+	h.mux.HandleFunc("GET /stats", h.handleStats)
+	h.mux.HandleFunc("GET /count", h.handleCount)
+	h.mux.HandleFunc("GET /random-key", h.handleRandomKey)
+	h.mux.HandleFunc("GET /healthz", h.handleHealth)
+	h.mux.HandleFunc("GET /readyz", h.handleReady)
+	h.mux.HandleFunc("POST /admin/expire-now/{key}", h.requireAdmin(h.handleExpireNow))
+	h.mux.HandleFunc("POST /admin/readonly", h.requireAdmin(h.handleReadOnly))
+	h.mux.HandleFunc("GET /admin/stats", h.requireAdmin(h.handleAdminStats))
+	h.mux.HandleFunc("POST /flush", h.requireAdmin(h.handleFlush))
+	h.mux.HandleFunc("GET /dump", h.requireAdmin(h.handleDump))
+	h.mux.HandleFunc("POST /restore", h.requireAdmin(h.handleRestore))
+
+	// The same key routes, scoped to a namespace.
+	h.mux.HandleFunc("GET /ns/{ns}/keys", h.handleList)
+	h.mux.HandleFunc("DELETE /ns/{ns}/keys", h.handleDeleteKeys)
+	h.mux.HandleFunc("GET /ns/{ns}/keys/{key}", h.handleGet)
+	h.mux.HandleFunc("HEAD /ns/{ns}/keys/{key}", h.handleHead)
+	h.mux.HandleFunc("PUT /ns/{ns}/keys/{key}", h.handleSet)
+	h.mux.HandleFunc("DELETE /ns/{ns}/keys/{key}", h.handleDelete)
+	h.mux.HandleFunc("PATCH /ns/{ns}/keys/{key}", h.handleExpire)
+	h.mux.HandleFunc("POST /ns/{ns}/keys/batch/get", h.handleBatchGet)
+	h.mux.HandleFunc("POST /ns/{ns}/keys/batch/set", h.handleBatchSet)
+	h.mux.HandleFunc("POST /ns/{ns}/keys/batch/delete", h.handleBatchDelete)
+	h.mux.HandleFunc("POST /ns/{ns}/keys/{key}/append", h.handleAppend)
+	h.mux.HandleFunc("POST /ns/{ns}/keys/{key}/touch", h.handleTouch)
+	h.mux.HandleFunc("POST /ns/{ns}/keys/{key}/copy", h.handleCopy)
+	h.mux.HandleFunc("GET /ns/{ns}/keys/{key}/info", h.handleInfo)
+	h.mux.HandleFunc("GET /ns/{ns}/keys/{key}/ttl", h.handleTTL)
+	h.mux.HandleFunc("GET /ns/{ns}/keys/{key}/history", h.handleHistory)
+	h.mux.HandleFunc("GET /ns/{ns}/lists/{key}", h.handleRange)
+	h.mux.HandleFunc("POST /ns/{ns}/lists/{key}", h.handlePush)
+	h.mux.HandleFunc("GET /ns/{ns}/lists/{key}/length", h.handleListLength)
+	h.mux.HandleFunc("GET /ns/{ns}/hashes/{key}", h.handleHashGetAll)
+	h.mux.HandleFunc("GET /ns/{ns}/hashes/{key}/{field}", h.handleHashGet)
+	h.mux.HandleFunc("PUT /ns/{ns}/hashes/{key}/{field}", h.handleHashSet)
+	h.mux.HandleFunc("DELETE /ns/{ns}/hashes/{key}/{field}", h.handleHashDelete)
+	h.mux.HandleFunc("GET /ns/{ns}/watch", h.handleWatch)
+	h.mux.HandleFunc("GET /ns/{ns}/stats", h.handleStats)
+	h.mux.HandleFunc("GET /ns/{ns}/count", h.handleCount)
+	h.mux.HandleFunc("GET /ns/{ns}/random-key", h.handleRandomKey)
+	h.mux.HandleFunc("DELETE /ns/{ns}", h.handleDeleteNamespace)
 	return h
 }
 
+// namespace returns the namespace named by r's {ns} path value, or the
+// default namespace for the unscoped routes, with writes recorded in the
+// history as coming from r's client.
+func (h *HTTPServer) namespace(r *http.Request) *store.Namespace {
+	return h.store.Namespace(r.PathValue("ns")).WithSource("http " + h.clientIP(r))
+}
+
 func (h *HTTPServer) Handler() http.Handler {
-	return h.mux
+	return h.trace(h.logAccess(h.logRequests(h.cors(h.rateLimit(h.compress(h.requireAuth(h.limitBody(h.mux))))))))
 }
 
+// handleList returns the live keys, sorted, with their count, optionally
+// filtered by ?prefix=, a glob ?pattern= or a ?tag=name:value. If several are
+// given the key must satisfy all of them. With ?detail=true it returns entries
+// with their size and TTL instead, and values up to ?max_value_bytes=, largest
+// first with ?sort=size. With ?cursor= or ?limit= it returns one sorted page
+// instead, along with the next_cursor to continue from.
+func (h *HTTPServer) handleList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	prefix, pattern := q.Get("prefix"), q.Get("pattern")
+
+	if q.Has("tag") {
+		name, value, ok := parseTag(q.Get("tag"))
+		if !ok {
+			http.Error(w, `{"error":"tag must be name:value"}`, http.StatusBadRequest)
+			return
+		}
+		if q.Has("cursor") || q.Has("limit") || q.Get("detail") == "true" {
+			http.Error(w, `{"error":"tag cannot be combined with cursor, limit or detail"}`, http.StatusBadRequest)
+			return
+		}
+		keys := []string{}
+		filter := keyFilter(prefix, pattern)
+		for _, k := range h.namespace(r).ListByTag(name, value) {
+			if filter == nil || filter(k) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keysResponse{Keys: keys, Count: len(keys)})
+		return
+	}
+
+	if q.Has("cursor") || q.Has("limit") {
+		limit, err := strconv.Atoi(q.Get("limit"))
+		if q.Get("limit") != "" && (err != nil || limit <= 0) {
+			http.Error(w, `{"error":"limit must be a positive integer"}`, http.StatusBadRequest)
+			return
+		}
+		keys, next, err := h.namespace(r).ListPageFunc(r.Context(), q.Get("cursor"), limit, keyFilter(prefix, pattern))
+		if errors.Is(err, store.ErrInvalidCursor) {
+			http.Error(w, `{"error":"invalid cursor"}`, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if keys == nil {
+			keys = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(scanResponse{Keys: keys, Count: len(keys), NextCursor: next})
+		return
+	}
+
+	if q.Get("detail") == "true" {
+		maxValue, _ := strconv.Atoi(q.Get("max_value_bytes"))
+		entries := h.namespace(r).ListEntries(store.ListOptions{Prefix: prefix, Pattern: pattern, MaxValueBytes: maxValue})
+		if q.Get("sort") == "size" {
+			// Stable, so equal sizes stay in key order.
+			slices.SortStableFunc(entries, func(a, b store.EntryInfo) int { return b.Size - a.Size })
+		}
+		out := make([]entryResponse, len(entries))
+		for i, e := range entries {
+			out[i] = entryResponse{Key: e.Key, Size: e.Size, TTLSecondsRemaining: ceilSeconds(e.TTL)}
+			if e.ValueIncluded {
+				out[i].Value = &entries[i].Value
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string][]entryResponse{"entries": out})
+		return
+	}
+
+	keys := listKeys(h.namespace(r), prefix, pattern)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keysResponse{Keys: keys, Count: len(keys)})
+}
+
+// listKeys returns the sorted live keys matching prefix and, if non-empty, the
+// glob pattern. It never returns nil, so an empty result encodes as [] rather
+// than null.
+func listKeys(ns *store.Namespace, prefix, pattern string) []string {
+	var keys []string
+	if pattern == "" {
+		keys = ns.ListPrefix(prefix)
+	} else {
+		for _, k := range ns.ListMatch(pattern) {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+	}
+	if keys == nil {
+		keys = []string{}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// handleRandomKey returns a random live key as {"key": ...}, or 404 if there
+// are none.
+func (h *HTTPServer) handleRandomKey(w http.ResponseWriter, r *http.Request) {
+	key, ok := h.namespace(r).RandomKey()
+	if !ok {
+		http.Error(w, `{"error":"no keys"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"key": key})
+}
+
+// flushesAll reports whether r is a DELETE /keys that flushes the whole
+// store: one with ?confirm=true and neither ?tag= nor ?prefix=.
+func flushesAll(r *http.Request) bool {
+	q := r.URL.Query()
+	return r.Method == http.MethodDelete && r.URL.Path == "/keys" &&
+		!q.Has("tag") && !q.Has("prefix") && q.Get("confirm") == "true"
+}
+
+// handleDeleteKeys deletes every key starting with ?prefix=, which must not be
+// empty, or every key with the ?tag=name:value. Without either it flushes
+// every key in every namespace instead, but only with ?confirm=true so a
+// stray DELETE cannot wipe the store; ?reset_stats=true then also zeroes the
+// cumulative counters.
+func (h *HTTPServer) handleDeleteKeys(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Has("tag") {
+		name, value, ok := parseTag(q.Get("tag"))
+		if !ok {
+			http.Error(w, `{"error":"tag must be name:value"}`, http.StatusBadRequest)
+			return
+		}
+		n, err := h.namespace(r).DeleteByTag(name, value)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"deleted": n})
+		return
+	}
+	if q.Has("prefix") {
+		n, err := h.namespace(r).DeletePrefix(r.Context(), q.Get("prefix"))
+		if errors.Is(err, store.ErrEmptyPrefix) {
+			http.Error(w, `{"error":"prefix must not be empty"}`, http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"deleted": n})
+		return
+	}
+	if r.PathValue("ns") != "" {
+		http.Error(w, `{"error":"prefix is required; use DELETE /ns/{ns} to drop the namespace"}`, http.StatusBadRequest)
+		return
+	}
+	if !flushesAll(r) {
+		http.Error(w, `{"error":"flushing every key requires ?confirm=true"}`, http.StatusBadRequest)
+		return
+	}
+	// Flushing the whole store is the same admin operation as POST /flush.
+	h.requireAdmin(h.handleFlush)(w, r)
+}
+
+// errInvalidTag rejects a ?tag= that is not of the form name:value.
+var errInvalidTag = errors.New("tag must be name:value")
+
+// parseTag splits a ?tag= parameter of the form name:value. The name must not
+// be empty; the value may be, and may itself contain colons.
+func parseTag(v string) (name, value string, ok bool) {
+	name, value, ok = strings.Cut(v, ":")
+	return name, value, ok && name != ""
+}
+
+// keyFilter returns a Scan filter for keys matching prefix and, if non-empty,
+// the glob pattern, or nil if neither is set.
+func keyFilter(prefix, pattern string) func(string) bool {
+	if prefix == "" && pattern == "" {
+		return nil
+	}
+	return func(k string) bool {
+		return strings.HasPrefix(k, prefix) && (pattern == "" || store.Match(pattern, k))
+	}
+}
+
+type keysResponse struct {
+	Keys  []string `json:"keys"`
+	Count int      `json:"count"` // len(Keys)
+}
+
+type scanResponse struct {
+	Keys       []string `json:"keys"`
+	Count      int      `json:"count"` // len(Keys), this page only
+	NextCursor string   `json:"next_cursor"`
+}
+
+type entryResponse struct {
+	Key                 string  `json:"key"`
+	Size                int     `json:"size"`
+	TTLSecondsRemaining int64   `json:"ttl_seconds_remaining,omitempty"`
+	Value               *string `json:"value,omitempty"`
+}
+
+type getResponse struct {
+	Value               string `json:"value"`
+	TTLSecondsRemaining int64  `json:"ttl_seconds_remaining,omitempty"`
+	Version             uint64 `json:"version"`
+}
+
+// octetStream is the media type for raw binary values. JSON strings cannot
+// carry arbitrary bytes, so binary values are sent and received as raw bodies
+// of this type instead.
+const octetStream = "application/octet-stream"
+
+// handleGet returns the value as JSON, or as the raw body if the client
+// accepts application/octet-stream, with any TTL in X-TTL-Seconds.
 func (h *HTTPServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Has("path") {
+		h.handleGetPath(w, r)
+		return
+	}
 	key := r.PathValue("key")
-	val, ok := h.store.Get(key)
+	ns := h.namespace(r)
+	val, info, ok := ns.GetWithInfo(key)
+	if !ok {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("ETag", etag(val))
+	w.Header().Set("X-Version", strconv.FormatUint(info.Version, 10))
+	if strings.Contains(r.Header.Get("Accept"), octetStream) {
+		w.Header().Set("Content-Type", octetStream)
+		if info.TTL > 0 {
+			w.Header().Set("X-TTL-Seconds", strconv.FormatInt(ceilSeconds(info.TTL), 10))
+		}
+		io.WriteString(w, val)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(getResponse{Value: val, TTLSecondsRemaining: ceilSeconds(info.TTL), Version: info.Version})
+}
+
+// handleGetPath returns one element of a JSON document value, selected by the
+// dotted ?path=, as {"value": <element>}.
+func (h *HTTPServer) handleGetPath(w http.ResponseWriter, r *http.Request) {
+	val, ok, err := h.namespace(r).GetJSONPath(r.PathValue("key"), r.URL.Query().Get("path"))
+	switch {
+	case !ok:
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	case errors.Is(err, store.ErrPathNotFound):
+		http.Error(w, `{"error":"path not found"}`, http.StatusNotFound)
+		return
+	case errors.Is(err, store.ErrNotJSON):
+		http.Error(w, `{"error":"value is not valid JSON"}`, http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]json.RawMessage{"value": json.RawMessage(val)})
+}
+
+// handleHead reports whether a live key exists without sending its value: 200
+// with any TTL in X-TTL-Seconds, or 404. It reads only the key's metadata, so
+// it is cheap even for large values.
+func (h *HTTPServer) handleHead(w http.ResponseWriter, r *http.Request) {
+	ttl, hasTTL, ok := h.namespace(r).TTL(r.PathValue("key"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if hasTTL {
+		w.Header().Set("X-TTL-Seconds", strconv.FormatInt(ceilSeconds(ttl), 10))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleTTL returns the key's remaining TTL as {"ttl_seconds": N}, rounded up
+// to whole seconds, or -1 if it has none, and 404 for a missing or expired
+// key. Like HEAD it reads only the metadata, and does not count as a read or
+// slide a sliding expiry.
+func (h *HTTPServer) handleTTL(w http.ResponseWriter, r *http.Request) {
+	ttl, hasTTL, ok := h.namespace(r).TTL(r.PathValue("key"))
 	if !ok {
 		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
 		return
 	}
+	seconds := int64(-1)
+	if hasTTL {
+		seconds = ceilSeconds(ttl)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"ttl_seconds": seconds})
+}
+
+// etag derives a strong entity tag from a value, so clients can make writes
+// conditional on the value they last read.
+func etag(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches reports whether an If-Match header value matches the entity tag
+// of value: either "*" or a comma-separated list containing that tag.
+func etagMatches(header, value string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	tag := etag(value)
+	for _, t := range strings.Split(header, ",") {
+		if strings.TrimSpace(t) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+type infoResponse struct {
+	Type                string            `json:"type"`
+	Size                int               `json:"size"`
+	HasTTL              bool              `json:"has_ttl"`
+	TTLSecondsRemaining int64             `json:"ttl_seconds_remaining,omitempty"`
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
+	Version             uint64            `json:"version"`
+	Tags                map[string]string `json:"tags,omitempty"`
+}
+
+// handleInfo describes a key without sending its value: its size, TTL and
+// when it was created and last written.
+func (h *HTTPServer) handleInfo(w http.ResponseWriter, r *http.Request) {
+	info, ok := h.namespace(r).Info(r.PathValue("key"))
+	if !ok {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infoResponse{
+		Type:                info.Type,
+		Size:                info.Size,
+		HasTTL:              info.HasTTL,
+		TTLSecondsRemaining: ceilSeconds(info.TTL),
+		CreatedAt:           info.CreatedAt,
+		UpdatedAt:           info.UpdatedAt,
+		Version:             info.Version,
+		Tags:                info.Tags,
+	})
+}
+
+type mutationResponse struct {
+	Op     string    `json:"op"`
+	Size   int       `json:"size"`
+	Time   time.Time `json:"time"`
+	Source string    `json:"source,omitempty"`
+}
+
+// handleHistory returns the key's recorded mutations, newest first, up to
+// ?limit=. The list is empty unless the store keeps a history.
+func (h *HTTPServer) handleHistory(w http.ResponseWriter, r *http.Request) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if r.URL.Query().Has("limit") && (err != nil || limit <= 0) {
+		http.Error(w, `{"error":"limit must be a positive integer"}`, http.StatusBadRequest)
+		return
+	}
+	muts := h.namespace(r).History(r.PathValue("key"), limit)
+	out := make([]mutationResponse, len(muts))
+	for i, m := range muts {
+		out[i] = mutationResponse{Op: m.Op.String(), Size: m.Size, Time: m.Time, Source: m.Source}
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"value": val})
+	json.NewEncoder(w).Encode(map[string][]mutationResponse{"mutations": out})
+}
+
+// ceilSeconds rounds d up to whole seconds, so a key that is still live never
+// reports a TTL of zero.
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
 }
 
 type setRequest struct {
-	Value      string `json:"value"`
-	TTLSeconds int64  `json:"ttl_seconds"`
+	Value      string            `json:"value"`
+	TTLSeconds int64             `json:"ttl_seconds"`
+	Sliding    bool              `json:"sliding"`
+	IfVersion  *uint64           `json:"if_version"` // write only if the key is at this version
+	Tags       map[string]string `json:"tags"`
 }
 
+// writeError reports a failed store write, mapping size-limit errors to client
+// errors and anything else to a 500.
+func writeError(w http.ResponseWriter, err error) {
+	code, msg := errorStatus(err)
+	body := map[string]string{"error": msg}
+	var follower *store.FollowerError
+	if errors.As(err, &follower) {
+		body["leader"] = follower.Leader
+	}
+	b, _ := json.Marshal(body)
+	http.Error(w, string(b), code)
+}
+
+// errorStatus returns the status code and message writeError answers err
+// with.
+func errorStatus(err error) (int, string) {
+	var follower *store.FollowerError
+	switch {
+	case errors.As(err, &follower):
+		return http.StatusForbidden, "store is a read-only follower"
+	case errors.Is(err, store.ErrKeyTooLarge):
+		return http.StatusBadRequest, "key too large"
+	case errors.Is(err, store.ErrReservedKey):
+		return http.StatusBadRequest, "keys starting with NUL are reserved"
+	case errors.Is(err, store.ErrValueTooLarge):
+		return http.StatusRequestEntityTooLarge, "value too large"
+	case errors.Is(err, store.ErrStoreClosed):
+		return http.StatusServiceUnavailable, "store closed"
+	case errors.Is(err, store.ErrReadOnly):
+		return http.StatusForbidden, "store is read-only"
+	case errors.Is(err, store.ErrWrongType):
+		return http.StatusConflict, "key holds the wrong type of value"
+	case errors.Is(err, store.ErrInvalidUTF8):
+		return http.StatusBadRequest, "invalid UTF-8"
+	case errors.Is(err, store.ErrInvalidEntry):
+		return http.StatusBadRequest, "invalid entry"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		// The client has most likely gone, but answer in case it has not.
+		return http.StatusServiceUnavailable, "request canceled"
+	}
+	return http.StatusInternalServerError, "internal error"
+}
+
+// SetMaxBodyBytes caps the size of request bodies. A request whose body is
+// larger is rejected with 413 before it is buffered in full. Zero, the
+// default, means unlimited.
+func (h *HTTPServer) SetMaxBodyBytes(n int64) {
+	h.maxBodyBytes = n
+}
+
+// limitBody applies the SetMaxBodyBytes cap to every request but /restore,
+// whose body is a whole dump, streamed rather than buffered, and whose
+// entries are still held to the store's key and value limits.
+func (h *HTTPServer) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.maxBodyBytes > 0 && r.Body != nil && r.URL.Path != "/restore" {
+			r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bodyError reports a request body that could not be read or decoded: 413 if
+// it was cut off by the body size cap, otherwise a 400 with body invalid.
+func bodyError(w http.ResponseWriter, err error, invalid string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, `{"error":"request body too large"}`, http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, invalid, http.StatusBadRequest)
+}
+
+type getSetResponse struct {
+	OldValue string `json:"old_value"`
+	Existed  bool   `json:"existed"`
+}
+
+// readSetRequest reads the value and TTL of a PUT. A JSON body carries both;
+// an application/octet-stream body is the raw value, with the TTL in the
+// ttl_seconds query parameter, the sliding flag in sliding, any expected
+// version in if_version and tags in repeated tag=name:value parameters.
+func readSetRequest(r *http.Request) (setRequest, error) {
+	var req setRequest
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == octetStream {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return req, err
+		}
+		req.Value = string(body)
+		if v := r.URL.Query().Get("ttl_seconds"); v != "" {
+			if req.TTLSeconds, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return req, err
+			}
+		}
+		req.Sliding = r.URL.Query().Get("sliding") == "true"
+		if v := r.URL.Query().Get("if_version"); v != "" {
+			version, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return req, err
+			}
+			req.IfVersion = &version
+		}
+		for _, v := range r.URL.Query()["tag"] {
+			name, value, ok := parseTag(v)
+			if !ok {
+				return req, errInvalidTag
+			}
+			if req.Tags == nil {
+				req.Tags = make(map[string]string)
+			}
+			req.Tags[name] = value
+		}
+		return req, nil
+	}
+	// Value is a pointer here, shadowing the one in setRequest, so that a
+	// body without it can be told apart from an empty value.
+	var body struct {
+		setRequest
+		Value *string `json:"value"`
+	}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); errors.Is(err, io.EOF) {
+		return req, errEmptyBody
+	} else if err != nil {
+		return req, err
+	}
+	if dec.Decode(&struct{}{}) != io.EOF {
+		return req, errInvalidJSON
+	}
+	if body.Value == nil {
+		return req, errMissingValue
+	}
+	req = body.setRequest
+	req.Value = *body.Value
+	return req, nil
+}
+
+// Errors readSetRequest returns for a JSON body that is not a valid PUT.
+var (
+	errEmptyBody    = errors.New("empty body")
+	errInvalidJSON  = errors.New("invalid JSON")
+	errMissingValue = errors.New("missing value field")
+)
+
+// setBodyError returns the error body for a PUT whose body readSetRequest
+// rejected, saying what was wrong with it where that is known.
+func setBodyError(err error) string {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	msg := "invalid request body"
+	switch {
+	case errors.Is(err, errEmptyBody), errors.Is(err, errInvalidJSON), errors.Is(err, errMissingValue), errors.Is(err, errInvalidTag):
+		msg = err.Error()
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		msg = errInvalidJSON.Error()
+	case errors.As(err, &typeErr):
+		msg = "field " + typeErr.Field + " has the wrong type"
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for this.
+		msg = strings.TrimPrefix(err.Error(), "json: ")
+	}
+	b, _ := json.Marshal(map[string]string{"error": msg})
+	return string(b)
+}
+
+// handleSet writes the key, answering 201 if the key was missing or expired
+// and 204 if it overwrote a live value, or with the old value for getset.
 func (h *HTTPServer) handleSet(w http.ResponseWriter, r *http.Request) {
 	key := r.PathValue("key")
+	ns := h.namespace(r)
 
-	var req setRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error":"invalid JSON"}`, http.StatusBadRequest)
+	req, err := readSetRequest(r)
+	if err != nil {
+		bodyError(w, err, setBodyError(err))
 		return
 	}
 
@@ -54,14 +708,274 @@ func (h *HTTPServer) handleSet(w http.ResponseWriter, r *http.Request) {
 	if req.TTLSeconds > 0 {
 		ttl = time.Duration(req.TTLSeconds) * time.Second
 	}
+	conditions := 0
+	for _, set := range []bool{r.Header.Get("If-Match") != "", r.Header.Get("If-None-Match") == "*", r.URL.Query().Get("getset") == "true", req.IfVersion != nil} {
+		if set {
+			conditions++
+		}
+	}
+	if conditions > 1 {
+		http.Error(w, `{"error":"only one of If-Match, If-None-Match, getset and if_version may be used"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Sliding && conditions > 0 {
+		http.Error(w, `{"error":"sliding cannot be combined with a conditional write or getset"}`, http.StatusBadRequest)
+		return
+	}
+	if len(req.Tags) > 0 && conditions > 0 {
+		http.Error(w, `{"error":"tags cannot be combined with a conditional write or getset"}`, http.StatusBadRequest)
+		return
+	}
 
-	h.store.Set(key, req.Value, ttl)
-	w.WriteHeader(http.StatusNoContent)
+	switch {
+	case req.IfVersion != nil:
+		// Conditional update by version: only write if nothing else has
+		// written the key since the client read it at this version.
+		written, version, err := ns.SetIfVersion(key, req.Value, *req.IfVersion, ttl)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("X-Version", strconv.FormatUint(version, 10))
+		if !written {
+			http.Error(w, `{"error":"version mismatch"}`, http.StatusPreconditionFailed)
+			return
+		}
+		h.appliedTTL(w, ttl)
+		// Version 0 only matches a missing key, so the write created it.
+		w.WriteHeader(setStatus(*req.IfVersion == 0))
+	case r.Header.Get("If-Match") != "":
+		// Conditional update: only write if the current value still has one
+		// of the given ETags. CompareAndSwap against the value the ETag was
+		// checked on closes the window for a concurrent write in between.
+		cur, ok := ns.Get(key)
+		if !ok || !etagMatches(r.Header.Get("If-Match"), cur) {
+			http.Error(w, `{"error":"precondition failed"}`, http.StatusPreconditionFailed)
+			return
+		}
+		swapped, err := ns.CompareAndSwap(key, cur, req.Value, ttl)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !swapped {
+			http.Error(w, `{"error":"precondition failed"}`, http.StatusPreconditionFailed)
+			return
+		}
+		w.Header().Set("ETag", etag(req.Value))
+		h.appliedTTL(w, ttl)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Header.Get("If-None-Match") == "*":
+		// Conditional create: only write if the key does not exist yet.
+		written, err := ns.SetNX(key, req.Value, ttl)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !written {
+			http.Error(w, `{"error":"key exists"}`, http.StatusPreconditionFailed)
+			return
+		}
+		h.appliedTTL(w, ttl)
+		w.WriteHeader(http.StatusCreated)
+	case r.URL.Query().Get("getset") == "true":
+		// The write also returns the value it replaced.
+		var resp getSetResponse
+		resp.OldValue, resp.Existed, err = ns.GetSet(key, req.Value, ttl)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		h.appliedTTL(w, ttl)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	default:
+		o := store.SetOptions{Value: req.Value, TTL: ttl, Sliding: req.Sliding, Tags: req.Tags}
+		created, err := ns.SetReportCreated(key, o)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		h.appliedTTL(w, ttl)
+		w.WriteHeader(setStatus(created))
+	}
+}
+
+// setStatus is the status of a successful PUT without getset: 201 if it
+// created the key, 204 if it overwrote a live one.
+func setStatus(created bool) int {
+	if created {
+		return http.StatusCreated
+	}
+	return http.StatusNoContent
+}
+
+// appliedTTL reports the TTL a write asking for ttl was given in the
+// X-TTL-Seconds header, which the store's default and maximum TTL can make
+// differ from the request. Writes left without an expiry get no header.
+func (h *HTTPServer) appliedTTL(w http.ResponseWriter, ttl time.Duration) {
+	if eff := h.store.EffectiveTTL(ttl); eff > 0 {
+		w.Header().Set("X-TTL-Seconds", strconv.FormatInt(ceilSeconds(eff), 10))
+	}
 }
 
 func (h *HTTPServer) handleDelete(w http.ResponseWriter, r *http.Request) {
 	key := r.PathValue("key")
-	deleted := h.store.Delete(key)
+	ns := h.namespace(r)
+	deleted, err := ns.Delete(key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]bool{"deleted": deleted})
 }
+
+type expireRequest struct {
+	TTLSeconds *int64 `json:"ttl_seconds"`
+}
+
+// handleExpire sets the key's TTL to ttl_seconds from now with Expire, or
+// clears it with Persist for 0, a negative value or none, leaving the value
+// alone.
+func (h *HTTPServer) handleExpire(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	ns := h.namespace(r)
+
+	var req expireRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err, `{"error":"invalid JSON"}`)
+		return
+	}
+
+	var found bool
+	var err error
+	if req.TTLSeconds == nil || *req.TTLSeconds <= 0 {
+		found, err = ns.Persist(key)
+	} else {
+		found, err = ns.Expire(key, time.Duration(*req.TTLSeconds)*time.Second)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !found {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type touchRequest struct {
+	TTLSeconds *int64 `json:"ttl_seconds"`
+}
+
+// handleTouch resets the key's expiry to ttl_seconds from now, clearing it for
+// 0. With no body or no ttl_seconds it refreshes the key's own TTL instead.
+func (h *HTTPServer) handleTouch(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	ns := h.namespace(r)
+
+	var req touchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		bodyError(w, err, `{"error":"invalid JSON"}`)
+		return
+	}
+
+	var touched bool
+	var err error
+	if req.TTLSeconds == nil {
+		touched, err = ns.Refresh(key)
+	} else {
+		var ttl time.Duration
+		if *req.TTLSeconds > 0 {
+			ttl = time.Duration(*req.TTLSeconds) * time.Second
+		}
+		touched, err = ns.Touch(key, ttl)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !touched {
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"touched": true})
+}
+
+type copyRequest struct {
+	Destination string `json:"destination"`
+	Overwrite   bool   `json:"overwrite"`
+	TTLSeconds  *int64 `json:"ttl_seconds"`
+}
+
+// handleCopy copies the key to the destination in the body. Without
+// ttl_seconds the copy keeps the source's TTL; 0 or less means no expiry.
+func (h *HTTPServer) handleCopy(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	ns := h.namespace(r)
+
+	var req copyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err, `{"error":"invalid JSON"}`)
+		return
+	}
+	if req.Destination == "" {
+		http.Error(w, `{"error":"destination is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	var ttl *time.Duration
+	if req.TTLSeconds != nil {
+		d := time.Duration(*req.TTLSeconds) * time.Second
+		ttl = &d
+	}
+	err := ns.Copy(key, req.Destination, req.Overwrite, ttl)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+	case errors.Is(err, store.ErrKeyExists):
+		http.Error(w, `{"error":"destination exists"}`, http.StatusConflict)
+	case errors.Is(err, store.ErrSameKey):
+		http.Error(w, `{"error":"source and destination are the same key"}`, http.StatusBadRequest)
+	case err != nil:
+		writeError(w, err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+type appendRequest struct {
+	Suffix string `json:"suffix"`
+}
+
+func (h *HTTPServer) handleAppend(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	ns := h.namespace(r)
+
+	var req appendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		bodyError(w, err, `{"error":"invalid JSON"}`)
+		return
+	}
+
+	n, err := ns.Append(key, req.Suffix)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"length": n})
+}
+
+func (h *HTTPServer) handleDeleteNamespace(w http.ResponseWriter, r *http.Request) {
+	n, err := h.store.DeleteNamespace(r.PathValue("ns"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"deleted": n})
+}
@@ -0,0 +1,1190 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"stashr/store"
+)
+
+func TestHeadKey(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("plain", "a large value we should not send", 0)
+	s.Set("session", "v", 90*time.Second)
+	handler := NewHTTPServer(s).Handler()
+
+	tests := []struct {
+		path    string
+		want    int
+		wantTTL string
+	}{
+		{"/keys/plain", http.StatusOK, ""},
+		{"/keys/session", http.StatusOK, "90"},
+		{"/keys/missing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, rec.Code)
+			}
+			if rec.Body.Len() != 0 {
+				t.Fatalf("expected no body, got %q", rec.Body)
+			}
+			if got := rec.Header().Get("X-TTL-Seconds"); got != tt.wantTTL {
+				t.Fatalf("expected X-TTL-Seconds %q, got %q", tt.wantTTL, got)
+			}
+		})
+	}
+}
+
+func TestGetJSONPathHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("doc", `{"user":{"address":{"city":"London"}},"items":[{"id":7}]}`, 0)
+	s.Set("text", "plain", 0)
+	handler := NewHTTPServer(s).Handler()
+
+	tests := []struct {
+		path string
+		want int
+		body string
+	}{
+		{"/keys/doc?path=user.address.city", http.StatusOK, `{"value":"London"}`},
+		{"/keys/doc?path=items.0.id", http.StatusOK, `{"value":7}`},
+		{"/keys/doc?path=user.zip", http.StatusNotFound, `{"error":"path not found"}`},
+		{"/keys/text?path=a", http.StatusUnprocessableEntity, `{"error":"value is not valid JSON"}`},
+		{"/keys/missing?path=a", http.StatusNotFound, `{"error":"not found"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d", tt.want, rec.Code)
+			}
+			if got := strings.TrimSpace(rec.Body.String()); got != tt.body {
+				t.Fatalf("expected %s, got %s", tt.body, got)
+			}
+		})
+	}
+}
+
+func TestListDetail(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("a", "small", 0)
+	s.Set("b", "a larger value", time.Minute)
+	handler := NewHTTPServer(s).Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys?detail=true&max_value_bytes=5", nil))
+	want := `{"entries":[{"key":"a","size":5,"value":"small"},{"key":"b","size":14,"ttl_seconds_remaining":60}]}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys?detail=true&sort=size", nil))
+	want = `{"entries":[{"key":"b","size":14,"ttl_seconds_remaining":60},{"key":"a","size":5}]}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Fatalf("expected the largest first, got %s", got)
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	h.SetMaxBodyBytes(64)
+	handler := h.Handler()
+
+	big := strings.Repeat("x", 100)
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{"small JSON", "/keys/k", "application/json", `{"value":"ok"}`, http.StatusCreated},
+		{"large JSON", "/keys/k", "application/json", `{"value":"` + big + `"}`, http.StatusRequestEntityTooLarge},
+		{"large raw", "/keys/k", "application/octet-stream", big, http.StatusRequestEntityTooLarge},
+		{"large batch", "/batch", "application/json", `[{"op":"set","key":"k","value":"` + big + `"}]`, http.StatusRequestEntityTooLarge},
+		{"malformed", "/keys/k", "application/json", `{`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := http.MethodPut
+			if tt.path == "/batch" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+		})
+	}
+	if v, _ := s.Get("k"); v != "ok" {
+		t.Fatalf("expected rejected writes to leave k=ok, got %q", v)
+	}
+}
+
+func TestSetBodyErrors(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	h.SetMaxBodyBytes(64)
+	handler := h.Handler()
+
+	tests := []struct {
+		name string
+		body string
+		want int
+		err  string
+	}{
+		{"empty body", "", http.StatusBadRequest, "empty body"},
+		{"whitespace only", " \n", http.StatusBadRequest, "empty body"},
+		{"truncated", `{"value":`, http.StatusBadRequest, "invalid JSON"},
+		{"not JSON", `value=v`, http.StatusBadRequest, "invalid JSON"},
+		{"trailing data", `{"value":"v"} {}`, http.StatusBadRequest, "invalid JSON"},
+		{"missing value", `{}`, http.StatusBadRequest, "missing value field"},
+		{"null value", `{"value":null}`, http.StatusBadRequest, "missing value field"},
+		{"unknown field", `{"value":"v","ttl":60}`, http.StatusBadRequest, `unknown field "ttl"`},
+		{"wrong type", `{"value":"v","ttl_seconds":"60"}`, http.StatusBadRequest, "field ttl_seconds has the wrong type"},
+		{"too large", `{"value":"` + strings.Repeat("x", 100) + `"}`, http.StatusRequestEntityTooLarge, "request body too large"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, rec.Code, rec.Body)
+			}
+			var got map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got["error"] != tt.err {
+				t.Fatalf("expected error %q, got %s", tt.err, rec.Body)
+			}
+		})
+	}
+	if _, ok := s.Get("k"); ok {
+		t.Fatal("expected rejected writes to store nothing")
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(`{"value":""}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected an explicit empty value to be stored, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestListScanHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+
+	for i := 0; i < 25; i++ {
+		s.Set(fmt.Sprintf("user:%02d", i), "v", 0)
+	}
+	s.Set("order:1", "v", 0)
+
+	seen := make(map[string]bool)
+	var order []string
+	cursor := ""
+	for {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys?prefix=user:&limit=10&cursor="+url.QueryEscape(cursor), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+		}
+		var resp struct {
+			Keys       []string `json:"keys"`
+			NextCursor string   `json:"next_cursor"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Keys) > 10 {
+			t.Fatalf("page of %d keys exceeds the limit", len(resp.Keys))
+		}
+		for _, k := range resp.Keys {
+			seen[k] = true
+		}
+		order = append(order, resp.Keys...)
+		if resp.NextCursor == "" {
+			break
+		}
+		cursor = resp.NextCursor
+	}
+	if len(seen) != 25 || seen["order:1"] {
+		t.Fatalf("expected the 25 user keys, got %v", seen)
+	}
+	if !slices.IsSorted(order) {
+		t.Fatalf("expected pages in key order, got %v", order)
+	}
+
+	for _, target := range []string{"/keys?cursor=bogus!", "/keys?limit=-1"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected 400, got %d", target, rec.Code)
+		}
+	}
+}
+
+func TestCopyHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+	s.Set("src", "v", time.Hour)
+	s.Set("taken", "x", 0)
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"destination":"dst"}`, http.StatusNoContent},
+		{`{"destination":"taken"}`, http.StatusConflict},
+		{`{"destination":"taken","overwrite":true,"ttl_seconds":0}`, http.StatusNoContent},
+		{`{"destination":"src"}`, http.StatusBadRequest},
+		{`{}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/keys/src/copy", strings.NewReader(tt.body)))
+		if rec.Code != tt.want {
+			t.Errorf("copy %s: expected %d, got %d: %s", tt.body, tt.want, rec.Code, rec.Body)
+		}
+	}
+	if v, _ := s.Get("taken"); v != "v" {
+		t.Fatalf("expected the overwrite to land, got %q", v)
+	}
+	if _, hasTTL, _ := s.TTL("taken"); hasTTL {
+		t.Fatal("expected ttl_seconds 0 to clear the TTL")
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/keys/missing/copy", strings.NewReader(`{"destination":"x"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing source, got %d", rec.Code)
+	}
+}
+
+func TestTouchRefreshHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+	s.Set("session", "v", time.Hour)
+	s.Set("forever", "v", 0)
+
+	for _, body := range []string{"", "{}"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/keys/session/touch", strings.NewReader(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("touch with body %q: expected 200, got %d: %s", body, rec.Code, rec.Body)
+		}
+		if ttl, _, _ := s.TTL("session"); ttl <= 59*time.Minute {
+			t.Fatalf("expected the TTL to be refreshed to an hour, got %v", ttl)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/keys/forever/touch", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 refreshing a key without a TTL, got %d", rec.Code)
+	}
+}
+
+func TestRandomKeyHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/random-key", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 from an empty store, got %d", rec.Code)
+	}
+
+	s.Set("only", "v", 0)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/random-key", nil))
+	var resp struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Key != "only" {
+		t.Fatalf("expected {\"key\":\"only\"}, got %d %s (%v)", rec.Code, rec.Body, err)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ns/app/random-key", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 from an empty namespace, got %d", rec.Code)
+	}
+	s.Namespace("app").Set("scoped", "v", 0)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ns/app/random-key", nil))
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Key != "scoped" {
+		t.Fatalf("expected {\"key\":\"scoped\"}, got %d %s (%v)", rec.Code, rec.Body, err)
+	}
+
+	// A key named "random" is an ordinary key.
+	s.Set("random", "v", 0)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys/random", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"value":"v"`) {
+		t.Fatalf("expected GET /keys/random to read the key, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestFlushHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	handler := h.Handler()
+	s.Set("a", "1", 0)
+	s.Set("b", "2", 0)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/keys?confirm=true", nil))
+	if rec.Code != http.StatusNotFound || s.Len() != 2 {
+		t.Fatalf("expected 404 without an admin token configured, got %d with %d keys", rec.Code, s.Len())
+	}
+
+	h.SetAdminToken("admin")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/keys?confirm=true", nil))
+	if rec.Code != http.StatusUnauthorized || s.Len() != 2 {
+		t.Fatalf("expected 401 without the admin token, got %d with %d keys", rec.Code, s.Len())
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/keys", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || s.Len() != 2 {
+		t.Fatalf("expected an unconfirmed flush to be refused, got %d with %d keys", rec.Code, s.Len())
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/keys?confirm=true", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"flushed":2}` {
+		t.Fatalf("expected {\"flushed\":2}, got %d %s", rec.Code, rec.Body)
+	}
+	if s.Len() != 0 {
+		t.Fatalf("expected an empty store, got %d keys", s.Len())
+	}
+}
+
+func TestDumpRestoreHTTP(t *testing.T) {
+	src := store.New()
+	defer src.Stop()
+	src.Set("a", "1", time.Hour)
+	src.Namespace("app").Set("b", "2", 0)
+	dst := store.New()
+	defer dst.Stop()
+	dst.Set("a", "kept", 0)
+
+	do := func(s *store.Store, method, target, body string) *httptest.ResponseRecorder {
+		h := NewHTTPServer(s)
+		h.SetAdminToken("admin")
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin")
+		rec := httptest.NewRecorder()
+		h.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+	dump := do(src, http.MethodGet, "/dump", "")
+	if dump.Code != http.StatusOK || strings.Count(dump.Body.String(), "\n") != 2 {
+		t.Fatalf("expected a two-line dump, got %d %s", dump.Code, dump.Body)
+	}
+	rec := do(dst, http.MethodPost, "/restore", dump.Body.String())
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"imported":1,"skipped":1}` {
+		t.Fatalf("expected one key imported and one skipped, got %d %s", rec.Code, rec.Body)
+	}
+	if v, _ := dst.Namespace("app").Get("b"); v != "2" {
+		t.Fatalf("expected the namespaced key restored, got %q", v)
+	}
+	rec = do(dst, http.MethodPost, "/restore?overwrite=true", dump.Body.String()+"not json\n")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"imported":2`) {
+		t.Fatalf("expected a 400 reporting the two entries imported first, got %d %s", rec.Code, rec.Body)
+	}
+	if v, _ := dst.Get("a"); v != "1" {
+		t.Fatalf("expected overwrite to replace the key, got %q", v)
+	}
+
+	dst.SetLeader("leader:8080")
+	rec = do(dst, http.MethodPost, "/restore", dump.Body.String())
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"leader":"leader:8080"`) {
+		t.Fatalf("expected 403 naming the leader on a follower, got %d %s", rec.Code, rec.Body)
+	}
+	dst.SetLeader("")
+	dst.Stop()
+	if rec := do(dst, http.MethodPost, "/restore", dump.Body.String()); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 once the store is closed, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestDeletePrefixHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+	s.Set("tenant:1:a", "v", 0)
+	s.Set("tenant:1:b", "v", 0)
+	s.Set("tenant:2:a", "v", 0)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/keys?prefix=", nil))
+	if rec.Code != http.StatusBadRequest || s.Len() != 3 {
+		t.Fatalf("expected an empty prefix to be refused, got %d with %d keys", rec.Code, s.Len())
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/keys?prefix=tenant:1:", nil))
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"deleted":2}` {
+		t.Fatalf("expected {\"deleted\":2}, got %d %s", rec.Code, rec.Body)
+	}
+	if s.Len() != 1 {
+		t.Fatalf("expected 1 key left, got %d", s.Len())
+	}
+}
+
+func TestStoppedStoreHTTP(t *testing.T) {
+	s := store.New()
+	s.Set("k", "v", 0)
+	s.Stop()
+	handler := NewHTTPServer(s).Handler()
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(`{"value":"w"}`)),
+		httptest.NewRequest(http.MethodDelete, "/keys/k", nil),
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s: expected 503, got %d", req.Method, req.URL, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys/k", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected reads to keep working, got %d", rec.Code)
+	}
+}
+
+func TestExpireNowHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("k", "v", time.Hour)
+	h := NewHTTPServer(s)
+	expireNow := func(key, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/expire-now/"+key, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		h.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := expireNow("k", "admin"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without an admin token configured, got %d", rec.Code)
+	}
+	h.SetAdminToken("admin")
+	if rec := expireNow("k", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 with the wrong token, got %d", rec.Code)
+	}
+	if !s.Exists("k") {
+		t.Fatal("expected k to survive unauthorized requests")
+	}
+
+	rec := expireNow("k", "admin")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"expired":true}` {
+		t.Fatalf("expected k to be expired, got %d %s", rec.Code, rec.Body)
+	}
+	if s.Exists("k") {
+		t.Fatal("expected k to be gone")
+	}
+	if n := s.Stats().Expirations; n != 1 {
+		t.Fatalf("expected 1 expiration, got %d", n)
+	}
+
+	rec = expireNow("missing", "admin")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"expired":false}` {
+		t.Fatalf("expected nothing to expire for a missing key, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestReadOnlyHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("k", "v", 0)
+	h := NewHTTPServer(s)
+	h.SetAdminToken("admin")
+	handler := h.Handler()
+
+	setReadOnly := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/readonly", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := setReadOnly(`{"read_only":true}`); rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"read_only":true}` {
+		t.Fatalf("expected read-only mode on, got %d %s", rec.Code, rec.Body)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(`{"value":"w"}`)))
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "read-only") {
+		t.Fatalf("expected 403 for a write, got %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys/k", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected reads to keep working, got %d", rec.Code)
+	}
+
+	if rec := setReadOnly(`{}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without read_only, got %d", rec.Code)
+	}
+	setReadOnly(`{"read_only":false}`)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(`{"value":"w"}`)))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected writes to resume, got %d", rec.Code)
+	}
+}
+
+func TestSetIfVersionHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := put(`{"value":"a","if_version":0}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected version 0 to create the key, got %d: %s", rec.Code, rec.Body)
+	}
+	created := rec.Header().Get("X-Version")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys/k", nil))
+	var got getResponse
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if strconv.FormatUint(got.Version, 10) != created || rec.Header().Get("X-Version") != created {
+		t.Fatalf("expected GET to report version %s, got %d and %q", created, got.Version, rec.Header().Get("X-Version"))
+	}
+
+	rec = put(`{"value":"b","if_version":0}`)
+	if rec.Code != http.StatusPreconditionFailed || rec.Header().Get("X-Version") != created {
+		t.Fatalf("expected 412 with the current version, got %d %q", rec.Code, rec.Header().Get("X-Version"))
+	}
+	if rec := put(`{"value":"b","if_version":` + created + `}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected a matching version to write, got %d", rec.Code)
+	}
+	if v, _ := s.Get("k"); v != "b" {
+		t.Fatalf("expected b, got %q", v)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(`{"value":"c","if_version":1}`))
+	req.Header.Set("If-None-Match", "*")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for if_version with If-None-Match, got %d", rec.Code)
+	}
+}
+
+func TestTagsHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return rec
+	}
+	for _, k := range []string{"b", "a"} {
+		if rec := do(http.MethodPut, "/ns/app/keys/"+k, `{"value":"v","tags":{"tenant":"acme"}}`); rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+		}
+	}
+	req := httptest.NewRequest(http.MethodPut, "/ns/app/keys/c?tag=tenant:initech", strings.NewReader("raw"))
+	req.Header.Set("Content-Type", octetStream)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	rec := do(http.MethodGet, "/ns/app/keys?tag=tenant:acme", "")
+	var list keysResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(list.Keys, []string{"a", "b"}) || list.Count != 2 {
+		t.Fatalf("expected a and b, sorted, got %v", list.Keys)
+	}
+	var info infoResponse
+	json.NewDecoder(do(http.MethodGet, "/ns/app/keys/c/info", "").Body).Decode(&info)
+	if info.Tags["tenant"] != "initech" {
+		t.Fatalf("expected the octet-stream tag on c, got %v", info.Tags)
+	}
+
+	if rec := do(http.MethodGet, "/ns/app/keys?tag=tenant", ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a tag without a value, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/ns/app/keys/a?getset=true", `{"value":"v","tags":{"x":"y"}}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for tags with getset, got %d", rec.Code)
+	}
+
+	rec = do(http.MethodDelete, "/ns/app/keys?tag=tenant:acme", "")
+	var deleted map[string]int
+	json.NewDecoder(rec.Body).Decode(&deleted)
+	if deleted["deleted"] != 2 || s.Namespace("app").Exists("a") || !s.Namespace("app").Exists("c") {
+		t.Fatalf("expected the 2 acme keys deleted, got %v", deleted)
+	}
+}
+
+func TestHistoryHTTP(t *testing.T) {
+	s := store.New(store.WithHistory(10))
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+
+	for _, body := range []string{`{"value":"a"}`, `{"value":"abc"}`} {
+		req := httptest.NewRequest(http.MethodPut, "/ns/app/keys/k", strings.NewReader(body))
+		req.RemoteAddr = "10.0.0.7:5000"
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ns/app/keys/k/history?limit=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Mutations []mutationResponse `json:"mutations"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Mutations) != 1 {
+		t.Fatalf("expected one mutation, got %+v", resp.Mutations)
+	}
+	if m := resp.Mutations[0]; m.Op != "set" || m.Size != 3 || m.Source != "http 10.0.0.7" {
+		t.Fatalf("expected the latest set from the client, got %+v", m)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys/k/history?limit=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a bad limit, got %d", rec.Code)
+	}
+}
+
+func TestConditionalSetHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+	s.Set("k", "v1", 0)
+
+	put := func(header, value, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(body))
+		req.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys/k", nil))
+	tag := rec.Header().Get("ETag")
+	if tag == "" {
+		t.Fatal("expected GET to return an ETag")
+	}
+
+	if rec := put("If-Match", `"stale"`, `{"value":"x"}`); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a stale ETag, got %d", rec.Code)
+	}
+	rec = put("If-Match", tag, `{"value":"v2"}`)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 for a matching ETag, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("ETag") == tag {
+		t.Fatal("expected the new value to have a new ETag")
+	}
+	if rec := put("If-Match", tag, `{"value":"v3"}`); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 once the value changed, got %d", rec.Code)
+	}
+	if v, _ := s.Get("k"); v != "v2" {
+		t.Fatalf("expected v2, got %q", v)
+	}
+
+	if rec := put("If-Match", "*", `{"value":"new"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected If-Match: * to update a present key, got %d", rec.Code)
+	}
+	s.Delete("k")
+	if rec := put("If-Match", "*", `{"value":"new"}`); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected If-Match: * to fail on a missing key, got %d", rec.Code)
+	}
+	if rec := put("If-None-Match", "*", `{"value":"created"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected If-None-Match: * to create, got %d", rec.Code)
+	}
+	if rec := put("If-None-Match", "*", `{"value":"again"}`); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected If-None-Match: * to refuse an existing key, got %d", rec.Code)
+	}
+}
+
+func TestSlidingSetHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/keys/session", strings.NewReader(`{"value":"v","ttl_seconds":1,"sliding":true}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	time.Sleep(200 * time.Millisecond)
+	s.Get("session")
+	if ttl, _, _ := s.TTL("session"); ttl <= 900*time.Millisecond {
+		t.Fatalf("expected a read to slide the expiry, got %v", ttl)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/keys/session", strings.NewReader(`{"value":"v","sliding":true}`))
+	req.Header.Set("If-None-Match", "*")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a conditional sliding write, got %d", rec.Code)
+	}
+}
+
+func TestSetReportsAppliedTTLHTTP(t *testing.T) {
+	s := store.New(store.WithMaxTTL(time.Hour))
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(`{"value":"v","ttl_seconds":86400}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rec.Code)
+	}
+	if got := rec.Header().Get("X-TTL-Seconds"); got != "3600" {
+		t.Fatalf("expected the clamped TTL of 3600 in X-TTL-Seconds, got %q", got)
+	}
+}
+
+func TestInfoHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+	s.Set("k", "value", time.Minute)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys/k/info", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var resp struct {
+		Size       int       `json:"size"`
+		HasTTL     bool      `json:"has_ttl"`
+		TTLSeconds int64     `json:"ttl_seconds_remaining"`
+		CreatedAt  time.Time `json:"created_at"`
+		UpdatedAt  time.Time `json:"updated_at"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Size != 5 || !resp.HasTTL || resp.TTLSeconds != 60 || resp.CreatedAt.IsZero() || resp.UpdatedAt.Before(resp.CreatedAt) {
+		t.Fatalf("unexpected info %+v", resp)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys/missing/info", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rec.Code)
+	}
+}
+
+func TestListsAndHashesHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("str", "v", 0)
+	handler := NewHTTPServer(s).Handler()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	do(http.MethodPost, "/ns/app/lists/l", `{"values":["b","c"]}`)
+	if rec := do(http.MethodPost, "/ns/app/lists/l", `{"values":["a"],"head":true}`); rec.Body.String() != "{\"length\":3}\n" {
+		t.Fatalf("expected length 3, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/ns/app/lists/l?start=1", ""); rec.Body.String() != "{\"values\":[\"b\",\"c\"]}\n" {
+		t.Fatalf("unexpected range %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/ns/app/lists/l/length", ""); rec.Body.String() != "{\"length\":3}\n" {
+		t.Fatalf("unexpected length %d %s", rec.Code, rec.Body)
+	}
+
+	if rec := do(http.MethodPut, "/hashes/h/name", `{"value":"ada"}`); rec.Body.String() != "{\"added\":true}\n" {
+		t.Fatalf("expected a new field, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/hashes/h/name", ""); rec.Body.String() != "{\"value\":\"ada\"}\n" {
+		t.Fatalf("unexpected field %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/hashes/h", ""); rec.Body.String() != "{\"fields\":{\"name\":\"ada\"}}\n" {
+		t.Fatalf("unexpected hash %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/keys/h/info", ""); !strings.Contains(rec.Body.String(), `"type":"hash"`) {
+		t.Fatalf("expected info to give the type, got %s", rec.Body)
+	}
+	if rec := do(http.MethodDelete, "/hashes/h/name", ""); rec.Body.String() != "{\"deleted\":true}\n" {
+		t.Fatalf("unexpected delete %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/hashes/h/name", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 once the field is gone, got %d", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, "/lists/str", `{"values":["x"]}`); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 pushing to a string, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodGet, "/hashes/str", ""); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 reading a string as a hash, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+// BenchmarkSetDuringList measures Set latency on a store of a million keys
+// while another client lists them over HTTP as fast as it can. Listing stalls
+// writers only rarely, so the slowest Sets are reported alongside the mean.
+func BenchmarkSetDuringList(b *testing.B) {
+	for name, path := range map[string]string{"keys": "/keys", "detail": "/keys?detail=true", "pattern": "/keys?pattern=key-1*"} {
+		b.Run(name, func(b *testing.B) {
+			s := store.New()
+			defer s.Stop()
+			for i := 0; i < 1_000_000; i++ {
+				s.Set(fmt.Sprintf("key-%d", i), "value", time.Hour)
+			}
+			handler := NewHTTPServer(s).Handler()
+			stop := make(chan struct{})
+			listed := make(chan struct{})
+			go func() {
+				defer close(listed)
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+				}
+			}()
+
+			latencies := make([]time.Duration, b.N)
+			b.ResetTimer()
+			for i := range latencies {
+				start := time.Now()
+				s.Set(fmt.Sprintf("key-%d", i%1_000_000), "value", time.Hour)
+				latencies[i] = time.Since(start)
+			}
+			b.StopTimer()
+			close(stop)
+			<-listed
+			slices.Sort(latencies)
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+			b.ReportMetric(float64(latencies[len(latencies)*999/1000].Nanoseconds()), "p99.9-ns")
+			b.ReportMetric(float64(latencies[len(latencies)-1].Nanoseconds()), "max-ns")
+		})
+	}
+}
+
+func TestPatchTTL(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("k", "v", time.Hour)
+	handler := NewHTTPServer(s).Handler()
+	patch := func(key, body string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/keys/"+key, strings.NewReader(body)))
+		return rec.Code
+	}
+
+	if code := patch("k", `{"ttl_seconds":60}`); code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", code)
+	}
+	if ttl, ok, _ := s.TTL("k"); !ok || ttl > time.Minute || ttl < 59*time.Second {
+		t.Fatalf("expected the TTL to be shortened to a minute, got %v, %v", ttl, ok)
+	}
+	for _, body := range []string{`{"ttl_seconds":0}`, `{"ttl_seconds":-5}`, `{}`} {
+		s.Expire("k", time.Hour)
+		if code := patch("k", body); code != http.StatusNoContent {
+			t.Fatalf("%s: expected 204, got %d", body, code)
+		}
+		if _, hasTTL, exists := s.TTL("k"); hasTTL || !exists {
+			t.Fatalf("%s: expected the expiry to be cleared, got hasTTL=%v exists=%v", body, hasTTL, exists)
+		}
+	}
+	if v, _ := s.Get("k"); v != "v" {
+		t.Fatalf("expected the value to be untouched, got %q", v)
+	}
+	if code := patch("missing", `{"ttl_seconds":60}`); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing key, got %d", code)
+	}
+}
+
+func TestListKeysHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+	list := func(query string) (keys []string, count int, raw string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keys"+query, nil))
+		if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("GET /keys%s: expected 200 with JSON, got %d, %q", query, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		raw = rec.Body.String()
+		var resp struct {
+			Keys  []string `json:"keys"`
+			Count int      `json:"count"`
+		}
+		if err := json.Unmarshal([]byte(raw), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Keys, resp.Count, raw
+	}
+
+	if _, _, raw := list(""); strings.TrimSpace(raw) != `{"keys":[],"count":0}` {
+		t.Fatalf("expected an empty array for an empty store, got %s", raw)
+	}
+	for _, k := range []string{"user:1", "user:2", "user:3", "order:1"} {
+		s.Set(k, "v", 0)
+	}
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"order:1", "user:1", "user:2", "user:3"}},
+		{"?prefix=user:", []string{"user:1", "user:2", "user:3"}},
+		{"?limit=2", []string{"order:1", "user:1"}},
+		{"?prefix=user:&limit=2", []string{"user:1", "user:2"}},
+		{"?prefix=user:&limit=10", []string{"user:1", "user:2", "user:3"}},
+		{"?prefix=none:&limit=2", []string{}},
+	}
+	for _, tt := range tests {
+		keys, count, _ := list(tt.query)
+		if !slices.Equal(keys, tt.want) || count != len(tt.want) {
+			t.Errorf("GET /keys%s: expected %v with count %d, got %v with count %d", tt.query, tt.want, len(tt.want), keys, count)
+		}
+	}
+}
+
+func TestBatchHTTP(t *testing.T) {
+	s := store.New(store.WithMaxValueBytes(4))
+	defer s.Stop()
+	s.Set("b", "old", 0)
+	handler := NewHTTPServer(s).Handler()
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post(`[
+		{"op":"set","key":"a","value":"1"},
+		{"op":"get","key":"a"},
+		{"op":"set","key":"big","value":"too long"},
+		{"op":"delete","key":"b"},
+		{"op":"get","key":"b"},
+		{"op":"rename","key":"a"},
+		{"op":"get"}
+	]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var got []batchResult
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`{"op":"set","key":"a"}`,
+		`{"op":"get","key":"a","value":"1","found":true}`,
+		`{"op":"set","key":"big","error":"value too large"}`,
+		`{"op":"delete","key":"b","deleted":true}`,
+		`{"op":"get","key":"b","found":false}`,
+		`{"op":"rename","key":"a","error":"unknown op"}`,
+		`{"op":"get","error":"missing key"}`,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d results, got %d", len(want), len(got))
+	}
+	for i, res := range got {
+		if b, _ := json.Marshal(res); string(b) != want[i] {
+			t.Errorf("result %d: expected %s, got %s", i, want[i], b)
+		}
+	}
+	if s.Exists("big") {
+		t.Fatal("expected the failed set not to write")
+	}
+
+	s.SetReadOnly(true)
+	if rec := post(`[{"op":"get","key":"a"}]`); rec.Code != http.StatusOK {
+		t.Fatalf("expected reads to keep working in read-only mode, got %d", rec.Code)
+	}
+	if rec := post(`[{"op":"get","key":"a"},{"op":"set","key":"a","value":"2"}]`); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "read-only") {
+		t.Fatalf("expected 403 for a write in read-only mode, got %d: %s", rec.Code, rec.Body)
+	}
+	s.SetReadOnly(false)
+	s.SetLeader("leader:8080")
+	if rec := post(`[{"op":"delete","key":"a"}]`); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"leader":"leader:8080"`) {
+		t.Fatalf("expected 403 naming the leader on a follower, got %d: %s", rec.Code, rec.Body)
+	}
+	s.SetLeader("")
+
+	ops := "[" + strings.TrimSuffix(strings.Repeat(`{"op":"get","key":"a"},`, maxBatchItems+1), ",") + "]"
+	if rec := post(ops); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 beyond the batch limit, got %d", rec.Code)
+	}
+
+	s.Stop()
+	if rec := post(`[{"op":"set","key":"a","value":"2"}]`); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 once the store is closed, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestBatchKeysHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post("/ns/app/keys/batch/set", `[{"key":"a","value":"1"},{"key":"b","value":"2","ttl_seconds":60},{"key":"a","value":"3"}]`)
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"written":2}` {
+		t.Fatalf("expected 2 keys written, got %d: %s", rec.Code, rec.Body)
+	}
+	ns := s.Namespace("app")
+	if v, _ := ns.Get("a"); v != "3" {
+		t.Fatalf("expected the last item for a key to win, got %q", v)
+	}
+	if _, hasTTL, _ := ns.TTL("b"); !hasTTL {
+		t.Fatal("expected b to have a TTL")
+	}
+
+	rec = post("/ns/app/keys/batch/set", `[{"key":"c","value":"1"},{"key":"d"},{"key":"e","value":"1"}]`)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), `"index":1`) {
+		t.Fatalf("expected 400 naming item 1, got %d: %s", rec.Code, rec.Body)
+	}
+	if ns.Exists("c") || ns.Exists("e") {
+		t.Fatal("expected a malformed item to reject the whole batch")
+	}
+
+	var got struct {
+		Values  map[string]string `json:"values"`
+		Missing []string          `json:"missing"`
+	}
+	rec = post("/ns/app/keys/batch/get", `{"keys":["a","x","b","y"]}`)
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Values["a"] != "3" || got.Values["b"] != "2" || len(got.Values) != 2 || !slices.Equal(got.Missing, []string{"x", "y"}) {
+		t.Fatalf("unexpected batch get %+v", got)
+	}
+
+	if rec := post("/ns/app/keys/batch/delete", `{"keys":["a","x"]}`); strings.TrimSpace(rec.Body.String()) != `{"deleted":1}` {
+		t.Fatalf("expected 1 key deleted, got %s", rec.Body)
+	}
+	if ns.Exists("a") || !ns.Exists("b") {
+		t.Fatal("expected only a deleted")
+	}
+
+	keys, _ := json.Marshal(map[string][]string{"keys": make([]string, maxBatchItems+1)})
+	items := "[" + strings.TrimSuffix(strings.Repeat(`{"key":"k","value":"v"},`, maxBatchItems+1), ",") + "]"
+	for path, body := range map[string]string{"/keys/batch/get": string(keys), "/keys/batch/delete": string(keys), "/keys/batch/set": items} {
+		if rec := post(path, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("POST %s: expected 400 beyond the batch limit, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestSetCreatedHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+	put := func(body string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(body)))
+		return rec.Code
+	}
+
+	if code := put(`{"value":"a","ttl_seconds":1}`); code != http.StatusCreated {
+		t.Fatalf("expected 201 for a new key, got %d", code)
+	}
+	if code := put(`{"value":"b"}`); code != http.StatusNoContent {
+		t.Fatalf("expected 204 for an overwrite, got %d", code)
+	}
+	s.Set("k", "old", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if code := put(`{"value":"c"}`); code != http.StatusCreated {
+		t.Fatalf("expected 201 over an expired key, got %d", code)
+	}
+}
+
+func TestTTLHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("short", "v", 90*time.Second)
+	s.Set("forever", "v", 0)
+	s.Namespace("app").SetSliding("session", "v", time.Minute)
+	handler := NewHTTPServer(s).Handler()
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/keys/short/ttl", http.StatusOK, `{"ttl_seconds":90}`},
+		{"/keys/forever/ttl", http.StatusOK, `{"ttl_seconds":-1}`},
+		{"/ns/app/keys/session/ttl", http.StatusOK, `{"ttl_seconds":60}`},
+		{"/keys/missing/ttl", http.StatusNotFound, `{"error":"not found"}`},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.code || strings.TrimSpace(rec.Body.String()) != tt.body {
+			t.Errorf("GET %s: expected %d %s, got %d %s", tt.path, tt.code, tt.body, rec.Code, rec.Body)
+		}
+	}
+	if st := s.Namespace("app").Stats(); st.Hits != 0 {
+		t.Fatalf("expected reading the TTL not to count as a read, got %d hits", st.Hits)
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// SetLogger sets the logger used for per-request logging. By default the
+// server logs through slog.Default().
+func (h *HTTPServer) SetLogger(l *slog.Logger) {
+	h.logger = l
+}
+
+// SetAccessLog enables an info-level access log line for every request. If
+// trustProxy is true the client IP is taken from X-Forwarded-For when present;
+// only enable that behind a proxy that sets the header, since clients can
+// forge it otherwise.
+func (h *HTTPServer) SetAccessLog(enabled, trustProxy bool) {
+	h.accessLog = enabled
+	h.trustProxy = trustProxy
+}
+
+// statusRecorder captures the status code and body size a handler writes. It
+// passes Flush through so streaming handlers such as /watch keep working when
+// wrapped.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// logRequests logs each request's method, key, status and latency at debug
+// level. It does nothing extra when debug logging is off.
+func (h *HTTPServer) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.logger.Enabled(r.Context(), slog.LevelDebug) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		// The mux fills in path values on r, so the key is known by now.
+		h.logger.LogAttrs(r.Context(), slog.LevelDebug, "http request",
+			slog.String("method", r.Method),
+			slog.String("key", r.PathValue("key")),
+			slog.Int("status", rec.status),
+			slog.Duration("latency", time.Since(start)),
+		)
+	})
+}
+
+// logAccess writes an access log line for each request when enabled with
+// SetAccessLog.
+func (h *HTTPServer) logAccess(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !h.accessLog {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		h.logger.LogAttrs(r.Context(), slog.LevelInfo, "access",
+			slog.String("client_ip", h.clientIP(r)),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int("size", rec.size),
+			slog.Duration("duration", time.Since(start)),
+		)
+	})
+}
+
+// clientIP returns the address of the client that sent r: the first entry of
+// X-Forwarded-For if the proxy is trusted and set it, else the peer address.
+func (h *HTTPServer) clientIP(r *http.Request) string {
+	if h.trustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			first, _, _ := strings.Cut(fwd, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// keyed is implemented by every request message that names a single key.
+type keyed interface {
+	GetKey() string
+}
+
+// LoggingUnaryInterceptor logs each unary call's method, key, status code and
+// latency to logger at debug level.
+func LoggingUnaryInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !logger.Enabled(ctx, slog.LevelDebug) {
+			return handler(ctx, req)
+		}
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		var key string
+		if k, ok := req.(keyed); ok {
+			key = k.GetKey()
+		}
+		logger.LogAttrs(ctx, slog.LevelDebug, "grpc request",
+			slog.String("method", info.FullMethod),
+			slog.String("key", key),
+			slog.String("status", status.Code(err).String()),
+			slog.Duration("latency", time.Since(start)),
+		)
+		return resp, err
+	}
+}
+
+// LoggingStreamInterceptor is the streaming counterpart of
+// LoggingUnaryInterceptor. The latency it logs is the lifetime of the stream.
+func LoggingStreamInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !logger.Enabled(ss.Context(), slog.LevelDebug) {
+			return handler(srv, ss)
+		}
+		start := time.Now()
+		err := handler(srv, ss)
+		logger.LogAttrs(ss.Context(), slog.LevelDebug, "grpc stream",
+			slog.String("method", info.FullMethod),
+			slog.String("status", status.Code(err).String()),
+			slog.Duration("latency", time.Since(start)),
+		)
+		return err
+	}
+}
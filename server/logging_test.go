@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"stashr/pb"
+	"stashr/store"
+)
+
+func TestHTTPRequestLogging(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+
+	var buf bytes.Buffer
+	h := NewHTTPServer(s)
+	h.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	req := httptest.NewRequest(http.MethodGet, "/keys/missing", nil)
+	h.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected one JSON log line, got %q: %v", buf.String(), err)
+	}
+	if line["method"] != "GET" || line["key"] != "missing" || line["status"] != float64(http.StatusNotFound) {
+		t.Fatalf("unexpected log line %v", line)
+	}
+	if _, ok := line["latency"]; !ok {
+		t.Fatalf("expected a latency, got %v", line)
+	}
+}
+
+func TestHTTPRequestLoggingOffAboveDebug(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+
+	var buf bytes.Buffer
+	h := NewHTTPServer(s)
+	h.SetLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	h.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/keys", nil))
+	if buf.Len() != 0 {
+		t.Fatalf("expected no request logs at info level, got %q", buf.String())
+	}
+}
+
+func TestLoggingUnaryInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	intercept := LoggingUnaryInterceptor(logger)
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/stashr.KVStore/Get"}
+	failing := func(context.Context, any) (any, error) { return nil, status.Error(codes.NotFound, "nope") }
+	if _, err := intercept(context.Background(), &pb.GetRequest{Key: "k1"}, info, failing); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected the handler's error to pass through, got %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"method=/stashr.KVStore/Get", "key=k1", "status=NotFound", "latency="} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in %q", want, out)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("k", "value", 0)
+
+	tests := []struct {
+		name       string
+		trustProxy bool
+		wantIP     string
+	}{
+		{"peer address", false, "192.0.2.1"},
+		{"forwarded for trusted proxy", true, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			h := NewHTTPServer(s)
+			h.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+			h.SetAccessLog(true, tt.trustProxy)
+
+			req := httptest.NewRequest(http.MethodGet, "/keys/k", nil)
+			req.RemoteAddr = "192.0.2.1:5555"
+			req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.0.0.1")
+			rec := httptest.NewRecorder()
+			h.Handler().ServeHTTP(rec, req)
+
+			var line map[string]any
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatalf("expected one JSON log line, got %q: %v", buf.String(), err)
+			}
+			if line["client_ip"] != tt.wantIP {
+				t.Errorf("expected client_ip %s, got %v", tt.wantIP, line["client_ip"])
+			}
+			if line["path"] != "/keys/k" || line["status"] != float64(http.StatusOK) {
+				t.Errorf("unexpected log line %v", line)
+			}
+			if line["size"] != float64(rec.Body.Len()) {
+				t.Errorf("expected size %d, got %v", rec.Body.Len(), line["size"])
+			}
+		})
+	}
+}
+
+func TestAccessLogDisabled(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+
+	var buf bytes.Buffer
+	h := NewHTTPServer(s)
+	h.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	h.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/keys", nil))
+	if buf.Len() != 0 {
+		t.Fatalf("expected no access log by default, got %q", buf.String())
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"stashr/store"
+)
+
+// storeCollector exposes the store's counters to Prometheus. It reads a
+// single Stats snapshot per scrape, so every metric in one scrape agrees and
+// concurrent scrapes need no coordination.
+type storeCollector struct {
+	store *store.Store
+
+	requests  *prometheus.Desc
+	hits      *prometheus.Desc
+	misses    *prometheus.Desc
+	keys      *prometheus.Desc
+	bytes     *prometheus.Desc
+	expired   *prometheus.Desc
+	evictions *prometheus.Desc
+}
+
+func newStoreCollector(s *store.Store) *storeCollector {
+	return &storeCollector{
+		store:     s,
+		requests:  prometheus.NewDesc("stashr_requests_total", "Store operations by type.", []string{"op"}, nil),
+		hits:      prometheus.NewDesc("stashr_cache_hits_total", "Get lookups that found a live key.", nil, nil),
+		misses:    prometheus.NewDesc("stashr_cache_misses_total", "Get lookups of missing or expired keys.", nil, nil),
+		keys:      prometheus.NewDesc("stashr_keys", "Keys currently held, including expired keys not yet swept.", nil, nil),
+		bytes:     prometheus.NewDesc("stashr_bytes", "Approximate memory used by keys and values.", nil, nil),
+		expired:   prometheus.NewDesc("stashr_expired_keys_total", "Keys removed because their TTL elapsed.", nil, nil),
+		evictions: prometheus.NewDesc("stashr_evicted_keys_total", "Keys evicted to stay within -max-keys or -max-bytes.", nil, nil),
+	}
+}
+
+func (c *storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c *storeCollector) Collect(ch chan<- prometheus.Metric) {
+	st := c.store.Stats()
+	ch <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(st.Hits+st.Misses), "get")
+	ch <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(st.Sets), "set")
+	ch <- prometheus.MustNewConstMetric(c.requests, prometheus.CounterValue, float64(st.Deletes), "delete")
+	ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(st.Hits))
+	ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(st.Misses))
+	ch <- prometheus.MustNewConstMetric(c.keys, prometheus.GaugeValue, float64(st.Keys))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(st.Bytes))
+	ch <- prometheus.MustNewConstMetric(c.expired, prometheus.CounterValue, float64(st.Expirations))
+	ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(st.Evictions))
+}
+
+// metricsHandler returns the /metrics handler: a registry of its own holding
+// the store's counters plus the Go runtime and process collectors, served by
+// promhttp. Everything is registered here, once per server, so scrapes never
+// register anything and cannot conflict.
+func metricsHandler(s *store.Store) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		newStoreCollector(s),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"stashr/store"
+)
+
+func TestMetrics(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+	s.Set("a", "1", 0)
+	s.Get("a")
+	s.Get("missing")
+
+	// Concurrent scrapes share one registry and must not conflict.
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("expected 200, got %d", rec.Code)
+			}
+		}()
+	}
+	wg.Wait()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		`stashr_requests_total{op="get"} 2`,
+		`stashr_requests_total{op="set"} 1`,
+		"stashr_cache_hits_total 1",
+		"stashr_cache_misses_total 1",
+		"stashr_keys 1",
+		"# TYPE stashr_expired_keys_total counter",
+		"go_goroutines ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the metrics, got:\n%s", want, body)
+		}
+	}
+}
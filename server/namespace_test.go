@@ -0,0 +1,84 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"stashr/store"
+)
+
+func TestHTTPNamespaces(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodPut, "/ns/app/keys/k", `{"value":"scoped"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", rec.Code)
+	}
+	do(http.MethodPut, "/keys/k", `{"value":"default"}`)
+
+	if rec := do(http.MethodGet, "/ns/app/keys/k", ""); !strings.Contains(rec.Body.String(), `"scoped"`) {
+		t.Fatalf("expected the namespaced value, got %s", rec.Body)
+	}
+	if rec := do(http.MethodGet, "/keys/k", ""); !strings.Contains(rec.Body.String(), `"default"`) {
+		t.Fatalf("expected the default value, got %s", rec.Body)
+	}
+	if rec := do(http.MethodGet, "/keys", ""); strings.TrimSpace(rec.Body.String()) != `{"keys":["k"],"count":1}` {
+		t.Fatalf("expected the default listing to hold one key, got %s", rec.Body)
+	}
+
+	do(http.MethodPut, "/ns/app/keys/k2", `{"value":"v"}`)
+	if rec := do(http.MethodGet, "/count", ""); strings.TrimSpace(rec.Body.String()) != `{"count":1}` {
+		t.Fatalf("expected a count of 1, got %s", rec.Body)
+	}
+	if rec := do(http.MethodGet, "/ns/app/count", ""); strings.TrimSpace(rec.Body.String()) != `{"count":2}` {
+		t.Fatalf("expected a namespace count of 2, got %s", rec.Body)
+	}
+
+	if rec := do(http.MethodDelete, "/ns/app", ""); strings.TrimSpace(rec.Body.String()) != `{"deleted":2}` {
+		t.Fatalf("expected two keys deleted, got %s", rec.Body)
+	}
+	if rec := do(http.MethodGet, "/ns/app/keys/k", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 after deleting the namespace, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/keys/k", ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected the default key to survive, got %d", rec.Code)
+	}
+}
+
+func TestHTTPDefaultNamespaceCannotReachNamedOnes(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	handler := NewHTTPServer(s).Handler()
+	s.Namespace("tenantA").Set("secret", "mine", 0)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	const forged = "/keys/%007%00tenantAsecret"
+	if rec := do(http.MethodPut, forged, `{"value":"pwned"}`); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a reserved key, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, forged, ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 deleting a reserved key, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, forged, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 reading a reserved key, got %d: %s", rec.Code, rec.Body)
+	}
+	if v, _ := s.Namespace("tenantA").Get("secret"); v != "mine" {
+		t.Fatalf("expected tenantA's key to be untouched, got %q", v)
+	}
+}
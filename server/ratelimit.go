@@ -0,0 +1,206 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RateLimitKey selects what identifies a client to a RateLimiter.
+type RateLimitKey int
+
+const (
+	// RateLimitByIP gives every client address its own budget.
+	RateLimitByIP RateLimitKey = iota
+	// RateLimitByToken gives every bearer token its own budget, so clients
+	// sharing an address through a proxy or NAT do not starve each other.
+	// Only the tokens given to SetTokens count; requests without one fall
+	// back to their address.
+	RateLimitByToken
+)
+
+// ParseRateLimitKey parses "ip" or "token".
+func ParseRateLimitKey(s string) (RateLimitKey, error) {
+	switch s {
+	case "ip":
+		return RateLimitByIP, nil
+	case "token":
+		return RateLimitByToken, nil
+	}
+	return 0, fmt.Errorf(`want "ip" or "token", got %q`, s)
+}
+
+// limiterSweepEvery is how often Allow drops the limiters of idle clients.
+const limiterSweepEvery = time.Minute
+
+// RateLimiter allows each client a steady rate of requests plus bursts, with
+// a rate.Limiter per client. One limiter can back both the HTTP middleware
+// and the gRPC interceptors, so a client's budget covers both APIs.
+type RateLimiter struct {
+	limit  rate.Limit
+	burst  int
+	key    RateLimitKey
+	tokens map[string]bool
+	now    func() time.Time
+
+	mu        sync.Mutex
+	clients   map[string]*rate.Limiter
+	lastSweep time.Time
+}
+
+// NewRateLimiter returns a limiter allowing perSecond requests per second per
+// client, in bursts of up to burst. perSecond must be positive; a burst below
+// one is raised to one.
+func NewRateLimiter(perSecond float64, burst int, key RateLimitKey) *RateLimiter {
+	return &RateLimiter{
+		limit:   rate.Limit(perSecond),
+		burst:   max(burst, 1),
+		key:     key,
+		now:     time.Now,
+		clients: make(map[string]*rate.Limiter),
+	}
+}
+
+// SetTokens lists the bearer tokens that identify a client under
+// RateLimitByToken, normally the auth and admin tokens; empty ones are
+// ignored. A request carrying any other token is limited by its address, so
+// a client cannot get a fresh budget by sending a new made-up token each
+// time. Call it before the limiter is in use.
+func (l *RateLimiter) SetTokens(tokens ...string) {
+	l.tokens = make(map[string]bool, len(tokens))
+	for _, t := range tokens {
+		if t != "" {
+			l.tokens[t] = true
+		}
+	}
+}
+
+// client names the client a request comes from for Allow: its bearer token
+// under RateLimitByToken if that is one of the known tokens, otherwise addr.
+func (l *RateLimiter) client(addr, authorization string) string {
+	if l.key == RateLimitByToken {
+		if token, ok := strings.CutPrefix(authorization, "Bearer "); ok && l.tokens[token] {
+			return "token:" + token
+		}
+	}
+	return addr
+}
+
+// Allow takes a token from client's bucket. If there is none it returns false
+// and how long until there will be.
+func (l *RateLimiter) Allow(client string) (bool, time.Duration) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) >= limiterSweepEvery {
+		l.sweep(now)
+	}
+	lim, ok := l.clients[client]
+	if !ok {
+		lim = rate.NewLimiter(l.limit, l.burst)
+		l.clients[client] = lim
+	}
+	r := lim.ReserveN(now, 1)
+	if wait := r.DelayFrom(now); wait > 0 {
+		// Refused requests must not use up tokens, or a client retrying too
+		// early would push its next allowed request further away.
+		r.CancelAt(now)
+		return false, wait
+	}
+	return true, 0
+}
+
+// sweep drops the limiters that have refilled completely, which are no
+// different from a client never seen, so the map only holds active clients.
+// Caller must hold l.mu.
+func (l *RateLimiter) sweep(now time.Time) {
+	for client, lim := range l.clients {
+		if lim.TokensAt(now) >= float64(l.burst) {
+			delete(l.clients, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// SetRateLimiter applies l to every request except the health and metrics
+// probes. Clients over their limit get 429 with a Retry-After header. A nil
+// limiter, the default, disables rate limiting.
+func (h *HTTPServer) SetRateLimiter(l *RateLimiter) {
+	h.limiter = l
+}
+
+// rateLimit wraps next with the limiter configured by SetRateLimiter.
+func (h *HTTPServer) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.limiter == nil || probePaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := h.limiter.client(h.clientIP(r), r.Header.Get("Authorization"))
+		if ok, wait := h.limiter.Allow(client); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RateLimitUnaryInterceptor rejects unary calls from clients over l's limit
+// with codes.ResourceExhausted. It is a no-op when l is nil.
+func RateLimitUnaryInterceptor(l *RateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := l.check(ctx); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitStreamInterceptor is the streaming counterpart of
+// RateLimitUnaryInterceptor. A stream counts as one request however many
+// messages it carries.
+func RateLimitStreamInterceptor(l *RateLimiter) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := l.check(ss.Context()); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// check takes a token for the gRPC client of ctx.
+func (l *RateLimiter) check(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	var addr, authorization string
+	if p, ok := peer.FromContext(ctx); ok {
+		addr = p.Addr.String()
+		if host, _, err := net.SplitHostPort(addr); err == nil {
+			addr = host
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			authorization = v[0]
+		}
+	}
+	if ok, wait := l.Allow(l.client(addr, authorization)); !ok {
+		return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %v", wait.Round(time.Millisecond))
+	}
+	return nil
+}
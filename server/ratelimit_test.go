@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"stashr/store"
+)
+
+func TestRateLimiterBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter(2, 3, RateLimitByIP)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatalf("expected request %d of the burst to pass", i+1)
+		}
+	}
+	ok, wait := l.Allow("a")
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("expected a refusal with a 500ms wait, got %v %v", ok, wait)
+	}
+	if ok, _ := l.Allow("b"); !ok {
+		t.Fatal("expected another client to have its own budget")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if ok, _ := l.Allow("a"); !ok {
+		t.Fatal("expected a token after waiting")
+	}
+
+	now = now.Add(limiterSweepEvery)
+	l.Allow("c")
+	if _, ok := l.clients["a"]; ok {
+		t.Fatal("expected the idle client's limiter to be evicted")
+	}
+}
+
+func TestRateLimitHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	l := NewRateLimiter(1, 2, RateLimitByToken)
+	l.SetTokens("alice", "bob")
+	h.SetRateLimiter(l)
+	handler := h.Handler()
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	for i := 0; i < 2; i++ {
+		if rec := get("/keys", "alice"); rec.Code != http.StatusOK {
+			t.Fatalf("expected request %d to pass, got %d", i+1, rec.Code)
+		}
+	}
+	rec := get("/keys", "alice")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "1" {
+		t.Fatalf("expected 429 with Retry-After: 1, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := get("/keys", "bob"); rec.Code != http.StatusOK {
+		t.Fatalf("expected another token from the same address to pass, got %d", rec.Code)
+	}
+	if rec := get("/healthz", "alice"); rec.Code != http.StatusOK {
+		t.Fatalf("expected probes to be exempt, got %d", rec.Code)
+	}
+}
+
+func TestRateLimitUnknownTokens(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	l := NewRateLimiter(1, 2, RateLimitByToken)
+	l.SetTokens("alice")
+	h.SetRateLimiter(l)
+	handler := h.Handler()
+
+	var codes []int
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/keys", nil)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer bogus-%d", i))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Fatalf("expected made-up tokens to share their address's budget, got %v", codes)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.clients) != 1 {
+		t.Fatalf("expected one limiter for the address, got %d", len(l.clients))
+	}
+}
+
+func TestRateLimitGRPC(t *testing.T) {
+	l := NewRateLimiter(1, 1, RateLimitByToken)
+	l.SetTokens("t")
+	interceptor := RateLimitUnaryInterceptor(l)
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/stashr.KVStore/Get"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer t"))
+
+	if _, err := interceptor(ctx, nil, info, handler); err != nil {
+		t.Fatalf("expected the first call to pass, got %v", err)
+	}
+	if _, err := interceptor(ctx, nil, info, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("expected ResourceExhausted, got %v", err)
+	}
+
+	// Made-up tokens fall back to the peer address, which has one budget.
+	for i, want := range []codes.Code{codes.OK, codes.ResourceExhausted} {
+		bogus := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", fmt.Sprintf("Bearer bogus-%d", i)))
+		if _, err := interceptor(bogus, nil, info, handler); status.Code(err) != want {
+			t.Fatalf("call %d with a made-up token: expected %v, got %v", i+1, want, err)
+		}
+	}
+
+	if _, err := RateLimitUnaryInterceptor(nil)(ctx, nil, info, handler); err != nil {
+		t.Fatalf("expected a nil limiter to allow everything, got %v", err)
+	}
+}
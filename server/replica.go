@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"stashr/pb"
+	"stashr/store"
+)
+
+// Backoff between attempts to reach the leader, doubling from
+// followRetryMin after each failure up to followRetryMax.
+const (
+	followRetryMin = time.Second
+	followRetryMax = 30 * time.Second
+)
+
+// Follow keeps s a copy of the leader client is connected to until ctx is
+// done. It opens a Replicate stream and applies it to s; whenever the stream
+// is lost it waits and opens a new one, which starts with a full copy of the
+// leader so nothing missed in between is lost. s should already have been
+// made a follower with SetLeader so that it rejects writes of its own.
+func Follow(ctx context.Context, s *store.Store, client pb.KVStoreClient, logger *slog.Logger) {
+	wait := followRetryMin
+	for {
+		received := false
+		err := follow(ctx, s, client, &received)
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			wait = followRetryMin
+		}
+		logger.Warn("replication stream lost; reconnecting", "err", err, "retry_in", wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return
+		}
+		wait = min(wait*2, followRetryMax)
+	}
+}
+
+// follow applies one Replicate stream to s until it fails, setting received
+// once anything has arrived over it.
+func follow(ctx context.Context, s *store.Store, client pb.KVStoreClient, received *bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Replicate(ctx, &pb.ReplicateRequest{})
+	if err != nil {
+		return err
+	}
+	return s.ApplyReplication(func() ([]byte, error) {
+		rec, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		*received = true
+		return rec.Record, nil
+	})
+}
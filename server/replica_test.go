@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"stashr/store"
+)
+
+func TestFollow(t *testing.T) {
+	leader := store.New()
+	defer leader.Stop()
+	leader.Set("a", "1", 0)
+	follower := store.New()
+	defer follower.Stop()
+	follower.SetLeader("leader:9090")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Follow(ctx, follower, dialBufconn(t, leader), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	leader.Set("b", "2", time.Hour)
+	deadline := time.Now().Add(5 * time.Second)
+	for !follower.Exists("a") || !follower.Exists("b") {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the follower to catch up")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, hasTTL, _ := follower.TTL("b"); !hasTTL {
+		t.Fatal("expected the TTL to be replicated")
+	}
+
+	rec := httptest.NewRecorder()
+	NewHTTPServer(follower).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/keys/c", strings.NewReader(`{"value":"v"}`)))
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `"leader":"leader:9090"`) {
+		t.Fatalf("expected a 403 naming the leader, got %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,542 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"stashr/store"
+)
+
+// ErrRESPServerClosed is returned by RESPServer.Serve after Close.
+var ErrRESPServerClosed = errors.New("resp server closed")
+
+// Limits on what a RESP client may send before a command is rejected as a
+// protocol error. Bulk strings are further capped by SetMaxArgBytes, and whole
+// commands by SetMaxCommandBytes. Until a
+// client has authenticated it gets the much smaller limits Redis applies to
+// unauthenticated clients, which are plenty for AUTH and QUIT.
+const (
+	respMaxInline       = 64 << 10  // bytes in an inline command or a header line
+	respMaxArgs         = 1 << 20   // arguments in one command
+	respMaxBulk         = 512 << 20 // bytes in a bulk string, as Redis's proto-max-bulk-len
+	respMaxArgsUnauthed = 10        // arguments in one command before AUTH
+	respMaxBulkUnauthed = 16 << 10  // bytes in a bulk string before AUTH
+)
+
+// RESPServer speaks enough of the Redis serialization protocol (RESP) for
+// existing Redis clients to use the store for simple commands: GET, SET with
+// EX, PX and NX, DEL, EXISTS, EXPIRE, TTL and INCR, plus PING, ECHO, AUTH and
+// QUIT. Every other command gets a RESP error. Commands act on the default
+// namespace.
+type RESPServer struct {
+	store           *store.Store
+	authToken       string
+	maxArgBytes     int64
+	maxCommandBytes int64
+	logger          *slog.Logger
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+func NewRESPServer(s *store.Store) *RESPServer {
+	return &RESPServer{
+		store:     s,
+		logger:    slog.Default(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// SetAuthToken requires clients to send AUTH with token before any other
+// command, as with a Redis requirepass. An empty token disables auth.
+func (rs *RESPServer) SetAuthToken(token string) {
+	rs.authToken = token
+}
+
+// SetMaxArgBytes caps the length of each argument a client sends. A longer
+// one is a protocol error and closes the connection before it is buffered.
+// Zero, the default, means unlimited.
+func (rs *RESPServer) SetMaxArgBytes(n int64) {
+	rs.maxArgBytes = n
+}
+
+// SetMaxCommandBytes caps the total length of the arguments of one command,
+// so that many arguments each within SetMaxArgBytes cannot add up to an
+// unbounded amount of memory. A command that would exceed it is a
+// protocol error and closes the connection before the argument that crosses
+// the limit is buffered. Zero, the default, means unlimited.
+func (rs *RESPServer) SetMaxCommandBytes(n int64) {
+	rs.maxCommandBytes = n
+}
+
+// SetLogger sets the logger for connection errors. The default is
+// slog.Default().
+func (rs *RESPServer) SetLogger(l *slog.Logger) {
+	rs.logger = l
+}
+
+// Serve accepts connections on lis and serves each on its own goroutine until
+// lis fails or Close is called, when it returns ErrRESPServerClosed.
+func (rs *RESPServer) Serve(lis net.Listener) error {
+	rs.mu.Lock()
+	if rs.closed {
+		rs.mu.Unlock()
+		lis.Close()
+		return ErrRESPServerClosed
+	}
+	rs.listeners[lis] = struct{}{}
+	rs.mu.Unlock()
+	defer func() {
+		rs.mu.Lock()
+		delete(rs.listeners, lis)
+		rs.mu.Unlock()
+	}()
+
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			rs.mu.Lock()
+			closed := rs.closed
+			rs.mu.Unlock()
+			if closed {
+				return ErrRESPServerClosed
+			}
+			return err
+		}
+		rs.mu.Lock()
+		if rs.closed {
+			rs.mu.Unlock()
+			conn.Close()
+			return ErrRESPServerClosed
+		}
+		rs.conns[conn] = struct{}{}
+		rs.mu.Unlock()
+		go rs.serveConn(conn)
+	}
+}
+
+// Close stops every Serve call and closes every open connection. Commands
+// already running finish, but their replies may be lost.
+func (rs *RESPServer) Close() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.closed = true
+	for lis := range rs.listeners {
+		lis.Close()
+	}
+	for conn := range rs.conns {
+		conn.Close()
+	}
+	return nil
+}
+
+// respConn is the state of one client connection.
+type respConn struct {
+	ns     *store.Namespace
+	w      *bufio.Writer
+	authed bool
+	quit   bool
+}
+
+func (rs *RESPServer) serveConn(conn net.Conn) {
+	defer func() {
+		rs.mu.Lock()
+		delete(rs.conns, conn)
+		rs.mu.Unlock()
+		conn.Close()
+	}()
+	br := bufio.NewReader(conn)
+	c := &respConn{
+		ns:     rs.store.Namespace("").WithSource("resp " + conn.RemoteAddr().String()),
+		w:      bufio.NewWriter(conn),
+		authed: rs.authToken == "",
+	}
+	for !c.quit {
+		maxArgs, maxBulk := respMaxArgsUnauthed, int64(respMaxBulkUnauthed)
+		if c.authed {
+			maxArgs, maxBulk = respMaxArgs, respMaxBulk
+			if rs.maxArgBytes > 0 {
+				maxBulk = min(maxBulk, rs.maxArgBytes)
+			}
+		}
+		args, err := readCommand(br, maxArgs, maxBulk, rs.maxCommandBytes)
+		if err != nil {
+			var perr respProtocolError
+			if errors.As(err, &perr) {
+				c.error("ERR Protocol error: " + string(perr))
+				c.w.Flush()
+				rs.logger.Debug("resp protocol error", "client", conn.RemoteAddr().String(), "err", err)
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		rs.exec(c, args)
+		// Only flush once every pipelined command already received has been
+		// answered, so a pipeline costs one write rather than one per command.
+		if br.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	c.w.Flush()
+}
+
+// respProtocolError is malformed input, after which the connection cannot be
+// resynchronized and is closed.
+type respProtocolError string
+
+func (e respProtocolError) Error() string { return string(e) }
+
+// readCommand reads one command, either a RESP array of bulk strings, as sent
+// by client libraries, or an inline command of space-separated words, as
+// typed into telnet. An array of more than maxArgs elements, a bulk string
+// longer than maxBulk, or bulk strings adding up to more than maxTotal bytes,
+// unless it is zero, is a protocol error. The arguments and each bulk
+// string are buffered as they arrive rather than allocated up front from
+// their headers, so a client cannot make the server reserve memory for data
+// it never sends.
+func readCommand(br *bufio.Reader, maxArgs int, maxBulk, maxTotal int64) ([]string, error) {
+	line, err := readLine(br)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, respProtocolError("invalid multibulk length")
+	}
+	var args []string
+	var total int64
+	for range n {
+		line, err := readLine(br)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, respProtocolError(fmt.Sprintf("expected '$', got '%.1s'", line))
+		}
+		size, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil || size < 0 || size > maxBulk {
+			return nil, respProtocolError("invalid bulk length")
+		}
+		if total += size; maxTotal > 0 && total > maxTotal {
+			return nil, respProtocolError("command too large")
+		}
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, br, size+2); err != nil {
+			return nil, err
+		}
+		b := buf.Bytes()
+		if string(b[size:]) != "\r\n" {
+			return nil, respProtocolError("bulk string not terminated by CRLF")
+		}
+		args = append(args, string(b[:size]))
+	}
+	return args, nil
+}
+
+// readLine reads a line ending in "\n", with any "\r" before it removed,
+// rejecting lines longer than respMaxInline.
+func readLine(br *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		line = append(line, chunk...)
+		if len(line) > respMaxInline {
+			return "", respProtocolError("too big inline request")
+		}
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, bufio.ErrBufferFull) {
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"), nil
+}
+
+// exec runs one command and writes its reply.
+func (rs *RESPServer) exec(c *respConn, args []string) {
+	name := strings.ToUpper(args[0])
+	args = args[1:]
+	if !c.authed && name != "AUTH" && name != "QUIT" {
+		c.error("NOAUTH Authentication required.")
+		return
+	}
+	switch name {
+	case "PING":
+		switch len(args) {
+		case 0:
+			c.simple("PONG")
+		case 1:
+			c.bulk(args[0])
+		default:
+			c.wrongArgs(name)
+		}
+	case "ECHO":
+		if len(args) != 1 {
+			c.wrongArgs(name)
+			return
+		}
+		c.bulk(args[0])
+	case "QUIT":
+		c.simple("OK")
+		c.quit = true
+	case "AUTH":
+		rs.auth(c, args)
+	case "COMMAND":
+		// redis-cli asks for command docs on connect; an empty reply is
+		// enough for it to carry on.
+		c.w.WriteString("*0\r\n")
+	case "GET":
+		if len(args) != 1 {
+			c.wrongArgs(name)
+			return
+		}
+		if val, ok := c.ns.Get(args[0]); ok {
+			c.bulk(val)
+		} else {
+			c.null()
+		}
+	case "SET":
+		rs.set(c, args)
+	case "DEL":
+		if len(args) == 0 {
+			c.wrongArgs(name)
+			return
+		}
+		n := 0
+		for _, k := range args {
+			deleted, err := c.ns.Delete(k)
+			if err != nil {
+				c.storeError(err)
+				return
+			}
+			if deleted {
+				n++
+			}
+		}
+		c.integer(int64(n))
+	case "EXISTS":
+		if len(args) == 0 {
+			c.wrongArgs(name)
+			return
+		}
+		n := 0
+		for _, k := range args {
+			if c.ns.Exists(k) {
+				n++
+			}
+		}
+		c.integer(int64(n))
+	case "EXPIRE":
+		rs.expire(c, args)
+	case "TTL":
+		if len(args) != 1 {
+			c.wrongArgs(name)
+			return
+		}
+		ttl, hasTTL, ok := c.ns.TTL(args[0])
+		switch {
+		case !ok:
+			c.integer(-2)
+		case !hasTTL:
+			c.integer(-1)
+		default:
+			c.integer(ceilSeconds(ttl))
+		}
+	case "INCR":
+		if len(args) != 1 {
+			c.wrongArgs(name)
+			return
+		}
+		v, err := c.ns.Incr(args[0], 1)
+		if err != nil {
+			c.storeError(err)
+			return
+		}
+		c.integer(v)
+	default:
+		c.error(fmt.Sprintf("ERR unknown command '%s'", shorten(name)))
+	}
+}
+
+// shorten truncates a command name for an error reply, so a client sending
+// garbage does not get it all echoed back.
+func shorten(name string) string {
+	if len(name) > 128 {
+		return name[:128] + "..."
+	}
+	return name
+}
+
+// auth handles AUTH password, and AUTH username password for Redis 6 clients,
+// which is accepted whatever the username.
+func (rs *RESPServer) auth(c *respConn, args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		c.wrongArgs("AUTH")
+		return
+	}
+	if rs.authToken == "" {
+		c.error("ERR AUTH called without any password configured")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(args[len(args)-1]), []byte(rs.authToken)) != 1 {
+		c.error("WRONGPASS invalid username-password pair")
+		return
+	}
+	c.authed = true
+	c.simple("OK")
+}
+
+// set handles SET key value [EX seconds | PX milliseconds] [NX].
+func (rs *RESPServer) set(c *respConn, args []string) {
+	if len(args) < 2 {
+		c.wrongArgs("SET")
+		return
+	}
+	key, value := args[0], args[1]
+	var ttl time.Duration
+	var nx, hasTTL bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "NX" && !nx:
+			nx = true
+		case (opt == "EX" || opt == "PX") && !hasTTL && i+1 < len(args):
+			i++
+			n, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil || n <= 0 {
+				c.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			if n > int64(1<<63-1)/int64(unit) {
+				c.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl, hasTTL = time.Duration(n)*unit, true
+		default:
+			c.error("ERR syntax error")
+			return
+		}
+	}
+	if nx {
+		written, err := c.ns.SetNX(key, value, ttl)
+		switch {
+		case err != nil:
+			c.storeError(err)
+		case written:
+			c.simple("OK")
+		default:
+			c.null()
+		}
+		return
+	}
+	if err := c.ns.Set(key, value, ttl); err != nil {
+		c.storeError(err)
+		return
+	}
+	c.simple("OK")
+}
+
+// expire handles EXPIRE key seconds. As in Redis, a non-positive TTL deletes
+// the key.
+func (rs *RESPServer) expire(c *respConn, args []string) {
+	if len(args) != 2 {
+		c.wrongArgs("EXPIRE")
+		return
+	}
+	secs, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || secs > int64(1<<63-1)/int64(time.Second) {
+		c.error("ERR value is not an integer or out of range")
+		return
+	}
+	var ok bool
+	if secs <= 0 {
+		ok, err = c.ns.Delete(args[0])
+	} else {
+		ok, err = c.ns.Expire(args[0], time.Duration(secs)*time.Second)
+	}
+	if err != nil {
+		c.storeError(err)
+		return
+	}
+	if ok {
+		c.integer(1)
+	} else {
+		c.integer(0)
+	}
+}
+
+func (c *respConn) simple(s string) {
+	c.w.WriteString("+" + s + "\r\n")
+}
+
+func (c *respConn) error(msg string) {
+	c.w.WriteString("-" + msg + "\r\n")
+}
+
+func (c *respConn) integer(n int64) {
+	c.w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (c *respConn) bulk(s string) {
+	c.w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n")
+	c.w.WriteString(s)
+	c.w.WriteString("\r\n")
+}
+
+func (c *respConn) null() {
+	c.w.WriteString("$-1\r\n")
+}
+
+func (c *respConn) wrongArgs(name string) {
+	c.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+}
+
+// storeError reports a failed store write, mapping the store's errors to the
+// replies Redis gives for the same conditions where there is one.
+func (c *respConn) storeError(err error) {
+	var follower *store.FollowerError
+	switch {
+	case errors.Is(err, store.ErrNotInteger), errors.Is(err, store.ErrOverflow):
+		c.error("ERR value is not an integer or out of range")
+	case errors.Is(err, store.ErrWrongType):
+		c.error("WRONGTYPE Operation against a key holding the wrong kind of value")
+	case errors.Is(err, store.ErrKeyTooLarge):
+		c.error("ERR key too large")
+	case errors.Is(err, store.ErrReservedKey):
+		c.error("ERR keys starting with NUL are reserved")
+	case errors.Is(err, store.ErrValueTooLarge):
+		c.error("ERR value too large")
+	case errors.As(err, &follower):
+		c.error("READONLY You can't write against a read only replica. Leader is " + follower.Leader)
+	case errors.Is(err, store.ErrReadOnly):
+		c.error("READONLY store is read-only")
+	case errors.Is(err, store.ErrStoreClosed):
+		c.error("ERR store closed")
+	default:
+		c.error("ERR internal error")
+	}
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"stashr/store"
+)
+
+// dialRESP starts a RESPServer for s and returns a client connection to it
+// and a reader for its replies.
+func dialRESP(t *testing.T, rs *RESPServer) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go rs.Serve(lis)
+	t.Cleanup(func() { rs.Close() })
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+// respCommand encodes args as a RESP array of bulk strings, as clients send.
+func respCommand(args ...string) string {
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		b.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+	return b.String()
+}
+
+// readReply reads one reply, returning bulk strings with their header so the
+// test can tell them from simple strings.
+func readReply(t *testing.T, br *bufio.Reader) string {
+	t.Helper()
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasPrefix(line, "$") && line != "$-1\r\n" {
+		n, err := strconv.Atoi(line[1 : len(line)-2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			t.Fatal(err)
+		}
+		line += string(buf)
+	}
+	return line
+}
+
+func TestRESPCommands(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	conn, br := dialRESP(t, NewRESPServer(s))
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{respCommand("PING"), "+PONG\r\n"},
+		{respCommand("SET", "k", "hello world"), "+OK\r\n"},
+		{respCommand("GET", "k"), "$11\r\nhello world\r\n"},
+		{respCommand("GET", "missing"), "$-1\r\n"},
+		{respCommand("SET", "k", "v", "NX"), "$-1\r\n"},
+		{respCommand("SET", "t", "v", "EX", "100"), "+OK\r\n"},
+		{respCommand("TTL", "t"), ":100\r\n"},
+		{respCommand("SET", "p", "v", "px", "1500"), "+OK\r\n"},
+		{respCommand("TTL", "p"), ":2\r\n"},
+		{respCommand("TTL", "k"), ":-1\r\n"},
+		{respCommand("TTL", "missing"), ":-2\r\n"},
+		{respCommand("EXPIRE", "k", "60"), ":1\r\n"},
+		{respCommand("EXPIRE", "missing", "60"), ":0\r\n"},
+		{respCommand("EXISTS", "k", "t", "missing"), ":2\r\n"},
+		{respCommand("INCR", "n"), ":1\r\n"},
+		{respCommand("INCR", "n"), ":2\r\n"},
+		{respCommand("INCR", "k"), "-ERR value is not an integer or out of range\r\n"},
+		{respCommand("DEL", "k", "t", "missing"), ":2\r\n"},
+		{respCommand("SET", "k", "v", "EX", "0"), "-ERR invalid expire time in 'set' command\r\n"},
+		{respCommand("SET", "k", "v", "XX"), "-ERR syntax error\r\n"},
+		{respCommand("GET"), "-ERR wrong number of arguments for 'get' command\r\n"},
+		{respCommand("HSET", "h", "f", "v"), "-ERR unknown command 'HSET'\r\n"},
+		{respCommand("SET", "\x003\x00appk", "v"), "-ERR keys starting with NUL are reserved\r\n"},
+		{"SET inline value\r\n", "+OK\r\n"},
+		{"GET inline\r\n", "$5\r\nvalue\r\n"},
+	}
+	for _, tt := range tests {
+		if _, err := io.WriteString(conn, tt.cmd); err != nil {
+			t.Fatal(err)
+		}
+		if got := readReply(t, br); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.cmd, tt.want, got)
+		}
+	}
+	if v, _ := s.Get("n"); v != "2" {
+		t.Fatalf("expected INCR to write through to the store, got %q", v)
+	}
+}
+
+func TestRESPPipelineAndQuit(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	conn, br := dialRESP(t, NewRESPServer(s))
+
+	io.WriteString(conn, respCommand("SET", "a", "1")+respCommand("INCR", "a")+respCommand("QUIT"))
+	for _, want := range []string{"+OK\r\n", ":2\r\n", "+OK\r\n"} {
+		if got := readReply(t, br); got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Fatalf("expected QUIT to close the connection, got %v", err)
+	}
+}
+
+func TestRESPAuth(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	rs := NewRESPServer(s)
+	rs.SetAuthToken("secret")
+	conn, br := dialRESP(t, rs)
+
+	for _, tt := range []struct{ cmd, want string }{
+		{respCommand("GET", "k"), "-NOAUTH Authentication required.\r\n"},
+		{respCommand("AUTH", "wrong"), "-WRONGPASS invalid username-password pair\r\n"},
+		{respCommand("AUTH", "default", "secret"), "+OK\r\n"},
+		{respCommand("GET", "k"), "$-1\r\n"},
+	} {
+		io.WriteString(conn, tt.cmd)
+		if got := readReply(t, br); got != tt.want {
+			t.Fatalf("%q: expected %q, got %q", tt.cmd, tt.want, got)
+		}
+	}
+}
+
+func TestRESPProtocolError(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	rs := NewRESPServer(s)
+	rs.SetMaxArgBytes(4)
+	conn, br := dialRESP(t, rs)
+
+	io.WriteString(conn, respCommand("SET", "k", "too long"))
+	if got := readReply(t, br); !strings.HasPrefix(got, "-ERR Protocol error") {
+		t.Fatalf("expected a protocol error, got %q", got)
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Fatalf("expected the connection to be closed, got %v", err)
+	}
+	if s.Exists("k") {
+		t.Fatal("expected the oversized command not to run")
+	}
+}
+
+func TestRESPHugeBulkLength(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+
+	for _, size := range []string{"9223372036854775807", "9223372036854775806", strconv.Itoa(respMaxBulk + 1)} {
+		t.Run(size, func(t *testing.T) {
+			rs := NewRESPServer(s)
+			rs.SetAuthToken("secret") // the length is checked before AUTH
+			conn, br := dialRESP(t, rs)
+			io.WriteString(conn, "*1\r\n$"+size+"\r\n")
+			if got := readReply(t, br); !strings.HasPrefix(got, "-ERR Protocol error: invalid bulk length") {
+				t.Fatalf("expected a protocol error, got %q", got)
+			}
+			if _, err := br.ReadByte(); err != io.EOF {
+				t.Fatalf("expected the connection to be closed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestRESPUnauthenticatedLimits(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+
+	for name, tt := range map[string]struct{ cmd, want string }{
+		"multibulk": {"*1048576\r\n", "-ERR Protocol error: invalid multibulk length"},
+		"bulk":      {"*2\r\n$4\r\nAUTH\r\n$" + strconv.Itoa(respMaxBulkUnauthed+1) + "\r\n", "-ERR Protocol error: invalid bulk length"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rs := NewRESPServer(s)
+			rs.SetAuthToken("secret")
+			conn, br := dialRESP(t, rs)
+			io.WriteString(conn, tt.cmd)
+			if got := readReply(t, br); !strings.HasPrefix(got, tt.want) {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+			if _, err := br.ReadByte(); err != io.EOF {
+				t.Fatalf("expected the connection to be closed, got %v", err)
+			}
+		})
+	}
+
+	// Once authenticated the full limits apply.
+	rs := NewRESPServer(s)
+	rs.SetAuthToken("secret")
+	conn, br := dialRESP(t, rs)
+	big := strings.Repeat("v", respMaxBulkUnauthed+1)
+	io.WriteString(conn, respCommand("AUTH", "secret")+respCommand("SET", "k", big))
+	for _, want := range []string{"+OK\r\n", "+OK\r\n"} {
+		if got := readReply(t, br); got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+}
+
+func TestRESPMaxCommandBytes(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	rs := NewRESPServer(s)
+	rs.SetMaxArgBytes(8)
+	rs.SetMaxCommandBytes(16)
+	conn, br := dialRESP(t, rs)
+
+	io.WriteString(conn, respCommand("SET", "k", "12345678"))
+	if got := readReply(t, br); got != "+OK\r\n" {
+		t.Fatalf("expected a command within the limit to pass, got %q", got)
+	}
+	// Every argument fits SetMaxArgBytes, but together they do not.
+	io.WriteString(conn, respCommand("SET", "k", "87654321", "EX", "100"))
+	if got := readReply(t, br); got != "-ERR Protocol error: command too large\r\n" {
+		t.Fatalf("expected a protocol error, got %q", got)
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Fatalf("expected the connection to be closed, got %v", err)
+	}
+	if v, _ := s.Get("k"); v != "12345678" {
+		t.Fatalf("expected the oversized command not to run, got %q", v)
+	}
+}
+
+func TestRESPReadOnly(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.SetReadOnly(true)
+	conn, br := dialRESP(t, NewRESPServer(s))
+
+	io.WriteString(conn, respCommand("SET", "k", "v"))
+	if got := readReply(t, br); got != "-READONLY store is read-only\r\n" {
+		t.Fatalf("expected a READONLY error, got %q", got)
+	}
+}
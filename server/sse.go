@@ -0,0 +1,78 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// sseKeepalive is how often an idle watch stream sends a comment line so that
+// proxies don't close the connection.
+const sseKeepalive = 15 * time.Second
+
+type watchEvent struct {
+	Type            string `json:"type"`
+	Key             string `json:"key"`
+	Value           string `json:"value,omitempty"`
+	ExpiresAtUnixMs int64  `json:"expires_at_unix_ms,omitempty"`
+}
+
+// handleWatch streams changes to keys matching ?prefix= as Server-Sent Events.
+// Each event is named after its type (set, delete, expire) and carries a JSON
+// watchEvent as its data. The stream ends when the client disconnects, the
+// server shuts down, or the client falls too far behind the store.
+func (h *HTTPServer) handleWatch(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error":"streaming unsupported"}`, http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := h.namespace(r).Subscribe(r.URL.Query().Get("prefix"))
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(h.keepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			out := watchEvent{Type: ev.Type.String(), Key: ev.Key, Value: ev.Value}
+			if !ev.ExpiresAt.IsZero() {
+				out.ExpiresAtUnixMs = ev.ExpiresAt.UnixMilli()
+			}
+			data, err := json.Marshal(out)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", out.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// Close ends any open watch streams. Register it with
+// http.Server.RegisterOnShutdown so Shutdown doesn't wait on them forever.
+func (h *HTTPServer) Close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"stashr/store"
+)
+
+// watch opens a watch stream on srv at path and returns a reader for its body
+// once the store has registered the subscription. Cancelling ctx disconnects.
+func watch(t *testing.T, ctx context.Context, s *store.Store, srv *httptest.Server, path string) *bufio.Reader {
+	t.Helper()
+	before := s.Subscribers()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if n := s.Subscribers(); n != before+1 {
+		t.Fatalf("expected %d subscribers, got %d", before+1, n)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// nextMessage reads one SSE message, the lines up to a blank one.
+func nextMessage(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+		if line == "\n" {
+			return strings.Join(lines, "\n")
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+}
+
+func TestWatchHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	srv := httptest.NewServer(h.Handler())
+	defer srv.Close()
+	defer h.Close()
+
+	r := watch(t, context.Background(), s, srv, "/watch?prefix=user:")
+	s.Set("other", "ignored", 0)
+	s.Set("user:1", "alice", 0)
+	s.Namespace("app").Set("user:2", "ignored", 0)
+	s.Delete("user:1")
+
+	want := []string{
+		"event: set\ndata: {\"type\":\"set\",\"key\":\"user:1\",\"value\":\"alice\"}",
+		"event: delete\ndata: {\"type\":\"delete\",\"key\":\"user:1\"}",
+	}
+	for _, w := range want {
+		if got := nextMessage(t, r); got != w {
+			t.Fatalf("expected %q, got %q", w, got)
+		}
+	}
+
+	ns := watch(t, context.Background(), s, srv, "/ns/app/watch")
+	s.Set("user:3", "ignored", 0)
+	s.Namespace("app").Set("k", "v", 0)
+	if got, w := nextMessage(t, ns), "event: set\ndata: {\"type\":\"set\",\"key\":\"k\",\"value\":\"v\"}"; got != w {
+		t.Fatalf("expected %q, got %q", w, got)
+	}
+}
+
+func TestWatchHTTPKeepalive(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	h.keepalive = 10 * time.Millisecond
+	srv := httptest.NewServer(h.Handler())
+	defer srv.Close()
+	defer h.Close()
+
+	r := watch(t, context.Background(), s, srv, "/watch")
+	if got := nextMessage(t, r); got != ": keepalive" {
+		t.Fatalf("expected a keepalive comment, got %q", got)
+	}
+}
+
+func TestWatchHTTPDisconnect(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	srv := httptest.NewServer(h.Handler())
+	defer srv.Close()
+	defer h.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watch(t, ctx, s, srv, "/watch")
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Subscribers() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := s.Subscribers(); n != 0 {
+		t.Fatalf("expected the subscription to end with the client, got %d subscribers", n)
+	}
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+type statsResponse struct {
+	Keys            int    `json:"keys"`
+	LiveKeys        int    `json:"live_keys"`
+	KeysWithTTL     int    `json:"keys_with_ttl"`
+	Bytes           int64  `json:"bytes"`
+	Hits            uint64 `json:"hits"`
+	Misses          uint64 `json:"misses"`
+	Sets            uint64 `json:"sets"`
+	Deletes         uint64 `json:"deletes"`
+	Evictions       uint64 `json:"evictions"`
+	Expirations     uint64 `json:"expirations"`
+	ExpiredBySweep  uint64 `json:"expired_by_sweep"`
+	ExpiredOnAccess uint64 `json:"expired_on_access"`
+	UptimeSeconds   int64  `json:"uptime_seconds"`
+}
+
+// handleStats reports the store's counters as JSON. It is the same data as
+// /metrics, for tools that would rather not parse the Prometheus format. Under
+// /ns/{ns}/ it reports that namespace's counters instead.
+func (h *HTTPServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	st := h.store.Stats()
+	if r.PathValue("ns") != "" {
+		st = h.namespace(r).Stats()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statsResponse{
+		Keys:            st.Keys,
+		LiveKeys:        st.LiveKeys,
+		KeysWithTTL:     st.KeysWithTTL,
+		Bytes:           st.Bytes,
+		Hits:            st.Hits,
+		Misses:          st.Misses,
+		Sets:            st.Sets,
+		Deletes:         st.Deletes,
+		Evictions:       st.Evictions,
+		Expirations:     st.Expirations,
+		ExpiredBySweep:  st.ExpiredBySweep,
+		ExpiredOnAccess: st.ExpiredOnAccess,
+		UptimeSeconds:   int64(st.Uptime / time.Second),
+	})
+}
+
+type adminStatsResponse struct {
+	Keys            int                  `json:"keys"`
+	LiveKeys        int                  `json:"live_keys"`
+	KeysWithTTL     int                  `json:"keys_with_ttl"`
+	KeysWithoutTTL  int                  `json:"keys_without_ttl"`
+	Bytes           int64                `json:"bytes"`
+	Evictions       uint64               `json:"evictions"`
+	Expirations     uint64               `json:"expirations"`
+	Sweeps          uint64               `json:"sweeps"`
+	ExpiredBySweep  uint64               `json:"expired_by_sweep"`
+	ExpiredOnAccess uint64               `json:"expired_on_access"`
+	ReadOnly        bool                 `json:"read_only"`
+	StartedAt       time.Time            `json:"started_at"`
+	UptimeSeconds   int64                `json:"uptime_seconds"`
+	Runtime         runtimeStatsResponse `json:"runtime"`
+}
+
+type runtimeStatsResponse struct {
+	GoVersion      string `json:"go_version"`
+	GOMAXPROCS     int    `json:"gomaxprocs"`
+	Goroutines     int    `json:"goroutines"`
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapInuseBytes uint64 `json:"heap_inuse_bytes"`
+	HeapObjects    uint64 `json:"heap_objects"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+}
+
+// handleAdminStats reports an overview of the whole store and the Go runtime
+// underneath it, for people inspecting a server by hand rather than for
+// scraping. Keys and bytes count every namespace, and uptime is the server's.
+// It reads the runtime's memory statistics, which briefly stops the world, so
+// it is not meant to be polled as often as /metrics.
+func (h *HTTPServer) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	st := h.store.Stats()
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adminStatsResponse{
+		Keys:            st.Keys,
+		LiveKeys:        st.LiveKeys,
+		KeysWithTTL:     st.KeysWithTTL,
+		KeysWithoutTTL:  st.Keys - st.KeysWithTTL,
+		Bytes:           st.Bytes,
+		Evictions:       st.Evictions,
+		Expirations:     st.Expirations,
+		Sweeps:          st.Sweeps,
+		ExpiredBySweep:  st.ExpiredBySweep,
+		ExpiredOnAccess: st.ExpiredOnAccess,
+		ReadOnly:        h.store.ReadOnly(),
+		StartedAt:       h.started.UTC().Truncate(time.Second),
+		UptimeSeconds:   int64(time.Since(h.started) / time.Second),
+		Runtime: runtimeStatsResponse{
+			GoVersion:      runtime.Version(),
+			GOMAXPROCS:     runtime.GOMAXPROCS(0),
+			Goroutines:     runtime.NumGoroutine(),
+			HeapAllocBytes: mem.HeapAlloc,
+			HeapInuseBytes: mem.HeapInuse,
+			HeapObjects:    mem.HeapObjects,
+			SysBytes:       mem.Sys,
+			NumGC:          mem.NumGC,
+		},
+	})
+}
+
+// handleCount returns the number of live keys in the namespace as
+// {"count": n}. It lives at /count rather than /keys/count, where it would
+// hide a key named "count".
+func (h *HTTPServer) handleCount(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"count": h.namespace(r).Count()})
+}
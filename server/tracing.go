@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// Tracer records a server span for every HTTP request and gRPC call with the
+// OpenTelemetry SDK and exports them to a collector over OTLP/HTTP. Incoming
+// W3C trace context and baggage, in HTTP headers or gRPC metadata, make the
+// span a child of the caller's, so stashr shows up inside the caller's trace;
+// a caller that did not sample its trace is not traced here either.
+//
+// A nil *Tracer is valid and disables tracing; the HTTP middleware, gRPC
+// server option and interceptor then pass requests straight through.
+type Tracer struct {
+	provider    *sdktrace.TracerProvider
+	propagators propagation.TextMapPropagator
+	recordKeys  bool
+}
+
+// NewTracer starts a tracer exporting to the OTLP/HTTP collector at endpoint,
+// such as http://localhost:4318; the /v1/traces path is added unless present.
+// If recordKeys is false spans leave out the key, for keys that hold personal
+// data. Export failures go to the OpenTelemetry error handler, see
+// otel.SetErrorHandler. Call Close to send the last spans before exiting.
+func NewTracer(ctx context.Context, endpoint string, recordKeys bool) (*Tracer, error) {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	exp, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(url))
+	if err != nil {
+		return nil, err
+	}
+	return newTracer(recordKeys, sdktrace.WithBatcher(exp)), nil
+}
+
+// newTracer builds a tracer around a provider configured with opts, which
+// must include where spans go.
+func newTracer(recordKeys bool, opts ...sdktrace.TracerProviderOption) *Tracer {
+	opts = append(opts,
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "stashr"))),
+	)
+	return &Tracer{
+		provider:    sdktrace.NewTracerProvider(opts...),
+		propagators: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+		recordKeys:  recordKeys,
+	}
+}
+
+// Close sends any spans still queued and stops the tracer, giving up when ctx
+// ends. Spans finished afterwards are dropped.
+func (t *Tracer) Close(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
+
+// annotate adds the namespace and key a request names, if any, to span. The
+// key is left out unless keys are recorded.
+func (t *Tracer) annotate(span trace.Span, ns, key string) {
+	if ns != "" {
+		span.SetAttributes(attribute.String("stashr.namespace", ns))
+	}
+	if key != "" && t.recordKeys {
+		span.SetAttributes(attribute.String("stashr.key", key))
+	}
+}
+
+// SetTracer enables tracing of every request with t. A nil t, the default,
+// disables it.
+func (h *HTTPServer) SetTracer(t *Tracer) {
+	h.tracer = t
+}
+
+// trace records a span for each request when a tracer is set. The span is
+// named after the matched route, such as "GET /keys/{key}", so that spans for
+// different keys group together, and requests answered 5xx are marked as
+// errors.
+func (h *HTTPServer) trace(next http.Handler) http.Handler {
+	if h.tracer == nil {
+		return next
+	}
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		// The mux fills in the pattern and path values on r.
+		span := trace.SpanFromContext(r.Context())
+		if _, route, ok := strings.Cut(r.Pattern, " "); ok {
+			span.SetAttributes(attribute.String("http.route", route))
+		}
+		h.tracer.annotate(span, r.PathValue("ns"), r.PathValue("key"))
+	})
+	return otelhttp.NewHandler(inner, "",
+		otelhttp.WithTracerProvider(h.tracer.provider),
+		otelhttp.WithPropagators(h.tracer.propagators),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			if r.Pattern != "" {
+				return r.Pattern
+			}
+			return r.Method
+		}),
+	)
+}
+
+// namespaced is implemented by every request message that names a namespace.
+type namespaced interface {
+	GetNamespace() string
+}
+
+// TracingServerOption records a span with t for every gRPC call, named after
+// the method, such as "stashr.KVStore/Get". Codes that signal a server-side
+// problem, such as Unavailable, mark the span as an error; codes such as
+// NotFound describe the request and do not. It adds nothing when t is nil.
+func TracingServerOption(t *Tracer) grpc.ServerOption {
+	if t == nil {
+		return grpc.EmptyServerOption{}
+	}
+	return grpc.StatsHandler(otelgrpc.NewServerHandler(
+		otelgrpc.WithTracerProvider(t.provider),
+		otelgrpc.WithPropagators(t.propagators),
+	))
+}
+
+// TracingUnaryInterceptor adds the key and namespace each unary call names to
+// the span TracingServerOption started for it. It is a no-op when t is nil.
+func TracingUnaryInterceptor(t *Tracer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if t == nil {
+			return handler(ctx, req)
+		}
+		var ns, key string
+		if n, ok := req.(namespaced); ok {
+			ns = n.GetNamespace()
+		}
+		if k, ok := req.(keyed); ok {
+			key = k.GetKey()
+		}
+		t.annotate(trace.SpanFromContext(ctx), ns, key)
+		return handler(ctx, req)
+	}
+}
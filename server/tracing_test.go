@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"stashr/pb"
+	"stashr/store"
+)
+
+// record returns a tracer that keeps finished spans in memory, and the
+// recorder holding them.
+func record(t *testing.T, recordKeys bool) (*Tracer, *tracetest.SpanRecorder) {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	tr := newTracer(recordKeys, sdktrace.WithSpanProcessor(rec))
+	t.Cleanup(func() { tr.Close(context.Background()) })
+	return tr, rec
+}
+
+func spanAttr(sp sdktrace.ReadOnlySpan, key string) (attribute.Value, bool) {
+	for _, a := range sp.Attributes() {
+		if string(a.Key) == key {
+			return a.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+// ended waits for rec to hold n finished spans and returns them. A gRPC
+// server span can end just after the client sees the response.
+func ended(t *testing.T, rec *tracetest.SpanRecorder, n int) []sdktrace.ReadOnlySpan {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for len(rec.Ended()) < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return rec.Ended()
+}
+
+func TestTraceHTTP(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	s.Set("user:1", "v", 0)
+
+	for _, recordKeys := range []bool{true, false} {
+		tr, rec := record(t, recordKeys)
+		h := NewHTTPServer(s)
+		h.SetTracer(tr)
+
+		req := httptest.NewRequest(http.MethodGet, "/keys/user:1", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		h.Handler().ServeHTTP(httptest.NewRecorder(), req)
+		unsampled := httptest.NewRequest(http.MethodGet, "/keys/user:1", nil)
+		unsampled.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		h.Handler().ServeHTTP(httptest.NewRecorder(), unsampled)
+
+		got := rec.Ended()
+		if len(got) != 1 {
+			t.Fatalf("expected 1 span, got %d", len(got))
+		}
+		sp := got[0]
+		if sp.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sp.Parent().SpanID().String() != "00f067aa0ba902b7" {
+			t.Fatalf("expected the span to continue the caller's trace, got trace %s parent %s", sp.SpanContext().TraceID(), sp.Parent().SpanID())
+		}
+		if sp.Name() != "GET /keys/{key}" {
+			t.Fatalf("expected the span to be named after the route, got %q", sp.Name())
+		}
+		if code, _ := spanAttr(sp, "http.response.status_code"); code.AsInt64() != 200 {
+			t.Fatalf("expected status code 200, got %v", code.Emit())
+		}
+		if route, _ := spanAttr(sp, "http.route"); route.AsString() != "/keys/{key}" {
+			t.Fatalf("expected route /keys/{key}, got %q", route.AsString())
+		}
+		key, ok := spanAttr(sp, "stashr.key")
+		if recordKeys && key.AsString() != "user:1" {
+			t.Fatalf("expected the key to be recorded, got %q", key.AsString())
+		}
+		if !recordKeys && ok {
+			t.Fatalf("expected no key when keys are not recorded, got %q", key.AsString())
+		}
+	}
+}
+
+func TestTraceHTTPNamespaceAndErrors(t *testing.T) {
+	s := store.New()
+	tr, rec := record(t, true)
+	h := NewHTTPServer(s)
+	h.SetTracer(tr)
+
+	h.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ns/app/keys/k", nil))
+	s.Stop()
+	h.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(`{"value":"v"}`)))
+
+	got := rec.Ended()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(got))
+	}
+	if ns, _ := spanAttr(got[0], "stashr.namespace"); ns.AsString() != "app" {
+		t.Fatalf("expected namespace app, got %q", ns.AsString())
+	}
+	if got[0].Status().Code == otelcodes.Error {
+		t.Fatal("expected a 404 not to mark the span as an error")
+	}
+	if got[1].Status().Code != otelcodes.Error {
+		t.Fatalf("expected a 503 to mark the span as an error, got %v", got[1].Status())
+	}
+}
+
+func TestTraceGRPC(t *testing.T) {
+	s := store.New()
+	tr, rec := record(t, true)
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(TracingServerOption(tr), grpc.ChainUnaryInterceptor(TracingUnaryInterceptor(tr)))
+	pb.RegisterKVStoreServer(srv, NewGRPCServer(s))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	client := pb.NewKVStoreClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if _, err := client.Copy(ctx, &pb.CopyRequest{Key: "k", Destination: "k2", Namespace: "app"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+	ended(t, rec, 1)
+	s.Stop()
+	if _, err := client.Set(context.Background(), &pb.SetRequest{Key: "k", Value: []byte("v")}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable, got %v", err)
+	}
+
+	got := ended(t, rec, 2)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(got))
+	}
+	sp := got[0]
+	if sp.Name() != "stashr.KVStore/Copy" || sp.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("unexpected span %q in trace %s", sp.Name(), sp.SpanContext().TraceID())
+	}
+	for key, want := range map[string]string{"stashr.key": "k", "stashr.namespace": "app"} {
+		if v, _ := spanAttr(sp, key); v.AsString() != want {
+			t.Fatalf("expected %s=%q, got %q", key, want, v.AsString())
+		}
+	}
+	if sp.Status().Code == otelcodes.Error {
+		t.Fatal("expected NotFound not to mark the span as an error")
+	}
+	if got[1].Parent().IsValid() || got[1].Status().Code != otelcodes.Error {
+		t.Fatalf("expected a root span marked as an error, got parent %v status %v", got[1].Parent(), got[1].Status())
+	}
+}
+
+func TestTraceExport(t *testing.T) {
+	var exports atomic.Int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected export path %q", r.URL.Path)
+		}
+		exports.Add(1)
+	}))
+	defer collector.Close()
+
+	tr, err := NewTracer(context.Background(), collector.URL, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	h.SetTracer(tr)
+	h.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/keys/k", nil))
+	if err := tr.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := exports.Load(); n != 1 {
+		t.Fatalf("expected 1 export, got %d", n)
+	}
+}
+
+func TestTraceDisabled(t *testing.T) {
+	s := store.New()
+	defer s.Stop()
+	h := NewHTTPServer(s)
+	h.SetTracer(nil)
+	rec := httptest.NewRecorder()
+	h.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/keys/k", strings.NewReader(`{"value":"v"}`)))
+	if rec.Code/100 != 2 {
+		t.Fatalf("expected success, got %d", rec.Code)
+	}
+	resp, err := TracingUnaryInterceptor(nil)(context.Background(), nil, &grpc.UnaryServerInfo{}, func(context.Context, any) (any, error) { return "ok", nil })
+	if resp != "ok" || err != nil {
+		t.Fatalf("expected the call to pass through, got %v, %v", resp, err)
+	}
+	if _, ok := TracingServerOption(nil).(grpc.EmptyServerOption); !ok {
+		t.Fatal("expected no server option when tracing is off")
+	}
+	if err := (*Tracer)(nil).Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// expiryCallbacks holds the functions registered with OnExpire, by key.
+type expiryCallbacks struct {
+	mu  sync.Mutex
+	fns map[string][]func(key, lastValue string)
+
+	// n is len(fns), kept so that removing a key can skip taking mu when no
+	// callbacks are pending. It only changes under mu.
+	n atomic.Int64
+}
+
+// OnExpire registers fn to run once, the next time key is removed because its
+// TTL elapsed, whether by the background sweep, lazily on access, or through
+// ExpireNow. lastValue is the value the key held when it expired. Overwriting
+// the key keeps the callback pending; deleting or evicting the key discards
+// it without running it.
+//
+// Callbacks run on their own goroutine, outside the store's locks, so a slow
+// callback cannot stall the sweep and may safely call back into the store.
+// A key starting with NUL is reserved, as for every write, and fn is
+// dropped.
+func (s *Store) OnExpire(key string, fn func(key, lastValue string)) {
+	if checkKey(key) != nil {
+		return
+	}
+	s.callbacks.mu.Lock()
+	defer s.callbacks.mu.Unlock()
+	if s.callbacks.fns == nil {
+		s.callbacks.fns = make(map[string][]func(key, lastValue string))
+	}
+	if s.callbacks.fns[key] == nil {
+		s.callbacks.n.Add(1)
+	}
+	s.callbacks.fns[key] = append(s.callbacks.fns[key], fn)
+}
+
+// fireExpiry runs the callbacks registered for key, or discards them if the
+// key was removed for any reason other than expiry. Caller must hold key's
+// shard lock. With no callbacks pending it returns without taking
+// callbacks.mu.
+func (s *Store) fireExpiry(key, lastValue string, why EventType) {
+	if s.callbacks.n.Load() == 0 {
+		return
+	}
+	s.callbacks.mu.Lock()
+	fns := s.callbacks.fns[key]
+	if fns != nil {
+		delete(s.callbacks.fns, key)
+		s.callbacks.n.Add(-1)
+	}
+	s.callbacks.mu.Unlock()
+	if why != EventExpire {
+		return
+	}
+	for _, fn := range fns {
+		go fn(key, lastValue)
+	}
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+type expiry struct{ key, value string }
+
+func waitExpiry(t *testing.T, ch <-chan expiry, timeout time.Duration) expiry {
+	t.Helper()
+	select {
+	case got := <-ch:
+		return got
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting for expiry callback")
+	}
+	return expiry{}
+}
+
+func TestOnExpireLazyGet(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	fired := make(chan expiry, 2)
+	s.Set("lease", "holder", 20*time.Millisecond)
+	s.OnExpire("lease", func(key, last string) { fired <- expiry{key, last} })
+
+	time.Sleep(50 * time.Millisecond)
+	if _, ok := s.Get("lease"); ok {
+		t.Fatal("expected lease to have expired")
+	}
+	if got := waitExpiry(t, fired, time.Second); got != (expiry{"lease", "holder"}) {
+		t.Fatalf("unexpected callback %+v", got)
+	}
+	s.Get("lease")
+	select {
+	case got := <-fired:
+		t.Fatalf("callback fired twice: %+v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestOnExpireSweep(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	fired := make(chan expiry, 1)
+	s.Set("lease", "holder", 20*time.Millisecond)
+	s.OnExpire("lease", func(key, last string) { fired <- expiry{key, last} })
+
+	// Nothing reads the key, so only the background sweep can expire it.
+	if got := waitExpiry(t, fired, 3*time.Second); got != (expiry{"lease", "holder"}) {
+		t.Fatalf("unexpected callback %+v", got)
+	}
+}
+
+func TestOnExpireNotOnDeleteOrOverwrite(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	fired := make(chan expiry, 2)
+	s.Set("a", "1", time.Hour)
+	s.OnExpire("a", func(key, last string) { fired <- expiry{key, last} })
+	s.Set("a", "2", 20*time.Millisecond)
+
+	s.Set("b", "1", 20*time.Millisecond)
+	s.OnExpire("b", func(key, last string) { fired <- expiry{key, last} })
+	s.Delete("b")
+
+	time.Sleep(50 * time.Millisecond)
+	s.Get("a")
+	s.Set("b", "again", 0)
+
+	if got := waitExpiry(t, fired, time.Second); got != (expiry{"a", "2"}) {
+		t.Fatalf("expected only a's callback with its overwritten value, got %+v", got)
+	}
+	select {
+	case got := <-fired:
+		t.Fatalf("unexpected callback %+v", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if n := s.callbacks.n.Load(); n != 0 {
+		t.Fatalf("expected no keys with pending callbacks, got %d", n)
+	}
+}
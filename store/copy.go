@@ -0,0 +1,90 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by Copy when the source key does not exist or
+	// has expired.
+	ErrNotFound = errors.New("key not found")
+
+	// ErrKeyExists is returned by Copy when the destination already holds a
+	// live key and overwriting was not requested.
+	ErrKeyExists = errors.New("key already exists")
+
+	// ErrSameKey is returned by Copy when the source and destination are the
+	// same key.
+	ErrSameKey = errors.New("source and destination are the same key")
+)
+
+// Copy copies the value and tags of src to dst, whether it is a string, list
+// or hash. The value and remaining TTL
+// of src are read under the same locks as the write to dst, so the copy
+// reflects a single moment. dst keeps src's expiry unless ttlOverride is
+// non-nil, in which case it gets that TTL instead, with a non-positive
+// override meaning no expiry.
+//
+// Returns ErrNotFound if src is missing or expired, ErrKeyExists if dst holds
+// a live key and overwrite is false, and ErrSameKey if src and dst are equal.
+func (s *Store) Copy(src, dst string, overwrite bool, ttlOverride *time.Duration) error {
+	if checkKey(src) != nil || checkKey(dst) != nil {
+		return ErrReservedKey
+	}
+	return s.copyKey("", src, dst, overwrite, ttlOverride)
+}
+
+func (s *Store) copyKey(source, src, dst string, overwrite bool, ttlOverride *time.Duration) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	if src == dst {
+		return ErrSameKey
+	}
+	unlock := s.lockShards([]string{src, dst}, true)
+	srcShard, dstShard := s.shardFor(src), s.shardFor(dst)
+	from, ok := srcShard.data[src]
+	if !ok || from.expired() {
+		if ok && s.expire(srcShard, src) {
+			s.lazyExpired.Add(1)
+		}
+		unlock()
+		return ErrNotFound
+	}
+	if err := s.checkEntry(dst, from); err != nil {
+		unlock()
+		return err
+	}
+	if prev, ok := dstShard.data[dst]; ok && !prev.expired() && !overwrite {
+		unlock()
+		return ErrKeyExists
+	}
+	now := time.Now()
+	e := &entry{expiresAt: from.expiresAt, period: from.period, createdAt: now, updatedAt: now}
+	if ttlOverride != nil {
+		e = s.newEntry("", now, *ttlOverride)
+	}
+	e.copyData(from)
+	e.sliding, e.tags = from.sliding, from.tags
+	if err := s.logSet(dst, e); err != nil {
+		unlock()
+		return err
+	}
+	s.put(dstShard, dst, e, source)
+	s.sets.Add(1)
+	unlock()
+	return s.settle()
+}
+
+// Copy is Store.Copy within the namespace. Both keys are in the namespace.
+func (n *Namespace) Copy(src, dst string, overwrite bool, ttlOverride *time.Duration) error {
+	if n.check(src) != nil || n.check(dst) != nil {
+		return ErrReservedKey
+	}
+	if err := n.s.copyKey(n.source, n.key(src), n.key(dst), overwrite, ttlOverride); err != nil {
+		return err
+	}
+	n.counters().sets.Add(1)
+	return nil
+}
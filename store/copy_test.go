@@ -0,0 +1,94 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCopy(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("src", "v1", time.Hour)
+	if err := s.Copy("src", "dst", false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, ttl, ok := s.GetWithTTL("dst"); !ok || v != "v1" || ttl <= 59*time.Minute {
+		t.Fatalf("expected dst to copy value and TTL, got %q %v %v", v, ttl, ok)
+	}
+	if v, _ := s.Get("src"); v != "v1" {
+		t.Fatalf("expected src to be left alone, got %q", v)
+	}
+
+	s.Set("src", "v2", time.Hour)
+	if err := s.Copy("src", "dst", false, nil); err != ErrKeyExists {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+	if v, _ := s.Get("dst"); v != "v1" {
+		t.Fatalf("a refused copy should not change dst, got %q", v)
+	}
+
+	none := time.Duration(0)
+	if err := s.Copy("src", "dst", true, &none); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.Get("dst"); v != "v2" {
+		t.Fatalf("expected dst to be overwritten, got %q", v)
+	}
+	if _, hasTTL, _ := s.TTL("dst"); hasTTL {
+		t.Fatal("expected a zero override to clear the TTL")
+	}
+
+	minute := time.Minute
+	if err := s.Copy("src", "short", false, &minute); err != nil {
+		t.Fatal(err)
+	}
+	if ttl, _, _ := s.TTL("short"); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("expected the override TTL, got %v", ttl)
+	}
+}
+
+func TestCopyErrors(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	if err := s.Copy("a", "a", true, nil); err != ErrSameKey {
+		t.Fatalf("expected ErrSameKey, got %v", err)
+	}
+	if err := s.Copy("missing", "b", false, nil); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	s.Set("gone", "v", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if err := s.Copy("gone", "b", false, nil); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound for an expired source, got %v", err)
+	}
+	if s.Exists("b") {
+		t.Fatal("copying an expired source should not create the destination")
+	}
+
+	s.Set("src", "v", 0)
+	s.Set("stale", "old", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if err := s.Copy("src", "stale", false, nil); err != nil {
+		t.Fatalf("an expired destination should not block the copy, got %v", err)
+	}
+}
+
+func TestNamespaceCopy(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	ns := s.Namespace("app")
+	ns.Set("src", "v", 0)
+	if err := ns.Copy("src", "dst", false, nil); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := ns.Get("dst"); !ok || v != "v" {
+		t.Fatalf("expected the copy inside the namespace, got %q %v", v, ok)
+	}
+	if s.Exists("dst") {
+		t.Fatal("the copy leaked into the default namespace")
+	}
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// EntryInfo describes a live key without necessarily carrying its value.
+type EntryInfo struct {
+	Key    string
+	Type   string        // "string", "list" or "hash"
+	Size   int           // length of the value in bytes, or of every list element or hash field and value
+	HasTTL bool          // whether the key has an expiry
+	TTL    time.Duration // remaining time-to-live, zero if HasTTL is false
+
+	// CreatedAt is when the key was first written since it last did not
+	// exist; overwriting a live key keeps it. UpdatedAt is when the value
+	// was last written. Changing only the TTL updates neither.
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// Version changes with every write of the value; see SetIfVersion.
+	Version uint64
+
+	// Tags are the labels given by SetWithOptions, or nil.
+	Tags map[string]string
+
+	// Value is only set if ListOptions.MaxValueBytes asked for values and
+	// the value is a string that fits within it; ValueIncluded says whether
+	// it was.
+	Value         string
+	ValueIncluded bool
+}
+
+// infoFor describes the entry e held under key, as of now, without its value.
+func infoFor(key string, e *entry, now time.Time) EntryInfo {
+	info := EntryInfo{Key: key, Type: e.kind.String(), Size: e.payload(), HasTTL: !e.expiresAt.IsZero(), CreatedAt: e.createdAt, UpdatedAt: e.updatedAt, Version: e.version, Tags: cloneTags(e.tags)}
+	if info.HasTTL {
+		info.TTL = e.expiresAt.Sub(now)
+	}
+	return info
+}
+
+// Info describes a live key in the default namespace without its value: its
+// size, expiry and when it was created and last written. It returns false if
+// the key does not exist or has expired. It does not count as a read.
+func (s *Store) Info(key string) (EntryInfo, bool) {
+	return s.Namespace("").Info(key)
+}
+
+// Info is Store.Info within the namespace.
+func (n *Namespace) Info(key string) (EntryInfo, bool) {
+	var info EntryInfo
+	if n.check(key) != nil {
+		return info, false
+	}
+	ok := n.s.lookup(n.key(key), func(e *entry) {
+		info = infoFor(key, e, time.Now())
+	})
+	return info, ok
+}
+
+// ListOptions filters and shapes the result of ListEntries.
+type ListOptions struct {
+	Prefix  string // only keys starting with Prefix
+	Pattern string // only keys matching this glob, if non-empty; see Match
+
+	// MaxValueBytes includes the values of entries no larger than this many
+	// bytes. Zero leaves all values out.
+	MaxValueBytes int
+}
+
+// ListEntries returns the live keys in the default namespace that match opts,
+// sorted by key, along with their size and TTL.
+func (s *Store) ListEntries(opts ListOptions) []EntryInfo {
+	return s.Namespace("").ListEntries(opts)
+}
+
+// ListEntries is Store.ListEntries within the namespace. Each shard's read
+// lock is held only to copy out the entries with the right prefix; the
+// pattern is matched and the result built after it is released, and the
+// caller can encode the result without holding any lock. As with List, the
+// result is consistent per shard but not across the whole store.
+func (n *Namespace) ListEntries(opts ListOptions) []EntryInfo {
+	type listed struct {
+		key string
+		e   entry
+	}
+	now := time.Now()
+	var out []EntryInfo
+	var batch []listed
+	for _, sh := range n.s.shards {
+		batch = batch[:0]
+		sh.mu.RLock()
+		for k, e := range sh.data {
+			if k, ok := n.owns(k); ok && !e.expiredAt(now) && strings.HasPrefix(k, opts.Prefix) {
+				batch = append(batch, listed{k, *e})
+			}
+		}
+		sh.mu.RUnlock()
+		for _, l := range batch {
+			if opts.Pattern != "" && !Match(opts.Pattern, l.key) {
+				continue
+			}
+			info := infoFor(l.key, &l.e, now)
+			if opts.MaxValueBytes > 0 && l.e.kind == kindString && len(l.e.value) <= opts.MaxValueBytes {
+				info.Value, info.ValueIncluded = l.e.value, true
+			}
+			out = append(out, info)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// KeyStat is the size and remaining TTL of a key, for finding the keys that
+// take up the most memory.
+type KeyStat struct {
+	Key        string
+	Size       int   // length of the value in bytes
+	TTLSeconds int64 // remaining TTL rounded up to whole seconds, -1 for none
+}
+
+// KeyStats returns the size and remaining TTL of every live key in the
+// default namespace starting with prefix, sorted by key. Sizes are read under
+// each shard's read lock; values are never copied.
+func (s *Store) KeyStats(prefix string) []KeyStat {
+	return s.Namespace("").KeyStats(prefix)
+}
+
+// KeyStats is Store.KeyStats within the namespace.
+func (n *Namespace) KeyStats(prefix string) []KeyStat {
+	entries := n.ListEntries(ListOptions{Prefix: prefix})
+	out := make([]KeyStat, len(entries))
+	for i, e := range entries {
+		out[i] = KeyStat{Key: e.Key, Size: e.Size, TTLSeconds: -1}
+		if e.HasTTL {
+			out[i].TTLSeconds = int64((e.TTL + time.Second - 1) / time.Second)
+		}
+	}
+	return out
+}
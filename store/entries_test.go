@@ -0,0 +1,110 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestListEntries(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("user:1", "short", time.Hour)
+	s.Set("user:2", "a much longer value", 0)
+	s.Set("order:1", "x", 0)
+	s.Set("user:gone", "x", 10*time.Millisecond)
+	s.Namespace("other").Set("user:3", "x", 0)
+	time.Sleep(20 * time.Millisecond)
+
+	entries := s.ListEntries(ListOptions{Prefix: "user:", MaxValueBytes: 5})
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 live user entries, got %+v", entries)
+	}
+
+	first, second := entries[0], entries[1]
+	if first.Key != "user:1" || second.Key != "user:2" {
+		t.Fatalf("expected entries sorted by key, got %q and %q", first.Key, second.Key)
+	}
+	if first.Size != 5 || !first.HasTTL || first.TTL <= 0 || first.TTL > time.Hour {
+		t.Errorf("unexpected metadata for user:1: %+v", first)
+	}
+	if !first.ValueIncluded || first.Value != "short" {
+		t.Errorf("expected the small value to be included, got %+v", first)
+	}
+	if second.ValueIncluded || second.Value != "" || second.Size != 19 || second.HasTTL {
+		t.Errorf("expected the large value to be left out, got %+v", second)
+	}
+
+	if entries := s.ListEntries(ListOptions{Pattern: "order:*"}); len(entries) != 1 || entries[0].ValueIncluded {
+		t.Fatalf("expected one order entry without its value, got %+v", entries)
+	}
+}
+
+func TestInfoTimestamps(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	if _, ok := s.Info("missing"); ok {
+		t.Fatal("expected no info for a missing key")
+	}
+
+	s.Set("k", "v1", 0)
+	first, ok := s.Info("k")
+	if !ok || first.Size != 2 || first.HasTTL || first.CreatedAt.IsZero() {
+		t.Fatalf("unexpected info %+v", first)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	s.Set("k", "longer", time.Minute)
+	second, _ := s.Info("k")
+	if !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Fatalf("expected an overwrite to keep createdAt %v, got %v", first.CreatedAt, second.CreatedAt)
+	}
+	if !second.UpdatedAt.After(first.UpdatedAt) {
+		t.Fatal("expected an overwrite to advance updatedAt")
+	}
+	if second.Size != 6 || !second.HasTTL || second.TTL <= 0 {
+		t.Fatalf("unexpected info after overwrite %+v", second)
+	}
+
+	s.Expire("k", time.Hour)
+	if third, _ := s.Info("k"); !third.UpdatedAt.Equal(second.UpdatedAt) {
+		t.Fatal("expected a TTL change not to count as a write")
+	}
+}
+
+func TestInfoCreatedAtResetsAfterExpiry(t *testing.T) {
+	s := New(WithGCInterval(0))
+	defer s.Stop()
+
+	s.Set("k", "v", 10*time.Millisecond)
+	first, _ := s.Info("k")
+	time.Sleep(20 * time.Millisecond)
+
+	// The expired entry has not been swept, so the write replaces it in place.
+	s.Set("k", "v", 0)
+	second, ok := s.Info("k")
+	if !ok || !second.CreatedAt.After(first.CreatedAt) {
+		t.Fatalf("expected a key recreated after expiring to get a new createdAt, got %v then %v", first.CreatedAt, second.CreatedAt)
+	}
+}
+
+func TestKeyStats(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("user:1", "short", 90*time.Second)
+	s.Set("user:2", "a much longer value", 0)
+	s.Set("order:1", "x", 0)
+
+	stats := s.KeyStats("user:")
+	want := []KeyStat{{Key: "user:1", Size: 5, TTLSeconds: 90}, {Key: "user:2", Size: 19, TTLSeconds: -1}}
+	if len(stats) != len(want) {
+		t.Fatalf("expected %+v, got %+v", want, stats)
+	}
+	for i := range want {
+		if stats[i] != want[i] {
+			t.Errorf("expected %+v, got %+v", want[i], stats[i])
+		}
+	}
+}
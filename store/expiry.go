@@ -0,0 +1,100 @@
+package store
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiryItem is a pending expiry in a shard's expiry heap. Items are never
+// removed when their entry changes; instead an item goes stale once key no
+// longer maps to e or e's expiry has moved, and is dropped when it surfaces.
+type expiryItem struct {
+	at  time.Time
+	key string
+	e   *entry
+}
+
+// expiryHeap is a min-heap of pending expiries ordered by deadline.
+type expiryHeap []expiryItem
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)        { *h = append(*h, x.(expiryItem)) }
+func (h *expiryHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	old[len(old)-1] = expiryItem{} // let the entry be collected
+	*h = old[:len(old)-1]
+	return x
+}
+
+// current reports whether it still describes the expiry of the entry held
+// under its key. Caller must hold sh.mu.
+func (sh *shard) current(it expiryItem) bool {
+	return sh.data[it.key] == it.e && it.e.expiresAt.Equal(it.at)
+}
+
+// trackExpiry schedules e, just stored or retimed under key, for the sweep.
+// Once stale items outnumber live ones the heap is rebuilt from the live
+// ones, so a key whose TTL is changed over and over cannot grow it without
+// bound. Caller must hold sh.mu.
+func (sh *shard) trackExpiry(key string, e *entry) {
+	if e.expiresAt.IsZero() {
+		return
+	}
+	heap.Push(&sh.expiries, expiryItem{at: e.expiresAt, key: key, e: e})
+	if len(sh.expiries) > 2*sh.ttlCount+64 {
+		live := sh.expiries[:0]
+		for _, it := range sh.expiries {
+			if sh.current(it) {
+				live = append(live, it)
+			}
+		}
+		clear(sh.expiries[len(live):])
+		sh.expiries = live
+		heap.Init(&sh.expiries)
+	}
+}
+
+// nextExpiry returns the live item with the earliest deadline, dropping any
+// stale items above it. It reports false if no entry in sh has a TTL. Caller
+// must hold sh.mu for writing.
+func (sh *shard) nextExpiry() (expiryItem, bool) {
+	for len(sh.expiries) > 0 {
+		if it := sh.expiries[0]; sh.current(it) {
+			return it, true
+		}
+		heap.Pop(&sh.expiries)
+	}
+	return expiryItem{}, false
+}
+
+// expiredCounts returns how many entries in sh expired before now but have
+// not been reclaimed yet, in total and in the default namespace. It only
+// visits the part of the heap that is due, so its cost is proportional to
+// those entries rather than to the shard. Caller must hold sh.mu.
+func (sh *shard) expiredCounts(now time.Time) (all, plain int) {
+	var visit func(i int)
+	visit = func(i int) {
+		if i >= len(sh.expiries) || !now.After(sh.expiries[i].at) {
+			return
+		}
+		if it := sh.expiries[i]; sh.current(it) {
+			all++
+			if !namespaced(it.key) {
+				plain++
+			}
+		}
+		visit(2*i + 1)
+		visit(2*i + 2)
+	}
+	visit(0)
+	return all, plain
+}
+
+// due reports whether sh may hold an entry that expired before now. Caller
+// must hold sh.mu.
+func (sh *shard) due(now time.Time) bool {
+	return len(sh.expiries) > 0 && now.After(sh.expiries[0].at)
+}
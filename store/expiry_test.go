@@ -0,0 +1,99 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSweepIgnoresStaleExpiries(t *testing.T) {
+	s := New(WithGCInterval(time.Hour))
+	defer s.Stop()
+
+	s.Set("rewritten", "v", 10*time.Millisecond)
+	s.Set("rewritten", "v", time.Hour)
+	s.Set("retimed", "v", 10*time.Millisecond)
+	s.Expire("retimed", time.Hour)
+	s.Set("persisted", "v", 10*time.Millisecond)
+	s.Persist("persisted")
+	s.Set("expired", "v", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	if n := s.SweepNow(); n != 1 {
+		t.Fatalf("expected only the one really expired key to be swept, got %d", n)
+	}
+	for _, k := range []string{"rewritten", "retimed", "persisted"} {
+		if !s.Exists(k) {
+			t.Errorf("%s was swept by a stale expiry", k)
+		}
+	}
+}
+
+func TestExpiryHeapStaysBounded(t *testing.T) {
+	s := New(WithShards(1), WithGCInterval(time.Hour))
+	defer s.Stop()
+
+	s.Set("k", "v", time.Hour)
+	for i := 0; i < 10000; i++ {
+		s.Expire("k", time.Hour+time.Duration(i))
+	}
+	sh := s.shards[0]
+	sh.mu.Lock()
+	n := len(sh.expiries)
+	sh.mu.Unlock()
+	if n > 2*1+64+1 {
+		t.Fatalf("expected stale items to be compacted away, heap holds %d", n)
+	}
+}
+
+// BenchmarkSweep measures a sweep that expires 100 keys in stores holding
+// increasingly many other keys, with no TTL or with a TTL an hour away, which
+// puts them in the expiry heap too. The cost should stay flat, or grow only
+// with the log of the heap's size, unlike BenchmarkSweepFullScan's.
+func BenchmarkSweep(b *testing.B) {
+	benchmarkSweep(b, func(s *Store) int { return s.SweepNow() })
+}
+
+// BenchmarkSweepFullScan is BenchmarkSweep for a sweep that visits every key,
+// as the sweep did before it kept an expiry heap, for comparison.
+func BenchmarkSweepFullScan(b *testing.B) {
+	benchmarkSweep(b, func(s *Store) int {
+		n := 0
+		for _, sh := range s.shards {
+			sh.mu.Lock()
+			for k, e := range sh.data {
+				if e.expired() && s.expire(sh, k) {
+					n++
+				}
+			}
+			sh.mu.Unlock()
+		}
+		return n
+	})
+}
+
+func benchmarkSweep(b *testing.B, sweep func(*Store) int) {
+	for _, ttl := range []time.Duration{0, time.Hour} {
+		for _, size := range []int{10_000, 100_000, 1_000_000} {
+			b.Run(fmt.Sprintf("ttl=%v/keys=%d", ttl, size), func(b *testing.B) {
+				s := New(WithGCInterval(0))
+				defer s.Stop()
+				for i := 0; i < size; i++ {
+					s.Set(fmt.Sprintf("static-%d", i), "v", ttl)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					for j := 0; j < 100; j++ {
+						s.Set(fmt.Sprintf("ttl-%d", j), "v", time.Nanosecond)
+					}
+					time.Sleep(time.Microsecond)
+					b.StartTimer()
+					if n := sweep(s); n != 100 {
+						b.Fatalf("expected 100 keys swept, got %d", n)
+					}
+				}
+			})
+		}
+	}
+}
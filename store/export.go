@@ -0,0 +1,213 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrInvalidEntry is returned by Import and ImportRecord for an entry that is
+// not valid JSON or names an unknown type.
+var ErrInvalidEntry = errors.New("invalid entry")
+
+// Record is one key as ExportEach produces it and ImportRecord takes it:
+// named as clients see it, with its namespace alongside, and with an
+// absolute expiry.
+type Record struct {
+	Namespace string
+	Key       string
+	Type      string            // "string", "list" or "hash"; empty means string
+	Value     string            // the value of a string
+	List      []string          // the elements of a list
+	Hash      map[string]string // the fields and values of a hash
+	ExpiresAt time.Time         // zero for no expiry
+	Tags      map[string]string
+}
+
+// exportRecord is one line of Export's output. Unlike a WAL record it names
+// keys as clients see them, with their namespace alongside, and gives expiry
+// as an RFC 3339 timestamp, so dumps are easy to read and produce elsewhere.
+type exportRecord struct {
+	Namespace string            `json:"namespace,omitempty"`
+	Key       string            `json:"key"`
+	Value     string            `json:"value"`
+	Binary    []byte            `json:"binary,omitempty"` // a value that is not valid UTF-8, in place of Value
+	Type      string            `json:"type,omitempty"`   // "list" or "hash" for those, in place of Value
+	List      []string          `json:"list,omitempty"`   // the elements of a list
+	Hash      map[string]string `json:"hash,omitempty"`   // the fields and values of a hash
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// splitKey returns the namespace an internal key belongs to and the key
+// within it.
+func splitKey(key string) (namespace, own string) {
+	n := nsPrefixLen(key)
+	if n == 0 {
+		return "", key
+	}
+	prefix := key[:n]
+	return prefix[strings.Index(prefix[1:], nsSep)+2:], key[n:]
+}
+
+// ExportEach calls fn with every live entry in every namespace, stopping at
+// the first error fn returns or when ctx is done. Shards are copied one at a
+// time under a read lock and passed to fn after it is released, so a slow fn
+// never blocks writers and only one shard is held in memory at once; the
+// entries are consistent per shard but not across the whole store.
+func (s *Store) ExportEach(ctx context.Context, fn func(Record) error) error {
+	var recs []Record
+	for _, sh := range s.shards {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		recs = recs[:0]
+		sh.mu.RLock()
+		for k, e := range sh.data {
+			if e.expired() {
+				continue
+			}
+			rec := Record{Type: e.kind.String(), Value: e.value, List: slices.Clone(e.list), Hash: maps.Clone(e.hash), Tags: cloneTags(e.tags)}
+			rec.Namespace, rec.Key = splitKey(k)
+			if !e.expiresAt.IsZero() {
+				rec.ExpiresAt = e.expiresAt.UTC()
+			}
+			recs = append(recs, rec)
+		}
+		sh.mu.RUnlock()
+		for _, rec := range recs {
+			if err := fn(rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Export writes every live entry in every namespace to w as JSON lines, one
+// object per key:
+//
+//	{"namespace":"app","key":"k","value":"v","expires_at":"2026-01-02T15:04:05Z"}
+//
+// namespace is omitted for the default namespace and expires_at for keys
+// without a TTL; values that are not valid UTF-8 are written base64-encoded
+// as binary instead of value. Lists and hashes have a type, "list" or
+// "hash", and their contents in list or hash instead of value. Entries are
+// read as ExportEach reads them, so a slow w never blocks writers.
+func (s *Store) Export(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := s.ExportEach(context.Background(), func(rec Record) error {
+		out := exportRecord{Namespace: rec.Namespace, Key: rec.Key, Value: rec.Value, List: rec.List, Hash: rec.Hash, Tags: rec.Tags}
+		if rec.Type != kindString.String() {
+			out.Type = rec.Type
+		}
+		if !utf8.ValidString(rec.Value) {
+			out.Value, out.Binary = "", []byte(rec.Value)
+		}
+		if !rec.ExpiresAt.IsZero() {
+			out.ExpiresAt = &rec.ExpiresAt
+		}
+		return enc.Encode(out)
+	})
+	if err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	return nil
+}
+
+// Import reads entries written by Export from r and stores each one as
+// ImportRecord does. Unlike Restore, keys not in r are left alone, and each
+// entry is a separate write, so an error part way through leaves the entries
+// before it imported; the counts say how far it got.
+func (s *Store) Import(r io.Reader, overwrite bool) (imported, skipped int, err error) {
+	dec := json.NewDecoder(r)
+	for i := 1; ; i++ {
+		var in exportRecord
+		if err := dec.Decode(&in); errors.Is(err, io.EOF) {
+			return imported, skipped, nil
+		} else if err != nil {
+			return imported, skipped, fmt.Errorf("import: entry %d: %w: %w", i, ErrInvalidEntry, err)
+		}
+		rec := Record{Namespace: in.Namespace, Key: in.Key, Type: in.Type, Value: in.Value, List: in.List, Hash: in.Hash, Tags: in.Tags}
+		if in.Binary != nil {
+			rec.Value = string(in.Binary)
+		}
+		if in.ExpiresAt != nil {
+			rec.ExpiresAt = *in.ExpiresAt
+		}
+		written, err := s.ImportRecord(rec, overwrite)
+		if err != nil {
+			return imported, skipped, fmt.Errorf("import: entry %d: %w", i, err)
+		}
+		if written {
+			imported++
+		} else {
+			skipped++
+		}
+	}
+}
+
+// ImportRecord stores rec, keeping its absolute expiry and tags, and reports
+// whether it was written. A record whose expiry has already passed is
+// skipped, as is a list or hash with nothing in it, and so is a key that
+// already holds a live value unless overwrite is set.
+func (s *Store) ImportRecord(rec Record, overwrite bool) (bool, error) {
+	if rec.Namespace == "" {
+		if err := checkKey(rec.Key); err != nil {
+			return false, err
+		}
+	}
+	now := time.Now()
+	e := &entry{value: rec.Value, tags: cloneTags(rec.Tags), updatedAt: now}
+	if err := e.setData(rec.Type, slices.Clone(rec.List), maps.Clone(rec.Hash)); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrInvalidEntry, err)
+	}
+	if e.kind != kindString && len(e.list) == 0 && len(e.hash) == 0 {
+		return false, nil
+	}
+	if !rec.ExpiresAt.IsZero() {
+		if !rec.ExpiresAt.After(now) {
+			return false, nil
+		}
+		e.expiresAt = rec.ExpiresAt
+		e.period = e.expiresAt.Sub(now)
+	}
+	return s.importEntry(nsPrefix(rec.Namespace)+rec.Key, e, overwrite)
+}
+
+// importEntry stores e under key, unless key holds a live value and
+// overwrite is false. It reports whether e was written.
+func (s *Store) importEntry(key string, e *entry, overwrite bool) (bool, error) {
+	if err := s.checkWritable(); err != nil {
+		return false, err
+	}
+	if err := s.checkEntry(key, e); err != nil {
+		return false, err
+	}
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	if prev, ok := sh.data[key]; ok && !prev.expired() && !overwrite {
+		sh.mu.Unlock()
+		return false, nil
+	}
+	if err := s.logSet(key, e); err != nil {
+		sh.mu.Unlock()
+		return false, err
+	}
+	s.put(sh, key, e, SourceImport)
+	s.sets.Add(1)
+	sh.mu.Unlock()
+	return true, s.settle()
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportImport(t *testing.T) {
+	src := New()
+	defer src.Stop()
+	src.Set("plain", "v", 0)
+	src.Set("ttl", "v", time.Hour)
+	src.SetBytes("binary", []byte{0xff, 0x00}, 0)
+	src.Namespace("app").SetWithOptions("k", SetOptions{Value: "scoped", Tags: map[string]string{"t": "1"}})
+	src.Set("gone", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := src.Export(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 4 {
+		t.Fatalf("expected 4 lines without the expired key, got %d:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), `{"namespace":"app","key":"k","value":"scoped","tags":{"t":"1"}}`) {
+		t.Fatalf("expected the namespaced key with its tags, got:\n%s", buf.String())
+	}
+
+	dst := New()
+	defer dst.Stop()
+	dst.Set("plain", "existing", 0)
+	imported, skipped, err := dst.Import(bytes.NewReader(buf.Bytes()), false)
+	if err != nil || imported != 3 || skipped != 1 {
+		t.Fatalf("expected 3 imported and 1 skipped, got %d, %d, %v", imported, skipped, err)
+	}
+	if v, _ := dst.Get("plain"); v != "existing" {
+		t.Fatalf("expected an existing key to be kept, got %q", v)
+	}
+	if v, _ := dst.GetBytes("binary"); !bytes.Equal(v, []byte{0xff, 0x00}) {
+		t.Fatalf("expected the binary value intact, got %v", v)
+	}
+	srcTTL, _, _ := src.TTL("ttl")
+	if ttl, _, _ := dst.TTL("ttl"); ttl > srcTTL || ttl < srcTTL-time.Second {
+		t.Fatalf("expected the original deadline to be kept, got %v against %v", ttl, srcTTL)
+	}
+	if got := dst.Namespace("app").ListByTag("t", "1"); len(got) != 1 {
+		t.Fatalf("expected the namespaced key's tags to be imported, got %v", got)
+	}
+
+	if imported, _, _ := dst.Import(bytes.NewReader(buf.Bytes()), true); imported != 4 {
+		t.Fatalf("expected every key imported with overwrite, got %d", imported)
+	}
+	if v, _ := dst.Get("plain"); v != "v" {
+		t.Fatalf("expected overwrite to replace the key, got %q", v)
+	}
+}
+
+func TestImportSkipsExpiredAndStopsAtMalformed(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	in := `{"key":"old","value":"v","expires_at":"2000-01-01T00:00:00Z"}
+{"key":"new","value":"v","expires_at":"2999-01-01T00:00:00Z"}
+{"key":
+{"key":"after","value":"v"}
+`
+	imported, skipped, err := s.Import(strings.NewReader(in), false)
+	if err == nil || imported != 1 || skipped != 1 {
+		t.Fatalf("expected an error after 1 imported and 1 skipped, got %d, %d, %v", imported, skipped, err)
+	}
+	if s.Exists("old") || !s.Exists("new") || s.Exists("after") {
+		t.Fatal("expected only the entry with a future expiry to be imported")
+	}
+}
+
+func TestExportEachAndImportRecord(t *testing.T) {
+	src := New()
+	defer src.Stop()
+	src.Set("s", "v", time.Hour)
+	src.RPush("l", "a", "b")
+	src.Namespace("app").HSet("h", "f", "v")
+
+	var recs []Record
+	if err := src.ExportEach(context.Background(), func(rec Record) error {
+		recs = append(recs, rec)
+		return nil
+	}); err != nil || len(recs) != 3 {
+		t.Fatalf("expected 3 records, got %d, %v", len(recs), err)
+	}
+	stop := errors.New("stop")
+	calls := 0
+	err := src.ExportEach(context.Background(), func(Record) error { calls++; return stop })
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("expected ExportEach to stop at fn's first error, got %d calls, %v", calls, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := src.ExportEach(ctx, func(Record) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a canceled export to fail, got %v", err)
+	}
+
+	dst := New()
+	defer dst.Stop()
+	for _, rec := range recs {
+		if ok, err := dst.ImportRecord(rec, false); !ok || err != nil {
+			t.Fatalf("expected %q to be imported, got %v, %v", rec.Key, ok, err)
+		}
+	}
+	if got, _ := dst.LRange("l", 0, -1); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("unexpected list %v", got)
+	}
+	if v, ok, _ := dst.Namespace("app").HGet("h", "f"); !ok || v != "v" {
+		t.Fatalf("unexpected hash field %q, %v", v, ok)
+	}
+	if ttl, ok, _ := dst.TTL("s"); !ok || ttl <= 59*time.Minute {
+		t.Fatalf("expected the expiry to be kept, got %v", ttl)
+	}
+	if ok, _ := dst.ImportRecord(Record{Key: "s", Value: "other"}, false); ok {
+		t.Fatal("expected an existing key to be kept without overwrite")
+	}
+	if ok, _ := dst.ImportRecord(Record{Key: "empty", Type: "list"}, false); ok || dst.Exists("empty") {
+		t.Fatal("expected an empty list to be skipped")
+	}
+}
@@ -0,0 +1,67 @@
+package store
+
+import "context"
+
+// Flush removes every key in every namespace as a single atomic write and
+// returns how many entries it removed, counting expired ones not yet swept.
+// Watchers see a delete event for each key, so on a large store slow watchers
+// will fall behind and be disconnected; pending OnExpire callbacks are
+// discarded, as for Delete.
+//
+// Key, TTL and byte counts drop to zero regardless. If resetStats is true the
+// cumulative counters (hits, misses, sets, deletes, evictions and
+// expirations, store-wide and per namespace) are zeroed too.
+//
+// If ctx is done before every shard is locked, Flush removes nothing and
+// returns ctx.Err(); once the flush is logged it always completes.
+func (s *Store) Flush(ctx context.Context, resetStats bool) (int, error) {
+	if err := s.checkWritable(); err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	unlock := s.lockAll()
+	if err := ctx.Err(); err != nil {
+		unlock()
+		return 0, err
+	}
+	if err := s.logFlush(); err != nil {
+		unlock()
+		return 0, err
+	}
+	n := 0
+	for _, sh := range s.shards {
+		for k := range sh.data {
+			s.remove(sh, k, EventDelete, "")
+			n++
+		}
+		sh.expiries = nil
+	}
+	if resetStats {
+		s.resetStats()
+	}
+	unlock()
+	return n, s.maybeCompact()
+}
+
+// resetStats zeroes the cumulative counters reported by Stats.
+func (s *Store) resetStats() {
+	s.hits.Store(0)
+	s.misses.Store(0)
+	s.sets.Store(0)
+	s.deletes.Store(0)
+	s.evictions.Store(0)
+	s.expirations.Store(0)
+	s.swept.Store(0)
+	s.sweeps.Store(0)
+	s.lazyExpired.Store(0)
+	s.namespaces.Range(func(_, v any) bool {
+		ctr := v.(*nsCounters)
+		ctr.hits.Store(0)
+		ctr.misses.Store(0)
+		ctr.sets.Store(0)
+		ctr.deletes.Store(0)
+		return true
+	})
+}
@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFlush(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("a", "1", 0)
+	s.Set("b", "2", time.Hour)
+	s.Namespace("app").Set("c", "3", 0)
+	s.Get("a")
+	events, cancel := s.Subscribe("")
+	defer cancel()
+
+	n, err := s.Flush(context.Background(), false)
+	if err != nil || n != 3 {
+		t.Fatalf("expected 3 keys flushed, got %d, %v", n, err)
+	}
+	if s.Len() != 0 || s.Namespace("app").Exists("c") {
+		t.Fatal("expected every namespace to be empty")
+	}
+	st := s.Stats()
+	if st.Keys != 0 || st.KeysWithTTL != 0 || st.Bytes != 0 {
+		t.Fatalf("expected gauges to drop to zero, got %+v", st)
+	}
+	if st.Hits != 1 || st.Sets != 3 {
+		t.Fatalf("expected cumulative counters to be kept, got %+v", st)
+	}
+	for range 2 {
+		if ev := <-events; ev.Type != EventDelete {
+			t.Fatalf("expected delete events, got %+v", ev)
+		}
+	}
+
+	s.Set("a", "1", 0)
+	if _, err := s.Flush(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if st := s.Stats(); st.Hits != 0 || st.Sets != 0 || st.Deletes != 0 {
+		t.Fatalf("expected counters to be reset, got %+v", st)
+	}
+	if st := s.Namespace("app").Stats(); st.Sets != 0 {
+		t.Fatalf("expected namespace counters to be reset, got %+v", st)
+	}
+}
+
+func TestFlushSurvivesWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("old", "v", 0)
+	s.Flush(context.Background(), false)
+	s.Set("new", "v", 0)
+	s.Stop()
+
+	r, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if r.Exists("old") || !r.Exists("new") {
+		t.Fatalf("expected only the key written after the flush, got %v", r.List())
+	}
+}
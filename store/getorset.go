@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrLoaderPanicked is returned by GetOrSet when the loader panics. The
+// error also carries the value it panicked with.
+var ErrLoaderPanicked = errors.New("loader panicked")
+
+// loads tracks the GetOrSet loaders in flight, so that concurrent misses on
+// a key share a single call.
+type loads struct {
+	mu    sync.Mutex
+	calls map[string]*loadCall // by internal key
+}
+
+// loadCall is one run of a loader and its outcome, which is set before done
+// is closed.
+type loadCall struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+// GetOrSet returns the value of key, loading it first if the key is missing
+// or expired: loader is called, and its result stored with ttl, following the
+// same rules as Set, and returned. loader runs without any lock held, so a
+// slow loader holds up nothing but the callers waiting for it.
+//
+// Concurrent misses on the same key share one call of loader, and all of
+// them get its result or error. If another writer stores the key while
+// loader runs, that value is kept and returned instead, so a concurrent Set
+// is never overwritten. If loader fails, nothing is stored and its error is
+// returned; if it panics, every waiter gets ErrLoaderPanicked. Returns
+// ErrWrongType if the key holds a list or hash.
+func (s *Store) GetOrSet(key string, ttl time.Duration, loader func() (string, error)) (string, error) {
+	return s.GetOrSetContext(context.Background(), key, ttl, loader)
+}
+
+// GetOrSetContext is GetOrSet, except that a caller whose ctx ends stops
+// waiting for loader and gets ctx's error. loader runs in a goroutine of its
+// own, so it carries on for the other callers and its result is still
+// stored.
+func (s *Store) GetOrSetContext(ctx context.Context, key string, ttl time.Duration, loader func() (string, error)) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	if v, ok := s.Get(key); ok {
+		return v, nil
+	}
+	return s.loadShared(ctx, "", key, ttl, loader, nil)
+}
+
+// GetOrSet is Store.GetOrSet within the namespace.
+func (n *Namespace) GetOrSet(key string, ttl time.Duration, loader func() (string, error)) (string, error) {
+	return n.GetOrSetContext(context.Background(), key, ttl, loader)
+}
+
+// GetOrSetContext is Store.GetOrSetContext within the namespace.
+func (n *Namespace) GetOrSetContext(ctx context.Context, key string, ttl time.Duration, loader func() (string, error)) (string, error) {
+	if err := n.check(key); err != nil {
+		return "", err
+	}
+	if v, ok := n.Get(key); ok {
+		return v, nil
+	}
+	return n.s.loadShared(ctx, n.source, n.key(key), ttl, loader, n.counters())
+}
+
+// loadShared waits for the loader call for key, starting one if none is in
+// flight. A call that stores its result counts it as a set in ctr, the
+// counters of the namespace key belongs to, if given.
+func (s *Store) loadShared(ctx context.Context, source, key string, ttl time.Duration, loader func() (string, error), ctr *nsCounters) (string, error) {
+	s.loads.mu.Lock()
+	c, ok := s.loads.calls[key]
+	if !ok {
+		if s.loads.calls == nil {
+			s.loads.calls = make(map[string]*loadCall)
+		}
+		c = &loadCall{done: make(chan struct{})}
+		s.loads.calls[key] = c
+		go s.runLoad(c, source, key, ttl, loader, ctr)
+	}
+	s.loads.mu.Unlock()
+	select {
+	case <-c.done:
+		return c.value, c.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// runLoad runs loader for c and stores its result under key, counting the
+// write in ctr if it made one. The count is made here rather than by a
+// waiter, since every waiter may have stopped waiting by the time the
+// result is stored.
+func (s *Store) runLoad(c *loadCall, source, key string, ttl time.Duration, loader func() (string, error), ctr *nsCounters) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.value, c.err = "", fmt.Errorf("%w: %v", ErrLoaderPanicked, r)
+		}
+		s.loads.mu.Lock()
+		delete(s.loads.calls, key)
+		s.loads.mu.Unlock()
+		close(c.done)
+	}()
+	// A call that finished between this caller's miss and its joining the
+	// map has already stored the key, so there is nothing to load.
+	found := false
+	s.lookup(key, func(e *entry) {
+		if e.kind == kindString {
+			c.value, found = e.value, true
+		}
+	})
+	if found {
+		return
+	}
+	value, err := loader()
+	if err != nil {
+		c.err = err
+		return
+	}
+	var written bool
+	c.value, written, c.err = s.setIfAbsent(source, key, value, ttl)
+	if written && ctr != nil {
+		ctr.sets.Add(1)
+	}
+}
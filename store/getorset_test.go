@@ -0,0 +1,182 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrSet(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	calls := 0
+	load := func() (string, error) {
+		calls++
+		return "loaded", nil
+	}
+	if v, err := s.GetOrSet("k", time.Minute, load); v != "loaded" || err != nil {
+		t.Fatalf("expected the loaded value, got %q, %v", v, err)
+	}
+	if _, hasTTL, _ := s.TTL("k"); !hasTTL {
+		t.Fatal("expected the loaded value to get the TTL")
+	}
+	if v, _ := s.GetOrSet("k", time.Minute, load); v != "loaded" || calls != 1 {
+		t.Fatalf("expected the stored value without loading again, got %q after %d calls", v, calls)
+	}
+
+	failed := errors.New("backend down")
+	if _, err := s.GetOrSet("bad", 0, func() (string, error) { return "", failed }); !errors.Is(err, failed) {
+		t.Fatalf("expected the loader's error, got %v", err)
+	}
+	if s.Exists("bad") {
+		t.Fatal("expected a failed load to store nothing")
+	}
+
+	// A Set made while the loader runs wins over the loaded value.
+	v, err := s.GetOrSet("race", 0, func() (string, error) {
+		s.Set("race", "explicit", 0)
+		return "loaded", nil
+	})
+	if v != "explicit" || err != nil {
+		t.Fatalf("expected the concurrent Set to win, got %q, %v", v, err)
+	}
+	if v, _ := s.Get("race"); v != "explicit" {
+		t.Fatalf("expected the concurrent Set to be kept, got %q", v)
+	}
+}
+
+func TestGetOrSetLoadsOnce(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	load := func() (string, error) {
+		calls.Add(1)
+		<-release
+		return "loaded", nil
+	}
+	const callers = 200
+	var wg sync.WaitGroup
+	results := make(chan string, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := s.GetOrSet("k", 0, load)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- v
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+	for v := range results {
+		if v != "loaded" {
+			t.Fatalf("expected every caller to get the loaded value, got %q", v)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("expected the loader to run once, ran %d times", n)
+	}
+}
+
+func TestGetOrSetWaiterCanceled(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go s.GetOrSet("k", 0, func() (string, error) {
+		close(started)
+		<-release
+		return "slow", nil
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.GetOrSetContext(ctx, "k", 0, func() (string, error) { return "other", nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the waiter to give up with its context, got %v", err)
+	}
+	close(release)
+	if v, err := s.GetOrSet("k", 0, nil); v != "slow" || err != nil {
+		t.Fatalf("expected the slow load to be stored, got %q, %v", v, err)
+	}
+}
+
+func TestGetOrSetLoaderPanic(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	release := make(chan struct{})
+	load := func() (string, error) {
+		<-release
+		panic("boom")
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.GetOrSet("k", 0, load)
+			errs <- err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiters deadlocked after the loader panicked")
+	}
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, ErrLoaderPanicked) {
+			t.Fatalf("expected ErrLoaderPanicked, got %v", err)
+		}
+	}
+	if s.Exists("k") {
+		t.Fatal("expected a panicking loader to store nothing")
+	}
+	// The failed call is forgotten, so the next miss loads again.
+	if v, err := s.GetOrSet("k", 0, func() (string, error) { return "ok", nil }); v != "ok" || err != nil {
+		t.Fatalf("expected a fresh load, got %q, %v", v, err)
+	}
+}
+
+func TestNamespaceGetOrSetStats(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	n := s.Namespace("app")
+
+	load := func() (string, error) { return "loaded", nil }
+	if v, err := n.GetOrSet("k", 0, load); v != "loaded" || err != nil {
+		t.Fatalf("expected the loaded value, got %q, %v", v, err)
+	}
+	if sets := n.Stats().Sets; sets != 1 {
+		t.Fatalf("expected the load to count as a namespace set, got %d", sets)
+	}
+	if v, err := n.GetOrSetContext(context.Background(), "k", 0, load); v != "loaded" || err != nil {
+		t.Fatalf("expected the stored value, got %q, %v", v, err)
+	}
+	if sets := n.Stats().Sets; sets != 1 {
+		t.Fatalf("expected a hit not to count as a set, got %d", sets)
+	}
+	if sets := s.Namespace("other").Stats().Sets; sets != 0 {
+		t.Fatalf("expected other namespaces not to count the set, got %d", sets)
+	}
+}
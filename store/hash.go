@@ -0,0 +1,146 @@
+package store
+
+import "maps"
+
+// HSet sets field in the hash stored at key to value and reports whether the
+// field is new. A missing or expired key is created as a new hash with the
+// store's default TTL; an existing hash keeps its TTL. Returns ErrWrongType if
+// the key holds a string or list.
+func (s *Store) HSet(key, field, value string) (bool, error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	return s.hset("", key, field, value)
+}
+
+// HSet is Store.HSet within the namespace.
+func (n *Namespace) HSet(key, field, value string) (bool, error) {
+	if err := n.check(key); err != nil {
+		return false, err
+	}
+	added, err := n.s.hset(n.source, n.key(key), field, value)
+	if err == nil {
+		n.counters().sets.Add(1)
+	}
+	return added, err
+}
+
+func (s *Store) hset(source, key, field, value string) (bool, error) {
+	if err := validUTF8(field, value); err != nil {
+		return false, err
+	}
+	var added bool
+	err := s.modify(source, key, kindHash, func(cur, next *entry) error {
+		var old map[string]string
+		if cur != nil {
+			old = cur.hash
+		}
+		_, exists := old[field]
+		next.hash = make(map[string]string, len(old)+1)
+		maps.Copy(next.hash, old)
+		next.hash[field], added = value, !exists
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return added, nil
+}
+
+// HGet returns the value of field in the hash stored at key, and whether the
+// key and field exist. Returns ErrWrongType if the key holds a string or
+// list.
+func (s *Store) HGet(key, field string) (string, bool, error) {
+	if err := checkKey(key); err != nil {
+		return "", false, err
+	}
+	return s.hget(key, field)
+}
+
+func (s *Store) hget(key, field string) (string, bool, error) {
+	var value string
+	var ok bool
+	_, err := s.view(key, kindHash, func(e *entry) { value, ok = e.hash[field] })
+	return value, ok, err
+}
+
+// HGet is Store.HGet within the namespace.
+func (n *Namespace) HGet(key, field string) (string, bool, error) {
+	if err := n.check(key); err != nil {
+		return "", false, err
+	}
+	value, ok, err := n.s.hget(n.key(key), field)
+	n.counted(ok, err)
+	return value, ok, err
+}
+
+// HGetAll returns a copy of the hash stored at key, empty if it is missing.
+// Returns ErrWrongType if the key holds a string or list.
+func (s *Store) HGetAll(key string) (map[string]string, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	return s.hgetAll(key)
+}
+
+func (s *Store) hgetAll(key string) (map[string]string, error) {
+	out := map[string]string{}
+	_, err := s.view(key, kindHash, func(e *entry) { out = maps.Clone(e.hash) })
+	return out, err
+}
+
+// HGetAll is Store.HGetAll within the namespace.
+func (n *Namespace) HGetAll(key string) (map[string]string, error) {
+	if err := n.check(key); err != nil {
+		return nil, err
+	}
+	out, err := n.s.hgetAll(n.key(key))
+	n.counted(len(out) > 0, err)
+	return out, err
+}
+
+// HDel removes fields from the hash stored at key and returns how many of
+// them it held. Removing the last field deletes the key. Returns
+// ErrWrongType if the key holds a string or list.
+func (s *Store) HDel(key string, fields ...string) (int, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	return s.hdel("", key, fields)
+}
+
+// HDel is Store.HDel within the namespace.
+func (n *Namespace) HDel(key string, fields ...string) (int, error) {
+	if err := n.check(key); err != nil {
+		return 0, err
+	}
+	removed, err := n.s.hdel(n.source, n.key(key), fields)
+	if removed > 0 {
+		n.counters().deletes.Add(1)
+	}
+	return removed, err
+}
+
+func (s *Store) hdel(source, key string, fields []string) (int, error) {
+	var removed int
+	err := s.modify(source, key, kindHash, func(cur, next *entry) error {
+		if cur == nil {
+			return errUnchanged
+		}
+		next.hash = maps.Clone(cur.hash)
+		for _, f := range fields {
+			if _, ok := next.hash[f]; ok {
+				delete(next.hash, f)
+				removed++
+			}
+		}
+		if removed == 0 {
+			return errUnchanged
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return removed, nil
+}
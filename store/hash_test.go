@@ -0,0 +1,60 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	if added, err := s.HSet("h", "name", "ada"); !added || err != nil {
+		t.Fatalf("expected a new field, got %v, %v", added, err)
+	}
+	if added, _ := s.HSet("h", "name", "grace"); added {
+		t.Fatal("expected overwriting a field not to add one")
+	}
+	s.HSet("h", "lang", "cobol")
+	if v, ok, _ := s.HGet("h", "name"); !ok || v != "grace" {
+		t.Fatalf("expected grace, got %q, %v", v, ok)
+	}
+	if _, ok, _ := s.HGet("h", "missing"); ok {
+		t.Fatal("expected a missing field not to be found")
+	}
+	all, _ := s.HGetAll("h")
+	if want := map[string]string{"name": "grace", "lang": "cobol"}; !reflect.DeepEqual(all, want) {
+		t.Fatalf("expected %v, got %v", want, all)
+	}
+	all["name"] = "changed"
+	if v, _, _ := s.HGet("h", "name"); v != "grace" {
+		t.Fatal("expected HGetAll to return a copy")
+	}
+
+	if n, _ := s.HDel("h", "name", "missing"); n != 1 {
+		t.Fatalf("expected 1 field removed, got %d", n)
+	}
+	if n, _ := s.HDel("h", "lang"); n != 1 || s.Exists("h") {
+		t.Fatalf("expected removing the last field to delete the key, got %d", n)
+	}
+	if n, err := s.HDel("h", "lang"); n != 0 || err != nil {
+		t.Fatalf("expected HDel on a missing key to remove nothing, got %d, %v", n, err)
+	}
+}
+
+func TestHashInNamespace(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	ns := s.Namespace("app")
+
+	ns.HSet("h", "f", "v")
+	if _, ok, _ := s.HGet("h", "f"); ok {
+		t.Fatal("expected the hash to be invisible outside its namespace")
+	}
+	if v, ok, _ := ns.HGet("h", "f"); !ok || v != "v" {
+		t.Fatalf("expected v, got %q, %v", v, ok)
+	}
+	if st := ns.Stats(); st.Keys != 1 || st.Hits != 1 {
+		t.Fatalf("expected 1 key and 1 hit, got %+v", st)
+	}
+}
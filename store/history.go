@@ -0,0 +1,133 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// Sources the store itself gives to mutations no caller made.
+const (
+	// SourceEviction tags keys removed to make room under WithMaxEntries or
+	// WithMaxBytes.
+	SourceEviction = "eviction"
+	// SourceWAL tags keys loaded from the WAL when the store opens.
+	SourceWAL = "wal"
+	// SourceSnapshot tags keys replaced by Restore.
+	SourceSnapshot = "snapshot"
+	// SourceImport tags keys written by Import.
+	SourceImport = "import"
+)
+
+// Mutation is one change recorded by WithHistory.
+type Mutation struct {
+	Key  string
+	Op   EventType // EventSet includes TTL changes, as for watchers
+	Size int       // length of the value afterwards; 0 for removals
+	Time time.Time
+	// Source tags who made the change: the tag of the Namespace view given
+	// by WithSource, one of the Source constants, or empty.
+	Source string
+}
+
+// history is a ring buffer of the most recent mutations. A nil buf means
+// history is disabled.
+type history struct {
+	mu   sync.Mutex
+	buf  []Mutation
+	next int  // where the next mutation goes
+	full bool // whether buf has wrapped
+}
+
+// record adds a mutation of key to the history, if enabled. Caller must hold
+// key's shard lock, so mutations of a key are recorded in the order they
+// happen.
+func (s *Store) record(op EventType, key string, e *entry, source string) {
+	h := &s.history
+	if h.buf == nil {
+		return
+	}
+	m := Mutation{Key: key, Op: op, Time: time.Now(), Source: source}
+	if e != nil {
+		m.Size = e.payload()
+	}
+	h.mu.Lock()
+	h.buf[h.next] = m
+	h.next++
+	if h.next == len(h.buf) {
+		h.next, h.full = 0, true
+	}
+	h.mu.Unlock()
+}
+
+// recent returns up to limit recorded mutations for which keep returns true,
+// newest first. A limit <= 0 means all of them.
+func (h *history) recent(limit int, keep func(m Mutation) bool) []Mutation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := h.next
+	if h.full {
+		n = len(h.buf)
+	}
+	var out []Mutation
+	for i := 1; i <= n && (limit <= 0 || len(out) < limit); i++ {
+		m := h.buf[(h.next-i+len(h.buf))%len(h.buf)]
+		if keep(m) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// History returns up to limit of the recorded mutations of key in the default
+// namespace, newest first; a limit <= 0 returns all of them. It returns nil
+// unless the store was opened WithHistory. The history is bounded and kept
+// only in memory, so older mutations, and everything from before a restart,
+// are lost.
+func (s *Store) History(key string, limit int) []Mutation {
+	if checkKey(key) != nil {
+		return nil
+	}
+	return s.history.recent(limit, func(m Mutation) bool { return m.Key == key })
+}
+
+// RecentMutations returns up to limit of the most recent mutations across
+// every namespace, newest first, with keys as stored internally. A limit <= 0
+// returns all of them. See History.
+func (s *Store) RecentMutations(limit int) []Mutation {
+	return s.history.recent(limit, func(Mutation) bool { return true })
+}
+
+// History is Store.History within the namespace.
+func (n *Namespace) History(key string, limit int) []Mutation {
+	if n.check(key) != nil {
+		return nil
+	}
+	internal := n.key(key)
+	out := n.s.history.recent(limit, func(m Mutation) bool { return m.Key == internal })
+	for i := range out {
+		out[i].Key = key
+	}
+	return out
+}
+
+// RecentMutations is Store.RecentMutations limited to the namespace's keys,
+// as seen from within the namespace.
+func (n *Namespace) RecentMutations(limit int) []Mutation {
+	out := n.s.history.recent(limit, func(m Mutation) bool {
+		_, ok := n.owns(m.Key)
+		return ok
+	})
+	for i := range out {
+		out[i].Key, _ = n.owns(out[i].Key)
+	}
+	return out
+}
+
+// WithSource returns a view of the namespace whose writes are recorded in
+// the history with source, such as the address of the client making them.
+// Reads are unaffected.
+func (n *Namespace) WithSource(source string) *Namespace {
+	v := *n
+	v.source = source
+	return &v
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	s := New(WithHistory(4))
+	defer s.Stop()
+
+	ns := s.Namespace("app").WithSource("10.0.0.7")
+	ns.Set("k", "hello", 0)
+	ns.Expire("k", time.Minute)
+	s.Set("other", "v", 0)
+	ns.Delete("k")
+
+	got := ns.History("k", 0)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 mutations of k, got %+v", got)
+	}
+	want := []struct {
+		op   EventType
+		size int
+	}{{EventDelete, 0}, {EventSet, 5}, {EventSet, 5}}
+	for i, w := range want {
+		if got[i].Key != "k" || got[i].Op != w.op || got[i].Size != w.size || got[i].Source != "10.0.0.7" {
+			t.Errorf("mutation %d: expected %v of size %d from 10.0.0.7, got %+v", i, w.op, w.size, got[i])
+		}
+	}
+	if got := ns.History("k", 1); len(got) != 1 || got[0].Op != EventDelete {
+		t.Fatalf("expected the limit to keep the newest mutation, got %+v", got)
+	}
+	if got := s.History("other", 0); len(got) != 1 || got[0].Source != "" {
+		t.Fatalf("expected an untagged write to the default namespace, got %+v", got)
+	}
+	if got := ns.RecentMutations(0); len(got) != 3 {
+		t.Fatalf("expected only the namespace's mutations, got %+v", got)
+	}
+
+	// The ring keeps only the last four.
+	for i := 0; i < 3; i++ {
+		s.Set(fmt.Sprintf("new%d", i), "v", 0)
+	}
+	recent := s.RecentMutations(0)
+	if len(recent) != 4 || recent[0].Key != "new2" || recent[3].Key != ns.key("k") {
+		t.Fatalf("expected the four newest mutations, got %+v", recent)
+	}
+}
+
+func TestHistoryRecordsStoreChanges(t *testing.T) {
+	s := New(WithHistory(10), WithMaxEntries(1))
+	defer s.Stop()
+
+	s.Set("a", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	s.Get("a")
+	s.Set("b", "v", 0)
+	s.Set("c", "v", 0)
+
+	if got := s.History("a", 0); len(got) != 2 || got[0].Op != EventExpire {
+		t.Fatalf("expected a set then an expiry of a, got %+v", got)
+	}
+	if got := s.History("b", 0); len(got) != 2 || got[0].Op != EventDelete || got[0].Source != SourceEviction {
+		t.Fatalf("expected b to be evicted, got %+v", got)
+	}
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("k", "v", 0)
+	if got := s.History("k", 0); got != nil {
+		t.Fatalf("expected no history by default, got %+v", got)
+	}
+	if got := s.RecentMutations(10); got != nil {
+		t.Fatalf("expected no history by default, got %+v", got)
+	}
+}
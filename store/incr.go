@@ -0,0 +1,79 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNotInteger is returned by Incr when the key holds a value that is
+	// not a base-10 64-bit integer.
+	ErrNotInteger = errors.New("value is not an integer")
+	// ErrOverflow is returned by Incr when the result would not fit in an
+	// int64.
+	ErrOverflow = errors.New("increment would overflow")
+)
+
+// Incr adds delta to the integer stored at key and returns the result. A
+// missing or expired key counts as 0 and is created with no expiry; an
+// existing key keeps its TTL and tags, as with Append. The read and the write
+// happen under the same lock, so concurrent increments are never lost.
+// Returns ErrWrongType if the key holds a list or hash.
+func (s *Store) Incr(key string, delta int64) (int64, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	return s.incr("", key, delta)
+}
+
+// Incr is Store.Incr within the namespace.
+func (n *Namespace) Incr(key string, delta int64) (int64, error) {
+	if err := n.check(key); err != nil {
+		return 0, err
+	}
+	v, err := n.s.incr(n.source, n.key(key), delta)
+	if err == nil {
+		n.counters().sets.Add(1)
+	}
+	return v, err
+}
+
+func (s *Store) incr(source, key string, delta int64) (int64, error) {
+	if err := s.checkWritable(); err != nil {
+		return 0, err
+	}
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	e, ok := sh.data[key]
+	if !ok || e.expired() {
+		e = s.newEntry("0", time.Now(), 0)
+	}
+	if e.kind != kindString {
+		sh.mu.Unlock()
+		return 0, ErrWrongType
+	}
+	cur, err := strconv.ParseInt(e.value, 10, 64)
+	if err != nil {
+		sh.mu.Unlock()
+		return 0, ErrNotInteger
+	}
+	if (delta > 0 && cur > math.MaxInt64-delta) || (delta < 0 && cur < math.MinInt64-delta) {
+		sh.mu.Unlock()
+		return 0, ErrOverflow
+	}
+	ne := &entry{value: strconv.FormatInt(cur+delta, 10), expiresAt: e.expiresAt, period: e.period, sliding: e.sliding, createdAt: e.createdAt, updatedAt: time.Now(), tags: e.tags}
+	if err := s.checkSize(key, ne.value); err != nil {
+		sh.mu.Unlock()
+		return 0, err
+	}
+	if err := s.logSet(key, ne); err != nil {
+		sh.mu.Unlock()
+		return 0, err
+	}
+	s.put(sh, key, ne, source)
+	s.sets.Add(1)
+	sh.mu.Unlock()
+	return cur + delta, s.settle()
+}
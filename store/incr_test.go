@@ -0,0 +1,54 @@
+package store
+
+import (
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIncr(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	if v, err := s.Incr("n", 5); err != nil || v != 5 {
+		t.Fatalf("expected a missing key to start from 0, got %d, %v", v, err)
+	}
+	s.Expire("n", time.Minute)
+	if v, err := s.Incr("n", -7); err != nil || v != -2 {
+		t.Fatalf("expected -2, got %d, %v", v, err)
+	}
+	if _, hasTTL, _ := s.TTL("n"); !hasTTL {
+		t.Fatal("expected Incr to keep the key's TTL")
+	}
+
+	s.Set("s", "abc", 0)
+	if _, err := s.Incr("s", 1); err != ErrNotInteger {
+		t.Fatalf("expected ErrNotInteger, got %v", err)
+	}
+	s.Set("max", "9223372036854775807", 0)
+	if _, err := s.Incr("max", 1); err != ErrOverflow {
+		t.Fatalf("expected ErrOverflow, got %v", err)
+	}
+	if v, _ := s.Incr("max", math.MinInt64); v != -1 {
+		t.Fatalf("expected -1, got %d", v)
+	}
+}
+
+func TestIncrConcurrent(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Incr("n", 1)
+		}()
+	}
+	wg.Wait()
+	if v, _ := s.Get("n"); v != "50" {
+		t.Fatalf("expected 50 after 50 concurrent increments, got %q", v)
+	}
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotJSON is returned by GetJSONPath when the stored value is not a
+	// valid JSON document.
+	ErrNotJSON = errors.New("value is not valid JSON")
+
+	// ErrPathNotFound is returned by GetJSONPath when the document has no
+	// value at the requested path.
+	ErrPathNotFound = errors.New("path not found")
+)
+
+// GetJSONPath parses the value of key as JSON and returns the JSON encoding of
+// the element at path. path is a dotted list of object fields and array
+// indices, such as "user.address.city" or "items.0.id"; an empty path selects
+// the whole document. found is false if the key does not exist. Returns
+// ErrNotJSON if the value is not valid JSON and ErrPathNotFound if path does
+// not lead to an element.
+func (s *Store) GetJSONPath(key, path string) (string, bool, error) {
+	val, ok := s.Get(key)
+	if !ok {
+		return "", false, nil
+	}
+	out, err := jsonPath(val, path)
+	return out, true, err
+}
+
+// GetJSONPath is Store.GetJSONPath within the namespace.
+func (n *Namespace) GetJSONPath(key, path string) (string, bool, error) {
+	val, ok := n.Get(key)
+	if !ok {
+		return "", false, nil
+	}
+	out, err := jsonPath(val, path)
+	return out, true, err
+}
+
+// jsonPath extracts the element at path from the JSON document doc. Numbers
+// are kept as written rather than round-tripped through float64.
+func jsonPath(doc, path string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", ErrNotJSON
+	}
+	if _, err := dec.Token(); err == nil {
+		return "", ErrNotJSON // trailing data after the document
+	}
+	if path != "" {
+		for _, part := range strings.Split(path, ".") {
+			switch node := v.(type) {
+			case map[string]any:
+				child, ok := node[part]
+				if !ok {
+					return "", ErrPathNotFound
+				}
+				v = child
+			case []any:
+				i, err := strconv.Atoi(part)
+				if err != nil || i < 0 || i >= len(node) {
+					return "", ErrPathNotFound
+				}
+				v = node[i]
+			default:
+				return "", ErrPathNotFound
+			}
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetJSONPath(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	s.Set("doc", `{"user":{"name":"Ada","address":{"city":"London"}},"items":[{"id":7},{"id":8.50}],"n":null}`, 0)
+	s.Set("text", "not json", 0)
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr error
+	}{
+		{"user.address.city", `"London"`, nil},
+		{"user.address", `{"city":"London"}`, nil},
+		{"items.1.id", `8.50`, nil},
+		{"items.0", `{"id":7}`, nil},
+		{"n", `null`, nil},
+		{"", `{"items":[{"id":7},{"id":8.50}],"n":null,"user":{"address":{"city":"London"},"name":"Ada"}}`, nil},
+		{"user.age", "", ErrPathNotFound},
+		{"items.2.id", "", ErrPathNotFound},
+		{"items.x", "", ErrPathNotFound},
+		{"user.name.first", "", ErrPathNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok, err := s.GetJSONPath("doc", tt.path)
+			if !ok {
+				t.Fatal("expected the key to be found")
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, ok, err := s.GetJSONPath("text", "a"); !ok || !errors.Is(err, ErrNotJSON) {
+		t.Fatalf("expected ErrNotJSON for a non-JSON value, got %v", err)
+	}
+	if _, ok, err := s.GetJSONPath("missing", "a"); ok || err != nil {
+		t.Fatalf("expected a missing key to report not found, got ok=%v err=%v", ok, err)
+	}
+}
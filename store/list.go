@@ -0,0 +1,136 @@
+package store
+
+// LPush inserts values at the head of the list stored at key, one after the
+// other, so the last of them ends up first, and returns the list's new
+// length. A missing or expired key is created as a new list with the
+// store's default TTL; an existing list keeps its TTL. Returns ErrWrongType
+// if the key holds a string or hash.
+func (s *Store) LPush(key string, values ...string) (int, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	return s.push("", key, values, true)
+}
+
+// RPush is like LPush but appends values to the tail of the list, in order.
+func (s *Store) RPush(key string, values ...string) (int, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	return s.push("", key, values, false)
+}
+
+// LPush is Store.LPush within the namespace.
+func (n *Namespace) LPush(key string, values ...string) (int, error) {
+	return n.push(key, values, true)
+}
+
+// RPush is Store.RPush within the namespace.
+func (n *Namespace) RPush(key string, values ...string) (int, error) {
+	return n.push(key, values, false)
+}
+
+func (n *Namespace) push(key string, values []string, head bool) (int, error) {
+	if err := n.check(key); err != nil {
+		return 0, err
+	}
+	length, err := n.s.push(n.source, n.key(key), values, head)
+	if err == nil {
+		n.counters().sets.Add(1)
+	}
+	return length, err
+}
+
+func (s *Store) push(source, key string, values []string, head bool) (int, error) {
+	if err := validUTF8(values...); err != nil {
+		return 0, err
+	}
+	var length int
+	err := s.modify(source, key, kindList, func(cur, next *entry) error {
+		var old []string
+		if cur != nil {
+			old = cur.list
+		}
+		list := make([]string, 0, len(old)+len(values))
+		if head {
+			for i := len(values) - 1; i >= 0; i-- {
+				list = append(list, values[i])
+			}
+			list = append(list, old...)
+		} else {
+			list = append(append(list, old...), values...)
+		}
+		next.list, length = list, len(list)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return length, nil
+}
+
+// LRange returns the elements of the list stored at key from index start to
+// stop inclusive. Negative indexes count back from the end, so -1 is the
+// last element; indexes past either end are clamped to it. A missing key is
+// an empty list. Returns ErrWrongType if the key holds a string or hash.
+func (s *Store) LRange(key string, start, stop int) ([]string, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	out, _, err := s.lrange(key, start, stop)
+	return out, err
+}
+
+// LRange is Store.LRange within the namespace.
+func (n *Namespace) LRange(key string, start, stop int) ([]string, error) {
+	if err := n.check(key); err != nil {
+		return nil, err
+	}
+	out, found, err := n.s.lrange(n.key(key), start, stop)
+	n.counted(found, err)
+	return out, err
+}
+
+func (s *Store) lrange(key string, start, stop int) ([]string, bool, error) {
+	var out []string
+	found, err := s.view(key, kindList, func(e *entry) {
+		n := len(e.list)
+		if start < 0 {
+			start = max(n+start, 0)
+		}
+		if stop < 0 {
+			stop = n + stop
+		}
+		stop = min(stop, n-1)
+		if start <= stop {
+			out = append([]string(nil), e.list[start:stop+1]...)
+		}
+	})
+	return out, found, err
+}
+
+// LLen returns the length of the list stored at key, zero if it is missing.
+// Returns ErrWrongType if the key holds a string or hash.
+func (s *Store) LLen(key string) (int, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	length, _, err := s.llen(key)
+	return length, err
+}
+
+// LLen is Store.LLen within the namespace.
+func (n *Namespace) LLen(key string) (int, error) {
+	if err := n.check(key); err != nil {
+		return 0, err
+	}
+	length, found, err := n.s.llen(n.key(key))
+	n.counted(found, err)
+	return length, err
+}
+
+func (s *Store) llen(key string) (int, bool, error) {
+	var length int
+	found, err := s.view(key, kindList, func(e *entry) { length = len(e.list) })
+	return length, found, err
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestListPushAndRange(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	if n, err := s.RPush("l", "b", "c"); n != 2 || err != nil {
+		t.Fatalf("expected length 2, got %d, %v", n, err)
+	}
+	if n, _ := s.LPush("l", "x", "a"); n != 4 {
+		t.Fatalf("expected length 4, got %d", n)
+	}
+	tests := []struct {
+		start, stop int
+		want        []string
+	}{
+		{0, -1, []string{"a", "x", "b", "c"}},
+		{1, 2, []string{"x", "b"}},
+		{-2, 100, []string{"b", "c"}},
+		{-100, 0, []string{"a"}},
+		{3, 1, nil},
+		{10, 20, nil},
+	}
+	for _, tt := range tests {
+		got, err := s.LRange("l", tt.start, tt.stop)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LRange(%d, %d) = %q, %v; want %q", tt.start, tt.stop, got, err, tt.want)
+		}
+	}
+	if n, _ := s.LLen("l"); n != 4 {
+		t.Fatalf("expected LLen 4, got %d", n)
+	}
+	if got, err := s.LRange("missing", 0, -1); got != nil || err != nil {
+		t.Fatalf("expected an empty list for a missing key, got %q, %v", got, err)
+	}
+	if info, _ := s.Info("l"); info.Type != "list" || info.Size != 4 {
+		t.Fatalf("expected a list of 4 bytes, got %+v", info)
+	}
+}
+
+func TestListKeepsTTL(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.RPush("l", "a")
+	if ok, _ := s.Expire("l", time.Hour); !ok {
+		t.Fatal("expected Expire to find the list")
+	}
+	s.RPush("l", "b")
+	if _, hasTTL, _ := s.TTL("l"); !hasTTL {
+		t.Fatal("expected the list to keep its TTL after a push")
+	}
+	if got, _ := s.LRange("l", 0, -1); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("expected Expire to keep the list, got %q", got)
+	}
+}
+
+func TestWrongType(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	s.Set("str", "1", 0)
+	s.RPush("list", "a")
+	s.HSet("hash", "f", "v")
+
+	if _, err := s.LPush("str", "a"); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("expected LPush on a string to fail, got %v", err)
+	}
+	if _, err := s.LLen("hash"); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("expected LLen on a hash to fail, got %v", err)
+	}
+	if _, err := s.HSet("list", "f", "v"); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("expected HSet on a list to fail, got %v", err)
+	}
+	if _, err := s.Incr("list", 1); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("expected Incr on a list to fail, got %v", err)
+	}
+	if _, err := s.Append("hash", "x"); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("expected Append on a hash to fail, got %v", err)
+	}
+	if _, ok := s.Get("list"); ok {
+		t.Fatal("expected Get not to read a list as a string")
+	}
+	if ok, err := s.SetNX("list", "v", 0); ok || err != nil {
+		t.Fatalf("expected SetNX to leave the list alone, got %v, %v", ok, err)
+	}
+	if _, err := s.LPush("l", "\xff"); !errors.Is(err, ErrInvalidUTF8) {
+		t.Fatalf("expected invalid UTF-8 to be rejected, got %v", err)
+	}
+
+	// Set replaces a value of any type.
+	s.Set("list", "now a string", 0)
+	if v, _ := s.Get("list"); v != "now a string" {
+		t.Fatalf("expected Set to replace the list, got %q", v)
+	}
+}
+
+func TestListAndHashWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stashr.wal")
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.RPush("l", "a", "b")
+	s.HSet("h", "f", "v")
+	s.HSet("h", "g", "w")
+	s.HDel("h", "g")
+	s.Stop()
+
+	r, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if got, _ := r.LRange("l", 0, -1); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Fatalf("expected the list to be replayed, got %q", got)
+	}
+	if got, _ := r.HGetAll("h"); !reflect.DeepEqual(got, map[string]string{"f": "v"}) {
+		t.Fatalf("expected the hash to be replayed, got %v", got)
+	}
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"container/heap"
+	"math/rand/v2"
+	"time"
+)
+
+// The LRU list is only maintained when the store is bounded and uses the
+// EvictLRU policy. Each entry holds its element in s.lru, whose value is the
+// key; the front is the most recently used. The list spans every shard, so all
+// access to it goes through s.lruMu, taken after the relevant shard lock.
+
+// touch marks e as most recently used. Caller must hold e's shard lock, at
+// least for reading.
+func (s *Store) touch(e *entry) {
+	if s.lru == nil || e.elem == nil {
+		return
+	}
+	s.lruMu.Lock()
+	s.lru.MoveToFront(e.elem)
+	s.lruMu.Unlock()
+}
+
+// overLimit reports whether the store holds more than its configured maximum
+// number of entries or bytes.
+func (s *Store) overLimit() bool {
+	return (s.maxEntries > 0 && s.count.Load() > int64(s.maxEntries)) ||
+		(s.maxBytes > 0 && s.bytes.Load() > s.maxBytes)
+}
+
+// evict removes entries until the store is within its configured maximum.
+// Expired entries are reclaimed first; only then are live keys evicted
+// according to the store's policy. It must be called without any shard lock
+// held.
+func (s *Store) evict() error {
+	if !s.overLimit() {
+		return nil
+	}
+	s.sweepDue()
+	for s.overLimit() {
+		var evicted bool
+		var err error
+		switch s.policy {
+		case EvictRandom:
+			evicted, err = s.evictRandom()
+		case EvictSoonestExpiry:
+			evicted, err = s.evictSoonestExpiry()
+		default:
+			evicted, err = s.evictLRU()
+		}
+		if err != nil || !evicted {
+			return err
+		}
+	}
+	return nil
+}
+
+// evictLRU evicts the least recently used key. It reports false if there was
+// nothing to evict.
+func (s *Store) evictLRU() (bool, error) {
+	s.lruMu.Lock()
+	back := s.lru.Back()
+	s.lruMu.Unlock()
+	if back == nil {
+		return false, nil
+	}
+	key := back.Value.(string)
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	// The key may have been removed or rewritten since we looked at the list;
+	// only evict it if it is still the entry we found. Either way the list has
+	// moved on, so the caller makes progress.
+	if e, ok := sh.data[key]; ok && e.elem == back {
+		if err := s.evictKey(sh, key); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// evictRandom evicts an arbitrary key, starting the search at a random shard.
+// It reports false if the store is empty.
+func (s *Store) evictRandom() (bool, error) {
+	start := rand.IntN(len(s.shards))
+	for i := range s.shards {
+		sh := s.shards[(start+i)%len(s.shards)]
+		sh.mu.Lock()
+		for key := range sh.data {
+			err := s.evictKey(sh, key)
+			sh.mu.Unlock()
+			return err == nil, err
+		}
+		sh.mu.Unlock()
+	}
+	return false, nil
+}
+
+// evictSoonestExpiry evicts the key with the earliest deadline, found from
+// the top of each shard's expiry heap. If no key has a TTL it falls back to
+// evictRandom. It reports false if the store is empty.
+func (s *Store) evictSoonestExpiry() (bool, error) {
+	var best *shard
+	var at time.Time
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		if it, ok := sh.nextExpiry(); ok && (best == nil || it.at.Before(at)) {
+			best, at = sh, it.at
+		}
+		sh.mu.Unlock()
+	}
+	if best == nil {
+		return s.evictRandom()
+	}
+	best.mu.Lock()
+	defer best.mu.Unlock()
+	// The shard may have changed since we looked; evict whatever is now
+	// soonest in it, and let the caller look again if that is nothing.
+	it, ok := best.nextExpiry()
+	if !ok {
+		return true, nil
+	}
+	heap.Pop(&best.expiries)
+	return true, s.evictKey(best, it.key)
+}
+
+// evictKey logs and removes key as an eviction. Caller must hold sh.mu.
+func (s *Store) evictKey(sh *shard, key string) error {
+	if err := s.logDel(key); err != nil {
+		return err
+	}
+	s.remove(sh, key, EventDelete, SourceEviction)
+	s.evictions.Add(1)
+	return nil
+}
+
+// SizeBytes returns the approximate memory footprint of the store, as bounded
+// by WithMaxBytes: the length of every key and value plus a fixed overhead per
+// entry. It is an estimate, not a measurement; the Go runtime's own overhead
+// for strings and maps is not counted exactly. Expired entries that have not
+// yet been reclaimed are included.
+func (s *Store) SizeBytes() int64 {
+	return s.bytes.Load()
+}
+
+// Len returns the number of entries held by the store. Expired entries that
+// have not yet been reclaimed are included.
+func (s *Store) Len() int {
+	return int(s.count.Load())
+}
+
+// Count returns the number of non-expired keys in the default namespace, the
+// length List would return, without building the list. Each shard keeps a
+// count of its keys, and only the expired ones still awaiting the sweep are
+// visited to subtract them.
+func (s *Store) Count() int {
+	now := time.Now()
+	n := 0
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		_, expired := sh.expiredCounts(now)
+		n += sh.plainCount - expired
+		sh.mu.RUnlock()
+	}
+	return n
+}
+
+// liveKeys returns the number of non-expired keys in every namespace.
+func (s *Store) liveKeys() int {
+	now := time.Now()
+	n := 0
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		expired, _ := sh.expiredCounts(now)
+		n += len(sh.data) - expired
+		sh.mu.RUnlock()
+	}
+	return n
+}
@@ -0,0 +1,269 @@
+package store
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+func TestMaxEntriesEvictsLRU(t *testing.T) {
+	s := New(WithMaxEntries(2))
+	defer s.Stop()
+
+	s.Set("a", "1", 0)
+	s.Set("b", "2", 0)
+	s.Get("a") // a is now more recently used than b
+	s.Set("c", "3", 0)
+
+	if _, ok := s.Get("b"); ok {
+		t.Fatal("expected b to be evicted as least recently used")
+	}
+	if _, ok := s.Get("a"); !ok {
+		t.Fatal("expected a to survive eviction")
+	}
+	if _, ok := s.Get("c"); !ok {
+		t.Fatal("expected c to be present")
+	}
+	if n := s.Len(); n != 2 {
+		t.Fatalf("expected Len 2, got %d", n)
+	}
+}
+
+func TestMaxEntriesOverwriteDoesNotEvict(t *testing.T) {
+	s := New(WithMaxEntries(2))
+	defer s.Stop()
+
+	s.Set("a", "1", 0)
+	s.Set("b", "2", 0)
+	s.Set("a", "3", 0)
+
+	if n := s.Len(); n != 2 {
+		t.Fatalf("expected Len 2, got %d", n)
+	}
+	if _, ok := s.Get("b"); !ok {
+		t.Fatal("overwriting an existing key should not evict")
+	}
+}
+
+func TestMaxEntriesPrefersExpired(t *testing.T) {
+	s := New(WithMaxEntries(2))
+	defer s.Stop()
+
+	s.Set("old", "1", 0)
+	s.Set("temp", "2", 20*time.Millisecond)
+	s.Get("temp") // temp is most recently used, but about to expire
+
+	time.Sleep(50 * time.Millisecond)
+
+	s.Set("new", "3", 0)
+	if _, ok := s.Get("old"); !ok {
+		t.Fatal("expected the expired entry to be reclaimed before evicting a live one")
+	}
+	if _, ok := s.Get("new"); !ok {
+		t.Fatal("expected new to be present")
+	}
+}
+
+func TestMaxEntriesMSet(t *testing.T) {
+	s := New(WithMaxEntries(3))
+	defer s.Stop()
+
+	s.MSet(map[string]SetOptions{
+		"a": {Value: "1"}, "b": {Value: "2"}, "c": {Value: "3"}, "d": {Value: "4"}, "e": {Value: "5"},
+	})
+	if n := s.Len(); n != 3 {
+		t.Fatalf("expected Len 3 after oversized batch, got %d", n)
+	}
+}
+
+func TestNewWithOptionsMaxKeys(t *testing.T) {
+	s := NewWithOptions(Options{MaxKeys: 2, Eviction: EvictLRU})
+	defer s.Stop()
+
+	s.Set("a", "1", 0)
+	s.Set("b", "2", 0)
+	s.Get("a")
+	s.Set("c", "3", 0)
+
+	if _, ok := s.Get("b"); ok {
+		t.Fatal("expected b to be evicted as least recently used")
+	}
+	if n := s.Len(); n != 2 {
+		t.Fatalf("expected Len 2, got %d", n)
+	}
+}
+
+func TestStatsSeparatesEvictionsFromExpirations(t *testing.T) {
+	s := New(WithMaxEntries(2))
+	defer s.Stop()
+
+	s.Set("a", "1", 0)
+	s.Set("b", "2", 0)
+	s.Set("c", "3", 0)            // evicts a
+	s.Set("temp", "4", time.Hour) // evicts b
+	s.ExpireNow("temp")
+
+	st := s.Stats()
+	if st.Evictions != 2 {
+		t.Errorf("expected 2 evictions, got %d", st.Evictions)
+	}
+	if st.Expirations != 1 {
+		t.Errorf("expected 1 expiration, got %d", st.Expirations)
+	}
+	if st.Keys != 1 {
+		t.Errorf("expected 1 key, got %d", st.Keys)
+	}
+}
+
+func TestMaxBytesEvictsLRU(t *testing.T) {
+	budget := 3 * entrySize("k1", "0123456789")
+	s := New(WithMaxBytes(budget))
+	defer s.Stop()
+
+	s.Set("k1", "0123456789", 0)
+	s.Set("k2", "0123456789", 0)
+	s.Set("k3", "0123456789", 0)
+	s.Get("k1")
+	s.Set("k4", "0123456789", 0)
+
+	if _, ok := s.Get("k2"); ok {
+		t.Fatal("expected k2 to be evicted as least recently used")
+	}
+	if _, ok := s.Get("k1"); !ok {
+		t.Fatal("expected k1 to survive eviction")
+	}
+	if st := s.Stats(); st.Bytes > budget || st.Evictions != 1 {
+		t.Fatalf("expected usage within %d after 1 eviction, got %+v", budget, st)
+	}
+}
+
+func TestMaxBytesTracksOverwritesAndDeletes(t *testing.T) {
+	s := New(WithMaxBytes(1 << 20))
+	defer s.Stop()
+
+	s.Set("a", "short", 0)
+	s.Set("a", "a much longer value", 0)
+	if got, want := s.Stats().Bytes, entrySize("a", "a much longer value"); got != want {
+		t.Fatalf("expected %d bytes after overwrite, got %d", want, got)
+	}
+	s.Delete("a")
+	if got := s.Stats().Bytes; got != 0 {
+		t.Fatalf("expected 0 bytes after delete, got %d", got)
+	}
+}
+
+func TestMaxBytesRejectsOversizedEntry(t *testing.T) {
+	s := New(WithMaxBytes(200))
+	defer s.Stop()
+
+	s.Set("keep", "v", 0)
+	big := make([]byte, 500)
+	if err := s.Set("big", string(big), 0); err != ErrValueTooLarge {
+		t.Fatalf("expected ErrValueTooLarge, got %v", err)
+	}
+	if _, ok := s.Get("keep"); !ok {
+		t.Fatal("a rejected write should not evict anything")
+	}
+}
+
+func TestMaxBytesEvictRandom(t *testing.T) {
+	budget := 5 * entrySize("k0", "v")
+	s := New(WithMaxBytes(budget), WithEviction(EvictRandom))
+	defer s.Stop()
+
+	for i := 0; i < 10; i++ {
+		s.Set(fmt.Sprintf("k%d", i), "v", 0)
+	}
+	if n := s.Len(); n != 5 {
+		t.Fatalf("expected 5 keys within budget, got %d", n)
+	}
+	if st := s.Stats(); st.Evictions != 5 {
+		t.Fatalf("expected 5 evictions, got %d", st.Evictions)
+	}
+}
+
+func TestMaxBytesEvictSoonestExpiry(t *testing.T) {
+	budget := 3 * entrySize("k0", "v")
+	s := New(WithMaxBytes(budget), WithEviction(EvictSoonestExpiry))
+	defer s.Stop()
+
+	s.Set("k0", "v", 0)
+	s.Set("k1", "v", time.Hour)
+	s.Set("k2", "v", time.Minute)
+	s.Set("k3", "v", 0)
+
+	if _, ok := s.Get("k2"); ok {
+		t.Fatal("expected k2, the soonest to expire, to be evicted")
+	}
+	s.Set("k4", "v", 0)
+	if _, ok := s.Get("k1"); ok {
+		t.Fatal("expected k1 to be evicted before keys without a TTL")
+	}
+	if n := s.Len(); n != 3 {
+		t.Fatalf("expected 3 keys within budget, got %d", n)
+	}
+	s.Set("k5", "v", 0)
+	if n := s.Len(); n != 3 || s.Stats().Evictions != 3 {
+		t.Fatalf("expected a random eviction once no key has a TTL, got %d keys and %+v", n, s.Stats())
+	}
+}
+
+func TestSizeBytes(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("a", "12345", 0)
+	s.Set("bb", "x", time.Hour)
+	want := entrySize("a", "12345") + entrySize("bb", "x")
+	if got := s.SizeBytes(); got != want {
+		t.Fatalf("expected %d bytes, got %d", want, got)
+	}
+	s.Delete("a")
+	s.Expire("bb", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	s.Get("bb")
+	if got := s.SizeBytes(); got != 0 {
+		t.Fatalf("expected 0 bytes after delete and expiry, got %d", got)
+	}
+}
+
+func TestCount(t *testing.T) {
+	s := New(WithGCInterval(time.Millisecond))
+	defer s.Stop()
+	ns := s.Namespace("other")
+
+	// TTLs are either already over or far off, so that no key expires
+	// between Count and the brute-force List it is compared with.
+	ttls := []time.Duration{0, time.Nanosecond, time.Hour}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprint(rng.IntN(200))
+		ttl := ttls[rng.IntN(len(ttls))]
+		switch rng.IntN(7) {
+		case 0, 1:
+			s.Set(key, "v", ttl)
+		case 2:
+			s.Expire(key, ttl)
+		case 3:
+			s.Persist(key)
+		case 4:
+			s.Delete(key)
+		case 5:
+			s.Get(key)
+		case 6:
+			ns.Set(key, "v", ttl)
+		}
+		if i%50 == 0 {
+			if got, want := s.Count(), len(s.List()); got != want {
+				t.Fatalf("after %d operations: Count() = %d, len(List()) = %d", i, got, want)
+			}
+			if got, want := ns.Count(), len(ns.List()); got != want {
+				t.Fatalf("after %d operations: namespace Count() = %d, len(List()) = %d", i, got, want)
+			}
+		}
+	}
+	if got, want := s.Stats().LiveKeys, len(s.List())+len(ns.List()); got != want {
+		t.Fatalf("expected LiveKeys %d, got %d", want, got)
+	}
+}
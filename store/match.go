@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrEmptyPrefix is returned by DeletePrefix for an empty prefix, which would
+// match every key. Use Flush or DeleteNamespace to remove everything.
+var ErrEmptyPrefix = errors.New("prefix must not be empty")
+
+// ListPrefix returns all non-expired keys in the default namespace starting
+// with prefix.
+func (s *Store) ListPrefix(prefix string) []string {
+	return s.Namespace("").ListPrefix(prefix)
+}
+
+// ListMatch returns all non-expired keys in the default namespace matching the
+// glob pattern. See Match for the pattern syntax.
+func (s *Store) ListMatch(pattern string) []string {
+	return s.Namespace("").ListMatch(pattern)
+}
+
+// DeletePrefix deletes every key in the default namespace starting with prefix
+// as a single atomic write, and returns how many live keys it removed.
+// Returns ErrEmptyPrefix if prefix is empty. If ctx is done while the keys are
+// still being gathered, nothing is deleted and ctx.Err() is returned.
+func (s *Store) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	return s.Namespace("").DeletePrefix(ctx, prefix)
+}
+
+// DeletePrefix is Store.DeletePrefix within the namespace.
+func (n *Namespace) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	if prefix == "" {
+		return 0, ErrEmptyPrefix
+	}
+	live, _, err := n.s.deleteWhere(ctx, n.source, n.prefix+prefix, func(k string) bool {
+		_, ok := n.owns(k)
+		return ok
+	})
+	if err == nil {
+		n.counters().deletes.Add(uint64(live))
+	}
+	return live, err
+}
+
+// Match reports whether key matches the glob pattern. '*' matches any run of
+// characters (including none), '?' matches exactly one character, and '\'
+// makes the following character literal. Every other character, including
+// '[' and ':', matches itself.
+func Match(pattern, key string) bool {
+	// Iterative matching with single-star backtracking: on a mismatch, retry
+	// from just after the most recent '*', letting it absorb one more
+	// character of key.
+	var p, k int
+	starP, starK := -1, 0
+	for k < len(key) {
+		if p < len(pattern) {
+			switch c := pattern[p]; c {
+			case '*':
+				starP, starK = p, k
+				p++
+				continue
+			case '?':
+				_, n := utf8.DecodeRuneInString(key[k:])
+				p++
+				k += n
+				continue
+			default:
+				lit, pn := literal(pattern[p:])
+				if strings.HasPrefix(key[k:], lit) {
+					p += pn
+					k += len(lit)
+					continue
+				}
+			}
+		}
+		if starP < 0 {
+			return false
+		}
+		_, n := utf8.DecodeRuneInString(key[starK:])
+		starK += n
+		p, k = starP+1, starK
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// literal returns the literal character at the start of pattern, resolving a
+// '\' escape, and how many pattern bytes it consumed. A trailing '\' is taken
+// literally.
+func literal(pattern string) (string, int) {
+	if pattern[0] == '\\' && len(pattern) > 1 {
+		_, n := utf8.DecodeRuneInString(pattern[1:])
+		return pattern[1 : 1+n], 1 + n
+	}
+	_, n := utf8.DecodeRuneInString(pattern)
+	return pattern[:n], n
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		key     string
+		want    bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything:at:all", true},
+		{"user:*", "user:42", true},
+		{"user:*", "user:", true},
+		{"user:*", "users:42", false},
+		{"user:*:session", "user:42:session", true},
+		{"user:*:session", "user:42:profile", false},
+		{"user:*:session", "user:a:b:session", true},
+		{"*:session", "user:42:session:old", false},
+		{"?", "a", true},
+		{"?", "", false},
+		{"?", "ab", false},
+		{"?", "é", true},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"a*b*c", "aXbYc", true},
+		{"a*b*c", "aXcYb", false},
+		{"**", "abc", true},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`\?`, "?", true},
+		{`\?`, "a", false},
+		{`a\\b`, `a\b`, true},
+		{`trailing\`, `trailing\`, true},
+		{"[abc]", "[abc]", true},
+		{"[abc]", "a", false},
+		{"x.y+z", "x.y+z", true},
+		{"x.y+z", "xayyz", false},
+		{"日本*", "日本語", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.key); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestListPrefixAndMatch(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("user:1:session", "a", 0)
+	s.Set("user:2:session", "b", 0)
+	s.Set("user:2:profile", "c", 0)
+	s.Set("order:1", "d", 0)
+
+	keys := s.ListPrefix("user:2")
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "user:2:profile" || keys[1] != "user:2:session" {
+		t.Fatalf("unexpected ListPrefix result: %v", keys)
+	}
+
+	keys = s.ListMatch("user:*:session")
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "user:1:session" || keys[1] != "user:2:session" {
+		t.Fatalf("unexpected ListMatch result: %v", keys)
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("tenant:1:a", "v", 0)
+	s.Set("tenant:1:b", "v", 0)
+	s.Set("tenant:1:gone", "v", time.Millisecond)
+	s.Set("tenant:2:a", "v", 0)
+	s.Namespace("other").Set("tenant:1:a", "v", 0)
+	time.Sleep(10 * time.Millisecond)
+
+	n, err := s.DeletePrefix(context.Background(), "tenant:1:")
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 live keys deleted, got %d, %v", n, err)
+	}
+	if got := s.ListPrefix("tenant:"); len(got) != 1 || got[0] != "tenant:2:a" {
+		t.Fatalf("expected only tenant:2:a to remain, got %v", got)
+	}
+	if !s.Namespace("other").Exists("tenant:1:a") {
+		t.Fatal("DeletePrefix reached into another namespace")
+	}
+	if _, err := s.DeletePrefix(context.Background(), ""); err != ErrEmptyPrefix {
+		t.Fatalf("expected ErrEmptyPrefix, got %v", err)
+	}
+	if s.Len() != 2 {
+		t.Fatalf("a refused delete should remove nothing, got %d keys", s.Len())
+	}
+}
+
+func TestDeletePrefixOverlap(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	for _, k := range []string{"job:12", "job:12:a", "job:123", "job:123:a", "job:1"} {
+		s.Set(k, "v", 0)
+	}
+	if n, _ := s.DeletePrefix(context.Background(), "job:12:"); n != 1 {
+		t.Fatalf("expected job:12: to match only job:12:a, got %d", n)
+	}
+	if n, _ := s.DeletePrefix(context.Background(), "job:12"); n != 3 {
+		t.Fatalf("expected job:12 to match job:12, job:123 and job:123:a, got %d", n)
+	}
+	if got := s.List(); len(got) != 1 || got[0] != "job:1" {
+		t.Fatalf("expected only job:1 to remain, got %v", got)
+	}
+}
@@ -0,0 +1,574 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDefaultNamespace is returned by DeleteNamespace for the default
+// namespace, which cannot be dropped.
+var ErrDefaultNamespace = errors.New("cannot delete the default namespace")
+
+// ErrReservedKey is returned by writes to a key in the default namespace that
+// starts with a NUL byte. Such keys are reserved for the encoding of named
+// namespaces; see nsSep.
+var ErrReservedKey = errors.New("keys starting with NUL are reserved")
+
+// nsSep marks a key as belonging to a named namespace. Such keys are stored as
+// nsSep + len(name) + nsSep + name + key. The length makes the encoding
+// unambiguous whatever bytes the name holds, so no two namespaces can
+// collide. Keys in the default namespace are stored as-is; keys starting with
+// nsSep are therefore reserved: writes to them through the default namespace
+// fail with ErrReservedKey, and reads find nothing.
+const nsSep = "\x00"
+
+// checkKey returns ErrReservedKey if key, given to the default namespace,
+// would reach into a named one.
+func checkKey(key string) error {
+	if namespaced(key) {
+		return ErrReservedKey
+	}
+	return nil
+}
+
+// namespaced reports whether an internal key belongs to a named namespace.
+func namespaced(key string) bool {
+	return strings.HasPrefix(key, nsSep)
+}
+
+// nsPrefix returns the prefix under which the keys of namespace name are
+// stored.
+func nsPrefix(name string) string {
+	if name == "" {
+		return ""
+	}
+	return nsSep + strconv.Itoa(len(name)) + nsSep + name
+}
+
+// nsPrefixLen returns the length of key's namespace prefix, or 0 for a key in
+// the default namespace.
+func nsPrefixLen(key string) int {
+	if !namespaced(key) {
+		return 0
+	}
+	i := strings.Index(key[1:], nsSep)
+	if i < 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(key[1 : 1+i])
+	if err != nil || 2+i+n > len(key) {
+		return 0
+	}
+	return 2 + i + n
+}
+
+// nsCounters are the operation counters of one namespace.
+type nsCounters struct {
+	hits, misses, sets, deletes atomic.Uint64
+}
+
+// Namespace is a view of the store scoped to one namespace. Keys in different
+// namespaces never collide, and listing, watching and stats only see the
+// namespace's own keys. Everything else is shared: limits, eviction, the WAL
+// and snapshots cover the whole store.
+//
+// The default namespace, named "", holds the keys written through the Store
+// methods directly, so Store.Get(k) and Store.Namespace("").Get(k) are
+// equivalent.
+type Namespace struct {
+	s      *Store
+	name   string
+	prefix string
+	source string // recorded in the history for writes; see WithSource
+}
+
+// Namespace returns a view of the namespace called name. Namespaces need not
+// be created first; one exists as long as it holds keys.
+func (s *Store) Namespace(name string) *Namespace {
+	return &Namespace{s: s, name: name, prefix: nsPrefix(name)}
+}
+
+// counters returns the namespace's operation counters, creating them on the
+// first write. Views look them up on every use rather than holding them, so
+// that those of a dropped namespace can be released.
+func (n *Namespace) counters() *nsCounters {
+	if ctr, ok := n.s.namespaces.Load(n.name); ok {
+		return ctr.(*nsCounters)
+	}
+	ctr, _ := n.s.namespaces.LoadOrStore(n.name, new(nsCounters))
+	return ctr.(*nsCounters)
+}
+
+// miss counts a read that found nothing. Unlike a write it does not create
+// the counters, so that reads of arbitrary namespace names, which callers
+// choose freely, leave nothing behind.
+func (n *Namespace) miss() {
+	if ctr, ok := n.s.namespaces.Load(n.name); ok {
+		ctr.(*nsCounters).misses.Add(1)
+	}
+}
+
+// DeleteNamespace deletes every key in the namespace called name as a single
+// atomic write, and returns how many keys it removed. Watchers see a delete
+// event for each key. The namespace's counters are dropped with it.
+func (s *Store) DeleteNamespace(name string) (int, error) {
+	if name == "" {
+		return 0, ErrDefaultNamespace
+	}
+	_, removed, err := s.deleteWhere(context.Background(), "", nsPrefix(name), nil)
+	if err == nil {
+		s.namespaces.Delete(name)
+	}
+	return removed, err
+}
+
+// deleteWhere deletes, on behalf of source, every internal key starting with
+// prefix for which keep, if non-nil, returns true, as a single atomic write.
+// It returns how many of the deleted keys were live and how many were
+// removed in all, including expired keys not yet swept.
+func (s *Store) deleteWhere(ctx context.Context, source, prefix string, keep func(string) bool) (live, removed int, err error) {
+	return s.deleteKeys(ctx, source, func() map[string]*entry { return s.collect(ctx, prefix, keep) })
+}
+
+// deleteKeys deletes, on behalf of source, the internal keys of the delete
+// batch returned by collect as a single atomic write. collect is called with
+// every shard locked. If ctx is done before the batch is logged nothing is
+// deleted and ctx.Err() is returned; after that the delete always completes.
+// It returns the same counts as deleteWhere.
+func (s *Store) deleteKeys(ctx context.Context, source string, collect func() map[string]*entry) (live, removed int, err error) {
+	if err := s.checkWritable(); err != nil {
+		return 0, 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, 0, err
+	}
+	unlock := s.lockAll()
+	batch := collect()
+	if err := ctx.Err(); err != nil {
+		unlock()
+		return 0, 0, err
+	}
+	if len(batch) == 0 {
+		unlock()
+		return 0, 0, nil
+	}
+	if err := s.logBatch(batch); err != nil {
+		unlock()
+		return 0, 0, err
+	}
+	for k := range batch {
+		sh := s.shardFor(k)
+		if !sh.data[k].expired() {
+			live++
+		}
+		s.remove(sh, k, EventDelete, source)
+	}
+	unlock()
+	return live, len(batch), s.maybeCompact()
+}
+
+// MDelete deletes several keys as a single atomic write, like MSet, and
+// returns how many of them were live. Missing keys are ignored.
+func (s *Store) MDelete(keys []string) (int, error) {
+	for _, k := range keys {
+		if err := checkKey(k); err != nil {
+			return 0, err
+		}
+	}
+	return s.mdelete("", keys)
+}
+
+func (s *Store) mdelete(source string, keys []string) (int, error) {
+	live, _, err := s.deleteKeys(context.Background(), source, func() map[string]*entry {
+		batch := make(map[string]*entry, len(keys))
+		for _, k := range keys {
+			if _, ok := s.shardFor(k).data[k]; ok {
+				batch[k] = nil
+			}
+		}
+		return batch
+	})
+	return live, err
+}
+
+// collect returns a delete batch of every internal key starting with prefix
+// for which keep, if non-nil, returns true. It gives up early, with a partial
+// batch, once ctx is done. Caller must hold every shard lock.
+func (s *Store) collect(ctx context.Context, prefix string, keep func(string) bool) map[string]*entry {
+	batch := make(map[string]*entry)
+	for _, sh := range s.shards {
+		if ctx.Err() != nil {
+			break
+		}
+		for k := range sh.data {
+			if strings.HasPrefix(k, prefix) && (keep == nil || keep(k)) {
+				batch[k] = nil
+			}
+		}
+	}
+	return batch
+}
+
+// Name returns the namespace's name, "" for the default namespace.
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+// key returns the internal key for key in n.
+func (n *Namespace) key(key string) string {
+	return n.prefix + key
+}
+
+// check is checkKey for a key given to n. Keys in a named namespace follow
+// its prefix, so they may start with any byte.
+func (n *Namespace) check(key string) error {
+	if n.prefix != "" {
+		return nil
+	}
+	return checkKey(key)
+}
+
+// owns reports whether the internal key belongs to n, and if so returns the
+// key as seen from within n.
+func (n *Namespace) owns(key string) (string, bool) {
+	if n.prefix == "" {
+		return key, !namespaced(key)
+	}
+	return strings.CutPrefix(key, n.prefix)
+}
+
+// Get is Store.Get within the namespace.
+func (n *Namespace) Get(key string) (string, bool) {
+	val, _, ok := n.GetWithTTL(key)
+	return val, ok
+}
+
+// GetBytes is Store.GetBytes within the namespace.
+func (n *Namespace) GetBytes(key string) ([]byte, bool) {
+	val, ok := n.Get(key)
+	if !ok {
+		return nil, false
+	}
+	return []byte(val), true
+}
+
+// GetWithTTL is Store.GetWithTTL within the namespace.
+func (n *Namespace) GetWithTTL(key string) (string, time.Duration, bool) {
+	val, info, ok := n.GetWithInfo(key)
+	return val, info.TTL, ok
+}
+
+// GetWithInfo is Store.GetWithInfo within the namespace.
+func (n *Namespace) GetWithInfo(key string) (string, EntryInfo, bool) {
+	if n.check(key) != nil {
+		n.miss()
+		return "", EntryInfo{}, false
+	}
+	val, info, ok := n.s.getWithInfo(n.key(key))
+	if ok {
+		info.Key = key
+		n.counters().hits.Add(1)
+	} else {
+		n.miss()
+	}
+	return val, info, ok
+}
+
+// MGet is Store.MGet within the namespace.
+func (n *Namespace) MGet(keys []string) map[string]string {
+	internal := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if n.check(k) == nil {
+			internal = append(internal, n.key(k))
+		}
+	}
+	found := n.s.mget(internal)
+	out := make(map[string]string, len(found))
+	for _, k := range keys {
+		if v, ok := found[n.key(k)]; ok {
+			out[k] = v
+			n.counters().hits.Add(1)
+		} else {
+			n.miss()
+		}
+	}
+	return out
+}
+
+// MSet is Store.MSet within the namespace.
+func (n *Namespace) MSet(entries map[string]SetOptions) error {
+	internal := make(map[string]SetOptions, len(entries))
+	for k, o := range entries {
+		if err := n.check(k); err != nil {
+			return err
+		}
+		internal[n.key(k)] = o
+	}
+	if err := n.s.mset(n.source, internal); err != nil {
+		return err
+	}
+	n.counters().sets.Add(uint64(len(entries)))
+	return nil
+}
+
+// MDelete is Store.MDelete within the namespace.
+func (n *Namespace) MDelete(keys []string) (int, error) {
+	internal := make([]string, len(keys))
+	for i, k := range keys {
+		if err := n.check(k); err != nil {
+			return 0, err
+		}
+		internal[i] = n.key(k)
+	}
+	live, err := n.s.mdelete(n.source, internal)
+	if err == nil {
+		n.counters().deletes.Add(uint64(live))
+	}
+	return live, err
+}
+
+// Exists is Store.Exists within the namespace.
+func (n *Namespace) Exists(key string) bool {
+	return n.check(key) == nil && n.s.exists(n.key(key))
+}
+
+// TTL is Store.TTL within the namespace.
+func (n *Namespace) TTL(key string) (remaining time.Duration, hasTTL bool, exists bool) {
+	if n.check(key) != nil {
+		return 0, false, false
+	}
+	return n.s.ttl(n.key(key))
+}
+
+// Set is Store.Set within the namespace.
+func (n *Namespace) Set(key, value string, ttl time.Duration) error {
+	if err := n.check(key); err != nil {
+		return err
+	}
+	if _, err := n.s.set(n.source, n.key(key), value, ttl, false, nil); err != nil {
+		return err
+	}
+	n.counters().sets.Add(1)
+	return nil
+}
+
+// SetSliding is Store.SetSliding within the namespace.
+func (n *Namespace) SetSliding(key, value string, ttl time.Duration) error {
+	if err := n.check(key); err != nil {
+		return err
+	}
+	if _, err := n.s.set(n.source, n.key(key), value, ttl, ttl > 0, nil); err != nil {
+		return err
+	}
+	n.counters().sets.Add(1)
+	return nil
+}
+
+// SetBytes is Store.SetBytes within the namespace.
+func (n *Namespace) SetBytes(key string, value []byte, ttl time.Duration) error {
+	return n.Set(key, string(value), ttl)
+}
+
+// SetNX is Store.SetNX within the namespace.
+func (n *Namespace) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	if err := n.check(key); err != nil {
+		return false, err
+	}
+	written, err := n.s.setNX(n.source, n.key(key), value, ttl)
+	if written {
+		n.counters().sets.Add(1)
+	}
+	return written, err
+}
+
+// CompareAndSwap is Store.CompareAndSwap within the namespace.
+func (n *Namespace) CompareAndSwap(key, old, value string, ttl time.Duration) (bool, error) {
+	if err := n.check(key); err != nil {
+		return false, err
+	}
+	swapped, err := n.s.compareAndSwap(n.source, n.key(key), old, value, ttl)
+	if swapped {
+		n.counters().sets.Add(1)
+	}
+	return swapped, err
+}
+
+// SetIfVersion is Store.SetIfVersion within the namespace.
+func (n *Namespace) SetIfVersion(key, value string, expectedVersion uint64, ttl time.Duration) (bool, uint64, error) {
+	if err := n.check(key); err != nil {
+		return false, 0, err
+	}
+	written, version, err := n.s.setIfVersion(n.source, n.key(key), value, expectedVersion, ttl)
+	if written {
+		n.counters().sets.Add(1)
+	}
+	return written, version, err
+}
+
+// GetSet is Store.GetSet within the namespace.
+func (n *Namespace) GetSet(key, value string, ttl time.Duration) (old string, existed bool, err error) {
+	if err := n.check(key); err != nil {
+		return "", false, err
+	}
+	old, existed, err = n.s.getSet(n.source, n.key(key), value, ttl)
+	if err == nil {
+		n.counters().sets.Add(1)
+	}
+	return old, existed, err
+}
+
+// Append is Store.Append within the namespace.
+func (n *Namespace) Append(key, suffix string) (int, error) {
+	if err := n.check(key); err != nil {
+		return 0, err
+	}
+	size, err := n.s.appendValue(n.source, n.key(key), suffix)
+	if err == nil {
+		n.counters().sets.Add(1)
+	}
+	return size, err
+}
+
+// Delete is Store.Delete within the namespace.
+func (n *Namespace) Delete(key string) (bool, error) {
+	if err := n.check(key); err != nil {
+		return false, err
+	}
+	n.counters().deletes.Add(1)
+	return n.s.delete(n.source, n.key(key))
+}
+
+// Expire is Store.Expire within the namespace.
+func (n *Namespace) Expire(key string, ttl time.Duration) (bool, error) {
+	return n.setExpiry(key, ttl, false)
+}
+
+// Persist is Store.Persist within the namespace.
+func (n *Namespace) Persist(key string) (bool, error) {
+	return n.setExpiry(key, 0, false)
+}
+
+// Touch is Store.Touch within the namespace.
+func (n *Namespace) Touch(key string, ttl time.Duration) (bool, error) {
+	return n.setExpiry(key, ttl, false)
+}
+
+// Refresh is Store.Refresh within the namespace.
+func (n *Namespace) Refresh(key string) (bool, error) {
+	return n.setExpiry(key, 0, true)
+}
+
+func (n *Namespace) setExpiry(key string, ttl time.Duration, refresh bool) (bool, error) {
+	if err := n.check(key); err != nil {
+		return false, err
+	}
+	return n.s.setExpiry(n.source, n.key(key), ttl, refresh)
+}
+
+// List returns the namespace's non-expired keys.
+func (n *Namespace) List() []string {
+	return n.listFunc(func(string) bool { return true })
+}
+
+// ListPrefix returns the namespace's non-expired keys starting with prefix.
+func (n *Namespace) ListPrefix(prefix string) []string {
+	return n.listFunc(func(k string) bool { return strings.HasPrefix(k, prefix) })
+}
+
+// ListMatch returns the namespace's non-expired keys matching the glob
+// pattern.
+func (n *Namespace) ListMatch(pattern string) []string {
+	return n.listFunc(func(k string) bool { return Match(pattern, k) })
+}
+
+// listFunc returns the namespace's live keys for which keep returns true, as
+// Store.List does. keep is called after each shard's lock is released, so a
+// slow pattern never holds up writers.
+func (n *Namespace) listFunc(keep func(string) bool) []string {
+	var keys []string
+	now := time.Now()
+	for _, sh := range n.s.shards {
+		from := len(keys)
+		sh.mu.RLock()
+		for k, e := range sh.data {
+			if k, ok := n.owns(k); ok && !e.expiredAt(now) {
+				keys = append(keys, k)
+			}
+		}
+		sh.mu.RUnlock()
+		kept := slices.DeleteFunc(keys[from:], func(k string) bool { return !keep(k) })
+		keys = keys[:from+len(kept)]
+	}
+	return keys
+}
+
+// Subscribe is Store.Subscribe within the namespace. Event keys are as seen
+// from within the namespace.
+func (n *Namespace) Subscribe(prefix string) (<-chan Event, func()) {
+	sub, cancel := n.s.subscribe(n.prefix, prefix)
+	return sub.events(), cancel
+}
+
+// Watch is Store.Watch within the namespace.
+func (n *Namespace) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	return n.s.watch(ctx, n.prefix, prefix)
+}
+
+// Count returns the number of non-expired keys in the namespace. For the
+// default namespace it is Store.Count; for a named one it visits the
+// namespace's keys but, unlike List, allocates nothing.
+func (n *Namespace) Count() int {
+	if n.prefix == "" {
+		return n.s.Count()
+	}
+	count := 0
+	for _, sh := range n.s.shards {
+		sh.mu.RLock()
+		for k, e := range sh.data {
+			if _, ok := n.owns(k); ok && !e.expired() {
+				count++
+			}
+		}
+		sh.mu.RUnlock()
+	}
+	return count
+}
+
+// Stats returns the namespace's own counters. Keys, KeysWithTTL and Bytes
+// count its entries; Hits, Misses, Sets and Deletes count operations made
+// through Namespace views. Evictions, expirations and sweeps are only
+// tracked store-wide and are left zero.
+func (n *Namespace) Stats() Stats {
+	var st Stats
+	for _, sh := range n.s.shards {
+		sh.mu.RLock()
+		for k, e := range sh.data {
+			if _, ok := n.owns(k); !ok {
+				continue
+			}
+			st.Keys++
+			if !e.expired() {
+				st.LiveKeys++
+			}
+			if !e.expiresAt.IsZero() {
+				st.KeysWithTTL++
+			}
+			st.Bytes += e.size(k)
+		}
+		sh.mu.RUnlock()
+	}
+	if v, ok := n.s.namespaces.Load(n.name); ok {
+		ctr := v.(*nsCounters)
+		st.Hits = ctr.hits.Load()
+		st.Misses = ctr.misses.Load()
+		st.Sets = ctr.sets.Load()
+		st.Deletes = ctr.deletes.Load()
+	}
+	st.Uptime = time.Since(n.s.started)
+	return st
+}
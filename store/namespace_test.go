@@ -0,0 +1,328 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNamespaceIsolation(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	a, b := s.Namespace("app-a"), s.Namespace("app-b")
+	s.Set("k", "default", 0)
+	a.Set("k", "a", 0)
+	b.Set("k", "b", 0)
+
+	for _, tt := range []struct {
+		ns   *Namespace
+		want string
+	}{{s.Namespace(""), "default"}, {a, "a"}, {b, "b"}} {
+		if v, _ := tt.ns.Get("k"); v != tt.want {
+			t.Errorf("namespace %q: expected %q, got %q", tt.ns.Name(), tt.want, v)
+		}
+	}
+	if v, _ := s.Get("k"); v != "default" {
+		t.Fatalf("expected the Store methods to use the default namespace, got %q", v)
+	}
+
+	a.Delete("k")
+	if _, ok := b.Get("k"); !ok {
+		t.Fatal("deleting in one namespace should not affect another")
+	}
+}
+
+func TestDefaultNamespaceCannotReachNamedOnes(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	a := s.Namespace("tenantA")
+	a.Set("secret", "mine", 0)
+	forged := nsPrefix("tenantA") + "secret"
+
+	if err := s.Set(forged, "pwned", 0); !errors.Is(err, ErrReservedKey) {
+		t.Fatalf("expected ErrReservedKey from Set, got %v", err)
+	}
+	if err := s.Namespace("").Set(forged, "pwned", 0); !errors.Is(err, ErrReservedKey) {
+		t.Fatalf("expected ErrReservedKey from the default Namespace, got %v", err)
+	}
+	if err := s.MSet(map[string]SetOptions{forged: {Value: "pwned"}}); !errors.Is(err, ErrReservedKey) {
+		t.Fatalf("expected ErrReservedKey from MSet, got %v", err)
+	}
+	if _, err := s.Delete(forged); !errors.Is(err, ErrReservedKey) {
+		t.Fatalf("expected ErrReservedKey from Delete, got %v", err)
+	}
+	if _, err := s.Expire(forged, time.Millisecond); !errors.Is(err, ErrReservedKey) {
+		t.Fatalf("expected ErrReservedKey from Expire, got %v", err)
+	}
+	err := s.Transaction(func(tx *Tx) error { return tx.Set(forged, "pwned", 0) })
+	if !errors.Is(err, ErrReservedKey) {
+		t.Fatalf("expected ErrReservedKey from Tx.Set, got %v", err)
+	}
+	if _, err := s.ImportRecord(Record{Key: forged, Value: "pwned"}, true); !errors.Is(err, ErrReservedKey) {
+		t.Fatalf("expected ErrReservedKey from ImportRecord, got %v", err)
+	}
+
+	if _, ok := s.Get(forged); ok {
+		t.Fatal("a default-namespace Get read a named namespace's key")
+	}
+	if got := s.MGet([]string{forged}); len(got) != 0 {
+		t.Fatalf("a default-namespace MGet read a named namespace's key: %v", got)
+	}
+	if v, _ := a.Get("secret"); v != "mine" {
+		t.Fatalf("expected tenantA's key to be untouched, got %q", v)
+	}
+	if err := a.Set("\x00k", "v", 0); err != nil {
+		t.Fatalf("expected a named namespace to accept a key starting with NUL, got %v", err)
+	}
+}
+
+func TestNamespaceBinaryValues(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	ns := s.Namespace("blobs")
+	if err := ns.SetBytes("k", binaryValue, 0); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := ns.GetBytes("k")
+	if !ok || !bytes.Equal(got, binaryValue) {
+		t.Fatalf("expected %q, got %q (found=%v)", binaryValue, got, ok)
+	}
+	if _, ok := s.GetBytes("k"); ok {
+		t.Fatal("a namespaced binary value leaked into the default namespace")
+	}
+}
+
+func TestNamespaceList(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("user:1", "x", 0)
+	ns := s.Namespace("app")
+	ns.Set("user:2", "x", 0)
+	ns.Set("order:1", "x", 0)
+
+	if keys := s.List(); len(keys) != 1 || keys[0] != "user:1" {
+		t.Fatalf("expected the default namespace to list only its own key, got %q", keys)
+	}
+	if keys := s.ListPrefix(""); len(keys) != 1 {
+		t.Fatalf("expected ListPrefix to skip other namespaces, got %q", keys)
+	}
+	keys := ns.List()
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "order:1,user:2" {
+		t.Fatalf("expected the namespace's keys without a prefix, got %q", keys)
+	}
+	if keys := ns.ListMatch("user:*"); len(keys) != 1 || keys[0] != "user:2" {
+		t.Fatalf("expected ListMatch within the namespace, got %q", keys)
+	}
+}
+
+func TestNamespaceNamesCannotCollide(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	// Without the length in the prefix, "a"+"bc" and "ab"+"c" would clash.
+	s.Namespace("a").Set("bc", "1", 0)
+	if _, ok := s.Namespace("ab").Get("c"); ok {
+		t.Fatal("expected namespaces a and ab to be disjoint")
+	}
+	if keys := s.Namespace("ab").List(); len(keys) != 0 {
+		t.Fatalf("expected namespace ab to be empty, got %q", keys)
+	}
+}
+
+func TestNamespaceKeySizeLimit(t *testing.T) {
+	s := New(WithMaxKeyBytes(4))
+	defer s.Stop()
+
+	if err := s.Namespace("a-long-namespace").Set("abcd", "v", 0); err != nil {
+		t.Fatalf("expected the namespace name not to count towards the key limit, got %v", err)
+	}
+	if err := s.Namespace("ns").Set("abcde", "v", 0); err != ErrKeyTooLarge {
+		t.Fatalf("expected ErrKeyTooLarge, got %v", err)
+	}
+}
+
+func TestDeleteNamespace(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("keep", "1", 0)
+	ns := s.Namespace("tmp")
+	ns.Set("a", "1", 0)
+	ns.Set("b", "2", time.Hour)
+	s.Namespace("other").Set("a", "1", 0)
+
+	n, err := s.DeleteNamespace("tmp")
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 keys deleted, got %d, %v", n, err)
+	}
+	if keys := ns.List(); len(keys) != 0 {
+		t.Fatalf("expected the namespace to be empty, got %q", keys)
+	}
+	if _, ok := s.Get("keep"); !ok {
+		t.Fatal("expected the default namespace to be untouched")
+	}
+	if _, ok := s.Namespace("other").Get("a"); !ok {
+		t.Fatal("expected other namespaces to be untouched")
+	}
+	if _, err := s.DeleteNamespace(""); err != ErrDefaultNamespace {
+		t.Fatalf("expected ErrDefaultNamespace, got %v", err)
+	}
+}
+
+func TestNamespaceSubscribe(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	def, cancelDef := s.Subscribe("")
+	defer cancelDef()
+	ns, cancelNS := s.Namespace("app").Subscribe("")
+	defer cancelNS()
+
+	s.Namespace("app").Set("k", "v", 0)
+	s.Set("plain", "v", 0)
+
+	select {
+	case ev := <-ns:
+		if ev.Key != "k" {
+			t.Fatalf("expected the namespace watcher to see key k, got %q", ev.Key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the namespace event")
+	}
+	select {
+	case ev := <-def:
+		if ev.Key != "plain" {
+			t.Fatalf("expected the default watcher to skip namespaced keys, got %q", ev.Key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the default event")
+	}
+	select {
+	case ev := <-ns:
+		t.Fatalf("expected the namespace watcher not to see default keys, got %+v", ev)
+	default:
+	}
+}
+
+func TestNamespaceStats(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("default", "1", 0)
+	ns := s.Namespace("app")
+	ns.Set("a", "1", time.Hour)
+	ns.Set("b", "2", 0)
+	ns.Append("a", "1")
+	ns.Get("a")
+	ns.Get("missing")
+	ns.Delete("b")
+
+	st := s.Namespace("app").Stats()
+	if st.Keys != 1 || st.KeysWithTTL != 1 || st.Bytes != entrySize(nsPrefix("app")+"a", "11") {
+		t.Errorf("unexpected key counts %+v", st)
+	}
+	if st.Sets != 3 || st.Hits != 1 || st.Misses != 1 || st.Deletes != 1 {
+		t.Errorf("unexpected operation counts %+v", st)
+	}
+	if all := s.Stats(); all.Keys != 2 {
+		t.Errorf("expected store-wide stats to cover every namespace, got %d keys", all.Keys)
+	}
+}
+
+func TestNamespaceCountersAreReleased(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	tracked := func() int {
+		n := 0
+		s.namespaces.Range(func(_, _ any) bool { n++; return true })
+		return n
+	}
+
+	for i := 0; i < 100; i++ {
+		ns := s.Namespace(fmt.Sprintf("probe%d", i))
+		ns.Get("k")
+		ns.MGet([]string{"k"})
+		ns.Stats()
+	}
+	if n := tracked(); n != 0 {
+		t.Fatalf("expected reads not to create counters, got %d namespaces", n)
+	}
+
+	s.Namespace("app").Set("k", "v", 0)
+	s.Namespace("app").Get("nope")
+	if st := s.Namespace("app").Stats(); st.Sets != 1 || st.Misses != 1 {
+		t.Fatalf("expected the write to start counting, got %+v", st)
+	}
+	if _, err := s.DeleteNamespace("app"); err != nil {
+		t.Fatal(err)
+	}
+	if n := tracked(); n != 0 {
+		t.Fatalf("expected the dropped namespace's counters to be released, got %d", n)
+	}
+	if st := s.Namespace("app").Stats(); st.Sets != 0 || st.Misses != 0 {
+		t.Fatalf("expected a dropped namespace to start from zero, got %+v", st)
+	}
+}
+
+func TestNamespaceSurvivesWALReplay(t *testing.T) {
+	path := t.TempDir() + "/wal"
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Namespace("app").Set("k", "v", 0)
+	s.Namespace("gone").Set("k", "v", 0)
+	s.DeleteNamespace("gone")
+	s.Stop()
+
+	r, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if v, _ := r.Namespace("app").Get("k"); v != "v" {
+		t.Fatalf("expected app/k to be replayed, got %q", v)
+	}
+	if _, ok := r.Namespace("gone").Get("k"); ok {
+		t.Fatal("expected the deleted namespace to stay deleted after replay")
+	}
+	if keys := r.List(); len(keys) != 0 {
+		t.Fatalf("expected no keys in the default namespace, got %q", keys)
+	}
+}
+
+func TestNamespaceExpiry(t *testing.T) {
+	s := New(WithGCInterval(time.Hour))
+	defer s.Stop()
+
+	a, b := s.Namespace("a"), s.Namespace("b")
+	a.Set("k", "v", 10*time.Millisecond)
+	b.Set("k", "v", time.Hour)
+	s.Set("k", "v", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	if _, ok := a.Get("k"); ok {
+		t.Fatal("expected the namespaced key to expire")
+	}
+	if ttl, hasTTL, ok := b.TTL("k"); !ok || !hasTTL || ttl <= 59*time.Minute {
+		t.Fatalf("expected the same key in another namespace to keep its own TTL, got %v %v %v", ttl, hasTTL, ok)
+	}
+	if n := s.SweepNow(); n != 1 {
+		t.Fatalf("expected the sweep to reclaim the default key, got %d", n)
+	}
+	if st := b.Stats(); st.Keys != 1 || st.KeysWithTTL != 1 {
+		t.Fatalf("expected b to keep its key, got %+v", st)
+	}
+	if st := a.Stats(); st.Keys != 0 {
+		t.Fatalf("expected a to be empty, got %+v", st)
+	}
+}
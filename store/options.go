@@ -0,0 +1,219 @@
+package store
+
+import "time"
+
+// Option configures a Store at construction time.
+type Option func(*Store)
+
+// Policy selects which entries are evicted when the store is full.
+type Policy int
+
+const (
+	// EvictLRU evicts the least recently used entry. Reads count as use.
+	EvictLRU Policy = iota
+	// EvictRandom evicts an arbitrary entry. It avoids the cost of tracking
+	// recency, but may evict the entry that was just written.
+	EvictRandom
+	// EvictSoonestExpiry evicts the entry closest to expiring, so keys with
+	// a TTL go before keys without one. Once no key has a TTL it evicts
+	// arbitrary entries, as EvictRandom does.
+	EvictSoonestExpiry
+)
+
+// Options is a struct form of the most common settings, for callers that
+// prefer it to functional options. The zero value is an unbounded store.
+type Options struct {
+	// MaxKeys bounds the number of entries; zero means unbounded. See
+	// WithMaxEntries.
+	MaxKeys int
+	// MaxBytes bounds the approximate memory footprint; zero means
+	// unbounded. See WithMaxBytes.
+	MaxBytes int64
+	// Eviction chooses what to evict once MaxKeys or MaxBytes is reached.
+	Eviction Policy
+}
+
+// NewWithOptions creates a Store configured by o, followed by any additional
+// functional options. Like New, it panics if an option fails to initialize.
+func NewWithOptions(o Options, opts ...Option) *Store {
+	base := []Option{WithMaxEntries(o.MaxKeys), WithMaxBytes(o.MaxBytes), WithEviction(o.Eviction)}
+	return New(append(base, opts...)...)
+}
+
+// WithMaxValueBytes caps the size of a stored value. Writes, including
+// Append, return ErrValueTooLarge rather than storing a value over n bytes.
+// The default is 1 MiB; zero means unlimited.
+func WithMaxValueBytes(n int) Option {
+	return func(s *Store) {
+		s.maxValueBytes = n
+	}
+}
+
+// WithMaxKeyBytes caps the length of a key. Writes return ErrKeyTooLarge for
+// longer keys. The default is 1 KiB; zero means unlimited.
+func WithMaxKeyBytes(n int) Option {
+	return func(s *Store) {
+		s.maxKeyBytes = n
+	}
+}
+
+// WithMaxEntries bounds the store to n entries. When a write would exceed the
+// bound, expired entries are reclaimed first and then the least recently used
+// keys are evicted. Zero means unbounded.
+func WithMaxEntries(n int) Option {
+	return func(s *Store) {
+		s.maxEntries = n
+	}
+}
+
+// WithMaxBytes bounds the approximate memory footprint of the store to n
+// bytes, counting each entry as its key and value length plus a fixed
+// per-entry overhead. When a write would exceed the bound, expired entries are
+// reclaimed first and then keys are evicted according to the eviction policy.
+// A single entry larger than n is rejected with ErrValueTooLarge. Zero means
+// unbounded.
+func WithMaxBytes(n int64) Option {
+	return func(s *Store) {
+		s.maxBytes = n
+	}
+}
+
+// WithEviction sets the policy used to choose entries to evict once the store
+// reaches its maximum size. The default is EvictLRU.
+func WithEviction(p Policy) Option {
+	return func(s *Store) {
+		s.policy = p
+	}
+}
+
+// WithExpiryJitter spreads expirations out by adding a random extra of up to
+// max to every TTL the store sets, so keys written together with the same TTL
+// do not all expire in the same sweep. TTLs are only ever lengthened: a key
+// lives at least as long as asked. Keys without a TTL are unaffected.
+//
+// The jitter is part of the key's expiry, so the remaining TTL reported by
+// GetWithTTL and TTL includes it and may exceed the requested TTL by up to
+// max. Zero, the default, disables jitter.
+func WithExpiryJitter(max time.Duration) Option {
+	return func(s *Store) {
+		s.jitter = max
+	}
+}
+
+// WithTTLJitterFraction randomizes every TTL the store sets by up to ±f of
+// itself, so with f = 0.1 a one-minute TTL becomes anything from 54 to 66
+// seconds. Unlike WithExpiryJitter it can shorten a TTL, but never to zero:
+// a key given a TTL always gets one. It is applied before WithExpiryJitter
+// when both are set, and the result is still capped by WithMaxTTL. As with
+// WithExpiryJitter the remaining TTL reported by GetWithTTL and TTL includes
+// it. f is clamped to [0, 1]; zero, the default, disables it.
+func WithTTLJitterFraction(f float64) Option {
+	return func(s *Store) {
+		s.jitterFrac = min(max(f, 0), 1)
+	}
+}
+
+// WithDefaultTTL gives writes that do not ask for a TTL, and Persist, an
+// expiry of d instead of none. Zero, the default, leaves such keys without
+// an expiry.
+func WithDefaultTTL(d time.Duration) Option {
+	return func(s *Store) {
+		s.defaultTTL = d
+	}
+}
+
+// WithMaxTTL caps every TTL the store sets at d, including the default TTL
+// and any expiry jitter, so that no key written lives longer than d. Writes
+// without a TTL, and Persist, get d as well. Zero, the default, means no cap.
+// Store.EffectiveTTL reports what a requested TTL becomes.
+func WithMaxTTL(d time.Duration) Option {
+	return func(s *Store) {
+		s.maxTTL = d
+	}
+}
+
+// WithGCInterval sets how often the background sweep removes expired keys.
+// Expired keys are never returned by reads, so this only affects how soon
+// their memory is reclaimed. The default is one second. With WithAdaptiveGC it
+// is the starting interval.
+//
+// Zero or less disables the background sweep: expired keys are then only
+// removed when accessed or by SweepNow.
+func WithGCInterval(d time.Duration) Option {
+	return func(s *Store) {
+		s.gcInterval = d
+	}
+}
+
+// WithAdaptiveGC lets the background sweep tune its own interval between min
+// and max: it backs off while sweeps find nothing to expire and speeds up
+// while they expire many keys. It is ignored unless 0 < min <= max.
+func WithAdaptiveGC(min, max time.Duration) Option {
+	return func(s *Store) {
+		if min > 0 && min <= max {
+			s.gcMinInterval, s.gcMaxInterval = min, max
+		}
+	}
+}
+
+// WithWAL enables a write-ahead log at path. Every mutation is appended to the
+// log before it is applied, and the log is replayed when the store is opened.
+func WithWAL(path string) Option {
+	return func(s *Store) {
+		s.walPath = path
+	}
+}
+
+// WithWALCompactEvery sets how many records the WAL may hold before it is
+// rewritten from the current state. Zero disables compaction.
+func WithWALCompactEvery(n int) Option {
+	return func(s *Store) {
+		s.walCompact = n
+	}
+}
+
+// FsyncPolicy controls when WAL writes are flushed to stable storage.
+type FsyncPolicy int
+
+const (
+	// FsyncNever leaves flushing to the operating system. Writes survive a
+	// crash of the process but may be lost on power failure.
+	FsyncNever FsyncPolicy = iota
+	// FsyncAlways flushes after every write before it is acknowledged.
+	FsyncAlways
+	// FsyncInterval flushes in the background at a fixed interval, bounding
+	// what a power failure can lose to that window.
+	FsyncInterval
+)
+
+// WithWALFsync sets the WAL's fsync policy. interval is only used with
+// FsyncInterval. The default is FsyncNever.
+func WithWALFsync(p FsyncPolicy, interval time.Duration) Option {
+	return func(s *Store) {
+		s.walFsync = p
+		s.walFsyncEvery = interval
+	}
+}
+
+// WithHistory keeps the last n mutations (key, operation, value size, time
+// and source) in memory for History and RecentMutations, to help answer who
+// changed a key. Older mutations are dropped. Zero, the default, disables
+// history.
+func WithHistory(n int) Option {
+	return func(s *Store) {
+		if n > 0 {
+			s.history.buf = make([]Mutation, n)
+		}
+	}
+}
+
+// WithShards splits the keyspace into n independently locked shards. More
+// shards reduce lock contention between writers to different keys at the cost
+// of slower whole-store operations such as List. Values below 1 are ignored.
+func WithShards(n int) Option {
+	return func(s *Store) {
+		if n >= 1 {
+			s.shards = newShards(n)
+		}
+	}
+}
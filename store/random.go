@@ -0,0 +1,73 @@
+package store
+
+import "math/rand/v2"
+
+// RandomKey returns a random live key from the default namespace, or false if
+// there are none. See Namespace.RandomKey for how random it is.
+func (s *Store) RandomKey() (string, bool) {
+	return s.Namespace("").RandomKey()
+}
+
+// RandomKey returns a random live key from the namespace, or false if it has
+// none. It is meant for sampling, such as spot-checking what a cache holds.
+//
+// It avoids visiting every key: it picks a shard with probability
+// proportional to its size, then a random position in that shard, and
+// returns the first live key of the namespace from there on. Every key can be
+// chosen, and in a store holding only live keys of one namespace the choice is
+// close to uniform. Otherwise keys that follow expired keys or other
+// namespaces' keys in a shard are favoured, and in a small namespace the cost
+// approaches a full scan.
+func (n *Namespace) RandomKey() (string, bool) {
+	shards := n.s.shards
+	sizes := make([]int, len(shards))
+	total := 0
+	for i, sh := range shards {
+		sh.mu.RLock()
+		sizes[i] = len(sh.data)
+		sh.mu.RUnlock()
+		total += sizes[i]
+	}
+	if total == 0 {
+		return "", false
+	}
+
+	pick := rand.IntN(total)
+	first := 0
+	for pick >= sizes[first] {
+		pick -= sizes[first]
+		first++
+	}
+	for i := range shards {
+		sh := shards[(first+i)%len(shards)]
+		sh.mu.RLock()
+		key, ok := n.randomIn(sh, pick)
+		sh.mu.RUnlock()
+		if ok {
+			return key, true
+		}
+		pick = 0
+	}
+	return "", false
+}
+
+// randomIn returns the first live key of n at or after position start in sh's
+// iteration order, wrapping around. Caller must hold sh.mu.
+func (n *Namespace) randomIn(sh *shard, start int) (string, bool) {
+	var fallback string
+	found := false
+	i := 0
+	for k, e := range sh.data {
+		k, ok := n.owns(k)
+		if ok && !e.expired() {
+			if i >= start {
+				return k, true
+			}
+			if !found {
+				fallback, found = k, true
+			}
+		}
+		i++
+	}
+	return fallback, found
+}
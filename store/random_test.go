@@ -0,0 +1,54 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRandomKey(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	if _, ok := s.RandomKey(); ok {
+		t.Fatal("expected no key from an empty store")
+	}
+
+	want := map[string]bool{"a": true, "b": true, "c": true}
+	for k := range want {
+		s.Set(k, "v", 0)
+	}
+	s.Set("gone", "v", time.Millisecond)
+	s.Namespace("other").Set("hidden", "v", 0)
+	time.Sleep(10 * time.Millisecond)
+
+	seen := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		k, ok := s.RandomKey()
+		if !ok || !want[k] {
+			t.Fatalf("unexpected RandomKey result %q, %v", k, ok)
+		}
+		seen[k]++
+	}
+	if len(seen) != 3 {
+		t.Fatalf("expected all three keys to be sampled, got %v", seen)
+	}
+}
+
+func TestNamespaceRandomKey(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	for _, k := range []string{"a", "b", "c", "d"} {
+		s.Set(k, "v", 0)
+	}
+	ns := s.Namespace("app")
+	if _, ok := ns.RandomKey(); ok {
+		t.Fatal("expected no key from an empty namespace")
+	}
+	ns.Set("only", "v", 0)
+	for i := 0; i < 20; i++ {
+		if k, ok := ns.RandomKey(); !ok || k != "only" {
+			t.Fatalf("expected the namespace's only key, got %q, %v", k, ok)
+		}
+	}
+}
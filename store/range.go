@@ -0,0 +1,45 @@
+package store
+
+import "time"
+
+// Range calls fn for each live string key in the default namespace with its
+// value and expiry, which is zero for keys without one. It stops early if fn
+// returns false. See Namespace.Range.
+func (s *Store) Range(fn func(key, value string, expiresAt time.Time) bool) {
+	s.Namespace("").Range(fn)
+}
+
+// Range calls fn for each live string key in the namespace with its value
+// and expiry, which is zero for keys without one. Lists and hashes are
+// skipped. It stops early if fn returns
+// false.
+//
+// Range works one shard at a time: it copies a shard's entries under its read
+// lock, releases the lock, and only then calls fn, so fn may call back into
+// the store and writers are never blocked on fn. Each shard's entries are a
+// consistent point-in-time view, but the shards are copied at different
+// times, so keys written or deleted during the iteration may or may not be
+// seen, and an entry may have been changed by the time fn sees it. Use
+// Snapshot for a view of the whole store at one moment.
+func (n *Namespace) Range(fn func(key, value string, expiresAt time.Time) bool) {
+	type item struct {
+		key, value string
+		expiresAt  time.Time
+	}
+	var chunk []item
+	for _, sh := range n.s.shards {
+		chunk = chunk[:0]
+		sh.mu.RLock()
+		for k, e := range sh.data {
+			if k, ok := n.owns(k); ok && !e.expired() && e.kind == kindString {
+				chunk = append(chunk, item{k, e.value, e.expiresAt})
+			}
+		}
+		sh.mu.RUnlock()
+		for _, it := range chunk {
+			if !fn(it.key, it.value, it.expiresAt) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRange(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	for i := 0; i < 100; i++ {
+		s.Set(fmt.Sprintf("k%d", i), fmt.Sprint(i), 0)
+	}
+	s.Set("ttl", "v", time.Hour)
+	s.Set("gone", "v", time.Millisecond)
+	s.Namespace("other").Set("hidden", "v", 0)
+	time.Sleep(10 * time.Millisecond)
+
+	seen := make(map[string]string)
+	s.Range(func(key, value string, expiresAt time.Time) bool {
+		seen[key] = value
+		if key == "ttl" && expiresAt.IsZero() {
+			t.Error("expected ttl's expiry to be passed through")
+		}
+		if key != "ttl" && !expiresAt.IsZero() {
+			t.Errorf("expected %s to have no expiry", key)
+		}
+		return true
+	})
+	if len(seen) != 101 || seen["k42"] != "42" {
+		t.Fatalf("expected the 101 live default keys, got %d", len(seen))
+	}
+
+	calls := 0
+	s.Range(func(string, string, time.Time) bool {
+		calls++
+		return calls < 5
+	})
+	if calls != 5 {
+		t.Fatalf("expected Range to stop after fn returned false, got %d calls", calls)
+	}
+}
+
+func TestRangeCallbackMayWrite(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	for i := 0; i < 50; i++ {
+		s.Set(fmt.Sprintf("k%d", i), "v", 0)
+	}
+	// Deleting from inside fn would deadlock if Range held a shard lock.
+	s.Range(func(key, _ string, _ time.Time) bool {
+		s.Delete(key)
+		return true
+	})
+	if s.Len() != 0 {
+		t.Fatalf("expected every key to be deleted, got %d", s.Len())
+	}
+}
+
+func TestNamespaceRange(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("default", "v", 0)
+	ns := s.Namespace("app")
+	ns.Set("a", "1", 0)
+	ns.Set("b", "2", 0)
+
+	seen := make(map[string]string)
+	ns.Range(func(key, value string, _ time.Time) bool {
+		seen[key] = value
+		return true
+	})
+	if len(seen) != 2 || seen["a"] != "1" || seen["b"] != "2" {
+		t.Fatalf("expected the namespace's own keys, got %v", seen)
+	}
+}
@@ -0,0 +1,209 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SourceReplication tags keys written by ApplyReplication on a follower.
+const SourceReplication = "replication"
+
+// ErrReplicaBehind is returned by Replicate when the follower fell more than
+// replicationBuffer changes behind and was disconnected. It should reconnect
+// and start again from a fresh copy.
+var ErrReplicaBehind = errors.New("replica fell behind")
+
+// replicationBuffer is the number of changes a replication stream may fall
+// behind by before it is disconnected. It is larger than subscriberBuffer
+// since the stream must first send the whole store.
+const replicationBuffer = 1 << 16
+
+// opSync marks the end of the initial copy in a replication stream.
+const opSync = "sync"
+
+// FollowerError is returned by every write to a store that follows a leader,
+// naming the leader to send the write to instead. It matches ErrReadOnly with
+// errors.Is.
+type FollowerError struct {
+	Leader string
+}
+
+func (e *FollowerError) Error() string {
+	return "read-only follower; write to the leader at " + e.Leader
+}
+
+func (e *FollowerError) Is(target error) bool {
+	return target == ErrReadOnly
+}
+
+// SetLeader makes the store a follower of the leader at addr, or a standalone
+// store again if addr is empty. While following, every write fails with a
+// *FollowerError naming addr, and only ApplyReplication changes the store.
+// SetReadOnly does not affect this.
+func (s *Store) SetLeader(addr string) {
+	s.leader.Store(&addr)
+}
+
+// Leader returns the address given to SetLeader, or "" if the store is not a
+// follower.
+func (s *Store) Leader() string {
+	if p := s.leader.Load(); p != nil {
+		return *p
+	}
+	return ""
+}
+
+// replicationRecord describes a change for replication, as a WAL record. e is
+// the new entry for EventSet and is ignored otherwise. Caller must hold key's
+// shard lock.
+func replicationRecord(typ EventType, key string, e *entry) *walRecord {
+	if typ == EventSet {
+		rec := recordFor(key, e)
+		return &rec
+	}
+	return &walRecord{Op: opDel, Key: key}
+}
+
+// Replicate streams the store to a follower by calling send with one record
+// at a time: first a copy of every live key in every namespace, then a marker,
+// then every change as it happens, in the order they are applied. Each record
+// is a line in the same format as the WAL. It returns when ctx is done, send
+// fails, the store stops, or the follower falls too far behind, with
+// ErrReplicaBehind.
+//
+// The subscription starts before the copy, so no change is missed; changes
+// made during the copy may be sent again afterwards, which is harmless since
+// each record carries the key's full state.
+func (s *Store) Replicate(ctx context.Context, send func(record []byte) error) error {
+	sub, cancel := s.register(&subscriber{
+		all:  true,
+		ch:   make(chan Event, replicationBuffer),
+		done: make(chan struct{}),
+	})
+	if sub == nil {
+		return ErrStopped
+	}
+	defer cancel()
+
+	unlock := s.rlockAll()
+	recs := make([]walRecord, 0, s.count.Load())
+	for _, sh := range s.shards {
+		for k, e := range sh.data {
+			if !e.expired() {
+				recs = append(recs, recordFor(k, e))
+			}
+		}
+	}
+	unlock()
+	recs = append(recs, walRecord{Op: opSync})
+	for _, rec := range recs {
+		if err := sendRecord(send, rec); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case ev, ok := <-sub.ch:
+			if !ok {
+				if s.closed.Load() {
+					return ErrStopped
+				}
+				return ErrReplicaBehind
+			}
+			if err := sendRecord(send, *ev.rec); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func sendRecord(send func([]byte) error, rec walRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("replicate: %w", err)
+	}
+	return send(b)
+}
+
+// ApplyReplication makes the store a copy of the leader whose Replicate
+// stream next returns records from, one at a time, until next fails, and then
+// returns that error. Once the leader's initial copy has arrived it replaces
+// the store's contents in one step, so keys deleted on the leader while the
+// follower was disconnected disappear too; every later change is applied as
+// it arrives. Call it again, with a new stream, to resynchronize after an
+// error. It applies changes even while the store is read-only or following,
+// which is the point.
+func (s *Store) ApplyReplication(next func() ([]byte, error)) error {
+	var data map[string]*entry // the initial copy, until the marker arrives
+	synced := false
+	for {
+		b, err := next()
+		if err != nil {
+			return err
+		}
+		var rec walRecord
+		if err := json.Unmarshal(bytes.TrimSpace(b), &rec); err != nil {
+			return fmt.Errorf("replication record: %w", err)
+		}
+		switch {
+		case !synced && rec.Op == opSync:
+			if s.closed.Load() {
+				return ErrStoreClosed
+			}
+			if err := s.replace(data, SourceReplication); err != nil {
+				return err
+			}
+			data, synced = nil, true
+		case !synced:
+			if data == nil {
+				data = make(map[string]*entry)
+			}
+			if err := apply(rec, data, time.Now()); err != nil {
+				return fmt.Errorf("replication record: %w", err)
+			}
+		default:
+			if err := s.applyReplicated(rec); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// applyReplicated applies one change from the leader.
+func (s *Store) applyReplicated(rec walRecord) error {
+	if s.closed.Load() {
+		return ErrStoreClosed
+	}
+	if rec.Op != opSet && rec.Op != opDel {
+		return fmt.Errorf("replication record: unexpected op %q", rec.Op)
+	}
+	data := make(map[string]*entry, 1)
+	if err := apply(rec, data, time.Now()); err != nil {
+		return fmt.Errorf("replication record: %w", err)
+	}
+	sh := s.shardFor(rec.Key)
+	sh.mu.Lock()
+	// A set that arrives already expired removes the key, as apply does.
+	if e, ok := data[rec.Key]; ok {
+		if err := s.logSet(rec.Key, e); err != nil {
+			sh.mu.Unlock()
+			return err
+		}
+		s.put(sh, rec.Key, e, SourceReplication)
+	} else if _, ok := sh.data[rec.Key]; ok {
+		if err := s.logDel(rec.Key); err != nil {
+			sh.mu.Unlock()
+			return err
+		}
+		s.remove(sh, rec.Key, EventDelete, SourceReplication)
+	}
+	sh.mu.Unlock()
+	return s.settle()
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// replicate runs leader.Replicate into follower.ApplyReplication until the
+// returned function is called, which waits for both to finish.
+func replicate(t *testing.T, leader, follower *Store) func() {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan []byte)
+	sent := make(chan error, 1)
+	applied := make(chan error, 1)
+	go func() {
+		sent <- leader.Replicate(ctx, func(rec []byte) error {
+			select {
+			case ch <- rec:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		close(ch)
+	}()
+	go func() {
+		applied <- follower.ApplyReplication(func() ([]byte, error) {
+			rec, ok := <-ch
+			if !ok {
+				return nil, io.EOF
+			}
+			return rec, nil
+		})
+	}()
+	return func() {
+		cancel()
+		if err := <-sent; !errors.Is(err, context.Canceled) {
+			t.Errorf("expected Replicate to stop with the context, got %v", err)
+		}
+		if err := <-applied; err != io.EOF {
+			t.Errorf("expected ApplyReplication to stop at the end of the stream, got %v", err)
+		}
+	}
+}
+
+// eventually polls cond until it holds or a second has passed.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReplication(t *testing.T) {
+	leader := New()
+	defer leader.Stop()
+	follower := New()
+	defer follower.Stop()
+	follower.SetLeader("leader:9090")
+
+	leader.Set("before", "v", 0)
+	leader.Namespace("app").SetWithOptions("k", SetOptions{Value: "v", TTL: time.Hour, Tags: map[string]string{"t": "1"}})
+	stop := replicate(t, leader, follower)
+
+	eventually(t, "the initial copy", func() bool { return follower.Exists("before") })
+	if ttl, hasTTL, ok := follower.Namespace("app").TTL("k"); !ok || !hasTTL || ttl < 59*time.Minute {
+		t.Fatalf("expected the namespaced key with its TTL, got %v %v %v", ttl, hasTTL, ok)
+	}
+	if got := follower.Namespace("app").ListByTag("t", "1"); len(got) != 1 {
+		t.Fatalf("expected tags to be replicated, got %v", got)
+	}
+
+	leader.Set("after", "1", 0)
+	leader.Append("after", "2")
+	leader.Delete("before")
+	leader.Namespace("app").Persist("k")
+	eventually(t, "live changes", func() bool {
+		v, _ := follower.Get("after")
+		_, hasTTL, _ := follower.Namespace("app").TTL("k")
+		return v == "12" && !follower.Exists("before") && !hasTTL
+	})
+	stop()
+
+	// Writes made while disconnected, including deletes, are caught up by
+	// the next stream's copy.
+	leader.Delete("after")
+	leader.Set("later", "v", 0)
+	stop = replicate(t, leader, follower)
+	eventually(t, "resync", func() bool { return follower.Exists("later") && !follower.Exists("after") })
+	stop()
+}
+
+func TestFollowerRejectsWrites(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	s.SetLeader("leader:9090")
+
+	err := s.Set("k", "v", 0)
+	var ferr *FollowerError
+	if !errors.As(err, &ferr) || ferr.Leader != "leader:9090" || !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected a FollowerError naming the leader, got %v", err)
+	}
+	s.SetReadOnly(false)
+	if err := s.Set("k", "v", 0); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected SetReadOnly not to make a follower writable, got %v", err)
+	}
+	s.SetLeader("")
+	if err := s.Set("k", "v", 0); err != nil {
+		t.Fatalf("expected writes once no longer following, got %v", err)
+	}
+}
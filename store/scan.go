@@ -0,0 +1,192 @@
+package store
+
+import (
+	"container/heap"
+	"context"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidCursor is returned by Scan for a cursor it did not produce.
+var ErrInvalidCursor = errors.New("invalid scan cursor")
+
+// defaultScanLimit is the page size Scan uses when limit is not positive.
+const defaultScanLimit = 100
+
+// Scan returns up to limit keys from the default namespace, starting at
+// cursor, along with the cursor to pass to the next call. Start with an empty
+// cursor; an empty next cursor means the scan is complete.
+//
+// Unlike List, Scan never holds more than one shard's lock at a time or builds
+// the whole key list. As with Redis SCAN, keys may change between calls: a key
+// present for the whole scan is returned exactly once, while keys added or
+// removed part way through may or may not be.
+func (s *Store) Scan(cursor string, limit int) (keys []string, next string, err error) {
+	return s.Namespace("").ScanFunc(cursor, limit, nil)
+}
+
+// Scan is Store.Scan within the namespace.
+func (n *Namespace) Scan(cursor string, limit int) (keys []string, next string, err error) {
+	return n.ScanFunc(cursor, limit, nil)
+}
+
+// ScanFunc is like Scan but only returns keys for which keep returns true,
+// while still filling each page up to limit. keep is called with a shard lock
+// held, so it must not call back into the store. A nil keep keeps every key.
+func (n *Namespace) ScanFunc(cursor string, limit int, keep func(key string) bool) (keys []string, next string, err error) {
+	shard, after, err := decodeCursor(cursor, len(n.s.shards))
+	if err != nil {
+		return nil, "", err
+	}
+	if limit <= 0 {
+		limit = defaultScanLimit
+	}
+	// Each shard is walked in key order, so a cursor is just the shard and
+	// the last key returned from it.
+	for ; shard < len(n.s.shards); shard, after = shard+1, "" {
+		page := n.scanShard(n.s.shards[shard], after, limit-len(keys), keep)
+		keys = append(keys, page...)
+		if len(keys) == limit {
+			return keys, encodeCursor(shard, keys[len(keys)-1]), nil
+		}
+	}
+	return keys, "", nil
+}
+
+// scanShard returns, in order, the want smallest live keys of n in sh that
+// sort after after and satisfy keep.
+func (n *Namespace) scanShard(sh *shard, after string, want int, keep func(string) bool) []string {
+	// A max-heap of the smallest keys seen so far: its root is the first key
+	// to give up when a smaller one turns up.
+	h := &maxHeap{}
+	sh.mu.RLock()
+	for k, e := range sh.data {
+		k, ok := n.owns(k)
+		if !ok || k <= after || e.expired() || (keep != nil && !keep(k)) {
+			continue
+		}
+		if h.Len() < want {
+			heap.Push(h, k)
+		} else if k < (*h)[0] {
+			(*h)[0] = k
+			heap.Fix(h, 0)
+		}
+	}
+	sh.mu.RUnlock()
+	sort.Strings(*h)
+	return *h
+}
+
+// ListPage returns up to limit keys from the default namespace starting with
+// prefix, in sorted order, beginning after cursor, along with the cursor for
+// the next page. Start with an empty cursor; an empty next cursor means there
+// are no more keys. A cursor ListPage did not produce returns no keys.
+//
+// Because pages follow key order, a cursor is simply a position in it: keys
+// present for the whole iteration are returned exactly once, keys added or
+// removed ahead of the cursor are seen or skipped accordingly, and changes
+// behind it are not revisited. Each page walks every shard, one at a time, so
+// prefer Scan when order does not matter. If ctx is done part way through,
+// ListPage stops and returns ctx.Err().
+func (s *Store) ListPage(ctx context.Context, prefix, cursor string, limit int) (keys []string, nextCursor string, err error) {
+	return s.Namespace("").ListPage(ctx, prefix, cursor, limit)
+}
+
+// ListPage is Store.ListPage within the namespace.
+func (n *Namespace) ListPage(ctx context.Context, prefix, cursor string, limit int) (keys []string, nextCursor string, err error) {
+	keys, next, err := n.ListPageFunc(ctx, cursor, limit, func(k string) bool { return strings.HasPrefix(k, prefix) })
+	if errors.Is(err, ErrInvalidCursor) {
+		return nil, "", nil
+	}
+	return keys, next, err
+}
+
+// ListPageFunc is like ListPage but only returns keys for which keep returns
+// true, and reports a cursor it did not produce as ErrInvalidCursor. As with
+// ScanFunc, keep is called with a shard lock held and a nil keep keeps every
+// key.
+func (n *Namespace) ListPageFunc(ctx context.Context, cursor string, limit int, keep func(key string) bool) (keys []string, next string, err error) {
+	after, err := decodePageCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	if limit <= 0 {
+		limit = defaultScanLimit
+	}
+	// Take the smallest keys after the cursor from each shard and keep the
+	// overall smallest. One key beyond the page tells whether there is more.
+	for _, sh := range n.s.shards {
+		if err := ctx.Err(); err != nil {
+			return nil, "", err
+		}
+		keys = append(keys, n.scanShard(sh, after, limit+1, keep)...)
+		sort.Strings(keys)
+		if len(keys) > limit+1 {
+			keys = keys[:limit+1]
+		}
+	}
+	if len(keys) <= limit {
+		return keys, "", nil
+	}
+	keys = keys[:limit]
+	return keys, encodePageCursor(keys[limit-1]), nil
+}
+
+// encodeCursor packs a shard index and the last key returned from it into an
+// opaque, URL-safe cursor.
+func encodeCursor(shard int, after string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(shard) + ":" + after))
+}
+
+func decodeCursor(cursor string, shards int) (int, string, error) {
+	if cursor == "" {
+		return 0, "", nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	idx, after, ok := strings.Cut(string(raw), ":")
+	shard, err := strconv.Atoi(idx)
+	if !ok || err != nil || shard < 0 || shard >= shards {
+		return 0, "", ErrInvalidCursor
+	}
+	return shard, after, nil
+}
+
+// encodePageCursor wraps the last key of a ListPage page into an opaque,
+// URL-safe cursor. The marker keeps Scan cursors from being mistaken for it.
+func encodePageCursor(after string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("k:" + after))
+}
+
+func decodePageCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	after, ok := strings.CutPrefix(string(raw), "k:")
+	if !ok {
+		return "", ErrInvalidCursor
+	}
+	return after, nil
+}
+
+type maxHeap []string
+
+func (h maxHeap) Len() int           { return len(h) }
+func (h maxHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h maxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x any)        { *h = append(*h, x.(string)) }
+func (h *maxHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestScanVisitsEveryKeyOnce(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	for i := 0; i < 250; i++ {
+		s.Set(fmt.Sprintf("key:%03d", i), "v", 0)
+	}
+	s.Namespace("other").Set("hidden", "v", 0)
+
+	seen := make(map[string]int)
+	cursor, pages := "", 0
+	for {
+		keys, next, err := s.Scan(cursor, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) > 16 {
+			t.Fatalf("page of %d keys exceeds the limit", len(keys))
+		}
+		for _, k := range keys {
+			seen[k]++
+		}
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(seen) != 250 {
+		t.Fatalf("expected 250 keys, got %d", len(seen))
+	}
+	for k, n := range seen {
+		if n != 1 {
+			t.Errorf("%q returned %d times", k, n)
+		}
+	}
+	if pages < 250/16 {
+		t.Errorf("expected at least %d pages, got %d", 250/16, pages)
+	}
+}
+
+func TestScanToleratesChangesBetweenCalls(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	for i := 0; i < 100; i++ {
+		s.Set(fmt.Sprintf("stable:%03d", i), "v", 0)
+		s.Set(fmt.Sprintf("doomed:%03d", i), "v", 0)
+	}
+
+	seen := make(map[string]int)
+	cursor, i := "", 0
+	for {
+		keys, next, err := s.Scan(cursor, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, k := range keys {
+			seen[k]++
+		}
+		// Churn the keyspace between pages.
+		s.Delete(fmt.Sprintf("doomed:%03d", i))
+		s.Set(fmt.Sprintf("new:%03d", i), "v", 0)
+		i++
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	for i := 0; i < 100; i++ {
+		if k := fmt.Sprintf("stable:%03d", i); seen[k] != 1 {
+			t.Errorf("%q returned %d times, want 1", k, seen[k])
+		}
+	}
+	for k, n := range seen {
+		if n != 1 {
+			t.Errorf("%q returned %d times", k, n)
+		}
+	}
+}
+
+func TestScanFuncFillsPages(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	ns := s.Namespace("app")
+	for i := 0; i < 50; i++ {
+		ns.Set(fmt.Sprintf("user:%02d", i), "v", 0)
+		ns.Set(fmt.Sprintf("order:%02d", i), "v", 0)
+	}
+
+	keep := func(k string) bool { return strings.HasPrefix(k, "user:") }
+	var all []string
+	cursor := ""
+	for {
+		keys, next, err := ns.ScanFunc(cursor, 20, keep)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next != "" && len(keys) != 20 {
+			t.Fatalf("expected a full page before the end, got %d keys", len(keys))
+		}
+		all = append(all, keys...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(all) != 50 {
+		t.Fatalf("expected 50 user keys, got %d", len(all))
+	}
+	for _, k := range all {
+		if !keep(k) {
+			t.Fatalf("unexpected key %q", k)
+		}
+	}
+}
+
+func TestScanInvalidCursor(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	for _, cursor := range []string{"not base64!", encodeCursor(len(s.shards), "x"), "eA"} {
+		if _, _, err := s.Scan(cursor, 10); err != ErrInvalidCursor {
+			t.Errorf("Scan(%q): expected ErrInvalidCursor, got %v", cursor, err)
+		}
+	}
+}
+
+func TestListPage(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	for i := 0; i < 95; i++ {
+		s.Set(fmt.Sprintf("user:%03d", i), "v", 0)
+	}
+	s.Set("order:1", "v", 0)
+	s.Namespace("other").Set("user:hidden", "v", 0)
+
+	var all []string
+	cursor, pages := "", 0
+	for {
+		keys, next, err := s.ListPage(context.Background(), "user:", cursor, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) > 10 {
+			t.Fatalf("page of %d keys exceeds the limit", len(keys))
+		}
+		all = append(all, keys...)
+		pages++
+		if next == "" {
+			break
+		}
+		cursor = next
+		if pages == 3 {
+			// Changes ahead of the cursor are seen, changes behind it are not.
+			s.Delete("user:090")
+			s.Set("user:000a", "v", 0)
+			s.Set("user:050a", "v", 0)
+		}
+	}
+	if pages != 10 {
+		t.Errorf("expected 10 pages, got %d", pages)
+	}
+	if !slices.IsSorted(all) || len(slices.Compact(slices.Clone(all))) != len(all) {
+		t.Fatalf("expected sorted keys without repeats, got %v", all)
+	}
+	if len(all) != 95 || all[0] != "user:000" || !slices.Contains(all, "user:050a") || slices.Contains(all, "user:090") || slices.Contains(all, "user:000a") {
+		t.Fatalf("unexpected keys %v", all)
+	}
+
+	if keys, next, err := s.ListPage(context.Background(), "user:", "bogus!", 10); keys != nil || next != "" || err != nil {
+		t.Fatalf("expected an invalid cursor to return nothing, got %v %q", keys, next)
+	}
+	if _, _, err := s.Namespace("").ListPageFunc(context.Background(), encodeCursor(0, "user:010"), 10, nil); err != ErrInvalidCursor {
+		t.Fatalf("expected a Scan cursor to be rejected, got %v", err)
+	}
+}
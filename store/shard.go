@@ -0,0 +1,139 @@
+package store
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+	"time"
+)
+
+// defaultShards is the number of shards used unless WithShards says otherwise.
+const defaultShards = 32
+
+// shard is an independently locked slice of the keyspace. Every key lives in
+// exactly one shard, chosen by hashing the key.
+type shard struct {
+	mu   sync.RWMutex
+	data map[string]*entry
+
+	// expiries holds the deadline of every entry with a TTL, plus stale
+	// items for entries since changed, so the sweep only visits entries that
+	// are due instead of the whole shard. ttlCount is how many entries have
+	// a TTL.
+	expiries expiryHeap
+	ttlCount int
+
+	// plainCount is how many entries are in the default namespace, including
+	// expired ones not yet reclaimed.
+	plainCount int
+}
+
+func newShards(n int) []*shard {
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{data: make(map[string]*entry)}
+	}
+	return shards
+}
+
+// shardIndex returns the shard for key, using 32-bit FNV-1a.
+func (s *Store) shardIndex(key string) int {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return int(h % uint32(len(s.shards)))
+}
+
+func (s *Store) shardFor(key string) *shard {
+	return s.shards[s.shardIndex(key)]
+}
+
+// lockShards write-locks (or read-locks) the shards holding keys, in index
+// order so that concurrent multi-shard operations cannot deadlock. The
+// returned function releases them.
+func (s *Store) lockShards(keys []string, write bool) func() {
+	seen := make(map[int]bool, len(keys))
+	idx := make([]int, 0, len(keys))
+	for _, k := range keys {
+		i := s.shardIndex(k)
+		if !seen[i] {
+			seen[i] = true
+			idx = append(idx, i)
+		}
+	}
+	sort.Ints(idx)
+	for _, i := range idx {
+		if write {
+			s.shards[i].mu.Lock()
+		} else {
+			s.shards[i].mu.RLock()
+		}
+	}
+	return func() {
+		for _, i := range idx {
+			if write {
+				s.shards[i].mu.Unlock()
+			} else {
+				s.shards[i].mu.RUnlock()
+			}
+		}
+	}
+}
+
+// lockAll write-locks every shard in index order. The returned function
+// releases them.
+func (s *Store) lockAll() func() {
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+	}
+	return func() {
+		for _, sh := range s.shards {
+			sh.mu.Unlock()
+		}
+	}
+}
+
+// sweepShard expires every entry in sh past its deadline and returns how many
+// entries it expired. Only entries that are due are visited, so the cost does
+// not depend on how many keys the shard holds. Caller must hold sh.mu.
+func (s *Store) sweepShard(sh *shard, now time.Time) int {
+	n := 0
+	for sh.due(now) {
+		it := heap.Pop(&sh.expiries).(expiryItem)
+		if sh.current(it) && s.expire(sh, it.key) {
+			s.swept.Add(1)
+			n++
+		}
+	}
+	return n
+}
+
+// sweepDue sweeps each shard that may hold expired entries, one shard at a
+// time so writers to other shards are not blocked, and returns how many
+// entries it expired.
+func (s *Store) sweepDue() int {
+	s.sweeps.Add(1)
+	now := time.Now()
+	n := 0
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		n += s.sweepShard(sh, now)
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+// rlockAll read-locks every shard in index order. The returned function
+// releases them.
+func (s *Store) rlockAll() func() {
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+	}
+	return func() {
+		for _, sh := range s.shards {
+			sh.mu.RUnlock()
+		}
+	}
+}
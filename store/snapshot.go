@@ -0,0 +1,118 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Snapshot writes every live entry to w, one JSON record per line in the same
+// format as the WAL. Expiry times are stored as absolute timestamps, so keys
+// restored later keep their original deadline rather than a fresh TTL.
+//
+// Entries are copied while the store is read-locked, then encoded after the
+// locks are released, so writers are only blocked for the copy.
+func (s *Store) Snapshot(w io.Writer) error {
+	unlock := s.rlockAll()
+	recs := make([]walRecord, 0, s.count.Load())
+	for _, sh := range s.shards {
+		for k, e := range sh.data {
+			if !e.expired() {
+				recs = append(recs, recordFor(k, e))
+			}
+		}
+	}
+	unlock()
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, rec := range recs {
+		if err := enc.Encode(rec); err != nil {
+			return fmt.Errorf("snapshot: %w", err)
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("snapshot: %w", err)
+	}
+	return nil
+}
+
+// errTruncated is returned by Restore when the input ends part way through a
+// record.
+var errTruncated = errors.New("truncated snapshot")
+
+// Restore replaces the store's contents with a snapshot written by Snapshot.
+// Entries whose expiry has already passed are skipped. The snapshot is read
+// in full before anything changes, and the swap happens with every shard
+// locked, so readers see either the old contents or the new ones. Removed
+// keys are reported to subscribers as deletes. With a WAL the log is
+// rewritten to match.
+func (s *Store) Restore(r io.Reader) error {
+	return s.load(r, true)
+}
+
+// ReplayLog replaces the store's contents with the state produced by replaying
+// a log in WAL format from r, as Open does for WithWAL. Unlike Restore, a
+// final record with no trailing newline is taken to be a write torn by a crash
+// and is ignored, so a log cut off mid-write recovers everything before it.
+func (s *Store) ReplayLog(r io.Reader) error {
+	return s.load(r, false)
+}
+
+// load reads records from r and swaps them in as the store's contents. If
+// strict, a torn trailing record is an error rather than being skipped.
+func (s *Store) load(r io.Reader, strict bool) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	data := make(map[string]*entry)
+	cr := &countingReader{r: r}
+	_, good, err := replay(cr, data)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	if strict && good != cr.n {
+		return fmt.Errorf("restore: %w", errTruncated)
+	}
+	return s.replace(data, SourceSnapshot)
+}
+
+// replace swaps data in as the store's contents on behalf of source, with
+// every shard locked, and rewrites the WAL to match.
+func (s *Store) replace(data map[string]*entry, source string) error {
+	var err error
+	unlock := s.lockAll()
+	for _, sh := range s.shards {
+		for k := range sh.data {
+			if _, ok := data[k]; !ok {
+				s.remove(sh, k, EventDelete, source)
+			}
+		}
+	}
+	for k, e := range data {
+		s.put(s.shardFor(k), k, e, source)
+	}
+	if s.wal != nil {
+		s.walMu.Lock()
+		err = s.wal.compact(s.shards)
+		s.walMu.Unlock()
+	}
+	unlock()
+	if err != nil {
+		return err
+	}
+	return s.evict()
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
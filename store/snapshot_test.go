@@ -0,0 +1,116 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	src := New()
+	defer src.Stop()
+	src.Set("plain", "1", 0)
+	src.Set("ttl", "2", time.Hour)
+	src.Set("gone", "3", 10*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := New()
+	defer dst.Stop()
+	dst.Set("stale", "x", 0)
+	if err := dst.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := dst.Get("plain"); v != "1" {
+		t.Errorf("expected plain=1, got %q", v)
+	}
+	if _, ok := dst.Get("gone"); ok {
+		t.Error("expected expired key to be left out of the snapshot")
+	}
+	if _, ok := dst.Get("stale"); ok {
+		t.Error("expected Restore to replace existing contents")
+	}
+	srcTTL, _, _ := src.TTL("ttl")
+	dstTTL, hasTTL, _ := dst.TTL("ttl")
+	if !hasTTL || dstTTL > srcTTL || srcTTL-dstTTL > time.Second {
+		t.Errorf("expected TTL to survive the round trip, src %v dst %v", srcTTL, dstTTL)
+	}
+}
+
+func TestRestoreTruncated(t *testing.T) {
+	src := New()
+	defer src.Stop()
+	src.Set("a", "1", 0)
+	src.Set("b", "2", 0)
+	var buf bytes.Buffer
+	src.Snapshot(&buf)
+
+	dst := New()
+	defer dst.Stop()
+	dst.Set("keep", "v", 0)
+	err := dst.Restore(bytes.NewReader(buf.Bytes()[:buf.Len()-3]))
+	if !errors.Is(err, errTruncated) {
+		t.Fatalf("expected truncated snapshot error, got %v", err)
+	}
+	if _, ok := dst.Get("keep"); !ok {
+		t.Fatal("a failed Restore should leave the store untouched")
+	}
+}
+
+func TestRestoreRewritesWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stashr.wal")
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("old", "x", 0)
+
+	snap := New()
+	snap.Set("new", "y", 0)
+	var buf bytes.Buffer
+	snap.Snapshot(&buf)
+	snap.Stop()
+
+	if err := s.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s.Stop()
+
+	s, err = Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	if _, ok := s.Get("old"); ok {
+		t.Error("expected old to stay gone after replay")
+	}
+	if v, _ := s.Get("new"); v != "y" {
+		t.Errorf("expected new=y after replay, got %q", v)
+	}
+}
+
+func TestSnapshotBinaryValues(t *testing.T) {
+	src := New()
+	defer src.Stop()
+	src.SetBytes("blob", binaryValue, 0)
+
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dst := New()
+	defer dst.Stop()
+	if err := dst.Restore(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := dst.GetBytes("blob"); string(got) != string(binaryValue) {
+		t.Fatalf("expected %q after restore, got %q", binaryValue, got)
+	}
+}
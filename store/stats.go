@@ -0,0 +1,58 @@
+package store
+
+import "time"
+
+// Stats is a point-in-time snapshot of store counters.
+type Stats struct {
+	Keys        int    // entries held, including expired ones not yet reclaimed
+	LiveKeys    int    // those entries that have not expired
+	KeysWithTTL int    // those entries that have an expiry
+	Bytes       int64  // approximate memory footprint of those entries
+	Evictions   uint64 // entries removed to stay within MaxKeys or MaxBytes
+	Expirations uint64 // entries removed because their TTL elapsed, or by ExpireNow
+
+	// ExpiredBySweep and ExpiredOnAccess break down Expirations by how the
+	// expired entry was found: by the background sweep, or lazily when a
+	// read or TTL change touched it. ExpireNow counts towards neither.
+	ExpiredBySweep  uint64
+	ExpiredOnAccess uint64
+	Sweeps          uint64 // expiry sweeps run: background, SweepNow or before an eviction
+
+	Hits    uint64 // Get lookups that found a live key
+	Misses  uint64 // Get lookups of missing or expired keys
+	Sets    uint64 // keys written by Set, SetNX, GetSet, MSet and Append
+	Deletes uint64 // Delete calls
+
+	Uptime time.Duration // time since the store was opened
+}
+
+// Stats returns the store's current counters. Evictions and expirations are
+// counted separately, so a cache that is too small can be told apart from one
+// whose keys simply time out. Every counter is an atomic, so reading them
+// takes no locks; only LiveKeys briefly read-locks each shard, as Count does.
+func (s *Store) Stats() Stats {
+	return Stats{
+		Keys:            s.Len(),
+		LiveKeys:        s.liveKeys(),
+		KeysWithTTL:     int(s.ttlKeys.Load()),
+		Bytes:           s.bytes.Load(),
+		Evictions:       s.evictions.Load(),
+		Expirations:     s.expirations.Load(),
+		ExpiredBySweep:  s.swept.Load(),
+		ExpiredOnAccess: s.lazyExpired.Load(),
+		Sweeps:          s.sweeps.Load(),
+		Hits:            s.hits.Load(),
+		Misses:          s.misses.Load(),
+		Sets:            s.sets.Load(),
+		Deletes:         s.deletes.Load(),
+		Uptime:          time.Since(s.started),
+	}
+}
+
+// Mutations returns the number of changes applied to the store since it was
+// created, including expiries and evictions. It only ever increases, so
+// comparing two readings tells whether anything changed in between, e.g. to
+// skip writing a snapshot of an idle store.
+func (s *Store) Mutations() uint64 {
+	return s.mutations.Load()
+}
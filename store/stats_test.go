@@ -0,0 +1,91 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStatsUptime(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	time.Sleep(10 * time.Millisecond)
+	if up := s.Stats().Uptime; up < 10*time.Millisecond {
+		t.Fatalf("expected uptime of at least 10ms, got %v", up)
+	}
+}
+
+func TestStatsKeysWithTTL(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("a", "1", time.Hour)
+	s.Set("b", "2", time.Hour)
+	s.Set("c", "3", 0)
+	if n := s.Stats().KeysWithTTL; n != 2 {
+		t.Fatalf("expected 2 keys with TTL, got %d", n)
+	}
+
+	s.Persist("a")
+	s.Expire("c", time.Hour)
+	s.Set("b", "4", 0) // overwrite drops the TTL
+	if n := s.Stats().KeysWithTTL; n != 1 {
+		t.Fatalf("expected 1 key with TTL after persist, expire and overwrite, got %d", n)
+	}
+
+	s.Delete("c")
+	if n := s.Stats().KeysWithTTL; n != 0 {
+		t.Fatalf("expected 0 keys with TTL after delete, got %d", n)
+	}
+}
+
+func TestStatsSweepVersusLazyExpiry(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("lazy", "1", 10*time.Millisecond)
+	s.Set("swept", "2", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	s.Get("lazy")
+	s.sweepDue()
+
+	st := s.Stats()
+	if st.ExpiredOnAccess != 1 {
+		t.Errorf("expected 1 lazy expiration, got %d", st.ExpiredOnAccess)
+	}
+	if st.ExpiredBySweep != 1 {
+		t.Errorf("expected 1 swept expiration, got %d", st.ExpiredBySweep)
+	}
+	if st.Expirations != 2 || st.KeysWithTTL != 0 {
+		t.Errorf("expected 2 expirations and no keys with TTL, got %+v", st)
+	}
+
+	s.Set("now", "3", time.Hour)
+	s.ExpireNow("now")
+	st = s.Stats()
+	if st.Expirations != 3 || st.ExpiredBySweep+st.ExpiredOnAccess != 2 {
+		t.Errorf("expected ExpireNow to count only as an expiration, got %+v", st)
+	}
+}
+
+func TestStatsSweeps(t *testing.T) {
+	s := New(WithGCInterval(0))
+	defer s.Stop()
+
+	s.SweepNow()
+	s.SweepNow()
+	if n := s.Stats().Sweeps; n != 2 {
+		t.Fatalf("expected 2 sweeps, got %d", n)
+	}
+	if n := s.Namespace("app").Stats().Sweeps; n != 0 {
+		t.Fatalf("expected sweeps to be counted only store-wide, got %d", n)
+	}
+	if _, err := s.Flush(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Stats().Sweeps; n != 0 {
+		t.Fatalf("expected resetting stats to zero sweeps, got %d", n)
+	}
+}
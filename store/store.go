@@ -1,121 +1,1167 @@
 package store
 
 import (
+	"container/list"
+	"errors"
+	"math/rand/v2"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// Default size limits, used unless overridden with WithMaxKeyBytes and
+// WithMaxValueBytes.
+const (
+	defaultMaxKeyBytes   = 1 << 10
+	defaultMaxValueBytes = 1 << 20
+)
+
+// defaultGCInterval is how often expired keys are swept unless overridden with
+// WithGCInterval.
+const defaultGCInterval = time.Second
+
+var (
+	// ErrKeyTooLarge is returned when a write uses a key longer than the
+	// configured maximum.
+	ErrKeyTooLarge = errors.New("key too large")
+	// ErrValueTooLarge is returned when a write would produce a value larger
+	// than the configured maximum.
+	ErrValueTooLarge = errors.New("value too large")
+	// ErrStoreClosed is returned by writes to a store that has been stopped.
+	ErrStoreClosed = errors.New("store closed")
+
+	// ErrReadOnly is returned by writes while the store is read-only; see
+	// SetReadOnly.
+	ErrReadOnly = errors.New("store is read-only")
+)
+
+// entryOverhead approximates the bytes an entry costs beyond its key and
+// value: the entry struct, its map slot and its LRU element. elemOverhead is
+// the extra cost of each list element or hash field.
+const (
+	entryOverhead = 96
+	elemOverhead  = 16
+)
+
+// entrySize is the approximate memory footprint of storing value under key.
+func entrySize(key, value string) int64 {
+	return int64(len(key) + len(value) + entryOverhead)
+}
+
 type entry struct {
-	value     string
-	expiresAt time.Time // zero value means no expiry
+	kind      kind              // which of value, list and hash holds the data
+	value     string            // for kindString
+	list      []string          // for kindList; shared between entries, never modified
+	hash      map[string]string // for kindHash; shared between entries, never modified
+	expiresAt time.Time         // zero value means no expiry
+	period    time.Duration     // the TTL expiresAt was last set from, for Refresh
+	sliding   bool              // reads push expiresAt back to period from now
+	version   uint64            // from Store.versions, bumped by every write of the value
+	createdAt time.Time         // first write of the key since it was last missing
+	updatedAt time.Time         // last write of the value
+	tags      map[string]string // shared between entries, never modified; see tags.go
+	elem      *list.Element     // position in the LRU list, if enabled
+}
+
+// payload returns the bytes of data e holds: the length of its value, or the
+// total length of its list elements or hash fields and values.
+func (e *entry) payload() int {
+	n := len(e.value)
+	for _, v := range e.list {
+		n += len(v)
+	}
+	for f, v := range e.hash {
+		n += len(f) + len(v)
+	}
+	return n
+}
+
+// size is the approximate memory footprint of e stored under key.
+func (e *entry) size(key string) int64 {
+	return entrySize(key, "") + int64(e.payload()+elemOverhead*(len(e.list)+len(e.hash)))
+}
+
+// copyData makes e hold the same data as from, of whatever kind.
+func (e *entry) copyData(from *entry) {
+	e.kind, e.value, e.list, e.hash = from.kind, from.value, from.list, from.hash
 }
 
 func (e *entry) expired() bool {
-	return !e.expiresAt.IsZero() && time.Now().After(e.expiresAt)
+	return e.expiredAt(time.Now())
+}
+
+// expiredAt is expired as of now, for loops over many entries that would
+// otherwise read the clock for each.
+func (e *entry) expiredAt(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// ttl returns the time left before e expires, or zero if it has no expiry.
+func (e *entry) ttl() time.Duration {
+	if e.expiresAt.IsZero() {
+		return 0
+	}
+	return time.Until(e.expiresAt)
+}
+
+// deadline returns the expiry for an entry written at now with ttl: none if
+// ttl <= 0, otherwise ttl from now, scaled by the store's TTL jitter fraction
+// and plus a random extra of up to its expiry jitter, but never beyond its
+// maximum TTL.
+func (s *Store) deadline(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	if s.jitterFrac > 0 {
+		ttl = max(time.Duration(float64(ttl)*(1+s.jitterFrac*(2*rand.Float64()-1))), 1)
+	}
+	if s.jitter > 0 {
+		ttl += rand.N(s.jitter)
+	}
+	if s.maxTTL > 0 {
+		ttl = min(ttl, s.maxTTL)
+	}
+	return now.Add(ttl)
+}
+
+// EffectiveTTL returns the TTL a write asking for ttl actually gets, zero
+// meaning no expiry: the default TTL if ttl <= 0, capped at the maximum TTL.
+// See WithDefaultTTL and WithMaxTTL. Expiry jitter comes on top.
+func (s *Store) EffectiveTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		ttl = s.defaultTTL
+	}
+	if s.maxTTL > 0 && (ttl <= 0 || ttl > s.maxTTL) {
+		ttl = s.maxTTL
+	}
+	return ttl
+}
+
+// newEntry returns an entry holding value that expires the effective TTL for
+// ttl after now, or never if that is zero.
+func (s *Store) newEntry(value string, now time.Time, ttl time.Duration) *entry {
+	ttl = s.EffectiveTTL(ttl)
+	e := &entry{value: value, expiresAt: s.deadline(now, ttl), createdAt: now, updatedAt: now}
+	if ttl > 0 {
+		e.period = ttl
+	}
+	return e
 }
 
 // Store is a thread-safe in-memory key/value store with optional TTL support.
+//
+// The keyspace is split into shards, each with its own lock, so operations on
+// different keys rarely contend. Lock order is: shards in index order, then
+// lruMu, then walMu, then subs.mu, callbacks.mu, history.mu or tags.mu.
 type Store struct {
-	mu      sync.RWMutex
-	data    map[string]*entry
-	stopGC  chan struct{}
+	shards   []*shard
+	count    atomic.Int64 // entries across all shards, including unswept expired ones
+	ttlKeys  atomic.Int64 // those entries that have an expiry
+	bytes    atomic.Int64 // sum of entrySize over those entries
+	stopGC   chan struct{}
+	stop     sync.Once
+	closed   atomic.Bool
+	readOnly atomic.Bool
+	leader   atomic.Pointer[string] // see SetLeader
+	started  time.Time
+
+	gcInterval    time.Duration
+	gcMinInterval time.Duration // adaptive GC bounds; zero when disabled
+	gcMaxInterval time.Duration
+
+	maxEntries int
+	maxBytes   int64
+	policy     Policy
+	jitter     time.Duration
+	jitterFrac float64
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+	lru        *list.List
+	lruMu      sync.Mutex
+
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+	swept       atomic.Uint64 // expirations found by the background sweep
+	sweeps      atomic.Uint64 // sweeps run, whether or not they expired anything
+	lazyExpired atomic.Uint64 // expirations found on access
+	mutations   atomic.Uint64
+	versions    atomic.Uint64 // last version given to an entry
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	sets        atomic.Uint64
+	deletes     atomic.Uint64
+
+	subs       subscribers
+	callbacks  expiryCallbacks
+	history    history
+	tags       tagIndex
+	namespaces sync.Map // namespace name -> *nsCounters
+	loads      loads
+
+	maxKeyBytes   int
+	maxValueBytes int
+	walPath       string
+	walCompact    int
+	walFsync      FsyncPolicy
+	walFsyncEvery time.Duration
+	wal           *wal
+	walMu         sync.Mutex
 }
 
 // New creates a new Store and starts a background goroutine that periodically
 // sweeps expired keys. Call Stop to release resources.
-func New() *Store {
-	s := &Store{
-		data:   make(map[string]*entry),
-		stopGC: make(chan struct{}),
+//
+// New panics if an option fails to initialize; use Open for options that touch
+// the filesystem, such as WithWAL.
+func New(opts ...Option) *Store {
+	s, err := Open(opts...)
+	if err != nil {
+		panic(err)
 	}
-	go s.gcLoop()
 	return s
 }
 
+// Open is like New but returns an error if an option fails to initialize. When
+// a WAL is configured the log is replayed before Open returns.
+func Open(opts ...Option) (*Store, error) {
+	s := &Store{
+		stopGC:        make(chan struct{}),
+		started:       time.Now(),
+		gcInterval:    defaultGCInterval,
+		maxKeyBytes:   defaultMaxKeyBytes,
+		maxValueBytes: defaultMaxValueBytes,
+		walCompact:    defaultWALCompactEvery,
+	}
+	s.shards = newShards(defaultShards)
+	for _, opt := range opts {
+		opt(s)
+	}
+	if (s.maxEntries > 0 || s.maxBytes > 0) && s.policy == EvictLRU {
+		s.lru = list.New()
+	}
+	if s.walPath != "" {
+		replayed := make(map[string]*entry)
+		w, err := openWAL(s.walPath, s.walCompact, s.walFsync, replayed)
+		if err != nil {
+			return nil, err
+		}
+		s.wal = w
+		for k, e := range replayed {
+			s.put(s.shardFor(k), k, e, SourceWAL)
+		}
+		if err := s.evict(); err != nil {
+			w.close()
+			return nil, err
+		}
+		if s.walFsync == FsyncInterval && s.walFsyncEvery > 0 {
+			go s.syncLoop(s.walFsyncEvery)
+		}
+	}
+	if s.gcInterval > 0 {
+		go s.gcLoop()
+	}
+	return s, nil
+}
+
 func (s *Store) gcLoop() {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+	interval := s.gcInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
 	for {
 		select {
-		case <-ticker.C:
-			s.sweep()
+		case <-timer.C:
+			withTTL := s.ttlKeys.Load()
+			interval = s.nextGCInterval(interval, s.sweepDue(), withTTL)
+			timer.Reset(interval)
 		case <-s.stopGC:
 			return
 		}
 	}
 }
 
-func (s *Store) sweep() {
-	now := time.Now()
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	for k, e := range s.data {
-		if !e.expiresAt.IsZero() && now.After(e.expiresAt) {
-			delete(s.data, k)
+// nextGCInterval picks the delay before the next background sweep, given the
+// current one and how many of the withTTL keys the last sweep expired. With
+// adaptive GC the interval doubles after a sweep that found nothing and halves
+// after one that expired at least a quarter of the keys with a TTL, within the
+// configured bounds. Otherwise it never changes.
+func (s *Store) nextGCInterval(cur time.Duration, expired int, withTTL int64) time.Duration {
+	if s.gcMinInterval <= 0 || s.gcMaxInterval <= 0 {
+		return cur
+	}
+	switch {
+	case expired == 0:
+		cur *= 2
+	case int64(expired)*4 >= withTTL:
+		cur /= 2
+	}
+	return min(max(cur, s.gcMinInterval), s.gcMaxInterval)
+}
+
+// SweepNow removes expired keys now, as the background sweep does, and returns
+// how many it removed. With the background sweep disabled it is the only way
+// besides lazy expiry on access to reclaim expired keys; expired keys are never
+// visible to reads either way.
+func (s *Store) SweepNow() int {
+	return s.sweepDue()
+}
+
+// put installs e under key in sh, replacing any existing entry, on behalf of
+// source. Every write goes through here so that secondary structures stay in
+// sync. Every write gets a new version, and overwriting a live key keeps its
+// creation time. Caller must hold sh.mu.
+func (s *Store) put(sh *shard, key string, e *entry, source string) {
+	old, exists := sh.data[key]
+	sh.data[key] = e
+	e.version = s.versions.Add(1)
+	if e.updatedAt.IsZero() {
+		e.updatedAt = time.Now()
+	}
+	switch {
+	case exists && !old.expired():
+		e.createdAt = old.createdAt
+	case e.createdAt.IsZero():
+		e.createdAt = e.updatedAt
+	}
+	size := e.size(key)
+	if exists {
+		size -= old.size(key)
+		if !old.expiresAt.IsZero() {
+			s.ttlKeys.Add(-1)
+			sh.ttlCount--
+		}
+	} else {
+		s.count.Add(1)
+		if !namespaced(key) {
+			sh.plainCount++
+		}
+	}
+	if !e.expiresAt.IsZero() {
+		s.ttlKeys.Add(1)
+		sh.ttlCount++
+	}
+	s.bytes.Add(size)
+	s.mutations.Add(1)
+	if s.lru != nil {
+		s.lruMu.Lock()
+		if exists {
+			s.lru.Remove(old.elem)
 		}
+		e.elem = s.lru.PushFront(key)
+		s.lruMu.Unlock()
 	}
+	if exists {
+		s.tags.drop(key, old.tags)
+	}
+	s.tags.add(key, e.tags)
+	sh.trackExpiry(key, e)
+	s.emit(EventSet, key, e)
+	s.record(EventSet, key, e, source)
+}
+
+// remove deletes key from sh along with its secondary bookkeeping, notifying
+// subscribers with an event of type why and recording source in the history.
+// It reports whether the key was present. Caller must hold sh.mu.
+func (s *Store) remove(sh *shard, key string, why EventType, source string) bool {
+	e, ok := sh.data[key]
+	if !ok {
+		return false
+	}
+	delete(sh.data, key)
+	s.count.Add(-1)
+	if !namespaced(key) {
+		sh.plainCount--
+	}
+	if !e.expiresAt.IsZero() {
+		s.ttlKeys.Add(-1)
+		sh.ttlCount--
+	}
+	s.bytes.Add(-e.size(key))
+	s.mutations.Add(1)
+	if e.elem != nil {
+		s.lruMu.Lock()
+		s.lru.Remove(e.elem)
+		s.lruMu.Unlock()
+	}
+	s.tags.drop(key, e.tags)
+	s.emit(why, key, nil)
+	s.record(why, key, nil, source)
+	s.fireExpiry(key, e.value, why)
+	return true
+}
+
+// retime changes e's expiry in place on behalf of source. Caller must hold
+// sh.mu.
+func (s *Store) retime(sh *shard, key string, e *entry, at time.Time, period time.Duration, source string) {
+	switch {
+	case e.expiresAt.IsZero() && !at.IsZero():
+		s.ttlKeys.Add(1)
+		sh.ttlCount++
+	case !e.expiresAt.IsZero() && at.IsZero():
+		s.ttlKeys.Add(-1)
+		sh.ttlCount--
+	}
+	moved := !e.expiresAt.Equal(at)
+	e.expiresAt, e.period = at, period
+	s.mutations.Add(1)
+	if moved {
+		// An unchanged deadline already has its item, and a second would
+		// be counted twice by expiredCounts.
+		sh.trackExpiry(key, e)
+	}
+	s.emit(EventSet, key, e)
+	s.record(EventSet, key, e, source)
+}
+
+// expire removes a key whose TTL has elapsed. All expiry paths (the sweep, lazy
+// deletion on access, and ExpireNow) go through here. It reports whether the
+// key was present. Caller must hold sh.mu.
+func (s *Store) expire(sh *shard, key string) bool {
+	if !s.remove(sh, key, EventExpire, "") {
+		return false
+	}
+	s.expirations.Add(1)
+	return true
 }
 
-// Stop halts the background GC goroutine.
+// checkSize validates a write of value under key against the configured key
+// and value limits, and against the byte budget, which the entry could never
+// fit within if it alone exceeds it.
+func (s *Store) checkSize(key, value string) error {
+	return s.checkLimits(key, len(value), entrySize(key, value))
+}
+
+// checkEntry is checkSize for an entry of any kind. The value limit applies
+// to a list or hash as a whole.
+func (s *Store) checkEntry(key string, e *entry) error {
+	return s.checkLimits(key, e.payload(), e.size(key))
+}
+
+func (s *Store) checkLimits(key string, payload int, size int64) error {
+	if s.maxKeyBytes > 0 && len(key)-nsPrefixLen(key) > s.maxKeyBytes {
+		return ErrKeyTooLarge
+	}
+	if s.maxValueBytes > 0 && payload > s.maxValueBytes {
+		return ErrValueTooLarge
+	}
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return ErrValueTooLarge
+	}
+	return nil
+}
+
+// settle runs the housekeeping that must happen after a write but outside any
+// shard lock: evicting down to the entry limit and compacting the WAL.
+func (s *Store) settle() error {
+	if err := s.evict(); err != nil {
+		return err
+	}
+	return s.maybeCompact()
+}
+
+// Stop halts the background goroutines, disconnects subscribers, and flushes
+// and closes the WAL, if any. Calling it again does nothing.
+//
+// Every write to a stopped store fails with ErrStoreClosed, so an application
+// tearing down cannot keep writing data that would never be logged or swept.
+// Reads keep serving what the store held when it stopped, so it can still be
+// inspected or snapshotted.
 func (s *Store) Stop() {
-	close(s.stopGC)
+	s.stop.Do(func() {
+		s.closed.Store(true)
+		close(s.stopGC)
+		s.closeSubscribers()
+		if s.wal != nil {
+			s.walMu.Lock()
+			s.wal.close()
+			s.walMu.Unlock()
+		}
+	})
+}
+
+// SetReadOnly switches the store in or out of read-only mode, for example
+// during maintenance. While read-only, every write, including Flush, Restore
+// and Transaction, fails with ErrReadOnly, while reads carry on as usual.
+// Expired keys are still removed, by the sweep or on access, since they are
+// already invisible to readers, but reads no longer extend sliding expiries.
+func (s *Store) SetReadOnly(readOnly bool) {
+	s.readOnly.Store(readOnly)
+}
+
+// ReadOnly reports whether the store is in read-only mode.
+func (s *Store) ReadOnly() bool {
+	return s.readOnly.Load()
+}
+
+// checkWritable returns ErrStoreClosed once the store has been stopped, a
+// *FollowerError while it follows a leader, and ErrReadOnly while it is
+// read-only. Every write checks it before doing anything else.
+func (s *Store) checkWritable() error {
+	if s.closed.Load() {
+		return ErrStoreClosed
+	}
+	if leader := s.Leader(); leader != "" {
+		return &FollowerError{Leader: leader}
+	}
+	if s.readOnly.Load() {
+		return ErrReadOnly
+	}
+	return nil
 }
 
 // Get retrieves a value by key. Returns the value and whether the key was found.
-// Lazily deletes expired keys on access.
+// Lazily deletes expired keys on access. A key holding a list or hash is not
+// a string and is reported as not found, here and by every other string read.
 func (s *Store) Get(key string) (string, bool) {
-	s.mu.RLock()
-	e, ok := s.data[key]
+	val, _, ok := s.GetWithTTL(key)
+	return val, ok
+}
+
+// GetBytes is like Get but returns the value as a byte slice, for binary
+// values. The slice is a copy the caller may modify.
+func (s *Store) GetBytes(key string) ([]byte, bool) {
+	val, ok := s.Get(key)
 	if !ok {
-		s.mu.RUnlock()
-		return "", false
+		return nil, false
+	}
+	return []byte(val), true
+}
+
+// GetWithTTL is like Get but also returns the key's remaining time-to-live,
+// which is zero if the key has no expiry.
+func (s *Store) GetWithTTL(key string) (string, time.Duration, bool) {
+	val, info, ok := s.GetWithInfo(key)
+	return val, info.TTL, ok
+}
+
+// GetWithInfo is like Get but also describes the entry as Info does, including
+// its version, as of the same read.
+func (s *Store) GetWithInfo(key string) (string, EntryInfo, bool) {
+	if checkKey(key) != nil {
+		s.misses.Add(1)
+		return "", EntryInfo{}, false
+	}
+	return s.getWithInfo(key)
+}
+
+// getWithInfo is GetWithInfo for an internal key.
+func (s *Store) getWithInfo(key string) (string, EntryInfo, bool) {
+	var val string
+	var info EntryInfo
+	var slid *entry
+	found := false
+	s.lookup(key, func(e *entry) {
+		if e.kind != kindString {
+			return
+		}
+		s.touch(e)
+		val, info, found = e.value, infoFor(key, e, time.Now()), true
+		if e.sliding {
+			slid = e
+		}
+	})
+	if !found {
+		s.misses.Add(1)
+		return "", EntryInfo{}, false
+	}
+	s.hits.Add(1)
+	if slid != nil {
+		if d, ok := s.slide(key, slid); ok {
+			info.TTL = d
+		}
+	}
+	return val, info, true
+}
+
+// slide pushes the expiry of the sliding entry e, just read under key, back
+// to its TTL from now and returns the new TTL. Reads only hold the read lock,
+// so this takes the write lock and leaves e alone unless it is still key's
+// live entry. A read cannot report a failure to log the new expiry; the key
+// then just keeps its previously logged expiry across a restart.
+func (s *Store) slide(key string, e *entry) (time.Duration, bool) {
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	if cur, ok := sh.data[key]; !ok || cur != e || e.expired() || e.period <= 0 || s.checkWritable() != nil {
+		sh.mu.Unlock()
+		return 0, false
+	}
+	ne := &entry{expiresAt: s.deadline(time.Now(), e.period), period: e.period, sliding: true, createdAt: e.createdAt, updatedAt: e.updatedAt, tags: e.tags}
+	ne.copyData(e)
+	if err := s.logSet(key, ne); err != nil {
+		sh.mu.Unlock()
+		return 0, false
+	}
+	s.retime(sh, key, e, ne.expiresAt, ne.period, "")
+	ttl := e.ttl()
+	sh.mu.Unlock()
+	s.maybeCompact()
+	return ttl, true
+}
+
+// Exists reports whether key holds a live value, without reading or copying
+// the value. Like Get it lazily deletes the key if it has expired, but it is
+// not counted as a hit or miss and does not mark the key as recently used.
+func (s *Store) Exists(key string) bool {
+	return checkKey(key) == nil && s.exists(key)
+}
+
+func (s *Store) exists(key string) bool {
+	return s.lookup(key, func(*entry) {})
+}
+
+// lookup calls fn with key's entry, under the shard's read lock, if the key is
+// live, and reports whether it was. Every read goes through here so that
+// expiry is handled the same way everywhere: an entry past its deadline is
+// deleted on access rather than returned.
+func (s *Store) lookup(key string, fn func(e *entry)) bool {
+	sh := s.shardFor(key)
+	sh.mu.RLock()
+	e, ok := sh.data[key]
+	if !ok {
+		sh.mu.RUnlock()
+		return false
 	}
 	if e.expired() {
-		s.mu.RUnlock()
-		// Upgrade to write lock to delete
-		s.mu.Lock()
-		delete(s.data, key)
-		s.mu.Unlock()
-		return "", false
+		sh.mu.RUnlock()
+		// Upgrade to write lock to delete. Another writer may have replaced
+		// the entry in between, so only delete it if it is still the one we
+		// saw expire.
+		sh.mu.Lock()
+		if cur, ok := sh.data[key]; ok && cur == e && s.expire(sh, key) {
+			s.lazyExpired.Add(1)
+		}
+		sh.mu.Unlock()
+		return false
 	}
-	val := e.value
-	s.mu.RUnlock()
-	return val, true
+	fn(e)
+	sh.mu.RUnlock()
+	return true
+}
+
+// TTL reports the remaining time-to-live of key. hasTTL is false for keys with
+// no expiry; exists is false for missing and expired keys.
+func (s *Store) TTL(key string) (remaining time.Duration, hasTTL bool, exists bool) {
+	if checkKey(key) != nil {
+		return 0, false, false
+	}
+	return s.ttl(key)
+}
+
+func (s *Store) ttl(key string) (remaining time.Duration, hasTTL bool, exists bool) {
+	exists = s.lookup(key, func(e *entry) {
+		remaining, hasTTL = e.ttl(), !e.expiresAt.IsZero()
+	})
+	return remaining, hasTTL, exists
 }
 
 // Set stores a key/value pair. If ttl > 0 the key will expire after that duration.
-func (s *Store) Set(key, value string, ttl time.Duration) {
-	e := &entry{value: value}
-	if ttl > 0 {
-		e.expiresAt = time.Now().Add(ttl)
+// Returns ErrKeyTooLarge or ErrValueTooLarge if the write exceeds the store's
+// size limits, ErrReservedKey if key starts with NUL, or an error if it could
+// not be logged to the WAL.
+func (s *Store) Set(key, value string, ttl time.Duration) error {
+	if err := checkKey(key); err != nil {
+		return err
 	}
-	s.mu.Lock()
-	s.data[key] = e
-	s.mu.Unlock()
+	_, err := s.set("", key, value, ttl, false, nil)
+	return err
 }
 
-// Delete removes a key. Returns true if the key existed (and was not expired).
-func (s *Store) Delete(key string) bool {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	e, ok := s.data[key]
+// SetSliding is like Set, but every successful Get of the key pushes its
+// expiry back to ttl from the read, so it expires after ttl of inactivity
+// rather than ttl after the write. This suits sessions. TTL, Exists and List
+// do not count as reads. A ttl <= 0 is a plain Set with no expiry.
+func (s *Store) SetSliding(key, value string, ttl time.Duration) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	_, err := s.set("", key, value, ttl, ttl > 0, nil)
+	return err
+}
+
+// set writes key and reports whether it created it, that is whether the key
+// was missing or expired beforehand.
+func (s *Store) set(source, key, value string, ttl time.Duration, sliding bool, tags map[string]string) (bool, error) {
+	if err := s.checkWritable(); err != nil {
+		return false, err
+	}
+	if err := s.checkSize(key, value); err != nil {
+		return false, err
+	}
+	e := s.newEntry(value, time.Now(), ttl)
+	e.sliding = sliding
+	e.tags = cloneTags(tags)
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	if err := s.logSet(key, e); err != nil {
+		sh.mu.Unlock()
+		return false, err
+	}
+	old, exists := sh.data[key]
+	created := !exists || old.expired()
+	s.put(sh, key, e, source)
+	s.sets.Add(1)
+	sh.mu.Unlock()
+	return created, s.settle()
+}
+
+// SetBytes is like Set but takes the value as a byte slice, for binary
+// values. Values may hold any bytes, including NUL and invalid UTF-8. The
+// slice is copied, so the caller may reuse it once SetBytes returns.
+func (s *Store) SetBytes(key string, value []byte, ttl time.Duration) error {
+	return s.Set(key, string(value), ttl)
+}
+
+// GetSet atomically replaces the value of key and returns the previous one.
+// existed is false if the key was missing or expired. The new entry's TTL
+// follows the same rules as Set. Returns ErrWrongType, and leaves the key
+// alone, if it holds a list or hash.
+func (s *Store) GetSet(key, value string, ttl time.Duration) (old string, existed bool, err error) {
+	if err := checkKey(key); err != nil {
+		return "", false, err
+	}
+	return s.getSet("", key, value, ttl)
+}
+
+func (s *Store) getSet(source, key, value string, ttl time.Duration) (old string, existed bool, err error) {
+	if err := s.checkWritable(); err != nil {
+		return "", false, err
+	}
+	if err := s.checkSize(key, value); err != nil {
+		return "", false, err
+	}
+	e := s.newEntry(value, time.Now(), ttl)
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	if prev, ok := sh.data[key]; ok && !prev.expired() {
+		if prev.kind != kindString {
+			sh.mu.Unlock()
+			return "", false, ErrWrongType
+		}
+		old, existed = prev.value, true
+	}
+	if err := s.logSet(key, e); err != nil {
+		sh.mu.Unlock()
+		return "", false, err
+	}
+	s.put(sh, key, e, source)
+	s.sets.Add(1)
+	sh.mu.Unlock()
+	return old, existed, s.settle()
+}
+
+// SetNX stores key only if it is missing or expired, returning whether it was
+// written. A live key is left untouched. The TTL follows the same rules as
+// Set.
+func (s *Store) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	return s.setNX("", key, value, ttl)
+}
+
+func (s *Store) setNX(source, key, value string, ttl time.Duration) (bool, error) {
+	_, written, err := s.setIfAbsent(source, key, value, ttl)
+	if errors.Is(err, ErrWrongType) {
+		return false, nil
+	}
+	return written, err
+}
+
+// setIfAbsent stores value under key if the key is missing or expired. It
+// returns the value key holds afterwards, which is the live one it found if
+// it did not write, or ErrWrongType if that is a list or hash.
+func (s *Store) setIfAbsent(source, key, value string, ttl time.Duration) (current string, written bool, err error) {
+	if err := s.checkWritable(); err != nil {
+		return "", false, err
+	}
+	if err := s.checkSize(key, value); err != nil {
+		return "", false, err
+	}
+	e := s.newEntry(value, time.Now(), ttl)
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	if prev, ok := sh.data[key]; ok && !prev.expired() {
+		sh.mu.Unlock()
+		if prev.kind != kindString {
+			return "", false, ErrWrongType
+		}
+		return prev.value, false, nil
+	}
+	if err := s.logSet(key, e); err != nil {
+		sh.mu.Unlock()
+		return "", false, err
+	}
+	s.put(sh, key, e, source)
+	s.sets.Add(1)
+	sh.mu.Unlock()
+	return value, true, s.settle()
+}
+
+// CompareAndSwap stores value under key only if the key currently holds old,
+// returning whether it was written. A missing or expired key never matches,
+// not even an empty old, so CompareAndSwap cannot create keys; use SetNX for
+// that. The TTL follows the same rules as Set. Returns ErrWrongType if the key
+// holds a list or hash.
+func (s *Store) CompareAndSwap(key, old, value string, ttl time.Duration) (bool, error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	return s.compareAndSwap("", key, old, value, ttl)
+}
+
+func (s *Store) compareAndSwap(source, key, old, value string, ttl time.Duration) (bool, error) {
+	if err := s.checkWritable(); err != nil {
+		return false, err
+	}
+	if err := s.checkSize(key, value); err != nil {
+		return false, err
+	}
+	e := s.newEntry(value, time.Now(), ttl)
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	prev, ok := sh.data[key]
+	if ok && !prev.expired() && prev.kind != kindString {
+		sh.mu.Unlock()
+		return false, ErrWrongType
+	}
+	if !ok || prev.expired() || prev.value != old {
+		sh.mu.Unlock()
+		return false, nil
+	}
+	if err := s.logSet(key, e); err != nil {
+		sh.mu.Unlock()
+		return false, err
+	}
+	s.put(sh, key, e, source)
+	s.sets.Add(1)
+	sh.mu.Unlock()
+	return true, s.settle()
+}
+
+// SetIfVersion stores value under key only if the key's current version is
+// expectedVersion, returning whether it was written and the key's version
+// afterwards. Versions start at 1, so an expectedVersion of 0 matches only a
+// missing or expired key. Versions come from a counter shared by every key
+// and are never reused while the store is open, so a key deleted and created
+// again does not match a version from before. They restart when the store is
+// reopened. The TTL follows the same rules as Set.
+func (s *Store) SetIfVersion(key, value string, expectedVersion uint64, ttl time.Duration) (bool, uint64, error) {
+	if err := checkKey(key); err != nil {
+		return false, 0, err
+	}
+	return s.setIfVersion("", key, value, expectedVersion, ttl)
+}
+
+func (s *Store) setIfVersion(source, key, value string, expectedVersion uint64, ttl time.Duration) (bool, uint64, error) {
+	if err := s.checkWritable(); err != nil {
+		return false, 0, err
+	}
+	if err := s.checkSize(key, value); err != nil {
+		return false, 0, err
+	}
+	e := s.newEntry(value, time.Now(), ttl)
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	var current uint64
+	if prev, ok := sh.data[key]; ok && !prev.expired() {
+		current = prev.version
+	}
+	if current != expectedVersion {
+		sh.mu.Unlock()
+		return false, current, nil
+	}
+	if err := s.logSet(key, e); err != nil {
+		sh.mu.Unlock()
+		return false, current, err
+	}
+	s.put(sh, key, e, source)
+	s.sets.Add(1)
+	sh.mu.Unlock()
+	return true, e.version, s.settle()
+}
+
+// SetOptions describes a single write, in a batch or to SetWithOptions.
+type SetOptions struct {
+	Value   string
+	TTL     time.Duration     // zero means no expiry
+	Sliding bool              // reads extend the TTL, as with SetSliding
+	Tags    map[string]string // labels for ListByTag and DeleteByTag
+}
+
+// MGet retrieves several keys under a single read lock pass. Missing and
+// expired keys, and keys holding a list or hash, are omitted from the result.
+func (s *Store) MGet(keys []string) map[string]string {
+	return s.mget(slices.DeleteFunc(slices.Clone(keys), namespaced))
+}
+
+// mget is MGet for internal keys.
+func (s *Store) mget(keys []string) map[string]string {
+	out := make(map[string]string, len(keys))
+	slid := make(map[string]*entry)
+	unlock := s.lockShards(keys, false)
+	for _, k := range keys {
+		if e, ok := s.shardFor(k).data[k]; ok && !e.expired() && e.kind == kindString {
+			s.touch(e)
+			out[k] = e.value
+			s.hits.Add(1)
+			if e.sliding {
+				slid[k] = e
+			}
+		} else {
+			s.misses.Add(1)
+		}
+	}
+	unlock()
+	for k, e := range slid {
+		s.slide(k, e)
+	}
+	return out
+}
+
+// MSet writes several keys while holding every affected shard's lock, so
+// concurrent readers (including MGet) observe either none or all of the batch.
+// With a WAL the batch is logged as a single record and is replayed
+// all-or-nothing too.
+func (s *Store) MSet(entries map[string]SetOptions) error {
+	for k := range entries {
+		if err := checkKey(k); err != nil {
+			return err
+		}
+	}
+	return s.mset("", entries)
+}
+
+func (s *Store) mset(source string, entries map[string]SetOptions) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	now := time.Now()
+	batch := make(map[string]*entry, len(entries))
+	keys := make([]string, 0, len(entries))
+	for k, o := range entries {
+		if err := s.checkSize(k, o.Value); err != nil {
+			return err
+		}
+		e := s.newEntry(o.Value, now, o.TTL)
+		e.sliding = o.Sliding && o.TTL > 0
+		e.tags = cloneTags(o.Tags)
+		batch[k] = e
+		keys = append(keys, k)
+	}
+	unlock := s.lockShards(keys, true)
+	if err := s.logBatch(batch); err != nil {
+		unlock()
+		return err
+	}
+	for k, e := range batch {
+		s.put(s.shardFor(k), k, e, source)
+	}
+	s.sets.Add(uint64(len(batch)))
+	unlock()
+	return s.settle()
+}
+
+// Append appends suffix to the value stored at key and returns the new length.
+// A missing or expired key is created with the default TTL, as by a Set
+// without one (see WithDefaultTTL); an existing key keeps its TTL. Returns
+// ErrKeyTooLarge or ErrValueTooLarge if the key or the result would exceed
+// the store's size limits, and ErrWrongType if the key holds a list or hash.
+func (s *Store) Append(key, suffix string) (int, error) {
+	if err := checkKey(key); err != nil {
+		return 0, err
+	}
+	return s.appendValue("", key, suffix)
+}
+
+func (s *Store) appendValue(source, key, suffix string) (int, error) {
+	if err := s.checkWritable(); err != nil {
+		return 0, err
+	}
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	e, ok := sh.data[key]
 	if !ok || e.expired() {
-		delete(s.data, key) // clean up if expired
-		return false
+		e = s.newEntry("", time.Now(), 0)
 	}
-	delete(s.data, key)
-	return true
+	if e.kind != kindString {
+		sh.mu.Unlock()
+		return 0, ErrWrongType
+	}
+	newLen := len(e.value) + len(suffix)
+	if s.maxValueBytes > 0 && newLen > s.maxValueBytes {
+		// Checked before concatenating so an oversized append costs nothing.
+		sh.mu.Unlock()
+		return len(e.value), ErrValueTooLarge
+	}
+	ne := &entry{value: e.value + suffix, expiresAt: e.expiresAt, period: e.period, sliding: e.sliding, createdAt: e.createdAt, updatedAt: time.Now(), tags: e.tags}
+	if err := s.checkSize(key, ne.value); err != nil {
+		sh.mu.Unlock()
+		return len(e.value), err
+	}
+	if err := s.logSet(key, ne); err != nil {
+		sh.mu.Unlock()
+		return len(e.value), err
+	}
+	s.put(sh, key, ne, source)
+	s.sets.Add(1)
+	sh.mu.Unlock()
+	return newLen, s.settle()
+}
+
+// Delete removes a key. Returns true if the key existed (and was not expired).
+// An error is only returned if the delete could not be logged to the WAL.
+func (s *Store) Delete(key string) (bool, error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	return s.delete("", key)
 }
 
-// List returns all non-expired keys.
+func (s *Store) delete(source, key string) (bool, error) {
+	if err := s.checkWritable(); err != nil {
+		return false, err
+	}
+	s.deletes.Add(1)
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	e, ok := sh.data[key]
+	if !ok {
+		sh.mu.Unlock()
+		return false, nil
+	}
+	if err := s.logDel(key); err != nil {
+		sh.mu.Unlock()
+		return false, err
+	}
+	s.remove(sh, key, EventDelete, source)
+	sh.mu.Unlock()
+	return !e.expired(), s.maybeCompact()
+}
+
+// Expire sets a new TTL on an existing key without touching its value. A ttl
+// <= 0 removes the expiry, as Persist does. Returns false if the key does not
+// exist or has already expired.
+func (s *Store) Expire(key string, ttl time.Duration) (bool, error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	return s.setExpiry("", key, ttl, false)
+}
+
+// Persist removes the expiry from an existing key so it lives until deleted,
+// or resets it to the default or maximum TTL if the store has one. Returns
+// false if the key does not exist or has already expired.
+func (s *Store) Persist(key string) (bool, error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	return s.setExpiry("", key, 0, false)
+}
+
+// Touch resets the expiry of an existing key to now+ttl, or clears it if ttl
+// <= 0, without rewriting the value. It is meant for sliding expirations such
+// as sessions. Returns false if the key does not exist; an expired key also
+// returns false and is deleted.
+func (s *Store) Touch(key string, ttl time.Duration) (bool, error) {
+	return s.Expire(key, ttl)
+}
+
+// Refresh resets the expiry of an existing key to now plus the TTL it was last
+// given, so callers can extend a session on activity without remembering how
+// long it lasts. Returns false if the key does not exist, has expired or has
+// no TTL.
+func (s *Store) Refresh(key string) (bool, error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	return s.setExpiry("", key, 0, true)
+}
+
+// setExpiry gives key a new expiry ttl from now on behalf of source, or
+// clears it if ttl <= 0. With refresh, ttl is ignored and the key's own TTL
+// is reused instead; keys without one are left alone and reported as not
+// found.
+func (s *Store) setExpiry(source, key string, ttl time.Duration, refresh bool) (bool, error) {
+	if err := s.checkWritable(); err != nil {
+		return false, err
+	}
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	e, ok := sh.data[key]
+	if !ok {
+		sh.mu.Unlock()
+		return false, nil
+	}
+	if e.expired() {
+		if s.expire(sh, key) {
+			s.lazyExpired.Add(1)
+		}
+		sh.mu.Unlock()
+		return false, nil
+	}
+	if refresh {
+		if e.period <= 0 {
+			sh.mu.Unlock()
+			return false, nil
+		}
+		ttl = e.period
+	}
+	ne := s.newEntry("", time.Now(), ttl)
+	ne.copyData(e)
+	ne.sliding = e.sliding
+	ne.createdAt, ne.updatedAt = e.createdAt, e.updatedAt
+	if err := s.logSet(key, ne); err != nil {
+		sh.mu.Unlock()
+		return false, err
+	}
+	s.retime(sh, key, e, ne.expiresAt, ne.period, source)
+	sh.mu.Unlock()
+	return true, s.maybeCompact()
+}
+
+// ExpireNow expires a key immediately, taking the same path as a TTL expiry
+// rather than a Delete. Returns false if the key did not exist or had already
+// expired.
+func (s *Store) ExpireNow(key string) (bool, error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	if err := s.checkWritable(); err != nil {
+		return false, err
+	}
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	e, ok := sh.data[key]
+	if !ok {
+		sh.mu.Unlock()
+		return false, nil
+	}
+	if err := s.logDel(key); err != nil {
+		sh.mu.Unlock()
+		return false, err
+	}
+	live := !e.expired()
+	s.expire(sh, key)
+	sh.mu.Unlock()
+	return live, s.maybeCompact()
+}
+
+// List returns all non-expired keys in the default namespace. Shards are read
+// one at a time, each under its read lock only for as long as it takes to copy
+// its keys, so the result is consistent per shard but not across the whole
+// store: a key written to one shard while another is being read may or may
+// not appear.
 func (s *Store) List() []string {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	keys := make([]string, 0, len(s.data))
-	for k, e := range s.data {
-		if !e.expired() {
-			keys = append(keys, k)
+	keys := make([]string, 0, s.count.Load())
+	now := time.Now()
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for k, e := range sh.data {
+			if !e.expiredAt(now) && !namespaced(k) {
+				keys = append(keys, k)
+			}
 		}
+		sh.mu.RUnlock()
 	}
 	return keys
 }
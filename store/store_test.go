@@ -1,7 +1,12 @@
 package store
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -32,7 +37,7 @@ func TestDelete(t *testing.T) {
 	defer s.Stop()
 
 	s.Set("foo", "bar", 0)
-	deleted := s.Delete("foo")
+	deleted, _ := s.Delete("foo")
 	if !deleted {
 		t.Fatal("expected delete to return true")
 	}
@@ -47,7 +52,7 @@ func TestDeleteMissing(t *testing.T) {
 	s := New()
 	defer s.Stop()
 
-	deleted := s.Delete("nope")
+	deleted, _ := s.Delete("nope")
 	if deleted {
 		t.Fatal("expected delete of missing key to return false")
 	}
@@ -114,3 +119,966 @@ func TestListExcludesExpired(t *testing.T) {
 		t.Fatalf("expected only [persist], got %v", keys)
 	}
 }
+
+func TestAppend(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	n, err := s.Append("log", "a")
+	if err != nil || n != 1 {
+		t.Fatalf("expected (1, nil), got (%d, %v)", n, err)
+	}
+	n, err = s.Append("log", "bc")
+	if err != nil || n != 3 {
+		t.Fatalf("expected (3, nil), got (%d, %v)", n, err)
+	}
+	val, _ := s.Get("log")
+	if val != "abc" {
+		t.Fatalf("expected abc, got %s", val)
+	}
+}
+
+func TestAppendPreservesTTL(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("temp", "a", 50*time.Millisecond)
+	if _, err := s.Append("temp", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, ok := s.Get("temp"); ok {
+		t.Fatal("appended key should keep its original TTL")
+	}
+}
+
+func TestAppendDefaultTTLAndSets(t *testing.T) {
+	s := New(WithDefaultTTL(time.Hour))
+	defer s.Stop()
+
+	if _, err := s.Append("new", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, hasTTL, _ := s.TTL("new"); !hasTTL {
+		t.Fatal("expected a key created by Append to get the default TTL")
+	}
+	s.Set("old", "a", 0)
+	if _, err := s.Append("old", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Stats().Sets; n != 3 {
+		t.Fatalf("expected every append to count as a set, got %d sets", n)
+	}
+}
+
+func TestAppendMaxValueBytes(t *testing.T) {
+	s := New(WithMaxValueBytes(4))
+	defer s.Stop()
+
+	if _, err := s.Append("k", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Append("k", "de"); err != ErrValueTooLarge {
+		t.Fatalf("expected ErrValueTooLarge, got %v", err)
+	}
+	val, _ := s.Get("k")
+	if val != "abc" {
+		t.Fatalf("rejected append should leave value untouched, got %s", val)
+	}
+}
+
+func TestExpireNow(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("k", "v", time.Hour)
+	if ok, _ := s.ExpireNow("k"); !ok {
+		t.Fatal("expected ExpireNow to report a live key")
+	}
+	if _, ok := s.Get("k"); ok {
+		t.Fatal("key should be gone after ExpireNow")
+	}
+	if ok, _ := s.ExpireNow("k"); ok {
+		t.Fatal("expected ExpireNow on a missing key to return false")
+	}
+}
+
+func TestMGetMSet(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	err := s.MSet(map[string]SetOptions{
+		"a": {Value: "1"},
+		"b": {Value: "2"},
+		"c": {Value: "3", TTL: 50 * time.Millisecond},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := s.MGet([]string{"a", "b", "c", "missing"})
+	if len(got) != 3 || got["a"] != "1" || got["b"] != "2" || got["c"] != "3" {
+		t.Fatalf("unexpected MGet result: %v", got)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	got = s.MGet([]string{"a", "c"})
+	if _, ok := got["c"]; ok || got["a"] != "1" {
+		t.Fatalf("expected only a after c expired, got %v", got)
+	}
+}
+
+func TestMDelete(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	s.MSet(map[string]SetOptions{"a": {Value: "1"}, "b": {Value: "2"}, "c": {Value: "3"}})
+	ns := s.Namespace("app")
+	ns.Set("a", "scoped", 0)
+
+	n, err := s.MDelete([]string{"a", "b", "missing"})
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 live keys deleted, got %d, %v", n, err)
+	}
+	if s.Exists("a") || s.Exists("b") || !s.Exists("c") || !ns.Exists("a") {
+		t.Fatal("expected only a and b deleted from the default namespace")
+	}
+	if n, _ := ns.MDelete([]string{"a"}); n != 1 || ns.Exists("a") {
+		t.Fatalf("expected the namespaced key deleted, got %d", n)
+	}
+}
+
+func TestMSetAtomicVisibility(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	batch := make(map[string]SetOptions)
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("k%d", i)
+		batch[keys[i]] = SetOptions{Value: "v"}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			if n := len(s.MGet(keys)); n != 0 && n != len(keys) {
+				t.Errorf("observed partial batch: %d of %d keys", n, len(keys))
+				return
+			}
+		}
+	}()
+	s.MSet(batch)
+	<-done
+}
+
+func TestExpire(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("k", "v", 0)
+	if ok, _ := s.Expire("k", 50*time.Millisecond); !ok {
+		t.Fatal("expected Expire on an existing key to return true")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, ok := s.Get("k"); ok {
+		t.Fatal("key should have expired after Expire")
+	}
+	if ok, _ := s.Expire("k", time.Minute); ok {
+		t.Fatal("expected Expire on an expired key to return false")
+	}
+	if ok, _ := s.Expire("missing", time.Minute); ok {
+		t.Fatal("expected Expire on a missing key to return false")
+	}
+}
+
+func TestPersist(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("k", "v", 50*time.Millisecond)
+	if ok, _ := s.Persist("k"); !ok {
+		t.Fatal("expected Persist on an existing key to return true")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if val, ok := s.Get("k"); !ok || val != "v" {
+		t.Fatal("persisted key should not expire")
+	}
+	if ok, _ := s.Persist("missing"); ok {
+		t.Fatal("expected Persist on a missing key to return false")
+	}
+}
+
+func TestTTL(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("forever", "v", 0)
+	remaining, hasTTL, exists := s.TTL("forever")
+	if !exists || hasTTL || remaining != 0 {
+		t.Fatalf("expected (0, false, true) for key without TTL, got (%v, %v, %v)", remaining, hasTTL, exists)
+	}
+
+	s.Set("session", "v", time.Minute)
+	remaining, hasTTL, exists = s.TTL("session")
+	if !exists || !hasTTL || remaining <= 0 || remaining > time.Minute {
+		t.Fatalf("expected remaining TTL within (0, 1m], got (%v, %v, %v)", remaining, hasTTL, exists)
+	}
+
+	_, _, exists = s.TTL("missing")
+	if exists {
+		t.Fatal("expected missing key to not exist")
+	}
+}
+
+func TestTTLExpiredBeforeQuery(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("temp", "v", 20*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	remaining, hasTTL, exists := s.TTL("temp")
+	if exists || hasTTL || remaining != 0 {
+		t.Fatalf("expected expired key to be reported missing, got (%v, %v, %v)", remaining, hasTTL, exists)
+	}
+}
+
+func TestGetWithTTL(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("k", "v", time.Minute)
+	val, ttl, ok := s.GetWithTTL("k")
+	if !ok || val != "v" || ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("unexpected GetWithTTL result: (%s, %v, %v)", val, ttl, ok)
+	}
+}
+
+// benchmarkMixed runs a read-heavy mix of Gets and Sets from many goroutines.
+// Compare BenchmarkMixedSingleShard (equivalent to the old single-lock store)
+// with BenchmarkMixedSharded to see the effect of sharding; the difference
+// only shows with GOMAXPROCS > 1.
+func benchmarkMixed(b *testing.B, opts ...Option) {
+	s := New(opts...)
+	defer s.Stop()
+	const nkeys = 1024
+	keys := make([]string, nkeys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key-%d", i)
+		s.Set(keys[i], "value", 0)
+	}
+	b.SetParallelism(64)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			k := keys[i%nkeys]
+			if i%4 == 0 {
+				s.Set(k, "value", 0)
+			} else {
+				s.Get(k)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkMixedSingleShard(b *testing.B) { benchmarkMixed(b, WithShards(1)) }
+
+func BenchmarkMixedSharded(b *testing.B) { benchmarkMixed(b) }
+
+func TestShardsAgree(t *testing.T) {
+	for _, n := range []int{1, 7} {
+		s := New(WithShards(n))
+		for i := 0; i < 100; i++ {
+			s.Set(fmt.Sprintf("k%d", i), "v", 0)
+		}
+		if got := len(s.List()); got != 100 {
+			t.Errorf("shards=%d: List returned %d keys, want 100", n, got)
+		}
+		if got := s.Len(); got != 100 {
+			t.Errorf("shards=%d: Len = %d, want 100", n, got)
+		}
+		s.Stop()
+	}
+}
+
+func TestGetExpiredDoesNotDropFreshSet(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	for i := 0; i < 2000; i++ {
+		s.Set("k", "old", time.Nanosecond)
+		time.Sleep(time.Microsecond)
+
+		start := make(chan struct{})
+		done := make(chan struct{}, 2)
+		go func() {
+			<-start
+			s.Get("k")
+			done <- struct{}{}
+		}()
+		go func() {
+			<-start
+			s.Set("k", "fresh", 0)
+			done <- struct{}{}
+		}()
+		close(start)
+		<-done
+		<-done
+
+		if v, ok := s.Get("k"); !ok || v != "fresh" {
+			t.Fatalf("iteration %d: fresh value lost, got %q, %v", i, v, ok)
+		}
+	}
+}
+
+func TestGetExpiredRacesManySetters(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	for round := 0; round < 200; round++ {
+		key := fmt.Sprintf("k%d", round)
+		s.Set(key, "old", time.Nanosecond)
+		time.Sleep(time.Microsecond)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.Get(key)
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Set(key, "fresh", 0)
+		}()
+		wg.Wait()
+
+		if v, ok := s.Get(key); !ok || v != "fresh" {
+			t.Fatalf("round %d: fresh value lost, got %q, %v", round, v, ok)
+		}
+	}
+}
+
+func TestTouch(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("session", "data", 50*time.Millisecond)
+	if ok, err := s.Touch("session", time.Hour); !ok || err != nil {
+		t.Fatalf("expected Touch to succeed, got %v, %v", ok, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if v, ok := s.Get("session"); !ok || v != "data" {
+		t.Fatalf("expected touched key to outlive its original TTL, got %q, %v", v, ok)
+	}
+
+	if ok, _ := s.Touch("session", 0); !ok {
+		t.Fatal("expected Touch with ttl 0 to succeed")
+	}
+	if _, hasTTL, _ := s.TTL("session"); hasTTL {
+		t.Error("expected Touch with ttl 0 to clear the expiry")
+	}
+
+	if ok, _ := s.Touch("missing", time.Hour); ok {
+		t.Error("expected Touch on a missing key to return false")
+	}
+
+	s.Set("stale", "x", 10*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	if ok, _ := s.Touch("stale", time.Hour); ok {
+		t.Error("expected Touch on an expired key to return false")
+	}
+	if n := s.Len(); n != 1 {
+		t.Errorf("expected the expired key to be deleted, Len = %d", n)
+	}
+}
+
+func TestSetSliding(t *testing.T) {
+	s := New(WithGCInterval(5 * time.Millisecond))
+	defer s.Stop()
+
+	s.SetSliding("session", "v", 100*time.Millisecond)
+	s.Set("fixed", "v", 100*time.Millisecond)
+	for end := time.Now().Add(time.Second); time.Now().Before(end); {
+		if _, ok := s.Get("session"); !ok {
+			t.Fatal("expected a sliding key read every 40ms to stay alive")
+		}
+		time.Sleep(40 * time.Millisecond)
+	}
+	if _, ok := s.Get("fixed"); ok {
+		t.Fatal("expected a plain TTL key to expire regardless of reads")
+	}
+
+	// TTL queries are not reads, so they do not keep the key alive.
+	for end := time.Now().Add(200 * time.Millisecond); time.Now().Before(end); {
+		s.TTL("session")
+		time.Sleep(20 * time.Millisecond)
+	}
+	if s.Exists("session") {
+		t.Fatal("expected the sliding key to expire once reads stopped")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("session", "data", time.Minute)
+	s.Append("session", "+more")
+	time.Sleep(20 * time.Millisecond)
+	before, _, _ := s.TTL("session")
+	if ok, err := s.Refresh("session"); !ok || err != nil {
+		t.Fatalf("expected Refresh to succeed, got %v, %v", ok, err)
+	}
+	if after, _, _ := s.TTL("session"); after <= before || after > time.Minute {
+		t.Fatalf("expected Refresh to reset the TTL to a minute, got %v (was %v)", after, before)
+	}
+
+	s.Expire("session", time.Hour)
+	s.Refresh("session")
+	if ttl, _, _ := s.TTL("session"); ttl <= time.Minute {
+		t.Fatalf("expected Refresh to reuse the TTL from Expire, got %v", ttl)
+	}
+
+	s.Set("forever", "v", 0)
+	if ok, _ := s.Refresh("forever"); ok {
+		t.Error("expected Refresh on a key without a TTL to return false")
+	}
+	if _, hasTTL, _ := s.TTL("forever"); hasTTL {
+		t.Error("Refresh should not give a TTL to a key without one")
+	}
+	if ok, _ := s.Refresh("missing"); ok {
+		t.Error("expected Refresh on a missing key to return false")
+	}
+	s.Set("stale", "x", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if ok, _ := s.Refresh("stale"); ok {
+		t.Error("expected Refresh on an expired key to return false")
+	}
+}
+
+func TestGetSet(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	old, existed, err := s.GetSet("counter", "1", 0)
+	if err != nil || existed || old != "" {
+		t.Fatalf("expected no previous value, got %q, %v, %v", old, existed, err)
+	}
+	old, existed, _ = s.GetSet("counter", "0", time.Hour)
+	if !existed || old != "1" {
+		t.Fatalf("expected previous value 1, got %q, %v", old, existed)
+	}
+	if v, ttl, _ := s.GetWithTTL("counter"); v != "0" || ttl <= 0 {
+		t.Fatalf("expected new value with TTL, got %q, %v", v, ttl)
+	}
+
+	s.Set("stale", "x", 10*time.Millisecond)
+	time.Sleep(30 * time.Millisecond)
+	if _, existed, _ := s.GetSet("stale", "y", 0); existed {
+		t.Fatal("expected an expired key to report existed=false")
+	}
+}
+
+func TestSizeLimits(t *testing.T) {
+	s := New(WithMaxKeyBytes(4), WithMaxValueBytes(8))
+	defer s.Stop()
+
+	if err := s.Set("toolong", "v", 0); err != ErrKeyTooLarge {
+		t.Errorf("expected ErrKeyTooLarge, got %v", err)
+	}
+	if err := s.Set("k", "far too long", 0); err != ErrValueTooLarge {
+		t.Errorf("expected ErrValueTooLarge, got %v", err)
+	}
+	if err := s.MSet(map[string]SetOptions{"k": {Value: "far too long"}}); err != ErrValueTooLarge {
+		t.Errorf("expected ErrValueTooLarge from MSet, got %v", err)
+	}
+	if _, _, err := s.GetSet("toolong", "v", 0); err != ErrKeyTooLarge {
+		t.Errorf("expected ErrKeyTooLarge from GetSet, got %v", err)
+	}
+	if err := s.Set("k", "12345678", 0); err != nil {
+		t.Errorf("expected a value at the limit to be accepted, got %v", err)
+	}
+	if n := s.Len(); n != 1 {
+		t.Errorf("expected only the valid write to be stored, Len = %d", n)
+	}
+}
+
+func TestSizeLimitsDefaultAndUnlimited(t *testing.T) {
+	big := string(make([]byte, defaultMaxValueBytes+1))
+
+	s := New()
+	if err := s.Set("k", big, 0); err != ErrValueTooLarge {
+		t.Errorf("expected the default limit to reject a value over 1 MiB, got %v", err)
+	}
+	s.Stop()
+
+	s = New(WithMaxValueBytes(0), WithMaxKeyBytes(0))
+	defer s.Stop()
+	if err := s.Set(strings.Repeat("k", defaultMaxKeyBytes+1), big, 0); err != nil {
+		t.Errorf("expected zero limits to be unlimited, got %v", err)
+	}
+}
+
+func TestSetNX(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	if ok, err := s.SetNX("lock", "owner-1", 50*time.Millisecond); !ok || err != nil {
+		t.Fatalf("expected first SetNX to succeed, got %v, %v", ok, err)
+	}
+	if ok, _ := s.SetNX("lock", "owner-2", time.Minute); ok {
+		t.Fatal("expected SetNX on a live key to fail")
+	}
+	if v, _ := s.Get("lock"); v != "owner-1" {
+		t.Fatalf("expected failed SetNX to leave the value alone, got %q", v)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if ok, _ := s.SetNX("lock", "owner-2", time.Minute); !ok {
+		t.Fatal("expected SetNX to succeed once the previous key expired")
+	}
+	if v, _ := s.Get("lock"); v != "owner-2" {
+		t.Fatalf("expected owner-2, got %q", v)
+	}
+}
+
+func TestSetIfVersion(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	ok, v1, err := s.SetIfVersion("k", "a", 0, 0)
+	if !ok || err != nil || v1 == 0 {
+		t.Fatalf("expected version 0 to create a missing key, got %v %d %v", ok, v1, err)
+	}
+	if ok, cur, _ := s.SetIfVersion("k", "b", 0, 0); ok || cur != v1 {
+		t.Fatalf("expected version 0 to fail on an existing key and report %d, got %v %d", v1, ok, cur)
+	}
+	if _, info, _ := s.GetWithInfo("k"); info.Version != v1 {
+		t.Fatalf("expected GetWithInfo to report version %d, got %d", v1, info.Version)
+	}
+
+	ok, v2, _ := s.SetIfVersion("k", "b", v1, 0)
+	if !ok || v2 <= v1 {
+		t.Fatalf("expected a matching version to write and bump it, got %v %d", ok, v2)
+	}
+	if ok, _, _ := s.SetIfVersion("k", "c", v1, 0); ok {
+		t.Fatal("expected a stale version to fail")
+	}
+
+	s.Set("k", "d", 0)
+	info, _ := s.Info("k")
+	if info.Version <= v2 {
+		t.Fatalf("expected a plain Set to bump the version past %d, got %d", v2, info.Version)
+	}
+	s.Expire("k", time.Hour)
+	if again, _ := s.Info("k"); again.Version != info.Version {
+		t.Fatal("expected a TTL change to keep the version")
+	}
+
+	s.Delete("k")
+	s.Set("k", "e", 0)
+	if recreated, _ := s.Info("k"); recreated.Version <= info.Version {
+		t.Fatalf("expected a recreated key not to reuse version %d, got %d", info.Version, recreated.Version)
+	}
+}
+
+func TestStop(t *testing.T) {
+	s := New()
+	s.Set("k", "v", 0)
+	s.Stop()
+	s.Stop()
+
+	if err := s.Set("k", "w", 0); !errors.Is(err, ErrStoreClosed) {
+		t.Fatalf("expected ErrStoreClosed from Set, got %v", err)
+	}
+	if _, err := s.Delete("k"); !errors.Is(err, ErrStoreClosed) {
+		t.Fatalf("expected ErrStoreClosed from Delete, got %v", err)
+	}
+	if _, err := s.Expire("k", time.Minute); !errors.Is(err, ErrStoreClosed) {
+		t.Fatalf("expected ErrStoreClosed from Expire, got %v", err)
+	}
+	if err := s.Namespace("ns").Set("k", "v", 0); !errors.Is(err, ErrStoreClosed) {
+		t.Fatalf("expected ErrStoreClosed from a namespace write, got %v", err)
+	}
+	if v, ok := s.Get("k"); !ok || v != "v" {
+		t.Fatalf("expected reads to keep serving the stopped store, got %q %v", v, ok)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	s := New(WithGCInterval(0))
+	defer s.Stop()
+	s.Set("k", "v", 0)
+	s.Set("gone", "v", time.Millisecond)
+	s.SetSliding("session", "v", time.Minute)
+	s.SetReadOnly(true)
+
+	if err := s.Set("k", "w", 0); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly from Set, got %v", err)
+	}
+	if _, err := s.Delete("k"); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly from Delete, got %v", err)
+	}
+	if _, err := s.Flush(context.Background(), false); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly from Flush, got %v", err)
+	}
+	if err := s.Namespace("ns").Set("k", "v", 0); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly from a namespace write, got %v", err)
+	}
+	if v, ok := s.Get("k"); !ok || v != "v" {
+		t.Fatalf("expected reads to keep working, got %q %v", v, ok)
+	}
+
+	// Expired keys are still swept, but reads do not slide expiries.
+	time.Sleep(5 * time.Millisecond)
+	if n := s.SweepNow(); n != 1 {
+		t.Fatalf("expected the sweep to remove the expired key, got %d", n)
+	}
+	_, before, _ := s.GetWithInfo("session")
+	time.Sleep(5 * time.Millisecond)
+	if _, after, _ := s.GetWithInfo("session"); after.TTL >= before.TTL {
+		t.Fatalf("expected a read not to extend a sliding TTL, got %v then %v", before.TTL, after.TTL)
+	}
+
+	s.SetReadOnly(false)
+	if err := s.Set("k", "w", 0); err != nil {
+		t.Fatalf("expected writes to resume, got %v", err)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	if ok, _ := s.CompareAndSwap("missing", "", "v", 0); ok {
+		t.Fatal("expected CompareAndSwap on a missing key to fail")
+	}
+	if _, ok := s.Get("missing"); ok {
+		t.Fatal("expected CompareAndSwap not to create the key")
+	}
+
+	s.Set("counter", "1", 0)
+	if ok, _ := s.CompareAndSwap("counter", "2", "3", 0); ok {
+		t.Fatal("expected CompareAndSwap with a stale value to fail")
+	}
+	if ok, err := s.CompareAndSwap("counter", "1", "2", time.Minute); !ok || err != nil {
+		t.Fatalf("expected CompareAndSwap to succeed, got %v, %v", ok, err)
+	}
+	if v, _ := s.Get("counter"); v != "2" {
+		t.Fatalf("expected 2, got %q", v)
+	}
+	if _, hasTTL, _ := s.TTL("counter"); !hasTTL {
+		t.Fatal("expected CompareAndSwap to apply the new TTL")
+	}
+
+	s.Set("short", "v", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if ok, _ := s.CompareAndSwap("short", "v", "w", 0); ok {
+		t.Fatal("expected CompareAndSwap on an expired key to fail")
+	}
+}
+
+func TestStatsCountsOperations(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("a", "1", 0)
+	s.MSet(map[string]SetOptions{"b": {Value: "2"}, "c": {Value: "3"}})
+	s.Get("a")
+	s.Get("missing")
+	s.MGet([]string{"b", "nope"})
+	s.Delete("c")
+
+	st := s.Stats()
+	if st.Sets != 3 || st.Hits != 2 || st.Misses != 2 || st.Deletes != 1 {
+		t.Fatalf("unexpected counters %+v", st)
+	}
+}
+
+func TestMutations(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	m0 := s.Mutations()
+	s.Get("missing")
+	s.Set("a", "1", 0)
+	m1 := s.Mutations()
+	if m1 == m0 {
+		t.Fatal("expected Set to count as a mutation")
+	}
+	s.Get("a")
+	s.List()
+	if s.Mutations() != m1 {
+		t.Fatal("expected reads not to count as mutations")
+	}
+	s.Expire("a", time.Hour)
+	s.Delete("a")
+	if s.Mutations() != m1+2 {
+		t.Fatalf("expected Expire and Delete to count, got %d want %d", s.Mutations(), m1+2)
+	}
+}
+
+// binaryValue holds a NUL byte and bytes that are not valid UTF-8.
+var binaryValue = []byte{'a', 0x00, 0xff, 0xfe, 'z', 0xc3}
+
+func TestSetBytesCopiesValue(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	buf := append([]byte(nil), binaryValue...)
+	if err := s.SetBytes("blob", buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	buf[0] = 'X' // must not reach the stored value
+
+	got, ok := s.GetBytes("blob")
+	if !ok || string(got) != string(binaryValue) {
+		t.Fatalf("expected %q, got %q", binaryValue, got)
+	}
+	got[1] = 'X' // nor may mutating what GetBytes returned
+	if again, _ := s.GetBytes("blob"); string(again) != string(binaryValue) {
+		t.Fatalf("expected the stored value to be unchanged, got %q", again)
+	}
+}
+
+func TestExists(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.Set("live", "v", 0)
+	s.Set("temp", "v", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	if !s.Exists("live") {
+		t.Fatal("expected live key to exist")
+	}
+	if s.Exists("missing") {
+		t.Fatal("expected missing key not to exist")
+	}
+	if s.Exists("temp") {
+		t.Fatal("expected expired key not to exist")
+	}
+	st := s.Stats()
+	if st.Keys != 1 || st.ExpiredOnAccess != 1 {
+		t.Fatalf("expected Exists to delete the expired key lazily, got %+v", st)
+	}
+	if st.Hits != 0 || st.Misses != 0 {
+		t.Fatalf("expected Exists not to count as a Get, got %d hits and %d misses", st.Hits, st.Misses)
+	}
+}
+
+func TestExpiryJitter(t *testing.T) {
+	const ttl, jitter = time.Minute, 30 * time.Second
+	s := New(WithExpiryJitter(jitter))
+	defer s.Stop()
+
+	remaining := make(map[time.Duration]bool)
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("k%d", i)
+		s.Set(key, "v", ttl)
+		got, hasTTL, _ := s.TTL(key)
+		if !hasTTL || got < ttl-time.Second || got > ttl+jitter {
+			t.Fatalf("%s: TTL %v outside [%v, %v]", key, got, ttl, ttl+jitter)
+		}
+		remaining[got.Round(time.Second)] = true
+	}
+	if len(remaining) < 2 {
+		t.Fatal("expected jitter to spread the expiries out")
+	}
+
+	s.Set("forever", "v", 0)
+	if _, hasTTL, _ := s.TTL("forever"); hasTTL {
+		t.Fatal("jitter should not give a TTL to keys without one")
+	}
+	s.Expire("forever", ttl)
+	if got, _, _ := s.TTL("forever"); got < ttl-time.Second || got > ttl+jitter {
+		t.Fatalf("expected Expire to be jittered too, got %v", got)
+	}
+}
+
+func TestTTLJitterFraction(t *testing.T) {
+	const ttl = time.Minute
+	s := New(WithTTLJitterFraction(0.5))
+	defer s.Stop()
+
+	shorter, longer := false, false
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("k%d", i)
+		s.Set(key, "v", ttl)
+		got, _, _ := s.TTL(key)
+		if got < ttl/2-time.Second || got > ttl*3/2 {
+			t.Fatalf("%s: TTL %v outside [%v, %v]", key, got, ttl/2, ttl*3/2)
+		}
+		shorter = shorter || got < ttl-time.Second
+		longer = longer || got > ttl
+	}
+	if !shorter || !longer {
+		t.Fatal("expected jitter to both shorten and lengthen TTLs")
+	}
+
+	full := New(WithTTLJitterFraction(1))
+	defer full.Stop()
+	for i := 0; i < 200; i++ {
+		now := time.Now()
+		if d := full.deadline(now, 2*time.Nanosecond); !d.After(now) {
+			t.Fatalf("expected a positive TTL to stay positive under full jitter, got %v", d.Sub(now))
+		}
+	}
+
+	none := New()
+	defer none.Stop()
+	now := time.Now()
+	if got := none.deadline(now, ttl); !got.Equal(now.Add(ttl)) {
+		t.Fatalf("expected no jitter by default, got %v", got.Sub(now))
+	}
+}
+
+func TestDefaultAndMaxTTL(t *testing.T) {
+	s := New(WithDefaultTTL(time.Minute), WithMaxTTL(time.Hour))
+	defer s.Stop()
+
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{"none gets the default", 0, time.Minute},
+		{"within the cap", 30 * time.Minute, 30 * time.Minute},
+		{"clamped to the cap", 48 * time.Hour, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.EffectiveTTL(tt.ttl); got != tt.want {
+				t.Fatalf("EffectiveTTL(%v) = %v, want %v", tt.ttl, got, tt.want)
+			}
+			s.Set("k", "v", tt.ttl)
+			if got, _, _ := s.TTL("k"); got > tt.want || got < tt.want-time.Second {
+				t.Fatalf("expected a TTL of about %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	s.Persist("k")
+	if _, hasTTL, _ := s.TTL("k"); !hasTTL {
+		t.Fatal("expected Persist to fall back to the default TTL")
+	}
+	s.Append("appended", "v")
+	if _, hasTTL, _ := s.TTL("appended"); !hasTTL {
+		t.Fatal("expected Append creating a key to apply the default TTL")
+	}
+
+	capped := New(WithMaxTTL(time.Hour), WithExpiryJitter(time.Hour))
+	defer capped.Stop()
+	capped.Set("k", "v", 0)
+	if got, _, _ := capped.TTL("k"); got > time.Hour {
+		t.Fatalf("expected jitter not to exceed the maximum TTL, got %v", got)
+	}
+
+	plain := New()
+	defer plain.Stop()
+	if got := plain.EffectiveTTL(0); got != 0 {
+		t.Fatalf("expected no default TTL out of the box, got %v", got)
+	}
+}
+
+func TestSweepNow(t *testing.T) {
+	s := New(WithGCInterval(0))
+	defer s.Stop()
+
+	for i := 0; i < 5; i++ {
+		s.Set(fmt.Sprintf("k%d", i), "v", 10*time.Millisecond)
+	}
+	s.Set("live", "v", time.Hour)
+	time.Sleep(20 * time.Millisecond)
+
+	if s.Len() != 6 {
+		t.Fatalf("expected the disabled sweeper to leave 6 keys, got %d", s.Len())
+	}
+
+	if n := s.SweepNow(); n != 5 {
+		t.Fatalf("expected SweepNow to expire 5 keys, got %d", n)
+	}
+	if s.Len() != 1 {
+		t.Fatalf("expected 1 key left, got %d", s.Len())
+	}
+	if n := s.SweepNow(); n != 0 {
+		t.Fatalf("expected nothing left to sweep, got %d", n)
+	}
+}
+
+func TestGCInterval(t *testing.T) {
+	s := New(WithGCInterval(5 * time.Millisecond))
+	defer s.Stop()
+
+	s.Set("k", "v", time.Millisecond)
+	deadline := time.Now().Add(time.Second)
+	for s.Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("background sweep did not run at the configured interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestNextGCInterval(t *testing.T) {
+	fixed := New()
+	defer fixed.Stop()
+	if got := fixed.nextGCInterval(time.Second, 0, 10); got != time.Second {
+		t.Fatalf("expected a fixed interval without adaptive GC, got %v", got)
+	}
+
+	s := New(WithAdaptiveGC(100*time.Millisecond, 8*time.Second))
+	defer s.Stop()
+	tests := []struct {
+		cur     time.Duration
+		expired int
+		withTTL int64
+		want    time.Duration
+	}{
+		{time.Second, 0, 100, 2 * time.Second},                    // idle: back off
+		{time.Second, 50, 100, 500 * time.Millisecond},            // busy: speed up
+		{time.Second, 5, 100, time.Second},                        // in between: hold
+		{6 * time.Second, 0, 100, 8 * time.Second},                // capped at max
+		{150 * time.Millisecond, 90, 100, 100 * time.Millisecond}, // floored at min
+	}
+	for _, tt := range tests {
+		if got := s.nextGCInterval(tt.cur, tt.expired, tt.withTTL); got != tt.want {
+			t.Errorf("nextGCInterval(%v, %d, %d) = %v, want %v", tt.cur, tt.expired, tt.withTTL, got, tt.want)
+		}
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	s.Set("user:1", "v", 0)
+	s.Set("user:2", "v", 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if n, err := s.DeletePrefix(ctx, "user:"); n != 0 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected DeletePrefix to be canceled, got %d, %v", n, err)
+	}
+	if n, err := s.Flush(ctx, false); n != 0 || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Flush to be canceled, got %d, %v", n, err)
+	}
+	if keys, _, err := s.ListPage(ctx, "user:", "", 10); keys != nil || !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected ListPage to be canceled, got %v, %v", keys, err)
+	}
+	if s.Len() != 2 {
+		t.Fatalf("expected canceled deletes to remove nothing, have %d keys", s.Len())
+	}
+}
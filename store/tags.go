@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+// Tags are small name/value labels attached to a key by SetWithOptions, such
+// as tenant=acme, so keys can be listed or deleted by label without encoding
+// it into their names. A key's tags belong to its value: a write that
+// replaces the value replaces them too, while Append and TTL changes keep
+// them.
+//
+// The store keeps a reverse index from each tag to the keys carrying it,
+// updated by put and remove, so it stays in step with overwrites, deletes,
+// evictions and expiry alike. Entries never change their tags in place, so
+// an entry's tags map may be shared and must not be modified.
+
+// tag is a single name/value pair in the reverse index.
+type tag struct {
+	name, value string
+}
+
+// tagIndex maps each tag to the internal keys carrying it. Its lock is taken
+// after the shard locks.
+type tagIndex struct {
+	mu   sync.Mutex
+	keys map[tag]map[string]struct{}
+}
+
+// add indexes key under each of tags. Caller must hold key's shard lock.
+func (ix *tagIndex) add(key string, tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+	ix.mu.Lock()
+	if ix.keys == nil {
+		ix.keys = make(map[tag]map[string]struct{})
+	}
+	for name, value := range tags {
+		t := tag{name, value}
+		if ix.keys[t] == nil {
+			ix.keys[t] = make(map[string]struct{})
+		}
+		ix.keys[t][key] = struct{}{}
+	}
+	ix.mu.Unlock()
+}
+
+// drop removes key from the index under each of tags, forgetting tags no key
+// carries any more. Caller must hold key's shard lock.
+func (ix *tagIndex) drop(key string, tags map[string]string) {
+	if len(tags) == 0 {
+		return
+	}
+	ix.mu.Lock()
+	for name, value := range tags {
+		t := tag{name, value}
+		delete(ix.keys[t], key)
+		if len(ix.keys[t]) == 0 {
+			delete(ix.keys, t)
+		}
+	}
+	ix.mu.Unlock()
+}
+
+// lookup returns the internal keys carrying t, including expired keys not yet
+// swept.
+func (ix *tagIndex) lookup(t tag) []string {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	keys := make([]string, 0, len(ix.keys[t]))
+	for k := range ix.keys[t] {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// SetWithOptions is like Set, but takes the value, TTL and any tags from o.
+// With o.Sliding the key expires after o.TTL of inactivity, as with
+// SetSliding. The tags are copied, so the caller may reuse the map.
+func (s *Store) SetWithOptions(key string, o SetOptions) error {
+	_, err := s.SetReportCreated(key, o)
+	return err
+}
+
+// SetReportCreated is like SetWithOptions but also reports whether the write
+// created the key rather than overwriting it. A key that had expired but not
+// yet been swept counts as created.
+func (s *Store) SetReportCreated(key string, o SetOptions) (created bool, err error) {
+	if err := checkKey(key); err != nil {
+		return false, err
+	}
+	return s.set("", key, o.Value, o.TTL, o.Sliding && o.TTL > 0, o.Tags)
+}
+
+// ListByTag returns the live keys in the default namespace tagged name=value.
+// Like List it makes no promise about the order.
+func (s *Store) ListByTag(name, value string) []string {
+	return s.Namespace("").ListByTag(name, value)
+}
+
+// DeleteByTag deletes every key in the default namespace tagged name=value as
+// a single atomic write, and returns how many live keys it removed.
+func (s *Store) DeleteByTag(name, value string) (int, error) {
+	return s.Namespace("").DeleteByTag(name, value)
+}
+
+// SetWithOptions is Store.SetWithOptions within the namespace.
+func (n *Namespace) SetWithOptions(key string, o SetOptions) error {
+	_, err := n.SetReportCreated(key, o)
+	return err
+}
+
+// SetReportCreated is Store.SetReportCreated within the namespace.
+func (n *Namespace) SetReportCreated(key string, o SetOptions) (bool, error) {
+	if err := n.check(key); err != nil {
+		return false, err
+	}
+	created, err := n.s.set(n.source, n.key(key), o.Value, o.TTL, o.Sliding && o.TTL > 0, o.Tags)
+	if err != nil {
+		return false, err
+	}
+	n.counters().sets.Add(1)
+	return created, nil
+}
+
+// ListByTag is Store.ListByTag within the namespace.
+func (n *Namespace) ListByTag(name, value string) []string {
+	var keys []string
+	for _, k := range n.s.tags.lookup(tag{name, value}) {
+		own, ok := n.owns(k)
+		if !ok {
+			continue
+		}
+		// The index was read without the shard lock, so check the key still
+		// carries the tag.
+		sh := n.s.shardFor(k)
+		sh.mu.RLock()
+		if e, ok := sh.data[k]; ok && !e.expired() && hasTag(e.tags, name, value) {
+			keys = append(keys, own)
+		}
+		sh.mu.RUnlock()
+	}
+	return keys
+}
+
+// DeleteByTag is Store.DeleteByTag within the namespace.
+func (n *Namespace) DeleteByTag(name, value string) (int, error) {
+	live, _, err := n.s.deleteKeys(context.Background(), n.source, func() map[string]*entry {
+		batch := make(map[string]*entry)
+		for _, k := range n.s.tags.lookup(tag{name, value}) {
+			if _, ok := n.owns(k); ok {
+				batch[k] = nil
+			}
+		}
+		return batch
+	})
+	if err == nil {
+		n.counters().deletes.Add(uint64(live))
+	}
+	return live, err
+}
+
+func hasTag(tags map[string]string, name, value string) bool {
+	v, ok := tags[name]
+	return ok && v == value
+}
+
+// cloneTags copies tags for storing in an entry, or returns nil if there are
+// none.
+func cloneTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	return maps.Clone(tags)
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func tagged(tenant string) SetOptions {
+	return SetOptions{Value: "v", Tags: map[string]string{"tenant": tenant, "type": "session"}}
+}
+
+func TestTags(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	s.SetWithOptions("a", tagged("acme"))
+	s.SetWithOptions("b", tagged("acme"))
+	s.SetWithOptions("c", tagged("initech"))
+	s.Namespace("other").SetWithOptions("d", tagged("acme"))
+
+	got := s.ListByTag("tenant", "acme")
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("expected a and b tagged tenant=acme, got %v", got)
+	}
+	if got := s.Namespace("other").ListByTag("tenant", "acme"); !slices.Equal(got, []string{"d"}) {
+		t.Fatalf("expected only the namespace's key, got %v", got)
+	}
+	if info, _ := s.Info("a"); info.Tags["type"] != "session" {
+		t.Fatalf("expected Info to report the tags, got %v", info.Tags)
+	}
+
+	// Append keeps the tags; overwriting the value drops them.
+	s.Append("a", "more")
+	s.Set("b", "plain", 0)
+	if got := s.ListByTag("tenant", "acme"); !slices.Equal(got, []string{"a"}) {
+		t.Fatalf("expected only a after overwriting b, got %v", got)
+	}
+
+	n, err := s.DeleteByTag("type", "session")
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 keys deleted, got %d, %v", n, err)
+	}
+	if s.Exists("a") || s.Exists("c") || !s.Exists("b") || !s.Namespace("other").Exists("d") {
+		t.Fatal("expected only the tagged keys in the default namespace to be deleted")
+	}
+}
+
+func TestTagsIndexDropsSweptKeys(t *testing.T) {
+	s := New(WithGCInterval(10 * time.Millisecond))
+	defer s.Stop()
+
+	o := tagged("acme")
+	o.TTL = 20 * time.Millisecond
+	for _, k := range []string{"a", "b", "c"} {
+		s.SetWithOptions(k, o)
+	}
+	s.SetWithOptions("keep", tagged("acme"))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Stats().ExpiredBySweep < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the sweep to expire 3 keys, got %+v", s.Stats())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := s.tags.lookup(tag{"tenant", "acme"}); !slices.Equal(got, []string{"keep"}) {
+		t.Fatalf("expected swept keys to leave the index, got %v", got)
+	}
+	s.Delete("keep")
+	s.tags.mu.Lock()
+	left := len(s.tags.keys)
+	s.tags.mu.Unlock()
+	if left != 0 {
+		t.Fatalf("expected an empty index once no key is tagged, got %d tags", left)
+	}
+}
+
+func TestTagsSurviveWAL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stashr.wal")
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetWithOptions("a", tagged("acme"))
+	s.Copy("a", "b", false, nil)
+	s.Stop()
+
+	s, err = Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	got := s.ListByTag("tenant", "acme")
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("expected tags to be replayed from the WAL, got %v", got)
+	}
+}
+
+func TestSetReportCreated(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	ns := s.Namespace("app")
+	if created, err := ns.SetReportCreated("k", SetOptions{Value: "a"}); !created || err != nil {
+		t.Fatalf("expected a new key to be created, got %v, %v", created, err)
+	}
+	if created, _ := ns.SetReportCreated("k", SetOptions{Value: "b"}); created {
+		t.Fatal("expected an overwrite not to count as created")
+	}
+	s.Set("gone", "v", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if created, _ := s.SetReportCreated("gone", SetOptions{Value: "v"}); !created {
+		t.Fatal("expected an expired key to count as created")
+	}
+}
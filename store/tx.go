@@ -0,0 +1,125 @@
+package store
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrTxDone is returned by Tx methods called after the transaction has
+// finished.
+var ErrTxDone = errors.New("transaction already finished")
+
+// Tx is a read-write view of the store inside Transaction. Writes are
+// buffered and only become visible to other callers when the transaction
+// commits; reads through the Tx see the transaction's own writes.
+type Tx struct {
+	s      *Store
+	writes map[string]*entry // nil means the key is deleted
+	order  []string          // keys in the order they were first written
+	done   bool
+}
+
+// Transaction runs fn with every shard write-locked, then applies fn's writes
+// atomically: concurrent readers see either none or all of them. If fn returns
+// an error, its writes are discarded and the error is returned.
+//
+// Because the whole store is locked while fn runs, fn must be quick and must
+// not call any other Store method (which would deadlock) or block on anything
+// that might itself wait on the store. Do slow work, such as I/O, before
+// starting the transaction.
+func (s *Store) Transaction(fn func(tx *Tx) error) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	tx := &Tx{s: s, writes: make(map[string]*entry)}
+	unlock := s.lockAll()
+	err := fn(tx)
+	tx.done = true
+	if err != nil {
+		unlock()
+		return err
+	}
+	if len(tx.order) == 0 {
+		unlock()
+		return nil
+	}
+	if err := s.logBatch(tx.writes); err != nil {
+		unlock()
+		return err
+	}
+	for _, k := range tx.order {
+		sh := s.shardFor(k)
+		if e := tx.writes[k]; e != nil {
+			s.put(sh, k, e, "")
+		} else {
+			s.remove(sh, k, EventDelete, "")
+		}
+	}
+	unlock()
+	return s.settle()
+}
+
+func (tx *Tx) write(key string, e *entry) {
+	if _, ok := tx.writes[key]; !ok {
+		tx.order = append(tx.order, key)
+	}
+	tx.writes[key] = e
+}
+
+// Get returns the value of key as seen by the transaction, including its own
+// uncommitted writes. Returns ErrWrongType if the key holds a list or hash.
+func (tx *Tx) Get(key string) (string, bool, error) {
+	if tx.done {
+		return "", false, ErrTxDone
+	}
+	if err := checkKey(key); err != nil {
+		return "", false, err
+	}
+	if e, ok := tx.writes[key]; ok {
+		if e == nil {
+			return "", false, nil
+		}
+		return e.value, true, nil
+	}
+	e, ok := tx.s.shardFor(key).data[key]
+	if !ok || e.expired() {
+		return "", false, nil
+	}
+	if e.kind != kindString {
+		return "", false, ErrWrongType
+	}
+	tx.s.touch(e)
+	return e.value, true, nil
+}
+
+// Set buffers a write of key. If ttl > 0 the key will expire after that
+// duration, measured from the call to Set. Returns ErrKeyTooLarge or
+// ErrValueTooLarge if the write exceeds the store's size limits.
+func (tx *Tx) Set(key, value string, ttl time.Duration) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := tx.s.checkSize(key, value); err != nil {
+		return err
+	}
+	e := tx.s.newEntry(value, time.Now(), ttl)
+	tx.write(key, e)
+	return nil
+}
+
+// Delete buffers the removal of key. It reports whether the key existed as
+// seen by the transaction.
+func (tx *Tx) Delete(key string) (bool, error) {
+	_, ok, err := tx.Get(key)
+	if errors.Is(err, ErrWrongType) {
+		ok, err = true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	tx.write(key, nil)
+	return ok, nil
+}
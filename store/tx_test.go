@@ -0,0 +1,132 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransactionCommit(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	s.Set("a", "1", 0)
+	s.Set("b", "2", 0)
+
+	err := s.Transaction(func(tx *Tx) error {
+		tx.Set("a", "10", 0)
+		if v, ok, _ := tx.Get("a"); !ok || v != "10" {
+			t.Errorf("expected tx to read its own write, got %q, %v", v, ok)
+		}
+		if existed, _ := tx.Delete("b"); !existed {
+			t.Error("expected Delete to report b existed")
+		}
+		if _, ok, _ := tx.Get("b"); ok {
+			t.Error("expected b to be gone inside the tx")
+		}
+		tx.Set("c", "3", time.Hour)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := s.Get("a"); v != "10" {
+		t.Errorf("expected a=10, got %q", v)
+	}
+	if _, ok := s.Get("b"); ok {
+		t.Error("expected b to be deleted")
+	}
+	if v, _ := s.Get("c"); v != "3" {
+		t.Errorf("expected c=3, got %q", v)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	s.Set("a", "1", 0)
+
+	boom := errors.New("boom")
+	err := s.Transaction(func(tx *Tx) error {
+		tx.Set("a", "10", 0)
+		tx.Set("b", "2", 0)
+		return boom
+	})
+	if err != boom {
+		t.Fatalf("expected callback error, got %v", err)
+	}
+	if v, _ := s.Get("a"); v != "1" {
+		t.Errorf("expected a to be unchanged, got %q", v)
+	}
+	if _, ok := s.Get("b"); ok {
+		t.Error("expected b not to be written")
+	}
+}
+
+func TestTransactionAfterDone(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	var leaked *Tx
+	s.Transaction(func(tx *Tx) error {
+		leaked = tx
+		return nil
+	})
+	if err := leaked.Set("a", "1", 0); err != ErrTxDone {
+		t.Errorf("expected ErrTxDone, got %v", err)
+	}
+}
+
+func TestTransactionAtomicVisibility(t *testing.T) {
+	s := New()
+	defer s.Stop()
+	s.MSet(map[string]SetOptions{"x": {Value: "0"}, "y": {Value: "0"}})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			got := s.MGet([]string{"x", "y"})
+			if got["x"] != got["y"] {
+				t.Errorf("saw half-applied transaction: %v", got)
+				return
+			}
+		}
+	}()
+	for i := 1; i <= 200; i++ {
+		v := string(rune('a' + i%26))
+		s.Transaction(func(tx *Tx) error {
+			tx.Set("x", v, 0)
+			tx.Set("y", v, 0)
+			return nil
+		})
+	}
+	<-done
+}
+
+func TestTransactionWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stashr.wal")
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("gone", "x", 0)
+	s.Transaction(func(tx *Tx) error {
+		tx.Set("kept", "y", 0)
+		tx.Delete("gone")
+		return nil
+	})
+	s.Stop()
+
+	s, err = Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	if v, _ := s.Get("kept"); v != "y" {
+		t.Errorf("expected kept=y after replay, got %q", v)
+	}
+	if _, ok := s.Get("gone"); ok {
+		t.Error("expected gone to stay deleted after replay")
+	}
+}
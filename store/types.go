@@ -0,0 +1,184 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	// ErrWrongType is returned by an operation on a key that holds a
+	// different type of value, such as LPush on a hash or Incr on a list.
+	ErrWrongType = errors.New("key holds the wrong type of value")
+
+	// ErrInvalidUTF8 is returned by list and hash writes given an element,
+	// field or value that is not valid UTF-8. Unlike strings, lists and
+	// hashes are stored as JSON text and cannot hold arbitrary bytes.
+	ErrInvalidUTF8 = errors.New("list and hash contents must be valid UTF-8")
+
+	// errUnchanged is returned by a change passed to modify to leave the key
+	// as it is.
+	errUnchanged = errors.New("unchanged")
+)
+
+// kind is the type of value an entry holds.
+type kind uint8
+
+const (
+	kindString kind = iota
+	kindList
+	kindHash
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindList:
+		return "list"
+	case kindHash:
+		return "hash"
+	}
+	return "string"
+}
+
+// data returns e's list or hash for a log record, with the name of its type,
+// or nothing for a string.
+func (e *entry) data() (typ string, list []string, hash map[string]string) {
+	if e.kind == kindString {
+		return "", nil, nil
+	}
+	return e.kind.String(), e.list, e.hash
+}
+
+// setData is the inverse of data. It also takes "string" for a string.
+func (e *entry) setData(typ string, list []string, hash map[string]string) error {
+	switch typ {
+	case "", "string":
+	case "list":
+		e.kind, e.list = kindList, list
+	case "hash":
+		e.kind, e.hash = kindHash, hash
+	default:
+		return fmt.Errorf("unknown type %q", typ)
+	}
+	return nil
+}
+
+func validUTF8(values ...string) error {
+	for _, v := range values {
+		if !utf8.ValidString(v) {
+			return ErrInvalidUTF8
+		}
+	}
+	return nil
+}
+
+// view calls fn with key's entry, under the shard's read lock, if the key is
+// live and holds a value of kind k, and reports whether it did. A missing or
+// expired key counts as a miss; a key of another kind is ErrWrongType.
+func (s *Store) view(key string, k kind, fn func(e *entry)) (bool, error) {
+	wrong := false
+	ok := s.lookup(key, func(e *entry) {
+		if e.kind != k {
+			wrong = true
+			return
+		}
+		s.touch(e)
+		fn(e)
+	})
+	switch {
+	case wrong:
+		return false, ErrWrongType
+	case ok:
+		s.hits.Add(1)
+	default:
+		s.misses.Add(1)
+	}
+	return ok, nil
+}
+
+// modify rewrites the list or hash of kind k at key on behalf of source.
+// change is given the current entry, or nil if the key is missing or
+// expired, and a new entry of kind k to fill in with the result; lists and
+// hashes are never modified in place, so change must build a new one. If it
+// leaves the new entry empty the key is deleted, and if it returns
+// errUnchanged nothing is written. A key that already existed
+// keeps its expiry and tags; a new one gets the store's default TTL. If key
+// holds another kind of value modify returns ErrWrongType without calling
+// change.
+func (s *Store) modify(source, key string, k kind, change func(cur, next *entry) error) error {
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	now := time.Now()
+	sh := s.shardFor(key)
+	sh.mu.Lock()
+	cur, ok := sh.data[key]
+	if ok && cur.expired() {
+		cur = nil
+	}
+	if cur != nil && cur.kind != k {
+		sh.mu.Unlock()
+		return ErrWrongType
+	}
+	var ne *entry
+	if cur == nil {
+		ne = s.newEntry("", now, 0)
+	} else {
+		ne = &entry{expiresAt: cur.expiresAt, period: cur.period, sliding: cur.sliding, createdAt: cur.createdAt, updatedAt: now, tags: cur.tags}
+	}
+	ne.kind = k
+	if err := change(cur, ne); err != nil {
+		sh.mu.Unlock()
+		if errors.Is(err, errUnchanged) {
+			return nil
+		}
+		return err
+	}
+	if len(ne.list) == 0 && len(ne.hash) == 0 {
+		err := s.removeEmptied(sh, key, cur != nil, source)
+		sh.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		return s.maybeCompact()
+	}
+	if err := s.checkEntry(key, ne); err != nil {
+		sh.mu.Unlock()
+		return err
+	}
+	if err := s.logSet(key, ne); err != nil {
+		sh.mu.Unlock()
+		return err
+	}
+	s.put(sh, key, ne, source)
+	s.sets.Add(1)
+	sh.mu.Unlock()
+	return s.settle()
+}
+
+// removeEmptied deletes key, whose last element or field was just removed,
+// if it still held a live list or hash. Caller must hold sh.mu.
+func (s *Store) removeEmptied(sh *shard, key string, live bool, source string) error {
+	if !live {
+		return nil
+	}
+	if err := s.logDel(key); err != nil {
+		return err
+	}
+	s.remove(sh, key, EventDelete, source)
+	s.deletes.Add(1)
+	return nil
+}
+
+// counted adds a read through view to the namespace's hits or misses. A read
+// of the wrong type counts as neither.
+func (n *Namespace) counted(found bool, err error) {
+	switch {
+	case err != nil:
+	case found:
+		n.counters().hits.Add(1)
+	default:
+		n.miss()
+	}
+}
@@ -0,0 +1,354 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+	"unicode/utf8"
+)
+
+const defaultWALCompactEvery = 10000
+
+const (
+	opSet   = "set"
+	opDel   = "del"
+	opBatch = "batch"
+	opFlush = "flush"
+)
+
+// walRecord is a single line in the write-ahead log. A batch record carries
+// its writes in Batch so that they are replayed all-or-nothing.
+type walRecord struct {
+	Op        string            `json:"op"`
+	Key       string            `json:"key,omitempty"`
+	Value     string            `json:"value,omitempty"`
+	Binary    []byte            `json:"binary,omitempty"`     // a value that is not valid UTF-8, in place of Value
+	Type      string            `json:"type,omitempty"`       // "list" or "hash" for those, in place of Value; empty for strings
+	List      []string          `json:"list,omitempty"`       // the elements of a list
+	Hash      map[string]string `json:"hash,omitempty"`       // the fields and values of a hash
+	ExpiresAt int64             `json:"expires_at,omitempty"` // unix nanoseconds, 0 means no expiry
+	TTL       int64             `json:"ttl,omitempty"`        // nanoseconds, the TTL ExpiresAt was set from
+	Sliding   bool              `json:"sliding,omitempty"`    // reads extend the expiry, see SetSliding
+	Created   int64             `json:"created,omitempty"`    // unix nanoseconds
+	Updated   int64             `json:"updated,omitempty"`    // unix nanoseconds
+	Tags      map[string]string `json:"tags,omitempty"`
+	Batch     []walRecord       `json:"batch,omitempty"`
+}
+
+// wal is an append-only log of mutations, one JSON record per line. Every
+// write is appended before the in-memory state changes, so replaying the log
+// in order rebuilds the store. Once the log holds compactEvery records it is
+// rewritten from the live state, which keeps it proportional to the data set
+// rather than to the write history.
+type wal struct {
+	path         string
+	f            *os.File
+	records      int // records currently in the log file
+	compactEvery int
+	compactAt    int // records count that triggers the next compaction
+	fsync        FsyncPolicy
+	dirty        bool // written since the last fsync
+}
+
+// openWAL replays the log at path into data and opens it for appending. A
+// missing file is treated as an empty log.
+func openWAL(path string, compactEvery int, fsync FsyncPolicy, data map[string]*entry) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+	n, good, err := replay(f, data)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("replay wal %s: %w", path, err)
+	}
+	// Drop a torn trailing record so new appends start on a clean line.
+	if err := f.Truncate(good); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("truncate wal: %w", err)
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("seek wal: %w", err)
+	}
+	w := &wal{path: path, f: f, records: n, compactEvery: compactEvery, fsync: fsync}
+	w.compactAt = max(compactEvery, n)
+	return w, nil
+}
+
+// replay applies every record in r to data in order. It returns the number of
+// records applied and the byte offset just past the last complete record. A
+// final line with no trailing newline is assumed to be a write torn by a crash
+// and is ignored; a malformed record anywhere else is an error.
+func replay(r io.Reader, data map[string]*entry) (int, int64, error) {
+	br := bufio.NewReader(r)
+	now := time.Now()
+	var n int
+	var offset int64
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return n, offset, nil
+		}
+		if err != nil {
+			return n, offset, err
+		}
+		var rec walRecord
+		if err := json.Unmarshal(bytes.TrimSpace(line), &rec); err != nil {
+			return n, offset, fmt.Errorf("record %d: %w", n+1, err)
+		}
+		if err := apply(rec, data, now); err != nil {
+			return n, offset, fmt.Errorf("record %d: %w", n+1, err)
+		}
+		n++
+		offset += int64(len(line))
+	}
+}
+
+func apply(rec walRecord, data map[string]*entry, now time.Time) error {
+	switch rec.Op {
+	case opSet:
+		e := &entry{value: rec.Value, tags: cloneTags(rec.Tags)}
+		if rec.Binary != nil {
+			e.value = string(rec.Binary)
+		}
+		if err := e.setData(rec.Type, rec.List, rec.Hash); err != nil {
+			return err
+		}
+		if rec.ExpiresAt != 0 {
+			e.expiresAt = time.Unix(0, rec.ExpiresAt)
+			e.period = time.Duration(rec.TTL)
+			e.sliding = rec.Sliding
+		}
+		if rec.Created != 0 {
+			e.createdAt, e.updatedAt = time.Unix(0, rec.Created), time.Unix(0, rec.Updated)
+		}
+		// Records are logged before the write is applied, so an overwrite
+		// carries its own write time as the creation time. Apply the rule put
+		// does: a key still live when overwritten keeps its creation time.
+		if prev, ok := data[rec.Key]; ok && !prev.createdAt.IsZero() && (prev.expiresAt.IsZero() || prev.expiresAt.After(e.updatedAt)) {
+			e.createdAt = prev.createdAt
+		}
+		if e.expiresAt.IsZero() || now.Before(e.expiresAt) {
+			data[rec.Key] = e
+		} else {
+			delete(data, rec.Key)
+		}
+	case opDel:
+		delete(data, rec.Key)
+	case opFlush:
+		clear(data)
+	case opBatch:
+		for _, r := range rec.Batch {
+			if err := apply(r, data, now); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unknown op %q", rec.Op)
+	}
+	return nil
+}
+
+func (w *wal) append(rec walRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := w.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write wal: %w", err)
+	}
+	w.records++
+	w.dirty = true
+	if w.fsync == FsyncAlways {
+		return w.sync()
+	}
+	return nil
+}
+
+// sync flushes the log to stable storage if it has been written to since the
+// last flush.
+func (w *wal) sync() error {
+	if !w.dirty {
+		return nil
+	}
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	w.dirty = false
+	return nil
+}
+
+// compact rewrites the log so it holds one set record per live entry. Caller
+// must hold every shard's lock. The new log is written to a temporary file
+// and renamed into place, so a crash during compaction leaves the previous
+// log intact.
+func (w *wal) compact(shards []*shard) error {
+	tmp := w.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("compact wal: %w", err)
+	}
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+	var n int
+	for _, sh := range shards {
+		for k, e := range sh.data {
+			if e.expired() {
+				continue
+			}
+			if err := enc.Encode(recordFor(k, e)); err != nil {
+				f.Close()
+				return fmt.Errorf("compact wal: %w", err)
+			}
+			n++
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("compact wal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("compact wal: %w", err)
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		f.Close()
+		return fmt.Errorf("compact wal: %w", err)
+	}
+	f.Close()
+
+	nf, err := os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("reopen wal: %w", err)
+	}
+	w.f.Close()
+	w.f = nf
+	w.records = n
+	w.dirty = false
+	// If most of the log is live data, let it double before compacting again
+	// so a large data set doesn't trigger a rewrite on every write.
+	w.compactAt = max(w.compactEvery, 2*n)
+	return nil
+}
+
+func (w *wal) close() error {
+	if err := w.sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}
+
+func recordFor(key string, e *entry) walRecord {
+	rec := walRecord{Op: opSet, Key: key, Value: e.value, Tags: e.tags}
+	rec.Type, rec.List, rec.Hash = e.data()
+	if !e.createdAt.IsZero() {
+		rec.Created, rec.Updated = e.createdAt.UnixNano(), e.updatedAt.UnixNano()
+	}
+	if !utf8.ValidString(e.value) {
+		// JSON strings cannot hold arbitrary bytes, so binary values are
+		// stored base64-encoded.
+		rec.Value, rec.Binary = "", []byte(e.value)
+	}
+	if !e.expiresAt.IsZero() {
+		rec.ExpiresAt = e.expiresAt.UnixNano()
+		rec.TTL = int64(e.period)
+		rec.Sliding = e.sliding
+	}
+	return rec
+}
+
+// logSet records that key is about to be set to e. Caller must hold key's
+// shard lock.
+func (s *Store) logSet(key string, e *entry) error {
+	if s.wal == nil {
+		return nil
+	}
+	return s.logged(recordFor(key, e))
+}
+
+// logDel records that key is about to be removed. Caller must hold key's
+// shard lock.
+func (s *Store) logDel(key string) error {
+	if s.wal == nil {
+		return nil
+	}
+	return s.logged(walRecord{Op: opDel, Key: key})
+}
+
+// logBatch records a set of writes as a single record. A nil entry records a
+// delete. Caller must hold the shard lock of every key in batch.
+func (s *Store) logBatch(batch map[string]*entry) error {
+	if s.wal == nil {
+		return nil
+	}
+	rec := walRecord{Op: opBatch, Batch: make([]walRecord, 0, len(batch))}
+	for k, e := range batch {
+		if e == nil {
+			rec.Batch = append(rec.Batch, walRecord{Op: opDel, Key: k})
+			continue
+		}
+		rec.Batch = append(rec.Batch, recordFor(k, e))
+	}
+	return s.logged(rec)
+}
+
+// logFlush records that every key is about to be removed. Caller must hold
+// every shard lock.
+func (s *Store) logFlush() error {
+	if s.wal == nil {
+		return nil
+	}
+	return s.logged(walRecord{Op: opFlush})
+}
+
+// syncLoop flushes the WAL every interval, for FsyncInterval.
+func (s *Store) syncLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.walMu.Lock()
+			s.wal.sync()
+			s.walMu.Unlock()
+		case <-s.stopGC:
+			return
+		}
+	}
+}
+
+// logged appends rec to the log.
+func (s *Store) logged(rec walRecord) error {
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+	return s.wal.append(rec)
+}
+
+// maybeCompact compacts the log if it has grown past its threshold. It must be
+// called without any shard lock held: compaction locks every shard so the
+// rewritten log is a consistent snapshot that no in-flight write can miss.
+func (s *Store) maybeCompact() error {
+	if s.wal == nil || s.wal.compactEvery <= 0 {
+		return nil
+	}
+	s.walMu.Lock()
+	due := s.wal.records >= s.wal.compactAt
+	s.walMu.Unlock()
+	if !due {
+		return nil
+	}
+	unlock := s.lockAll()
+	defer unlock()
+	s.walMu.Lock()
+	defer s.walMu.Unlock()
+	if s.wal.records < s.wal.compactAt {
+		return nil // another writer got here first
+	}
+	return s.wal.compact(s.shards)
+}
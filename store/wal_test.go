@@ -0,0 +1,300 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stashr.wal")
+
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("a", "1", 0)
+	s.Set("b", "2", 0)
+	s.Set("a", "3", 0)
+	s.Delete("b")
+	s.Set("ttl", "x", time.Hour)
+	s.Append("a", "4")
+	// Simulate a crash: abandon s without calling Stop.
+
+	r, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+
+	if val, ok := r.Get("a"); !ok || val != "34" {
+		t.Fatalf("expected (34, true), got (%s, %v)", val, ok)
+	}
+	if _, ok := r.Get("b"); ok {
+		t.Fatal("later delete should override earlier set")
+	}
+	if _, ok := r.Get("ttl"); !ok {
+		t.Fatal("expected ttl key to survive replay")
+	}
+}
+
+func TestWALReplaySkipsExpired(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stashr.wal")
+
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("temp", "v", 50*time.Millisecond)
+	s.Stop()
+
+	time.Sleep(100 * time.Millisecond)
+
+	r, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if _, ok := r.Get("temp"); ok {
+		t.Fatal("expired key should not be restored")
+	}
+}
+
+func TestWALTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stashr.wal")
+	log := `{"op":"set","key":"a","value":"1"}` + "\n" + `{"op":"set","key":"b","va`
+	if err := os.WriteFile(path, []byte(log), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatalf("torn trailing record should not fail replay: %v", err)
+	}
+	s.Set("c", "3", 0)
+	s.Stop()
+
+	r, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatalf("log should be clean after truncating the torn record: %v", err)
+	}
+	defer r.Stop()
+	if _, ok := r.Get("a"); !ok {
+		t.Fatal("expected a to be restored")
+	}
+	if _, ok := r.Get("b"); ok {
+		t.Fatal("torn record should be discarded")
+	}
+	if _, ok := r.Get("c"); !ok {
+		t.Fatal("expected c to be restored")
+	}
+}
+
+func TestWALCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stashr.wal")
+	log := `not json` + "\n" + `{"op":"set","key":"a","value":"1"}` + "\n"
+	if err := os.WriteFile(path, []byte(log), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(WithWAL(path)); err == nil {
+		t.Fatal("expected error for corrupt record")
+	}
+}
+
+func TestWALCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stashr.wal")
+
+	s, err := Open(WithWAL(path), WithWALCompactEvery(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		s.Set("counter", strings.Repeat("x", i), 0)
+	}
+	s.Set("other", "y", 0)
+	s.Stop()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(b), "\n"); lines > 10 {
+		t.Fatalf("expected compaction to bound the log, got %d records", lines)
+	}
+
+	r, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if val, _ := r.Get("counter"); val != strings.Repeat("x", 99) {
+		t.Fatalf("unexpected counter after compaction: %q", val)
+	}
+	if _, ok := r.Get("other"); !ok {
+		t.Fatal("expected other to survive compaction")
+	}
+}
+
+func TestWALReplaysBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stashr.wal")
+
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MSet(map[string]SetOptions{"a": {Value: "1"}, "b": {Value: "2"}})
+	s.Stop()
+
+	r, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if got := r.MGet([]string{"a", "b"}); len(got) != 2 {
+		t.Fatalf("expected batch to be replayed, got %v", got)
+	}
+}
+
+func TestWALFsyncPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		policy   FsyncPolicy
+		interval time.Duration
+	}{
+		{"never", FsyncNever, 0},
+		{"always", FsyncAlways, 0},
+		{"interval", FsyncInterval, 10 * time.Millisecond},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "stashr.wal")
+			s, err := Open(WithWAL(path), WithWALFsync(tc.policy, tc.interval))
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.Set("a", "1", 0)
+			time.Sleep(30 * time.Millisecond)
+			s.Stop()
+
+			r, err := Open(WithWAL(path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Stop()
+			if v, _ := r.Get("a"); v != "1" {
+				t.Fatalf("expected a=1 after reopen, got %q", v)
+			}
+		})
+	}
+}
+
+func TestReplayLogTornRecord(t *testing.T) {
+	log := `{"op":"set","key":"a","value":"1"}` + "\n" +
+		`{"op":"del","key":"old"}` + "\n" +
+		`{"op":"set","key":"b","va`
+
+	s := New()
+	defer s.Stop()
+	s.Set("old", "x", 0)
+	if err := s.ReplayLog(strings.NewReader(log)); err != nil {
+		t.Fatalf("torn trailing record should not fail replay: %v", err)
+	}
+	if v, _ := s.Get("a"); v != "1" {
+		t.Fatalf("expected a=1, got %q", v)
+	}
+	if _, ok := s.Get("b"); ok {
+		t.Fatal("torn record should be discarded")
+	}
+	if _, ok := s.Get("old"); ok {
+		t.Fatal("expected ReplayLog to replace existing contents")
+	}
+}
+
+func TestWALBinaryValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetBytes("blob", binaryValue, 0)
+	s.Set("text", "héllo", 0)
+	s.Stop()
+
+	r, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if got, _ := r.GetBytes("blob"); string(got) != string(binaryValue) {
+		t.Fatalf("expected binary value to survive replay, got %q", got)
+	}
+	if got, _ := r.Get("text"); got != "héllo" {
+		t.Fatalf("expected text value to survive replay, got %q", got)
+	}
+}
+
+func TestWALKeepsTTLForRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("session", "v", time.Hour)
+	s.Stop()
+
+	r, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if ok, _ := r.Refresh("session"); !ok {
+		t.Fatal("expected the original TTL to survive replay")
+	}
+	if ttl, _, _ := r.TTL("session"); ttl <= 59*time.Minute {
+		t.Fatalf("expected Refresh to reset to an hour, got %v", ttl)
+	}
+}
+
+func TestWALKeepsSliding(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetSliding("session", "v", time.Hour)
+	s.Stop()
+
+	r, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	if e := r.shardFor("session").data["session"]; e == nil || !e.sliding {
+		t.Fatal("expected the sliding flag to survive replay")
+	}
+}
+
+func TestWALKeepsTimestamps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	s, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("k", "v1", 0)
+	time.Sleep(5 * time.Millisecond)
+	s.Set("k", "v2", 0)
+	want, _ := s.Info("k")
+	s.Stop()
+
+	r, err := Open(WithWAL(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Stop()
+	got, _ := r.Info("k")
+	if !got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Fatalf("expected timestamps %v/%v after replay, got %v/%v", want.CreatedAt, want.UpdatedAt, got.CreatedAt, got.UpdatedAt)
+	}
+}
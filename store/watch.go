@@ -0,0 +1,225 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStopped is returned when watching a store that has been stopped.
+var ErrStopped = errors.New("store stopped")
+
+// subscriberBuffer is the number of events a subscriber may fall behind by
+// before it is disconnected.
+const subscriberBuffer = 256
+
+// EventType identifies the kind of change an Event describes.
+type EventType int
+
+const (
+	// EventSet is emitted when a key is written, including TTL changes.
+	EventSet EventType = iota + 1
+	// EventDelete is emitted when a key is deleted or evicted.
+	EventDelete
+	// EventExpire is emitted when a key is removed because its TTL elapsed.
+	EventExpire
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventDelete:
+		return "delete"
+	case EventExpire:
+		return "expire"
+	}
+	return "unknown"
+}
+
+// Event describes a single change to the store.
+type Event struct {
+	Type      EventType
+	Key       string
+	Value     string    // new value for EventSet on a string key, empty otherwise
+	ExpiresAt time.Time // expiry for EventSet, zero if none
+	Time      time.Time // when the change happened
+
+	rec *walRecord // the change as a log record, for replication subscribers
+}
+
+type subscriber struct {
+	prefix string // internal key prefix: namespace prefix + watched prefix
+	strip  int    // length of the namespace prefix, removed from event keys
+	all    bool   // every key in every namespace, with log records; see Replicate
+	ch     chan Event
+	done   chan struct{} // closed along with ch
+}
+
+// events returns sub's channel, or a closed channel for the nil subscriber
+// that subscribe returns on a stopped store.
+func (sub *subscriber) events() <-chan Event {
+	if sub == nil {
+		ch := make(chan Event)
+		close(ch)
+		return ch
+	}
+	return sub.ch
+}
+
+// close closes the subscriber's channels. Caller must hold subscribers.mu and
+// have removed sub from the set.
+func (sub *subscriber) close() {
+	close(sub.ch)
+	close(sub.done)
+}
+
+type subscribers struct {
+	mu     sync.Mutex
+	subs   map[*subscriber]struct{}
+	closed bool
+
+	// n is len(subs), kept so that writers can skip taking mu when nobody
+	// is subscribed. It only changes under mu.
+	n atomic.Int64
+}
+
+// drop removes sub and closes its channels. Caller must hold mu.
+func (subs *subscribers) drop(sub *subscriber) {
+	delete(subs.subs, sub)
+	subs.n.Add(-1)
+	sub.close()
+}
+
+// Subscribe registers a listener for changes to keys starting with prefix (an
+// empty prefix matches every key). Events are delivered in the order they were
+// applied.
+//
+// Writers never block on subscribers. Each subscriber has a buffer of
+// subscriberBuffer events; a subscriber that falls further behind is
+// disconnected by closing its channel, rather than silently missing events.
+// The channel is also closed when the returned cancel function is called or
+// the store is stopped.
+func (s *Store) Subscribe(prefix string) (<-chan Event, func()) {
+	sub, cancel := s.subscribe("", prefix)
+	return sub.events(), cancel
+}
+
+// Watch is like Subscribe, but the subscription is tied to ctx: cancelling ctx
+// unregisters the watcher and closes the channel. The same drop policy
+// applies: a watcher that falls more than subscriberBuffer events behind is
+// disconnected by closing its channel. Returns ErrStopped if the store has
+// been stopped.
+func (s *Store) Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+	return s.watch(ctx, "", prefix)
+}
+
+// watch implements Watch for the namespace stored under scope.
+func (s *Store) watch(ctx context.Context, scope, prefix string) (<-chan Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sub, cancel := s.subscribe(scope, prefix)
+	if sub == nil {
+		return nil, ErrStopped
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			cancel()
+		case <-sub.done:
+		}
+	}()
+	return sub.ch, nil
+}
+
+// Subscribers returns the number of open subscriptions from Subscribe, Watch
+// and their namespace counterparts, and from Replicate.
+func (s *Store) Subscribers() int {
+	return int(s.subs.n.Load())
+}
+
+// subscribe registers a subscriber for keys starting with prefix in the
+// namespace stored under scope. On a stopped store it returns a nil
+// subscriber for Watch, and Subscribe hands back an already-closed channel.
+func (s *Store) subscribe(scope, prefix string) (*subscriber, func()) {
+	return s.register(&subscriber{
+		prefix: scope + prefix,
+		strip:  len(scope),
+		ch:     make(chan Event, subscriberBuffer),
+		done:   make(chan struct{}),
+	})
+}
+
+// register adds sub to the store's subscribers. On a stopped store it closes
+// sub and returns nil instead.
+func (s *Store) register(sub *subscriber) (*subscriber, func()) {
+	s.subs.mu.Lock()
+	if s.subs.closed {
+		s.subs.mu.Unlock()
+		sub.close()
+		return nil, func() {}
+	}
+	if s.subs.subs == nil {
+		s.subs.subs = make(map[*subscriber]struct{})
+	}
+	s.subs.subs[sub] = struct{}{}
+	s.subs.n.Add(1)
+	s.subs.mu.Unlock()
+
+	cancel := func() {
+		s.subs.mu.Lock()
+		defer s.subs.mu.Unlock()
+		if _, ok := s.subs.subs[sub]; ok {
+			s.subs.drop(sub)
+		}
+	}
+	return sub, cancel
+}
+
+// emit delivers an event for key to every matching subscriber. e is the new
+// entry for EventSet and is ignored otherwise. Caller must hold key's shard
+// lock so that events for a key are delivered in the order they were applied.
+// With no subscribers it returns without taking subs.mu, so writers to
+// different shards do not contend on it.
+func (s *Store) emit(typ EventType, key string, e *entry) {
+	if s.subs.n.Load() == 0 {
+		return
+	}
+	s.subs.mu.Lock()
+	defer s.subs.mu.Unlock()
+	ev := Event{Type: typ, Key: key, Time: time.Now()}
+	if typ == EventSet {
+		ev.Value = e.value
+		ev.ExpiresAt = e.expiresAt
+	}
+	for sub := range s.subs.subs {
+		switch {
+		case sub.all:
+			if ev.rec == nil {
+				ev.rec = replicationRecord(typ, key, e)
+			}
+		case !strings.HasPrefix(key, sub.prefix) || (sub.strip == 0 && namespaced(key)):
+			continue
+		}
+		ev.Key = key[sub.strip:]
+		select {
+		case sub.ch <- ev:
+		default:
+			s.subs.drop(sub)
+		}
+	}
+}
+
+// closeSubscribers disconnects every subscriber and refuses new ones.
+func (s *Store) closeSubscribers() {
+	s.subs.mu.Lock()
+	defer s.subs.mu.Unlock()
+	s.subs.closed = true
+	for sub := range s.subs.subs {
+		s.subs.drop(sub)
+	}
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func nextEvent(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatal("subscription closed unexpectedly")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return Event{}
+}
+
+func TestSubscribe(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	ch, cancel := s.Subscribe("user:")
+	defer cancel()
+
+	s.Set("other", "ignored", 0)
+	s.Set("user:1", "alice", 0)
+	s.Delete("user:1")
+	s.Set("user:2", "bob", time.Hour)
+	s.ExpireNow("user:2")
+
+	want := []struct {
+		typ   EventType
+		key   string
+		value string
+	}{
+		{EventSet, "user:1", "alice"},
+		{EventDelete, "user:1", ""},
+		{EventSet, "user:2", "bob"},
+		{EventExpire, "user:2", ""},
+	}
+	for _, w := range want {
+		ev := nextEvent(t, ch)
+		if ev.Type != w.typ || ev.Key != w.key || ev.Value != w.value {
+			t.Fatalf("expected %v %s=%q, got %v %s=%q", w.typ, w.key, w.value, ev.Type, ev.Key, ev.Value)
+		}
+	}
+}
+
+func TestSubscribers(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	_, cancel := s.Subscribe("")
+	ctx, stop := context.WithCancel(context.Background())
+	if _, err := s.Namespace("app").Watch(ctx, ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Subscribers(); n != 2 {
+		t.Fatalf("expected 2 subscribers, got %d", n)
+	}
+	cancel()
+	cancel()
+	if n := s.Subscribers(); n != 1 {
+		t.Fatalf("expected 1 subscriber after cancel, got %d", n)
+	}
+	stop()
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Subscribers() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := s.Subscribers(); n != 0 {
+		t.Fatalf("expected no subscribers once the context ends, got %d", n)
+	}
+
+	// A subscriber that falls behind is dropped and no longer counted.
+	s.Subscribe("")
+	for i := 0; i <= subscriberBuffer; i++ {
+		s.Set("k", "v", 0)
+	}
+	if n := s.Subscribers(); n != 0 {
+		t.Fatalf("expected a subscriber that fell behind to be dropped, got %d", n)
+	}
+}
+
+func TestSubscribeSweepExpiry(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	ch, cancel := s.Subscribe("")
+	defer cancel()
+
+	s.Set("temp", "v", 50*time.Millisecond)
+	if ev := nextEvent(t, ch); ev.Type != EventSet {
+		t.Fatalf("expected set event, got %v", ev.Type)
+	}
+	// No reads: the background sweep must report the expiry.
+	if ev := nextEvent(t, ch); ev.Type != EventExpire || ev.Key != "temp" {
+		t.Fatalf("expected expire event for temp, got %v %s", ev.Type, ev.Key)
+	}
+}
+
+func TestSubscribeSlowSubscriberDisconnected(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	ch, cancel := s.Subscribe("")
+	defer cancel()
+
+	for i := 0; i < subscriberBuffer+1; i++ {
+		s.Set("k", "v", 0)
+	}
+
+	n := 0
+	for range ch {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Fatalf("expected %d buffered events before disconnect, got %d", subscriberBuffer, n)
+	}
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	ch, cancel := s.Subscribe("")
+	cancel()
+	cancel() // safe to call twice
+
+	if _, ok := <-ch; ok {
+		t.Fatal("expected channel to be closed after cancel")
+	}
+	s.Set("k", "v", 0) // must not panic sending on a closed channel
+}
+
+func TestWatchContextCancel(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := s.Watch(ctx, "cfg/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Set("cfg/a", "1", 0)
+	if ev := nextEvent(t, ch); ev.Type != EventSet || ev.Key != "cfg/a" || ev.Value != "1" || ev.Time.IsZero() {
+		t.Fatalf("unexpected event %+v", ev)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("expected no further events after cancel")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("channel not closed after context cancel")
+	}
+}
+
+func TestWatchDoesNotLeakGoroutines(t *testing.T) {
+	s := New()
+	defer s.Stop()
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		ch, err := s.Watch(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		for range ch {
+		}
+	}
+	// Watchers disconnected for falling behind must not leak either.
+	for i := 0; i < 10; i++ {
+		if _, err := s.Watch(context.Background(), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i <= subscriberBuffer; i++ {
+		s.Set("k", "v", 0)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Fatalf("goroutines leaked: %d before, %d after", before, n)
+	}
+}
+
+func TestWatchStoppedStore(t *testing.T) {
+	s := New()
+	s.Stop()
+	if _, err := s.Watch(context.Background(), ""); err != ErrStopped {
+		t.Fatalf("expected ErrStopped, got %v", err)
+	}
+}